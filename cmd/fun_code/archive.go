@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jun/fun_code/internal/classarchive"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/handler"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var archiveClassCmd = &cobra.Command{
+	Use:   "archive-class",
+	Short: "Export the work of every student in a class as a zip archive",
+	Long: `Write a zip archive with the scratch projects (as .sb3), programs and excalidraw boards
+of every student in a class, one directory per student, plus index.json and index.csv.
+
+--since and --until filter works by their last modification time and accept RFC3339 or
+YYYY-MM-DD; since is inclusive and until is exclusive.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		classID, err := cmd.Flags().GetUint("class")
+		if err != nil {
+			return err
+		}
+		if classID == 0 {
+			return errors.New("--class is required")
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return err
+		}
+		var opts classarchive.Options
+		for name, t := range map[string]*time.Time{"since": &opts.Since, "until": &opts.Until} {
+			value, err := cmd.Flags().GetString(name)
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				continue
+			}
+			if *t, err = parseArchiveTime(value); err != nil {
+				return fmt.Errorf("invalid --%s: %w", name, err)
+			}
+		}
+
+		cfg, db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		scratchBase := filepath.Join(cfg.Storage.BasePath, "scratch")
+		logger := zap.NewNop()
+		d := &dao.Dao{
+			ClassDao:      dao.NewClassDao(db),
+			ScratchDao:    dao.NewScratchDao(db, scratchBase, cfg, logger),
+			ProgramDao:    dao.NewProgramDao(db, filepath.Join(cfg.Storage.BasePath, "programs"), cfg, logger),
+			ExcalidrawDao: dao.NewExcalidrawDAO(db, filepath.Join(cfg.Storage.BasePath, "excalidraw"), cfg, logger),
+		}
+
+		class, err := d.ClassDao.GetClass(classID)
+		if err != nil {
+			return err
+		}
+		students, err := d.ClassDao.ListStudents(class.ID, class.TeacherID)
+		if err != nil {
+			return err
+		}
+		if output == "" {
+			output = fmt.Sprintf("class_%d_%s.zip", class.ID, time.Now().Format("20060102"))
+		}
+
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		archiver := classarchive.New(d, func(name string) ([]byte, error) {
+			return handler.ReadScratchAsset(scratchBase, name)
+		}, logger)
+		index, err := archiver.Write(context.Background(), f, class, students, opts)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(output)
+			return err
+		}
+
+		failed := 0
+		for _, entry := range index.Entries {
+			if entry.Error != "" {
+				failed++
+				fmt.Printf("  failed: %s %s %d %s: %s\n", entry.Username, entry.Type, entry.ID, entry.Name, entry.Error)
+			}
+		}
+		fmt.Printf("class %q: %d students, %d works written to %s\n", class.Name, index.Students, len(index.Entries)-failed, output)
+		if failed > 0 {
+			fmt.Printf("warning: %d works could not be read, see index.csv in the archive\n", failed)
+		}
+		return nil
+	},
+}
+
+// parseArchiveTime 解析 RFC3339 或日期，日期按本地时区的零点
+func parseArchiveTime(value string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		parsed, err = time.ParseInLocation(time.DateOnly, value, time.Local)
+	}
+	return parsed, err
+}
+
+func init() {
+	archiveClassCmd.Flags().Uint("class", 0, "ID of the class to archive")
+	archiveClassCmd.Flags().String("since", "", "only include works modified at or after this time")
+	archiveClassCmd.Flags().String("until", "", "only include works modified before this time")
+	archiveClassCmd.Flags().StringP("output", "o", "", "zip file to write (default: class_<id>_<date>.zip)")
+
+	rootCmd.AddCommand(archiveClassCmd)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jun/fun_code/internal/backup"
+	"github.com/jun/fun_code/internal/database"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the database and uploaded files into a single archive",
+	Long: `Back up the database and all files under storage.basePath into a single .tar.gz archive.
+The server can keep running: SQLite is copied with VACUUM INTO to get a consistent snapshot.
+PostgreSQL and MySQL databases are not included, back them up with pg_dump or mysqldump.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := cmd.Flags().GetString("dir")
+		if err != nil {
+			return err
+		}
+		prune, err := cmd.Flags().GetBool("prune")
+		if err != nil {
+			return err
+		}
+		cfg, db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			dir = cfg.Backup.Directory
+		}
+		if dir == "" {
+			return fmt.Errorf("请通过 --dir 或配置文件中的 backup.directory 指定备份目录")
+		}
+
+		path, manifest, err := backup.CreateInDir(db, cfg, dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("backup created: %s\n", path)
+		fmt.Printf("schema version: %d, files: %d\n", manifest.SchemaVersion, len(manifest.Files))
+		if !manifest.IncludesDatabase {
+			fmt.Printf("database (%s) is not included, back it up with its own tools\n", manifest.DatabaseDriver)
+		}
+
+		if prune {
+			removed, err := backup.Prune(dir, cfg.Backup.Keep)
+			if err != nil {
+				return err
+			}
+			for _, path := range removed {
+				fmt.Printf("old backup removed: %s\n", path)
+			}
+		}
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <archive>",
+	Short: "Restore the database and uploaded files from a backup archive",
+	Long: `Restore the database and all files under storage.basePath from a backup archive.
+Stop the server before restoring. The archive is fully verified against its manifest
+before anything is replaced, and the current data is renamed with a .before-restore-<time>
+suffix instead of being deleted.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		result, err := backup.Restore(args[0], cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("restored from %s (schema version %d, files: %d)\n",
+			args[0], result.Manifest.SchemaVersion, len(result.Manifest.Files))
+		if result.PreviousDatabase != "" {
+			fmt.Printf("previous database kept at: %s\n", result.PreviousDatabase)
+		}
+		if result.PreviousStorage != "" {
+			fmt.Printf("previous storage kept at: %s\n", result.PreviousStorage)
+		}
+		if result.Manifest.SchemaVersion < database.NewMigrator(nil, database.Migrations).LatestVersion() {
+			fmt.Println("the database will be migrated to the latest version on next start")
+		}
+		return nil
+	},
+}
+
+func init() {
+	backupCmd.Flags().String("dir", "", "directory to write the backup to (default: backup.directory in config)")
+	backupCmd.Flags().Bool("prune", false, "remove old backups beyond backup.keep after the backup")
+
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove scratch project histories beyond the retention policy",
+	Long: `Remove scratch project history files according to the history section of config.yaml:
+the latest keep_last versions, one version per hour for keep_hourly hours and one version
+per day for keep_daily days are kept. The current version of a project is never removed.
+
+With --assets, uploaded scratch assets that are no longer referenced by any version of a
+live project or by an assignment submission are removed afterwards, together with their
+user_assets rows. Assets newer than --min-age are kept so uploads of unsaved projects survive.`,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return err
+		}
+		assets, err := cmd.Flags().GetBool("assets")
+		if err != nil {
+			return err
+		}
+		minAge, err := cmd.Flags().GetDuration("min-age")
+		if err != nil {
+			return err
+		}
+		cfg, db, err := openDatabase(cmd)
+		if err != nil {
+			return err
+		}
+
+		scratchDao := dao.NewScratchDao(db, filepath.Join(cfg.Storage.BasePath, "scratch"), cfg, zap.NewNop())
+		result, err := scratchDao.CompactHistories(dryRun)
+		if err != nil {
+			return err
+		}
+
+		action := "removed"
+		if dryRun {
+			action = "would remove"
+		}
+		fmt.Printf("scratch histories: %d projects checked, %s %d files, %s reclaimed\n",
+			result.Projects, action, result.FilesRemoved, formatBytes(result.BytesReclaimed))
+
+		if !assets {
+			return nil
+		}
+		assetResult, err := scratchDao.CollectOrphanAssets(dao.AssetGCOptions{
+			DryRun:        dryRun,
+			MinAge:        minAge,
+			ReferenceDirs: []string{cfg.Storage.SubmissionsDir()},
+		})
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			for _, name := range assetResult.OrphanAssets {
+				fmt.Println("  orphan:", name)
+			}
+		}
+		fmt.Printf("scratch assets: %d projects and %d files scanned, %d assets referenced, %s %d files and %d rows, %s reclaimed\n",
+			assetResult.ProjectsScanned, assetResult.FilesScanned, assetResult.ReferencedAssets,
+			action, assetResult.FilesRemoved, assetResult.RowsRemoved, formatBytes(assetResult.BytesReclaimed))
+		if assetResult.UnreadableFiles > 0 {
+			fmt.Printf("warning: %d project files could not be parsed, assets will not be removed until they are fixed\n", assetResult.UnreadableFiles)
+		}
+		return nil
+	},
+}
+
+// formatBytes 以易读的单位显示字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	gcCmd.Flags().Bool("dry-run", false, "only report what would be removed")
+	gcCmd.Flags().Bool("assets", false, "also remove scratch assets no project references")
+	gcCmd.Flags().Duration("min-age", dao.DefaultAssetGCMinAge, "keep assets uploaded more recently than this")
+
+	rootCmd.AddCommand(gcCmd)
+}
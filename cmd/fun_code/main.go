@@ -29,33 +29,9 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Start the web server",
 	Run: func(cmd *cobra.Command, args []string) {
-		// 获取配置文件路径
-		configPath, err := cmd.Flags().GetString("config")
+		cfg, err := loadConfig(cmd)
 		if err != nil {
-			fmt.Printf("Failed to get config file path: %v\n", err)
-			os.Exit(1)
-		}
-
-		// If no explicit config file path is provided, and the default config file defaultConfigPath does not exist,
-		// create it in the user's home directory.
-		if configPath == "" || configPath == defaultConfigPath {
-			if _, err = os.Stat(defaultConfigPath); err == nil {
-				configPath = defaultConfigPath
-			} else {
-				// If the config file does not exist, create a default config file
-				cfg := config.NewConfig(defaultBaseDir)
-				if err = cfg.Save(defaultConfigPath); err != nil {
-					fmt.Printf("Failed to create default config file: %v\n", err)
-					os.Exit(1)
-				}
-				configPath = defaultConfigPath
-			}
-		}
-
-		// 加载配置
-		cfg, err := config.LoadConfig(configPath)
-		if err != nil {
-			fmt.Printf("加载配置失败: %v\n", err)
+			fmt.Println(err)
 			os.Exit(1)
 		}
 
@@ -114,6 +90,37 @@ var serveCmd = &cobra.Command{
 	},
 }
 
+// loadConfig 读取 --config 指定的配置文件，使用默认路径且文件不存在时创建默认配置
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	// 获取配置文件路径
+	configPath, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get config file path: %w", err)
+	}
+
+	// If no explicit config file path is provided, and the default config file defaultConfigPath does not exist,
+	// create it in the user's home directory.
+	if configPath == "" || configPath == defaultConfigPath {
+		if _, err = os.Stat(defaultConfigPath); err == nil {
+			configPath = defaultConfigPath
+		} else {
+			// If the config file does not exist, create a default config file
+			cfg := config.NewConfig(defaultBaseDir)
+			if err = cfg.Save(defaultConfigPath); err != nil {
+				return nil, fmt.Errorf("Failed to create default config file: %w", err)
+			}
+			configPath = defaultConfigPath
+		}
+	}
+
+	// 加载配置
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %w", err)
+	}
+	return cfg, nil
+}
+
 func init() {
 	rootCmd.PersistentFlags().StringP("config", "c", defaultConfigPath, "config file path")
 	rootCmd.AddCommand(serveCmd)
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/database"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database schema migrations",
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		migrator, err := openMigrator(cmd)
+		if err != nil {
+			return err
+		}
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tDESCRIPTION")
+		for _, status := range statuses {
+			state := "pending"
+			appliedAt := "-"
+			if status.Applied {
+				state = "applied"
+				appliedAt = time.Unix(status.AppliedAt, 0).Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state = "unknown"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, state, appliedAt, status.Description)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		// 数据库比程序新时提示升级
+		if err := migrator.Check(); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, err := cmd.Flags().GetInt64("to")
+		if err != nil {
+			return err
+		}
+		migrator, err := openMigrator(cmd)
+		if err != nil {
+			return err
+		}
+
+		done, err := migrator.Up(target)
+		for _, migration := range done {
+			fmt.Printf("applied %d: %s\n", migration.Version, migration.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return nil
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Roll back the latest applied migrations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		steps, err := cmd.Flags().GetInt("steps")
+		if err != nil {
+			return err
+		}
+		if steps <= 0 {
+			return fmt.Errorf("--steps 必须大于 0")
+		}
+		migrator, err := openMigrator(cmd)
+		if err != nil {
+			return err
+		}
+
+		done, err := migrator.Down(steps)
+		for _, migration := range done {
+			fmt.Printf("rolled back %d: %s\n", migration.Version, migration.Description)
+		}
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("no applied migrations")
+		}
+		return nil
+	},
+}
+
+// openMigrator 按配置连接数据库并创建迁移执行器
+func openMigrator(cmd *cobra.Command) (*database.Migrator, error) {
+	_, db, err := openDatabase(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return database.NewMigrator(db, database.Migrations), nil
+}
+
+// openDatabase 加载配置并连接数据库
+func openDatabase(cmd *cobra.Command) (*config.Config, *gorm.DB, error) {
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := database.Open(cfg.Database.Driver, cfg.Database.DSN, &gorm.Config{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("连接数据库失败: %w", err)
+	}
+	return cfg, db, nil
+}
+
+func init() {
+	migrateUpCmd.Flags().Int64("to", 0, "migrate up to this version (default: latest)")
+	migrateDownCmd.Flags().Int("steps", 1, "number of migrations to roll back")
+
+	// 执行出错时只输出错误，不输出用法说明
+	for _, cmd := range []*cobra.Command{migrateStatusCmd, migrateUpCmd, migrateDownCmd} {
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+	}
+	migrateCmd.AddCommand(migrateStatusCmd, migrateUpCmd, migrateDownCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
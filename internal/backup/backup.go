@@ -0,0 +1,284 @@
+// Package backup 把数据库和 Storage.BasePath 下的文件打包成一个备份文件，并支持从备份恢复
+//
+// 备份文件是 tar.gz 格式，包含：
+//
+//	database/fun_code.db  SQLite 数据库快照（仅 sqlite 驱动）
+//	storage/...           Storage.BasePath 下的所有文件
+//	manifest.json         清单，记录每个文件的大小和 SHA-256 以及数据库结构版本
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/database"
+	"gorm.io/gorm"
+)
+
+// FormatVersion 备份文件格式版本
+const FormatVersion = 1
+
+const (
+	manifestEntry = "manifest.json"
+	databaseEntry = "database/fun_code.db"
+	storagePrefix = "storage/"
+
+	fileNamePrefix = "fun_code-backup-"
+	fileNameSuffix = ".tar.gz"
+	fileNameLayout = "20060102-150405"
+)
+
+var (
+	// ErrInvalidArchive 不是有效的备份文件
+	ErrInvalidArchive = errors.New("备份文件格式错误")
+	// ErrChecksumMismatch 备份文件内容与清单不一致
+	ErrChecksumMismatch = errors.New("备份文件校验失败")
+)
+
+// FileEntry 清单中的文件记录，Path 为备份包内的路径
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest 备份清单
+type Manifest struct {
+	FormatVersion    int         `json:"format_version"`
+	CreatedAt        int64       `json:"created_at"`
+	SchemaVersion    int64       `json:"schema_version"`
+	DatabaseDriver   string      `json:"database_driver"`
+	IncludesDatabase bool        `json:"includes_database"`
+	Files            []FileEntry `json:"files"`
+}
+
+// FileName 按时间生成备份文件名，文件名按字典序排列即为时间顺序
+func FileName(t time.Time) string {
+	return fileNamePrefix + t.Format(fileNameLayout) + fileNameSuffix
+}
+
+// CreateInDir 在 dir 目录下创建以当前时间命名的备份文件
+func CreateInDir(db *gorm.DB, cfg *config.Config, dir string) (string, *Manifest, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nil, err
+	}
+	dest := filepath.Join(dir, FileName(time.Now()))
+	manifest, err := Create(db, cfg, dest)
+	if err != nil {
+		return "", nil, err
+	}
+	return dest, manifest, nil
+}
+
+// Create 创建备份文件，服务运行时也可以执行
+// SQLite 数据库通过 VACUUM INTO 得到一致的快照；PostgreSQL 和 MySQL 只备份文件，
+// 数据库请使用 pg_dump / mysqldump 备份
+func Create(db *gorm.DB, cfg *config.Config, dest string) (*Manifest, error) {
+	driver, err := database.NormalizeDriver(cfg.Database.Driver)
+	if err != nil {
+		return nil, err
+	}
+	schemaVersion, err := database.NewMigrator(db, database.Migrations).CurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		FormatVersion:  FormatVersion,
+		CreatedAt:      time.Now().Unix(),
+		SchemaVersion:  schemaVersion,
+		DatabaseDriver: driver,
+	}
+
+	// 先写到临时文件，成功后再改名，避免留下不完整的备份
+	tmpPath := dest + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	spool, err := os.CreateTemp("", "fun_code-backup-spool-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	w := &archiveWriter{tw: tw, manifest: manifest, spool: spool}
+
+	// 先做数据库快照再打包文件，快照中引用的文件一定已经存在
+	var dbPath string
+	if driver == database.DriverSQLite {
+		dbPath = database.SQLiteFilePath(cfg.Database.DSN)
+		if err := w.addSQLiteSnapshot(db); err != nil {
+			return nil, err
+		}
+		manifest.IncludesDatabase = true
+	}
+
+	if err := w.addStorage(cfg.Storage.BasePath, dbPath); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    manifestEntry,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Unix(manifest.CreatedAt, 0),
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, dest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+type archiveWriter struct {
+	tw       *tar.Writer
+	manifest *Manifest
+	spool    *os.File // 打包前先把文件复制到这里，按实际复制的大小写入 tar 头
+}
+
+// addSQLiteSnapshot 用 VACUUM INTO 生成数据库快照并写入备份
+func (w *archiveWriter) addSQLiteSnapshot(db *gorm.DB) error {
+	tmpDir, err := os.MkdirTemp("", "fun_code-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, "fun_code.db")
+	if err := db.Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+		return fmt.Errorf("生成数据库快照失败: %w", err)
+	}
+	return w.addFile(snapshot, databaseEntry)
+}
+
+// addStorage 打包存储目录下的所有文件，跳过位于存储目录中的数据库文件
+func (w *archiveWriter) addStorage(basePath, dbPath string) error {
+	if _, err := os.Stat(basePath); os.IsNotExist(err) {
+		return nil
+	}
+
+	skip := map[string]bool{}
+	if dbPath != "" {
+		if abs, err := filepath.Abs(dbPath); err == nil {
+			for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+				skip[abs+suffix] = true
+			}
+		}
+	}
+
+	return filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 服务运行时文件可能刚好被删除
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && skip[abs] {
+			return nil
+		}
+		rel, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		err = w.addFile(path, storagePrefix+filepath.ToSlash(rel))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// addFile 写入一个文件，同时计算 SHA-256 记录到清单
+func (w *archiveWriter) addFile(path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// 服务运行时文件可能正在被改写，大小与 Stat 的结果不一定一致，
+	// 先复制一份，tar 头中的大小和清单都以实际复制的内容为准
+	if err := w.spool.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w.spool, hash), io.LimitReader(f, info.Size()))
+	if err != nil {
+		return fmt.Errorf("读取 %s 失败: %w", path, err)
+	}
+	if _, err := w.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := w.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		Size:    size,
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(w.tw, w.spool, size); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", path, err)
+	}
+	w.manifest.Files = append(w.manifest.Files, FileEntry{
+		Path:   name,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+// isBackupFile 是否是 CreateInDir 生成的备份文件
+func isBackupFile(name string) bool {
+	return strings.HasPrefix(name, fileNamePrefix) && strings.HasSuffix(name, fileNameSuffix)
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/database"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupTestEnv(t *testing.T) (*config.Config, *gorm.DB) {
+	return setupTestEnvWithDatabase(t, filepath.Join("sqlite", "fun_code.db"))
+}
+
+// setupTestEnvWithDatabase dbPath 为数据库文件相对于测试目录的路径
+func setupTestEnvWithDatabase(t *testing.T, dbPath string) (*config.Config, *gorm.DB) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Driver: "sqlite", DSN: filepath.Join(dir, dbPath)},
+		Storage:  config.StorageConfig{BasePath: filepath.Join(dir, "data", "upload_files")},
+		Backup:   config.BackupConfig{Directory: filepath.Join(dir, "backups"), Keep: 2},
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(cfg.Database.DSN), 0755))
+
+	db, err := database.Open(cfg.Database.Driver, cfg.Database.DSN, nil)
+	require.NoError(t, err)
+	require.NoError(t, database.RunMigrations(db))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	writeFile(t, filepath.Join(cfg.Storage.BasePath, "scratch", "1", "project.json"), `{"targets":[]}`)
+	writeFile(t, filepath.Join(cfg.Storage.BasePath, "excalidraw", "board.json"), `{"elements":[]}`)
+	return cfg, db
+}
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+// 测试备份后修改数据，再从备份恢复
+func TestCreateAndRestore(t *testing.T) {
+	cfg, db := setupTestEnv(t)
+	require.NoError(t, db.Create(&model.User{Username: "alice", Password: "123456"}).Error)
+
+	path, manifest, err := CreateInDir(db, cfg, cfg.Backup.Directory)
+	require.NoError(t, err)
+	assert.True(t, manifest.IncludesDatabase)
+	assert.Equal(t, database.NewMigrator(db, database.Migrations).LatestVersion(), manifest.SchemaVersion)
+	assert.Len(t, manifest.Files, 3)
+
+	// 备份之后的修改
+	require.NoError(t, db.Create(&model.User{Username: "bob", Password: "123456"}).Error)
+	writeFile(t, filepath.Join(cfg.Storage.BasePath, "scratch", "1", "project.json"), `{"targets":["changed"]}`)
+	writeFile(t, filepath.Join(cfg.Storage.BasePath, "new.json"), `{}`)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	result, err := Restore(path, cfg)
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.PreviousDatabase)
+	assert.NotEmpty(t, result.PreviousStorage)
+	assert.FileExists(t, filepath.Join(result.PreviousStorage, "new.json"))
+
+	data, err := os.ReadFile(filepath.Join(cfg.Storage.BasePath, "scratch", "1", "project.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"targets":[]}`, string(data))
+	assert.NoFileExists(t, filepath.Join(cfg.Storage.BasePath, "new.json"))
+
+	restored, err := database.Open(cfg.Database.Driver, cfg.Database.DSN, nil)
+	require.NoError(t, err)
+	var usernames []string
+	require.NoError(t, restored.Model(&model.User{}).Pluck("username", &usernames).Error)
+	assert.Equal(t, []string{"alice"}, usernames)
+}
+
+// 测试数据库文件位于存储目录中时，恢复的数据库写入新的存储目录，原数据库随原存储目录保留
+func TestRestoreDatabaseInStorage(t *testing.T) {
+	cfg, db := setupTestEnvWithDatabase(t, filepath.Join("data", "upload_files", "fun_code.db"))
+	require.NoError(t, db.Create(&model.User{Username: "alice", Password: "123456"}).Error)
+
+	path, manifest, err := CreateInDir(db, cfg, cfg.Backup.Directory)
+	require.NoError(t, err)
+	// 存储目录中的数据库文件不重复打包
+	assert.Len(t, manifest.Files, 3)
+
+	require.NoError(t, db.Create(&model.User{Username: "bob", Password: "123456"}).Error)
+	writeFile(t, filepath.Join(cfg.Storage.BasePath, "scratch", "1", "project.json"), `{"targets":["changed"]}`)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	result, err := Restore(path, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(result.PreviousStorage, "fun_code.db"), result.PreviousDatabase)
+	assert.FileExists(t, result.PreviousDatabase)
+
+	data, err := os.ReadFile(filepath.Join(cfg.Storage.BasePath, "scratch", "1", "project.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"targets":[]}`, string(data))
+
+	restored, err := database.Open(cfg.Database.Driver, cfg.Database.DSN, nil)
+	require.NoError(t, err)
+	var usernames []string
+	require.NoError(t, restored.Model(&model.User{}).Pluck("username", &usernames).Error)
+	assert.Equal(t, []string{"alice"}, usernames)
+}
+
+// 测试内容被篡改的备份不会覆盖现有数据
+func TestRestoreChecksumMismatch(t *testing.T) {
+	cfg, db := setupTestEnv(t)
+	path, _, err := CreateInDir(db, cfg, cfg.Backup.Directory)
+	require.NoError(t, err)
+
+	tampered := filepath.Join(t.TempDir(), "tampered.tar.gz")
+	rewriteArchive(t, path, tampered, func(name string, data []byte) []byte {
+		if name == storagePrefix+"excalidraw/board.json" {
+			return []byte(`{"elements":["x"]}`)
+		}
+		return data
+	})
+
+	_, err = Restore(tampered, cfg)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.DirExists(t, cfg.Storage.BasePath)
+	assert.FileExists(t, filepath.Join(cfg.Storage.BasePath, "excalidraw", "board.json"))
+
+	_, err = Restore(filepath.Join(cfg.Backup.Directory, "missing.tar.gz"), cfg)
+	assert.Error(t, err)
+}
+
+// rewriteArchive 复制备份文件，并用 fn 修改其中的文件内容
+func rewriteArchive(t *testing.T, src, dest string, fn func(name string, data []byte) []byte) {
+	in, err := os.Open(src)
+	require.NoError(t, err)
+	defer in.Close()
+	gr, err := gzip.NewReader(in)
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+
+	out, err := os.Create(dest)
+	require.NoError(t, err)
+	defer out.Close()
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		data = fn(hdr.Name, data)
+		hdr.Size = int64(len(data))
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+}
+
+// 测试只保留最新的备份
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		writeFile(t, filepath.Join(dir, FileName(base.Add(time.Duration(i)*time.Hour))), "x")
+	}
+	writeFile(t, filepath.Join(dir, "other.tar.gz"), "x")
+
+	removed, err := Prune(dir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, FileName(base)),
+		filepath.Join(dir, FileName(base.Add(time.Hour))),
+	}, removed)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	removed, err = Prune(dir, 0)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+}
@@ -0,0 +1,254 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/database"
+)
+
+// maxManifestSize 清单文件大小上限
+const maxManifestSize = 64 << 20
+
+// RestoreResult 恢复结果，恢复前的数据被改名保留，确认无误后可以手动删除
+type RestoreResult struct {
+	Manifest         *Manifest
+	PreviousStorage  string // 原存储目录改名后的路径，原目录不存在时为空
+	PreviousDatabase string // 原数据库文件改名后的路径，未恢复数据库或原文件不存在时为空
+}
+
+// Restore 从备份文件恢复数据库和存储目录，执行前必须先停止服务
+// 备份文件会先完整解压并校验，校验通过后才替换现有数据
+func Restore(archivePath string, cfg *config.Config) (*RestoreResult, error) {
+	driver, err := database.NormalizeDriver(cfg.Database.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath := filepath.Clean(cfg.Storage.BasePath)
+	if err := os.MkdirAll(filepath.Dir(basePath), 0755); err != nil {
+		return nil, err
+	}
+	// 解压到存储目录旁边，保证最后可以直接改名
+	staging, err := os.MkdirTemp(filepath.Dir(basePath), ".fun_code-restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	manifest, err := extract(archivePath, staging)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("%w: 不支持的备份格式版本 %d", ErrInvalidArchive, manifest.FormatVersion)
+	}
+	latest := database.NewMigrator(nil, database.Migrations).LatestVersion()
+	if manifest.SchemaVersion > latest {
+		return nil, fmt.Errorf("%w: 备份的数据库版本 %d，程序最新版本 %d", database.ErrSchemaAhead, manifest.SchemaVersion, latest)
+	}
+	if manifest.IncludesDatabase && driver != database.DriverSQLite {
+		return nil, fmt.Errorf("备份包含 SQLite 数据库，但当前配置的数据库驱动是 %s", driver)
+	}
+
+	suffix := ".before-restore-" + time.Now().Format(fileNameLayout)
+	result := &RestoreResult{Manifest: manifest}
+
+	// 先替换存储目录再恢复数据库：数据库文件可能位于存储目录中，
+	// 这时原数据库随存储目录一起改名保留，恢复的数据库写入新的存储目录
+	if _, err := os.Stat(basePath); err == nil {
+		result.PreviousStorage = basePath + suffix
+		if err := os.Rename(basePath, result.PreviousStorage); err != nil {
+			return nil, err
+		}
+	}
+	stagedStorage := filepath.Join(staging, strings.TrimSuffix(storagePrefix, "/"))
+	if _, err := os.Stat(stagedStorage); os.IsNotExist(err) {
+		if err := os.MkdirAll(basePath, 0755); err != nil {
+			return nil, err
+		}
+	} else if err := os.Rename(stagedStorage, basePath); err != nil {
+		return nil, err
+	}
+
+	if manifest.IncludesDatabase {
+		dbPath := database.SQLiteFilePath(cfg.Database.DSN)
+		previous, err := replaceSQLite(filepath.Join(staging, filepath.FromSlash(databaseEntry)), dbPath, suffix)
+		if err != nil {
+			return nil, err
+		}
+		if rel, ok := relativeTo(basePath, dbPath); ok && result.PreviousStorage != "" {
+			previous = filepath.Join(result.PreviousStorage, rel)
+			if _, err := os.Stat(previous); err != nil {
+				previous = ""
+			}
+		}
+		result.PreviousDatabase = previous
+	}
+	return result, nil
+}
+
+// relativeTo 返回 path 相对于目录 dir 的路径，path 不在 dir 中时 ok 为 false
+func relativeTo(dir, path string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// extract 解压备份文件到 dir，并按清单校验每个文件
+func extract(archivePath, dir string) (*Manifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	extracted := map[string]FileEntry{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		if name == manifestEntry {
+			data, err := io.ReadAll(io.LimitReader(tr, maxManifestSize))
+			if err != nil {
+				return nil, err
+			}
+			manifest = &Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, fmt.Errorf("%w: 清单解析失败: %v", ErrInvalidArchive, err)
+			}
+			continue
+		}
+		// Clean 之后 ../ 只会出现在开头，前缀检查同时排除了越出解压目录的路径
+		if name != databaseEntry && !strings.HasPrefix(name, storagePrefix) {
+			return nil, fmt.Errorf("%w: 未知的文件 %s", ErrInvalidArchive, hdr.Name)
+		}
+
+		entry, err := extractFile(tr, filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		entry.Path = name
+		extracted[name] = entry
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: 缺少 %s", ErrInvalidArchive, manifestEntry)
+	}
+	if len(extracted) != len(manifest.Files) {
+		return nil, fmt.Errorf("%w: 清单记录 %d 个文件，实际 %d 个", ErrChecksumMismatch, len(manifest.Files), len(extracted))
+	}
+	for _, want := range manifest.Files {
+		got, ok := extracted[want.Path]
+		if !ok || got.Size != want.Size || got.SHA256 != want.SHA256 {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, want.Path)
+		}
+	}
+	return manifest, nil
+}
+
+func extractFile(r io.Reader, dest string) (FileEntry, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return FileEntry{}, err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), r)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	return FileEntry{Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, out.Close()
+}
+
+// replaceSQLite 用快照替换数据库文件，原文件连同 -wal、-shm 一起改名保留
+func replaceSQLite(snapshot, dbPath, suffix string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return "", err
+	}
+	// 先复制到数据库所在目录，快照和数据库可能不在同一个文件系统
+	tmpPath := dbPath + ".restore-tmp"
+	if err := copyFile(snapshot, tmpPath); err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+
+	var previous string
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = dbPath + suffix
+	}
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + ext); err != nil {
+			continue
+		}
+		if err := os.Rename(dbPath+ext, dbPath+suffix+ext); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
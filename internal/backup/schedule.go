@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/database"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Prune 只保留 dir 目录下最新的 keep 个备份文件，返回被删除的文件
+// keep 小于等于 0 时不删除
+func Prune(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isBackupFile(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) <= keep {
+		return nil, nil
+	}
+
+	// 文件名中的时间按字典序排列即为时间顺序
+	sort.Strings(names)
+	var removed []string
+	for _, name := range names[:len(names)-keep] {
+		path := filepath.Join(dir, name)
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// Scheduler 按配置的间隔在后台自动备份，并清理超出保留个数的旧备份
+type Scheduler struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	logger   *zap.Logger
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// NewScheduler 创建自动备份任务，未配置备份间隔时返回 nil
+func NewScheduler(db *gorm.DB, cfg *config.Config, logger *zap.Logger) (*Scheduler, error) {
+	interval, err := cfg.Backup.IntervalDuration()
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		return nil, nil
+	}
+	return &Scheduler{
+		db:       db,
+		cfg:      cfg,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start 在后台启动自动备份
+func (s *Scheduler) Start() {
+	if driver, _ := database.NormalizeDriver(s.cfg.Database.Driver); driver != database.DriverSQLite {
+		s.logger.Warn("automatic backup only includes storage files, back up the database with its own tools",
+			zap.String("driver", driver))
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.RunOnce()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止自动备份
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// RunOnce 执行一次备份和清理，错误只记录日志
+func (s *Scheduler) RunOnce() {
+	path, manifest, err := CreateInDir(s.db, s.cfg, s.cfg.Backup.Directory)
+	if err != nil {
+		s.logger.Error("automatic backup failed", zap.Error(err))
+		return
+	}
+	s.logger.Info("automatic backup created",
+		zap.String("path", path),
+		zap.Int("files", len(manifest.Files)),
+		zap.Int64("schema_version", manifest.SchemaVersion))
+
+	removed, err := Prune(s.cfg.Backup.Directory, s.cfg.Backup.Keep)
+	if err != nil {
+		s.logger.Error("failed to prune old backups", zap.Error(err))
+	}
+	for _, path := range removed {
+		s.logger.Info("old backup removed", zap.String("path", path))
+	}
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoginAttempts 一个用户名或 IP 最近的登录失败情况
+type LoginAttempts struct {
+	Failures    int       // 连续失败次数
+	LastFailure time.Time // 最近一次失败的时间
+	LockedUntil time.Time // 在此之前拒绝登录
+}
+
+// LoginAttemptCache 定义登录失败记录缓存接口，key 为 "user:<用户名>" 或 "ip:<IP>"
+type LoginAttemptCache interface {
+	GetAttempts(key string) (LoginAttempts, bool)
+	SetAttempts(key string, attempts LoginAttempts, expiration time.Duration)
+	DeleteAttempts(key string)
+}
+
+// LoginAttemptCacheImpl 实现基于通用 Cache 的登录失败记录缓存
+type LoginAttemptCacheImpl struct {
+	cache Cache
+}
+
+// NewLoginAttemptCache 创建一个新的登录失败记录缓存实例
+func NewLoginAttemptCache(cache Cache) LoginAttemptCache {
+	return &LoginAttemptCacheImpl{
+		cache: cache,
+	}
+}
+
+// GetAttempts 从缓存获取登录失败记录
+func (c *LoginAttemptCacheImpl) GetAttempts(key string) (LoginAttempts, bool) {
+	data, found := c.cache.Get(fmt.Sprintf("login_attempts:%s", key))
+	if !found {
+		return LoginAttempts{}, false
+	}
+	attempts, ok := data.(LoginAttempts)
+	return attempts, ok
+}
+
+// SetAttempts 保存登录失败记录，超过 expiration 没有新的失败后自动清除
+func (c *LoginAttemptCacheImpl) SetAttempts(key string, attempts LoginAttempts, expiration time.Duration) {
+	c.cache.Set(fmt.Sprintf("login_attempts:%s", key), attempts, expiration)
+}
+
+// DeleteAttempts 清除登录失败记录
+func (c *LoginAttemptCacheImpl) DeleteAttempts(key string) {
+	c.cache.Delete(fmt.Sprintf("login_attempts:%s", key))
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// OIDCState 跳转到身份提供方登录时保存的请求信息，回调时按 state 取出
+type OIDCState struct {
+	Nonce        string
+	CodeVerifier string
+	RedirectURL  string // 回调地址，换取令牌时需要与登录时一致
+	ReturnTo     string // 登录后返回的页面
+	LinkUserID   uint   // 不为 0 时表示已登录的用户关联外部身份
+}
+
+// OIDCStateCache 定义 OIDC 登录请求缓存接口
+type OIDCStateCache interface {
+	SetState(state string, value OIDCState, expiration time.Duration)
+	// TakeState 取出并删除，每个 state 只能使用一次
+	TakeState(state string) (OIDCState, bool)
+}
+
+// OIDCStateCacheImpl 实现基于通用 Cache 的 OIDC 登录请求缓存
+type OIDCStateCacheImpl struct {
+	cache Cache
+}
+
+// NewOIDCStateCache 创建一个新的 OIDC 登录请求缓存实例
+func NewOIDCStateCache(cache Cache) OIDCStateCache {
+	return &OIDCStateCacheImpl{
+		cache: cache,
+	}
+}
+
+// SetState 保存登录请求
+func (c *OIDCStateCacheImpl) SetState(state string, value OIDCState, expiration time.Duration) {
+	c.cache.Set(fmt.Sprintf("oidc_state:%s", state), value, expiration)
+}
+
+// TakeState 取出登录请求并删除
+func (c *OIDCStateCacheImpl) TakeState(state string) (OIDCState, bool) {
+	key := fmt.Sprintf("oidc_state:%s", state)
+	data, found := c.cache.Get(key)
+	if !found {
+		return OIDCState{}, false
+	}
+	c.cache.Delete(key)
+	value, ok := data.(OIDCState)
+	return value, ok
+}
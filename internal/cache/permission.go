@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// permissionExpiration 权限缓存的有效期。外部目录登录时同步的角色变化不会主动使缓存失效，
+// 最多在这段时间后生效
+const permissionExpiration = 5 * time.Minute
+
+// UserPermissions 用户的角色和角色拥有的权限
+type UserPermissions struct {
+	Role        string
+	Permissions []string
+}
+
+// PermissionCache 定义用户和角色权限的缓存接口。
+// 缓存带有版本号：先用 Version 取得版本再查询数据库，保存时带上这个版本，
+// 查询期间调用了 Invalidate 时保存的结果不会被读到
+type PermissionCache interface {
+	Version() uint64
+	GetUserPermissions(userID uint) (UserPermissions, bool)
+	SetUserPermissions(userID uint, permissions UserPermissions, version uint64)
+	GetRolePermissions(role string) ([]string, bool)
+	SetRolePermissions(role string, permissions []string, version uint64)
+	// Invalidate 使所有缓存失效，修改用户或角色权限后调用
+	Invalidate()
+}
+
+// versionedPermissions 缓存中保存的权限和写入时的版本
+type versionedPermissions struct {
+	permissions UserPermissions
+	version     uint64
+}
+
+// PermissionCacheImpl 实现基于通用 Cache 的权限缓存
+type PermissionCacheImpl struct {
+	cache   Cache
+	version atomic.Uint64
+}
+
+// NewPermissionCache 创建一个新的权限缓存实例
+func NewPermissionCache(cache Cache) PermissionCache {
+	return &PermissionCacheImpl{
+		cache: cache,
+	}
+}
+
+// Version 当前缓存版本
+func (c *PermissionCacheImpl) Version() uint64 {
+	return c.version.Load()
+}
+
+// GetUserPermissions 从缓存获取用户的权限
+func (c *PermissionCacheImpl) GetUserPermissions(userID uint) (UserPermissions, bool) {
+	return c.get(fmt.Sprintf("permissions:user:%d", userID))
+}
+
+// SetUserPermissions 保存用户的权限
+func (c *PermissionCacheImpl) SetUserPermissions(userID uint, permissions UserPermissions, version uint64) {
+	c.cache.Set(fmt.Sprintf("permissions:user:%d", userID), versionedPermissions{permissions: permissions, version: version}, permissionExpiration)
+}
+
+// GetRolePermissions 从缓存获取角色的权限
+func (c *PermissionCacheImpl) GetRolePermissions(role string) ([]string, bool) {
+	permissions, found := c.get(fmt.Sprintf("permissions:role:%s", role))
+	return permissions.Permissions, found
+}
+
+// SetRolePermissions 保存角色的权限
+func (c *PermissionCacheImpl) SetRolePermissions(role string, permissions []string, version uint64) {
+	c.cache.Set(fmt.Sprintf("permissions:role:%s", role), versionedPermissions{permissions: UserPermissions{Role: role, Permissions: permissions}, version: version}, permissionExpiration)
+}
+
+// Invalidate 增加版本号，之前写入的缓存都不再使用
+func (c *PermissionCacheImpl) Invalidate() {
+	c.version.Add(1)
+}
+
+func (c *PermissionCacheImpl) get(key string) (UserPermissions, bool) {
+	data, found := c.cache.Get(key)
+	if !found {
+		return UserPermissions{}, false
+	}
+	entry, ok := data.(versionedPermissions)
+	if !ok || entry.version != c.version.Load() {
+		return UserPermissions{}, false
+	}
+	return entry.permissions, true
+}
@@ -7,11 +7,11 @@ import (
 	"github.com/jun/fun_code/internal/model"
 )
 
-// SessionCache 定义会话缓存接口
+// SessionCache 定义会话缓存接口，按会话ID缓存
 type SessionCache interface {
-	GetSession(userID uint) (*model.UserSession, bool)
+	GetSession(sessionID string) (*model.UserSession, bool)
 	SetSession(session *model.UserSession)
-	DeleteSession(userID uint)
+	DeleteSession(sessionID string)
 }
 
 // UserSessionCache 实现基于内存的会话缓存
@@ -27,8 +27,8 @@ func NewUserSessionCache(cache Cache) SessionCache {
 }
 
 // GetSession 从缓存获取用户会话
-func (c *UserSessionCache) GetSession(userID uint) (*model.UserSession, bool) {
-	key := fmt.Sprintf("session:%d", userID)
+func (c *UserSessionCache) GetSession(sessionID string) (*model.UserSession, bool) {
+	key := fmt.Sprintf("session:%s", sessionID)
 	data, found := c.cache.Get(key)
 	if !found {
 		return nil, false
@@ -44,7 +44,7 @@ func (c *UserSessionCache) SetSession(session *model.UserSession) {
 		return
 	}
 
-	key := fmt.Sprintf("session:%d", session.UserID)
+	key := fmt.Sprintf("session:%s", session.SessionID)
 	// 计算过期时间
 	expiration := time.Until(session.ExpiresAt)
 	if expiration <= 0 {
@@ -56,7 +56,7 @@ func (c *UserSessionCache) SetSession(session *model.UserSession) {
 }
 
 // DeleteSession 从缓存中删除用户会话
-func (c *UserSessionCache) DeleteSession(userID uint) {
-	key := fmt.Sprintf("session:%d", userID)
+func (c *UserSessionCache) DeleteSession(sessionID string) {
+	key := fmt.Sprintf("session:%s", sessionID)
 	c.cache.Delete(key)
 }
@@ -0,0 +1,354 @@
+// Package classarchive 把班级学生在一段时间内的 Scratch 项目、程序和画板打包成 zip，
+// 用于学期结束时归档。作品逐个读取并直接写入 zip，不会把整个班级的作品读入内存
+package classarchive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jun/fun_code/internal/csvutil"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/sb3"
+	"go.uber.org/zap"
+)
+
+// pageSize 分页读取作品列表时每页的数量
+const pageSize = 100
+
+// 作品类型
+const (
+	TypeScratch    = "scratch"
+	TypeProgram    = "program"
+	TypeExcalidraw = "excalidraw"
+)
+
+// Options 归档的时间范围，按作品的最后修改时间筛选
+type Options struct {
+	Since time.Time // 包含，零值表示不限
+	Until time.Time // 不包含，零值表示不限
+}
+
+func (o Options) contains(t time.Time) bool {
+	if !o.Since.IsZero() && t.Before(o.Since) {
+		return false
+	}
+	if !o.Until.IsZero() && !t.Before(o.Until) {
+		return false
+	}
+	return true
+}
+
+// Entry 索引中的一个作品
+type Entry struct {
+	StudentID     uint      `json:"student_id"`
+	Username      string    `json:"username"`
+	Nickname      string    `json:"nickname"`
+	Type          string    `json:"type"`
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	Path          string    `json:"path"` // 在 zip 中的路径，读取失败时为空
+	UpdatedAt     time.Time `json:"updated_at"`
+	MissingAssets []string  `json:"missing_assets,omitempty"` // 导出 .sb3 时找不到的造型和声音
+	Error         string    `json:"error,omitempty"`          // 读取失败的原因
+}
+
+// Index 归档索引，写入 zip 根目录的 index.json 和 index.csv
+type Index struct {
+	ClassID    uint      `json:"class_id"`
+	ClassName  string    `json:"class_name"`
+	Since      time.Time `json:"since"` // 零值表示不限
+	Until      time.Time `json:"until"`
+	ExportedAt time.Time `json:"exported_at"`
+	Students   int       `json:"students"`
+	Entries    []Entry   `json:"entries"`
+}
+
+// Archiver 读取作品并写入 zip
+type Archiver struct {
+	dao       *dao.Dao
+	loadAsset func(name string) ([]byte, error)
+	logger    *zap.Logger
+}
+
+// New 创建 Archiver，loadAsset 按资源文件名读取 Scratch 的造型和声音，用于打包 .sb3
+func New(d *dao.Dao, loadAsset func(name string) ([]byte, error), logger *zap.Logger) *Archiver {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Archiver{dao: d, loadAsset: loadAsset, logger: logger}
+}
+
+// Write 把学生的作品按学生分目录写入 w，最后写入索引。
+// 单个作品读取失败时记录在索引中并继续，只有写入 w 失败或查询作品列表失败时返回错误
+func (a *Archiver) Write(ctx context.Context, w io.Writer, class *model.Class, students []model.User, opts Options) (*Index, error) {
+	index := &Index{
+		ClassID:    class.ID,
+		ClassName:  class.Name,
+		Since:      opts.Since,
+		Until:      opts.Until,
+		ExportedAt: time.Now(),
+		Students:   len(students),
+		Entries:    []Entry{},
+	}
+
+	zw := zip.NewWriter(w)
+	usedDirs := make(map[string]bool)
+	for i := range students {
+		if err := ctx.Err(); err != nil {
+			return index, err
+		}
+		student := &students[i]
+		dir := studentDir(student, usedDirs)
+		if err := a.writeScratchProjects(ctx, zw, student, dir, opts, index); err != nil {
+			return index, err
+		}
+		if err := a.writePrograms(ctx, zw, student, dir, opts, index); err != nil {
+			return index, err
+		}
+		if err := a.writeBoards(ctx, zw, student, dir, opts, index); err != nil {
+			return index, err
+		}
+	}
+
+	if err := writeIndex(zw, index); err != nil {
+		return index, err
+	}
+	return index, zw.Close()
+}
+
+// writeScratchProjects 把学生的 Scratch 项目打包成 .sb3 写入 zip
+func (a *Archiver) writeScratchProjects(ctx context.Context, zw *zip.Writer, student *model.User, dir string, opts Options, index *Index) error {
+	var beginID uint
+	for {
+		projects, hasMore, err := a.dao.ScratchDao.ListProjectsWithPagination(student.ID, pageSize, beginID, true, true)
+		if err != nil {
+			return fmt.Errorf("查询 %s 的 Scratch 项目失败: %w", student.Username, err)
+		}
+		for _, project := range projects {
+			beginID = project.ID
+			// 没有保存过的项目没有内容
+			if project.MD5 == "" || !opts.contains(project.UpdatedAt) {
+				continue
+			}
+			entry := newEntry(student, TypeScratch, project.ID, project.Name, project.UpdatedAt)
+			data, err := a.dao.ScratchDao.GetProjectHistory(project.ID, project.MD5)
+			if err != nil {
+				index.Entries = append(index.Entries, a.failed(entry, err))
+				continue
+			}
+			// 先检查项目文件能否解析，避免写了一半的 zip 条目
+			if _, err := sb3.AssetNames(data); err != nil {
+				index.Entries = append(index.Entries, a.failed(entry, err))
+				continue
+			}
+			entry.Path = entryPath(dir, "scratch", project.ID, project.Name, "sb3")
+			fw, err := zw.Create(entry.Path)
+			if err != nil {
+				return err
+			}
+			missing, err := sb3.Write(fw, data, a.loadAsset)
+			if err != nil {
+				return err
+			}
+			entry.MissingAssets = missing
+			index.Entries = append(index.Entries, entry)
+		}
+		if !hasMore || len(projects) == 0 || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// writePrograms 把学生的程序按语言的后缀名写入 zip
+func (a *Archiver) writePrograms(ctx context.Context, zw *zip.Writer, student *model.User, dir string, opts Options, index *Index) error {
+	var beginID uint
+	for {
+		programs, hasMore, err := a.dao.ProgramDao.ListProgramsWithPagination(student.ID, pageSize, beginID, true, true)
+		if err != nil {
+			return fmt.Errorf("查询 %s 的程序失败: %w", student.Username, err)
+		}
+		for _, program := range programs {
+			beginID = program.ID
+			if !opts.contains(program.UpdatedAt) {
+				continue
+			}
+			entry := newEntry(student, TypeProgram, program.ID, program.Name, program.UpdatedAt)
+			content, err := a.dao.ProgramDao.GetContent(program.ID, "")
+			if err != nil {
+				index.Entries = append(index.Entries, a.failed(entry, err))
+				continue
+			}
+			entry.Path = entryPath(dir, "programs", program.ID, program.Name, programExt(program.Ext))
+			if err := writeFile(zw, entry.Path, content); err != nil {
+				return err
+			}
+			index.Entries = append(index.Entries, entry)
+		}
+		if !hasMore || len(programs) == 0 || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// writeBoards 把学生的 Excalidraw 画板写入 zip，可以直接用 Excalidraw 打开
+func (a *Archiver) writeBoards(ctx context.Context, zw *zip.Writer, student *model.User, dir string, opts Options, index *Index) error {
+	var beginID uint
+	for {
+		boards, hasMore, err := a.dao.ExcalidrawDao.GetAllBoardsWithPagination(ctx, student.ID, pageSize, beginID, true, true)
+		if err != nil {
+			return fmt.Errorf("查询 %s 的画板失败: %w", student.Username, err)
+		}
+		for _, board := range boards {
+			beginID = board.ID
+			updatedAt := time.Unix(board.UpdatedAt, 0)
+			if !opts.contains(updatedAt) {
+				continue
+			}
+			entry := newEntry(student, TypeExcalidraw, board.ID, board.Name, updatedAt)
+			content, err := a.dao.ExcalidrawDao.ReadBoard(ctx, board)
+			if err != nil {
+				index.Entries = append(index.Entries, a.failed(entry, err))
+				continue
+			}
+			entry.Path = entryPath(dir, "excalidraw", board.ID, board.Name, "excalidraw")
+			if err := writeFile(zw, entry.Path, []byte(content)); err != nil {
+				return err
+			}
+			index.Entries = append(index.Entries, entry)
+		}
+		if !hasMore || len(boards) == 0 || ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// failed 记录读取失败的作品
+func (a *Archiver) failed(entry Entry, err error) Entry {
+	a.logger.Warn("归档作品失败", zap.String("type", entry.Type), zap.Uint("id", entry.ID), zap.Error(err))
+	entry.Error = err.Error()
+	return entry
+}
+
+func newEntry(student *model.User, typ string, id uint, name string, updatedAt time.Time) Entry {
+	return Entry{
+		StudentID: student.ID,
+		Username:  student.Username,
+		Nickname:  student.Nickname,
+		Type:      typ,
+		ID:        id,
+		Name:      name,
+		UpdatedAt: updatedAt,
+	}
+}
+
+// writeIndex 写入 index.json 和 index.csv
+func writeIndex(zw *zip.Writer, index *Index) error {
+	fw, err := zw.Create("index.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(index); err != nil {
+		return err
+	}
+
+	fw, err = zw.Create("index.csv")
+	if err != nil {
+		return err
+	}
+	// 写入 UTF-8 BOM，避免 Excel 打开中文乱码
+	if _, err := io.WriteString(fw, "\xEF\xBB\xBF"); err != nil {
+		return err
+	}
+	w := csv.NewWriter(fw)
+	w.Write([]string{"用户名", "昵称", "类型", "ID", "名称", "文件", "修改时间", "缺少的资源", "错误"})
+	for _, entry := range index.Entries {
+		w.Write([]string{
+			csvutil.SafeCell(entry.Username),
+			csvutil.SafeCell(entry.Nickname),
+			entry.Type,
+			strconv.FormatUint(uint64(entry.ID), 10),
+			csvutil.SafeCell(entry.Name),
+			csvutil.SafeCell(entry.Path),
+			entry.UpdatedAt.Format(time.RFC3339),
+			csvutil.SafeCell(strings.Join(entry.MissingAssets, " ")),
+			csvutil.SafeCell(entry.Error),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeFile(zw *zip.Writer, name string, content []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(content)
+	return err
+}
+
+// studentDir 学生的目录名，昵称加用户名，重名时加上学生ID
+func studentDir(student *model.User, used map[string]bool) string {
+	dir := safeName(student.Username)
+	if student.Nickname != "" && student.Nickname != student.Username {
+		dir = safeName(student.Nickname) + "_" + dir
+	}
+	if used[dir] {
+		dir = fmt.Sprintf("%s_%d", dir, student.ID)
+	}
+	used[dir] = true
+	return dir
+}
+
+// entryPath 作品在 zip 中的路径，文件名带上ID避免重名
+func entryPath(dir, kind string, id uint, name, ext string) string {
+	return path.Join(dir, kind, fmt.Sprintf("%d_%s.%s", id, safeName(name), ext))
+}
+
+// safeName 去掉文件名中不能使用的字符，并限制长度
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 32, strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ".")
+	if runes := []rune(name); len(runes) > 50 {
+		name = string(runes[:50])
+	}
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
+
+// programExt 程序的后缀名，与保存程序时的类型编号对应
+func programExt(ext int) string {
+	switch ext {
+	case 1:
+		return "py"
+	case 2:
+		return "js"
+	case 3:
+		return "ts"
+	case 4:
+		return "go"
+	case 5:
+		return "java"
+	default:
+		return "txt"
+	}
+}
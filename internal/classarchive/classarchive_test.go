@@ -0,0 +1,101 @@
+package classarchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/sb3"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// 测试按学生分目录写入项目和程序，并写入索引
+func TestArchiverWrite(t *testing.T) {
+	db := testutils.SetupTestDB()
+	basePath := t.TempDir()
+	cfg := &config.Config{}
+	d := &dao.Dao{
+		ScratchDao:    dao.NewScratchDao(db, filepath.Join(basePath, "scratch"), cfg, zap.NewNop()),
+		ProgramDao:    dao.NewProgramDao(db, filepath.Join(basePath, "programs"), cfg, zap.NewNop()),
+		ExcalidrawDao: dao.NewExcalidrawDAO(db, filepath.Join(basePath, "excalidraw"), cfg, zap.NewNop()),
+	}
+
+	students := []model.User{
+		{ID: 1, Username: "alice", Nickname: "小红"},
+		{ID: 2, Username: "bob", Nickname: "小红"},
+	}
+	costume := []byte("<svg></svg>")
+	sum := md5.Sum(costume)
+	costumeName := hex.EncodeToString(sum[:]) + ".svg"
+	project := []byte(`{"targets":[{"isStage":true,"costumes":[{"md5ext":"` + costumeName + `"}],"sounds":[]}]}`)
+
+	projectID, err := d.ScratchDao.SaveProject(1, 0, "跳舞的猫", project)
+	assert.NoError(t, err)
+	programID, err := d.ProgramDao.Save(2, 0, "=hello", 1, []byte("print('hello')"))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	archiver := New(d, func(name string) ([]byte, error) {
+		if name == costumeName {
+			return costume, nil
+		}
+		return nil, errors.New("not found")
+	}, zap.NewNop())
+	index, err := archiver.Write(context.Background(), &buf, &model.Class{ID: 9, Name: "三年级一班"}, students, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, index.Entries, 2)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	sb3Path := entryPath("小红_alice", "scratch", projectID, "跳舞的猫", "sb3")
+	archive, err := sb3.Read(bytes.NewReader(files[sb3Path]), int64(len(files[sb3Path])))
+	assert.NoError(t, err)
+	assert.Equal(t, project, archive.Project)
+	assert.Equal(t, costume, archive.Assets[costumeName])
+
+	// 昵称相同的学生用用户名区分目录
+	assert.Equal(t, []byte("print('hello')"), files[entryPath("小红_bob", "programs", programID, "=hello", "py")])
+
+	var saved Index
+	assert.NoError(t, json.Unmarshal(files["index.json"], &saved))
+	assert.Equal(t, uint(9), saved.ClassID)
+	assert.Len(t, saved.Entries, 2)
+	// 以 = 开头的名称在 CSV 中转义，避免被当作公式
+	assert.Contains(t, string(files["index.csv"]), ",'=hello,")
+
+	// 时间范围之外的作品不归档
+	buf.Reset()
+	index, err = archiver.Write(context.Background(), &buf, &model.Class{ID: 9}, students, Options{Until: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Empty(t, index.Entries)
+}
+
+func TestStudentDir(t *testing.T) {
+	used := make(map[string]bool)
+	assert.Equal(t, "alice", studentDir(&model.User{ID: 1, Username: "alice"}, used))
+	assert.Equal(t, "小明_ming", studentDir(&model.User{ID: 2, Username: "ming", Nickname: "小明"}, used))
+	assert.Equal(t, "alice_3", studentDir(&model.User{ID: 3, Username: "alice"}, used))
+	assert.Equal(t, "a_b_c", safeName("a/b:c"))
+	assert.Equal(t, "untitled", safeName(" .. "))
+}
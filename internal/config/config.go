@@ -6,11 +6,14 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/template"
+	"time"
 
 	_ "embed"
 
 	"github.com/google/uuid"
+	"github.com/jun/fun_code/internal/database"
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,8 +29,46 @@ type StorageConfig struct {
 	BasePath string `yaml:"basePath"`
 }
 
+// SubmissionsDir 作业提交快照的存储目录，作业 DAO 写入，资源清理时作为引用来源
+func (s StorageConfig) SubmissionsDir() string {
+	return filepath.Join(s.BasePath, "submissions")
+}
+
 type JWTConfig struct {
-	SecretKey string `yaml:"secretKey"`
+	SecretKey       string `yaml:"secretKey"`
+	AccessTokenTTL  string `yaml:"access_token_ttl"`  // 访问令牌有效期，为空默认 15m
+	RefreshTokenTTL string `yaml:"refresh_token_ttl"` // 刷新令牌有效期，超过这么久没有使用需要重新登录，为空默认 168h
+	SessionMaxAge   string `yaml:"session_max_age"`   // 一次登录最长有效期，到期后无论是否使用都要重新登录，为空默认 720h
+}
+
+// 未配置时的令牌有效期
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+	DefaultSessionMaxAge   = 30 * 24 * time.Hour
+)
+
+// AccessTokenTTLDuration 解析访问令牌有效期
+func (j JWTConfig) AccessTokenTTLDuration() (time.Duration, error) {
+	return parseDurationOr(j.AccessTokenTTL, DefaultAccessTokenTTL)
+}
+
+// RefreshTokenTTLDuration 解析刷新令牌有效期
+func (j JWTConfig) RefreshTokenTTLDuration() (time.Duration, error) {
+	return parseDurationOr(j.RefreshTokenTTL, DefaultRefreshTokenTTL)
+}
+
+// SessionMaxAgeDuration 解析一次登录的最长有效期
+func (j JWTConfig) SessionMaxAgeDuration() (time.Duration, error) {
+	return parseDurationOr(j.SessionMaxAge, DefaultSessionMaxAge)
+}
+
+// parseDurationOr 解析时间间隔，为空时返回 fallback
+func parseDurationOr(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(value)
 }
 
 // ServerMode 服务器启动模式
@@ -58,6 +99,9 @@ type ServerConfig struct {
 	HTTPPort  string     `yaml:"http_port"`  // HTTP端口
 	HTTPSPort string     `yaml:"https_port"` // HTTPS端口
 	TLS       TLSConfig  `yaml:"tls"`        // TLS证书配置
+	// TrustedProxies 可信的反向代理 IP 或 CIDR，只有来自这些地址的请求才使用 X-Forwarded-For 中的客户端 IP，
+	// 为空时使用连接的地址，避免客户端伪造 IP 绕过登录限制或写入审计日志
+	TrustedProxies []string `yaml:"trusted_proxies"`
 
 	// 兼容旧配置
 	Port          string `yaml:"port"`
@@ -89,6 +133,323 @@ type LoggerConfig struct {
 	Output    string `yaml:"output"`    // 日志输出方式，可选值为 "stdout" 和 "file"
 }
 
+// BackupConfig 自动备份配置
+type BackupConfig struct {
+	Directory string `yaml:"directory"` // 备份文件存放目录
+	Interval  string `yaml:"interval"`  // 自动备份间隔，例如 "24h"，为空表示不自动备份
+	Keep      int    `yaml:"keep"`      // 保留最近的备份个数，0 表示全部保留
+}
+
+// IntervalDuration 解析自动备份间隔，未配置时返回 0
+func (b BackupConfig) IntervalDuration() (time.Duration, error) {
+	if b.Interval == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(b.Interval)
+}
+
+// HistoryConfig Scratch 项目历史版本保留策略
+// 保留最近 KeepLast 个版本；KeepHourly 小时内每小时保留一个，KeepDaily 天内每天保留一个
+type HistoryConfig struct {
+	KeepLast        int    `yaml:"keep_last"`
+	KeepHourly      *int   `yaml:"keep_hourly"`      // 未配置时使用默认值，0 表示不按小时保留
+	KeepDaily       *int   `yaml:"keep_daily"`       // 未配置时使用默认值，0 表示不按天保留
+	CompactInterval string `yaml:"compact_interval"` // 后台清理间隔，为空默认 1h，"0" 表示不在后台清理
+}
+
+// 未配置时的历史版本保留策略
+const (
+	DefaultHistoryKeepLast        = 20
+	DefaultHistoryKeepHourly      = 24
+	DefaultHistoryKeepDaily       = 30
+	DefaultHistoryCompactInterval = time.Hour
+)
+
+// WithDefaults 未配置的项使用默认值
+func (h HistoryConfig) WithDefaults() HistoryConfig {
+	if h.KeepLast <= 0 {
+		h.KeepLast = DefaultHistoryKeepLast
+	}
+	if h.KeepHourly == nil {
+		h.KeepHourly = Int(DefaultHistoryKeepHourly)
+	}
+	if h.KeepDaily == nil {
+		h.KeepDaily = Int(DefaultHistoryKeepDaily)
+	}
+	return h
+}
+
+// Int 返回 v 的指针，用于设置可以区分未配置和 0 的配置项
+func Int(v int) *int {
+	return &v
+}
+
+// CompactIntervalDuration 解析后台清理间隔
+func (h HistoryConfig) CompactIntervalDuration() (time.Duration, error) {
+	if h.CompactInterval == "" {
+		return DefaultHistoryCompactInterval, nil
+	}
+	return time.ParseDuration(h.CompactInterval)
+}
+
+// LDAPConfig LDAP/AD 目录登录配置
+// 先用 BindDN 在 BaseDN 下按 UserFilter 查找用户，再用用户的 DN 和密码绑定验证密码
+type LDAPConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	URL                string `yaml:"url"`                  // 例如 ldap://dc.school.local:389 或 ldaps://dc.school.local:636
+	StartTLS           bool   `yaml:"start_tls"`            // ldap:// 连接后升级为 TLS
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 不校验服务器证书，仅用于测试环境
+	Timeout            string `yaml:"timeout"`              // 连接和查询超时，为空默认 5s
+	BindDN             string `yaml:"bind_dn"`              // 查找用户的服务帐号，为空表示匿名查找
+	BindPassword       string `yaml:"bind_password"`
+	BaseDN             string `yaml:"base_dn"`
+	UserFilter         string `yaml:"user_filter"` // {username} 会替换为转义后的用户名，为空默认 (uid={username})
+
+	UsernameAttribute string `yaml:"username_attribute"` // 为空默认 uid，AD 一般为 sAMAccountName
+	NicknameAttribute string `yaml:"nickname_attribute"` // 为空默认 displayName
+	EmailAttribute    string `yaml:"email_attribute"`    // 为空默认 mail
+
+	// RoleAttribute 中的值按 RoleMapping 映射为角色，匹配多个时取权限最高的，都不匹配时使用 DefaultRole，
+	// DefaultRole 为空表示不允许登录
+	RoleAttribute string            `yaml:"role_attribute"` // 为空默认 memberOf
+	RoleMapping   map[string]string `yaml:"role_mapping"`   // 属性值（不区分大小写）到角色 admin/teacher/student
+	DefaultRole   string            `yaml:"default_role"`
+}
+
+// 未配置时的 LDAP 默认值
+const (
+	DefaultLDAPTimeout           = 5 * time.Second
+	DefaultLDAPUserFilter        = "(uid={username})"
+	DefaultLDAPUsernameAttribute = "uid"
+	DefaultLDAPNicknameAttribute = "displayName"
+	DefaultLDAPEmailAttribute    = "mail"
+	DefaultLDAPRoleAttribute     = "memberOf"
+)
+
+// WithDefaults 未配置的项使用默认值
+func (l LDAPConfig) WithDefaults() LDAPConfig {
+	if l.UserFilter == "" {
+		l.UserFilter = DefaultLDAPUserFilter
+	}
+	if l.UsernameAttribute == "" {
+		l.UsernameAttribute = DefaultLDAPUsernameAttribute
+	}
+	if l.NicknameAttribute == "" {
+		l.NicknameAttribute = DefaultLDAPNicknameAttribute
+	}
+	if l.EmailAttribute == "" {
+		l.EmailAttribute = DefaultLDAPEmailAttribute
+	}
+	if l.RoleAttribute == "" {
+		l.RoleAttribute = DefaultLDAPRoleAttribute
+	}
+	return l
+}
+
+// TimeoutDuration 解析连接和查询超时
+func (l LDAPConfig) TimeoutDuration() (time.Duration, error) {
+	return parseDurationOr(l.Timeout, DefaultLDAPTimeout)
+}
+
+// validate 检查开启后的 LDAP 配置
+func (l LDAPConfig) validate() error {
+	if !l.Enabled {
+		return nil
+	}
+	if l.URL == "" {
+		return errors.New("LDAP 地址不能为空")
+	}
+	if l.BaseDN == "" {
+		return errors.New("LDAP base_dn 不能为空")
+	}
+	if l.UserFilter != "" && !strings.Contains(l.UserFilter, "{username}") {
+		return errors.New("LDAP user_filter 必须包含 {username}")
+	}
+	timeout, err := l.TimeoutDuration()
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("LDAP 超时格式错误: %q", l.Timeout)
+	}
+	return validateRoleMapping("LDAP", l.RoleMapping, l.DefaultRole)
+}
+
+// OIDCConfig OpenID Connect 单点登录配置，使用授权码模式 + PKCE
+type OIDCConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Name         string   `yaml:"name"`   // 登录按钮上显示的名称，为空默认 "统一身份认证"
+	Issuer       string   `yaml:"issuer"` // 例如 https://sso.school.local/realms/school
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"` // 公共客户端可以为空，只依赖 PKCE
+	RedirectURL  string   `yaml:"redirect_url"`  // 为空时使用 <访问地址>/api/auth/oidc/callback
+	Scopes       []string `yaml:"scopes"`        // 为空默认 openid profile email
+
+	UsernameClaim string `yaml:"username_claim"` // 为空默认 preferred_username
+	NicknameClaim string `yaml:"nickname_claim"` // 为空默认 name
+	EmailClaim    string `yaml:"email_claim"`    // 为空默认 email
+
+	// RoleClaim 中的值按 RoleMapping 映射为角色，规则与 LDAP 相同；可以用 . 访问嵌套的声明，如 realm_access.roles
+	RoleClaim   string            `yaml:"role_claim"` // 为空默认 groups
+	RoleMapping map[string]string `yaml:"role_mapping"`
+	DefaultRole string            `yaml:"default_role"`
+}
+
+// 未配置时的 OIDC 默认值
+const (
+	DefaultOIDCName          = "统一身份认证"
+	DefaultOIDCUsernameClaim = "preferred_username"
+	DefaultOIDCNicknameClaim = "name"
+	DefaultOIDCEmailClaim    = "email"
+	DefaultOIDCRoleClaim     = "groups"
+)
+
+// WithDefaults 未配置的项使用默认值
+func (o OIDCConfig) WithDefaults() OIDCConfig {
+	if o.Name == "" {
+		o.Name = DefaultOIDCName
+	}
+	if o.UsernameClaim == "" {
+		o.UsernameClaim = DefaultOIDCUsernameClaim
+	}
+	if o.NicknameClaim == "" {
+		o.NicknameClaim = DefaultOIDCNicknameClaim
+	}
+	if o.EmailClaim == "" {
+		o.EmailClaim = DefaultOIDCEmailClaim
+	}
+	if o.RoleClaim == "" {
+		o.RoleClaim = DefaultOIDCRoleClaim
+	}
+	return o
+}
+
+// validate 检查开启后的 OIDC 配置
+func (o OIDCConfig) validate() error {
+	if !o.Enabled {
+		return nil
+	}
+	if o.Issuer == "" {
+		return errors.New("OIDC issuer 不能为空")
+	}
+	if o.ClientID == "" {
+		return errors.New("OIDC client_id 不能为空")
+	}
+	return validateRoleMapping("OIDC", o.RoleMapping, o.DefaultRole)
+}
+
+// validateRoleMapping 检查外部帐号的角色映射和默认角色
+func validateRoleMapping(name string, mapping map[string]string, defaultRole string) error {
+	for value, role := range mapping {
+		if !isRole(role) {
+			return fmt.Errorf("%s 角色映射 %q 的角色无效: %q", name, value, role)
+		}
+	}
+	if defaultRole != "" && !isRole(defaultRole) {
+		return fmt.Errorf("%s 默认角色无效: %q", name, defaultRole)
+	}
+	return nil
+}
+
+// isRole 检查是否为 model 中定义的角色，config 不依赖 model，这里单独列出
+func isRole(role string) bool {
+	switch role {
+	case "admin", "teacher", "student":
+		return true
+	}
+	return false
+}
+
+// PasswordConfig 密码策略和重置密码的设置，外部目录和单点登录的帐号不受影响
+type PasswordConfig struct {
+	MinLength     int    `yaml:"min_length"`      // 最短长度，为空默认 6
+	RequireLetter bool   `yaml:"require_letter"`  // 必须包含字母
+	RequireDigit  bool   `yaml:"require_digit"`   // 必须包含数字
+	ResetCodeTTL  string `yaml:"reset_code_ttl"`  // 老师生成的重置码有效期，为空默认 72h
+	EmailResetTTL string `yaml:"email_reset_ttl"` // 邮件中的重置码有效期，为空默认 30m
+}
+
+// 未配置时的密码策略
+const (
+	DefaultPasswordMinLength = 6
+	DefaultResetCodeTTL      = 72 * time.Hour
+	DefaultEmailResetTTL     = 30 * time.Minute
+)
+
+// WithDefaults 未配置的项使用默认值
+func (p PasswordConfig) WithDefaults() PasswordConfig {
+	if p.MinLength <= 0 {
+		p.MinLength = DefaultPasswordMinLength
+	}
+	return p
+}
+
+// ResetCodeTTLDuration 解析老师生成的重置码有效期
+func (p PasswordConfig) ResetCodeTTLDuration() (time.Duration, error) {
+	return parseDurationOr(p.ResetCodeTTL, DefaultResetCodeTTL)
+}
+
+// EmailResetTTLDuration 解析邮件中的重置码有效期
+func (p PasswordConfig) EmailResetTTLDuration() (time.Duration, error) {
+	return parseDurationOr(p.EmailResetTTL, DefaultEmailResetTTL)
+}
+
+// validate 检查密码策略
+func (p PasswordConfig) validate() error {
+	if p.MinLength > 72 {
+		// bcrypt 只使用前 72 个字节
+		return fmt.Errorf("密码最短长度不能超过 72: %d", p.MinLength)
+	}
+	if ttl, err := p.ResetCodeTTLDuration(); err != nil || ttl <= 0 {
+		return fmt.Errorf("重置码有效期格式错误: %q", p.ResetCodeTTL)
+	}
+	if ttl, err := p.EmailResetTTLDuration(); err != nil || ttl <= 0 {
+		return fmt.Errorf("邮件重置码有效期格式错误: %q", p.EmailResetTTL)
+	}
+	return nil
+}
+
+// SMTPConfig 发送找回密码邮件的服务器，Host 为空表示不开启邮件找回密码
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"` // 为空默认 587，服务器支持时自动使用 STARTTLS
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"` // 发件人地址，为空时使用 Username
+	// BaseURL 邮件中链接使用的访问地址，如 https://code.school.local，不能从请求的 Host 推断，否则可以被伪造
+	BaseURL string `yaml:"base_url"`
+}
+
+// DefaultSMTPPort 未配置时的 SMTP 端口
+const DefaultSMTPPort = 587
+
+// Enabled 是否配置了发信服务器
+func (s SMTPConfig) Enabled() bool {
+	return s.Host != ""
+}
+
+// WithDefaults 未配置的项使用默认值
+func (s SMTPConfig) WithDefaults() SMTPConfig {
+	if s.Port <= 0 {
+		s.Port = DefaultSMTPPort
+	}
+	if s.From == "" {
+		s.From = s.Username
+	}
+	return s
+}
+
+// validate 检查开启后的 SMTP 配置
+func (s SMTPConfig) validate() error {
+	if !s.Enabled() {
+		return nil
+	}
+	if s.WithDefaults().From == "" {
+		return errors.New("SMTP 发件人地址不能为空")
+	}
+	if !strings.HasPrefix(s.BaseURL, "http://") && !strings.HasPrefix(s.BaseURL, "https://") {
+		return fmt.Errorf("SMTP base_url 必须是 http:// 或 https:// 开头的访问地址: %q", s.BaseURL)
+	}
+	return nil
+}
+
 type PyodideConfig struct {
 	FullPath string `yaml:"full_path"`
 }
@@ -107,6 +468,12 @@ type Config struct {
 	I18n          I18nConfig          `yaml:"i18n"`
 	Logger        LoggerConfig        `yaml:"logger"` // 新增 Logger 配置
 	Pyodide       PyodideConfig       `yaml:"pyodide"`
+	Backup        BackupConfig        `yaml:"backup"`
+	History       HistoryConfig       `yaml:"history"`
+	LDAP          LDAPConfig          `yaml:"ldap"`
+	OIDC          OIDCConfig          `yaml:"oidc"`
+	Password      PasswordConfig      `yaml:"password"`
+	SMTP          SMTPConfig          `yaml:"smtp"`
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -181,7 +548,10 @@ func NewConfig(baseDir string) *Config {
 			BasePath: filepath.Join(baseDir, "data", "upload_files"),
 		},
 		JWT: JWTConfig{
-			SecretKey: secretKey,
+			SecretKey:       secretKey,
+			AccessTokenTTL:  "15m",
+			RefreshTokenTTL: "168h",
+			SessionMaxAge:   "720h",
 		},
 		Server: ServerConfig{
 			Mode:      ModeDefault,
@@ -202,6 +572,21 @@ func NewConfig(baseDir string) *Config {
 			Directory: filepath.Join(baseDir, "logs"),
 			Output:    "stdout",
 		},
+		Backup: BackupConfig{
+			Directory: filepath.Join(baseDir, "backups"),
+			Keep:      7,
+		},
+		History: HistoryConfig{
+			KeepLast:        DefaultHistoryKeepLast,
+			KeepHourly:      Int(DefaultHistoryKeepHourly),
+			KeepDaily:       Int(DefaultHistoryKeepDaily),
+			CompactInterval: "1h",
+		},
+		Password: PasswordConfig{
+			MinLength:     DefaultPasswordMinLength,
+			ResetCodeTTL:  "72h",
+			EmailResetTTL: "30m",
+		},
 	}
 }
 
@@ -227,10 +612,16 @@ func (c *Config) Save(path string) error {
 		return err
 	}
 
-	// 初始化 sqlite 文件夹
-	if err := initDir(c.Database.DSN); err != nil {
+	// 初始化 sqlite 文件夹，其他数据库的 DSN 不是文件路径
+	driver, err := database.NormalizeDriver(c.Database.Driver)
+	if err != nil {
 		return err
 	}
+	if driver == database.DriverSQLite {
+		if err := initDir(c.Database.DSN); err != nil {
+			return err
+		}
+	}
 	// 初始化 data 文件夹
 	if err := initDir(c.Storage.BasePath); err != nil {
 		return err
@@ -274,6 +665,9 @@ func (c *Config) Validate() error {
 	if c.Database.Driver == "" {
 		return errors.New("数据库驱动不能为空")
 	}
+	if _, err := database.NormalizeDriver(c.Database.Driver); err != nil {
+		return err
+	}
 	if c.Database.DSN == "" {
 		return errors.New("数据库DSN不能为空")
 	}
@@ -283,5 +677,59 @@ func (c *Config) Validate() error {
 	if c.JWT.SecretKey == "" {
 		return errors.New("JWT密钥不能为空")
 	}
-	return nil
+	accessTTL, err := c.JWT.AccessTokenTTLDuration()
+	if err != nil || accessTTL <= 0 {
+		return fmt.Errorf("访问令牌有效期格式错误: %q", c.JWT.AccessTokenTTL)
+	}
+	refreshTTL, err := c.JWT.RefreshTokenTTLDuration()
+	if err != nil || refreshTTL <= 0 {
+		return fmt.Errorf("刷新令牌有效期格式错误: %q", c.JWT.RefreshTokenTTL)
+	}
+	if refreshTTL < accessTTL {
+		return errors.New("刷新令牌有效期不能短于访问令牌有效期")
+	}
+	maxAge, err := c.JWT.SessionMaxAgeDuration()
+	if err != nil || maxAge <= 0 {
+		return fmt.Errorf("登录最长有效期格式错误: %q", c.JWT.SessionMaxAge)
+	}
+	interval, err := c.Backup.IntervalDuration()
+	if err != nil {
+		return fmt.Errorf("自动备份间隔格式错误: %w", err)
+	}
+	if interval < 0 {
+		return errors.New("自动备份间隔不能为负数")
+	}
+	if interval > 0 && c.Backup.Directory == "" {
+		return errors.New("开启自动备份时备份目录不能为空")
+	}
+	if c.Backup.Keep < 0 {
+		return errors.New("备份保留个数不能为负数")
+	}
+	compactInterval, err := c.History.CompactIntervalDuration()
+	if err != nil {
+		return fmt.Errorf("历史版本清理间隔格式错误: %w", err)
+	}
+	if compactInterval < 0 {
+		return errors.New("历史版本清理间隔不能为负数")
+	}
+	if (c.History.KeepHourly != nil && *c.History.KeepHourly < 0) || (c.History.KeepDaily != nil && *c.History.KeepDaily < 0) {
+		return errors.New("历史版本保留时长不能为负数")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("可信代理地址格式错误: %q", proxy)
+			}
+		}
+	}
+	if err := c.LDAP.validate(); err != nil {
+		return err
+	}
+	if err := c.OIDC.validate(); err != nil {
+		return err
+	}
+	if err := c.Password.validate(); err != nil {
+		return err
+	}
+	return c.SMTP.validate()
 }
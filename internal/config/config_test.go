@@ -38,6 +38,24 @@ server:
 				assert.Equal(t, ":8080", cfg.Server.Port)
 			},
 		},
+		{
+			name: "关闭按小时保留历史版本",
+			content: `database:
+  dsn: test.db
+  driver: sqlite
+storage:
+  basePath: /tmp/storage
+jwt:
+  secretKey: test_secret_key
+history:
+  keep_hourly: 0`,
+			wantErr: false,
+			validate: func(t *testing.T, cfg *Config) {
+				history := cfg.History.WithDefaults()
+				assert.Equal(t, 0, *history.KeepHourly)
+				assert.Equal(t, DefaultHistoryKeepDaily, *history.KeepDaily)
+			},
+		},
 		{
 			name: "缺少必要字段",
 			content: `database:
@@ -176,6 +194,44 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "PostgreSQL配置",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "postgres",
+					DSN:    "host=127.0.0.1 user=fun_code dbname=fun_code sslmode=disable",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				Server: ServerConfig{
+					Port: ":8080",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "不支持的数据库驱动",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "oracle",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				Server: ServerConfig{
+					Port: ":8080",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "数据库驱动为空",
 			config: &Config{
@@ -195,6 +251,186 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "自动备份间隔格式错误",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				Backup: BackupConfig{
+					Directory: "/tmp/backups",
+					Interval:  "every day",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "历史版本清理间隔格式错误",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				History: HistoryConfig{
+					CompactInterval: "hourly",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "刷新令牌有效期短于访问令牌",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey:       "test_secret_key",
+					AccessTokenTTL:  "2h",
+					RefreshTokenTTL: "1h",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "自动备份配置",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				Backup: BackupConfig{
+					Directory: "/tmp/backups",
+					Interval:  "24h",
+					Keep:      7,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "LDAP角色映射无效",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				LDAP: LDAPConfig{
+					Enabled:     true,
+					URL:         "ldap://127.0.0.1:389",
+					BaseDN:      "dc=school,dc=local",
+					RoleMapping: map[string]string{"cn=teachers,dc=school,dc=local": "principal"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "LDAP用户过滤器缺少用户名",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				LDAP: LDAPConfig{
+					Enabled:    true,
+					URL:        "ldap://127.0.0.1:389",
+					BaseDN:     "dc=school,dc=local",
+					UserFilter: "(uid=%s)",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "重置码有效期格式错误",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				Password: PasswordConfig{
+					ResetCodeTTL: "3days",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "可信代理地址格式错误",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				Server: ServerConfig{
+					TrustedProxies: []string{"127.0.0.1", "10.0.0.0/8", "nginx"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "历史版本保留时长为负数",
+			config: &Config{
+				Database: DatabaseConfig{
+					Driver: "sqlite",
+					DSN:    "test.db",
+				},
+				Storage: StorageConfig{
+					BasePath: "/tmp/storage",
+				},
+				JWT: JWTConfig{
+					SecretKey: "test_secret_key",
+				},
+				History: HistoryConfig{
+					KeepHourly: Int(0),
+					KeepDaily:  Int(-1),
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -208,3 +444,14 @@ func TestConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+// 测试驱动名称大小写或别名不同时也会创建 sqlite 文件夹
+func TestConfig_SaveCreatesSQLiteDir(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := NewConfig(tempDir)
+	cfg.Database.Driver = "SQLite3"
+
+	assert.NoError(t, cfg.Save(filepath.Join(tempDir, "config", "config.yaml")))
+	_, err := os.Stat(filepath.Join(tempDir, "sqlite"))
+	assert.NoError(t, err)
+}
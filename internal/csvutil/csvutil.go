@@ -0,0 +1,24 @@
+// Package csvutil 提供导出 CSV 时的公共处理
+package csvutil
+
+// SafeCell 转义用户输入的单元格内容，防止 CSV 公式注入。
+// 以 = + - @ 制表符或回车开头的内容会被 Excel 等软件当作公式执行，
+// 前面加上单引号后按文本显示
+func SafeCell(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
+
+// UnescapeCell 还原 SafeCell 转义过的内容，用于重新导入导出的文件
+func UnescapeCell(s string) string {
+	if len(s) > 1 && s[0] == '\'' && SafeCell(s[1:]) != s[1:] {
+		return s[1:]
+	}
+	return s
+}
@@ -0,0 +1,33 @@
+package csvutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeCell(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"tom":               "tom",
+		"汤姆":                "汤姆",
+		"a=1":               "a=1",
+		"=HYPERLINK(\"x\")": "'=HYPERLINK(\"x\")",
+		"+1":                "'+1",
+		"-1":                "'-1",
+		"@SUM(A1)":          "'@SUM(A1)",
+		"\t=1":              "'\t=1",
+		"\r=1":              "'\r=1",
+	}
+	for input, want := range tests {
+		assert.Equal(t, want, SafeCell(input), input)
+	}
+}
+
+func TestUnescapeCell(t *testing.T) {
+	for _, s := range []string{"", "tom", "=1+1", "-1", "@a", "'", "'tom", "''=1"} {
+		assert.Equal(t, s, UnescapeCell(SafeCell(s)), s)
+	}
+	// 不是 SafeCell 转义出来的单引号保持不变
+	assert.Equal(t, "'tom", UnescapeCell("'tom"))
+}
@@ -0,0 +1,251 @@
+package dao
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AssignmentDaoImpl 作业数据访问实现
+type AssignmentDaoImpl struct {
+	db       *gorm.DB
+	basePath string // 提交快照的存储目录
+	cfg      *config.Config
+	logger   *zap.Logger
+}
+
+// NewAssignmentDao 创建作业DAO实例
+func NewAssignmentDao(db *gorm.DB, basePath string, cfg *config.Config, logger *zap.Logger) AssignmentDao {
+	return &AssignmentDaoImpl{
+		db:       db,
+		basePath: basePath,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// CreateAssignment 创建作业
+func (d *AssignmentDaoImpl) CreateAssignment(assignment *model.Assignment) error {
+	if err := d.db.Create(assignment).Error; err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+	}
+	return nil
+}
+
+// UpdateAssignment 更新作业信息
+func (d *AssignmentDaoImpl) UpdateAssignment(assignmentID uint, updates map[string]interface{}) error {
+	result := d.db.Model(&model.Assignment{}).
+		Where("id = ? AND deleted_at IS NULL", assignmentID).
+		Updates(updates)
+	if result.Error != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, nil)
+	}
+	return nil
+}
+
+// GetAssignment 获取作业详情
+func (d *AssignmentDaoImpl) GetAssignment(assignmentID uint) (*model.Assignment, error) {
+	var assignment model.Assignment
+	if err := d.db.Where("id = ? AND deleted_at IS NULL", assignmentID).First(&assignment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, err)
+		}
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return &assignment, nil
+}
+
+// DeleteAssignment 软删除作业，已有的提交记录和快照保留
+func (d *AssignmentDaoImpl) DeleteAssignment(assignmentID uint) error {
+	now := time.Now().Unix()
+	result := d.db.Model(&model.Assignment{}).
+		Where("id = ? AND deleted_at IS NULL", assignmentID).
+		Update("deleted_at", now)
+	if result.Error != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, nil)
+	}
+	return nil
+}
+
+// ListAssignments 列出班级的作业，按截止时间排序，没有截止时间的排在最后
+func (d *AssignmentDaoImpl) ListAssignments(classID, lessonID uint, publishedOnly bool) ([]model.Assignment, error) {
+	var assignments []model.Assignment
+	query := d.db.Where("class_id = ? AND deleted_at IS NULL", classID)
+	if lessonID > 0 {
+		query = query.Where("lesson_id = ?", lessonID)
+	}
+	if publishedOnly {
+		query = query.Where("is_published = ?", true)
+	}
+	if err := query.Order("due_at = 0, due_at ASC, id ASC").Find(&assignments).Error; err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return assignments, nil
+}
+
+// createSubmissionRetries 同时提交导致提交次数冲突时最多尝试的次数
+const createSubmissionRetries = 3
+
+// CreateSubmission 创建一次作业提交
+// 快照保存在 basePath/YYYY/MM/DD/<studentID>/<submissionID>_<md5>.json，
+// 数据库记录和快照文件在同一个事务中完成，文件写入失败时回滚记录
+func (d *AssignmentDaoImpl) CreateSubmission(submission *model.Submission, content []byte) error {
+	assignment, err := d.GetAssignment(submission.AssignmentID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if assignment.IsOverdue(now) {
+		if !assignment.AllowLate {
+			return gorails.NewError(http.StatusForbidden, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeAssignmentClosed, global.ErrorMsgAssignmentClosed, nil)
+		}
+		submission.IsLate = true
+	}
+
+	// 快照的 MD5 以实际保存的内容为准
+	hash := md5.Sum(content)
+	submission.ProjectMD5 = hex.EncodeToString(hash[:])
+	submission.FilePath = filepath.Join(now.Format("2006"), now.Format("01"), now.Format("02"), fmt.Sprintf("%d", submission.StudentID))
+	submission.Status = model.SubmissionStatusSubmitted
+
+	// 同一学生同时提交时可能算出相同的提交次数，唯一索引拒绝后者，重新计算后再试
+	for i := 1; ; i++ {
+		submission.ID = 0
+		err := d.insertSubmission(submission, content)
+		if err == nil || i == createSubmissionRetries || !d.submissionAttemptTaken(submission) {
+			return err
+		}
+	}
+}
+
+// insertSubmission 在事务中取下一个提交次数，保存记录和快照文件
+func (d *AssignmentDaoImpl) insertSubmission(submission *model.Submission, content []byte) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		if err := tx.Model(&model.Submission{}).
+			Where("assignment_id = ? AND student_id = ?", submission.AssignmentID, submission.StudentID).
+			Select("COALESCE(MAX(attempt), 0)").Scan(&last).Error; err != nil {
+			return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+		}
+		submission.Attempt = last + 1
+
+		if err := tx.Create(submission).Error; err != nil {
+			return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+		}
+
+		dirPath := filepath.Join(d.basePath, submission.FilePath)
+		if err := os.MkdirAll(dirPath, 0755); err != nil {
+			return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeWriteFileFailed, global.ErrorMsgWriteFileFailed, err)
+		}
+		if err := os.WriteFile(d.submissionFile(submission), content, 0644); err != nil {
+			d.logger.Error("写入作业快照失败", zap.Uint("submission_id", submission.ID), zap.Error(err))
+			return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeWriteFileFailed, global.ErrorMsgWriteFileFailed, err)
+		}
+		return nil
+	})
+}
+
+// submissionAttemptTaken 插入失败后检查提交次数是否已被同时进行的另一次提交占用
+func (d *AssignmentDaoImpl) submissionAttemptTaken(submission *model.Submission) bool {
+	var count int64
+	err := d.db.Model(&model.Submission{}).
+		Where("assignment_id = ? AND student_id = ? AND attempt = ?", submission.AssignmentID, submission.StudentID, submission.Attempt).
+		Count(&count).Error
+	return err == nil && count > 0
+}
+
+// GetSubmission 获取提交详情
+func (d *AssignmentDaoImpl) GetSubmission(submissionID uint) (*model.Submission, error) {
+	var submission model.Submission
+	if err := d.db.Preload("Student").First(&submission, submissionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, err)
+		}
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return &submission, nil
+}
+
+// GetSubmissionContent 读取提交时保存的项目快照
+func (d *AssignmentDaoImpl) GetSubmissionContent(submission *model.Submission) ([]byte, error) {
+	content, err := os.ReadFile(d.submissionFile(submission))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeFileNotFound, global.ErrorMsgFileNotFound, err)
+		}
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+	}
+	return content, nil
+}
+
+// ListSubmissions 列出作业的提交记录
+func (d *AssignmentDaoImpl) ListSubmissions(assignmentID uint, latestOnly bool) ([]model.Submission, error) {
+	var submissions []model.Submission
+	query := d.db.Preload("Student").Where("assignment_id = ?", assignmentID)
+	if latestOnly {
+		// 每个学生只取 ID 最大（即最近）的一次提交
+		latest := d.db.Model(&model.Submission{}).
+			Select("MAX(id)").
+			Where("assignment_id = ?", assignmentID).
+			Group("student_id")
+		query = query.Where("id IN (?)", latest)
+	}
+	if err := query.Order("student_id ASC, id DESC").Find(&submissions).Error; err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return submissions, nil
+}
+
+// ListStudentSubmissions 列出某个学生在某个作业下的所有提交
+func (d *AssignmentDaoImpl) ListStudentSubmissions(assignmentID, studentID uint) ([]model.Submission, error) {
+	var submissions []model.Submission
+	if err := d.db.Where("assignment_id = ? AND student_id = ?", assignmentID, studentID).
+		Order("id DESC").
+		Find(&submissions).Error; err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return submissions, nil
+}
+
+// ReturnSubmission 老师退回提交
+func (d *AssignmentDaoImpl) ReturnSubmission(submissionID, reviewerID uint, comment string) error {
+	result := d.db.Model(&model.Submission{}).
+		Where("id = ?", submissionID).
+		Updates(map[string]interface{}{
+			"status":         model.SubmissionStatusReturned,
+			"review_comment": comment,
+			"reviewer_id":    reviewerID,
+			"reviewed_at":    time.Now().Unix(),
+		})
+	if result.Error != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, nil)
+	}
+	return nil
+}
+
+// submissionFile 返回提交快照的完整路径
+func (d *AssignmentDaoImpl) submissionFile(submission *model.Submission) string {
+	return filepath.Join(d.basePath, submission.FilePath, fmt.Sprintf("%d_%s.json", submission.ID, submission.ProjectMD5))
+}
@@ -0,0 +1,119 @@
+package dao
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestAssignmentDao(t *testing.T) AssignmentDao {
+	db := testutils.SetupTestDB()
+	return NewAssignmentDao(db, t.TempDir(), &config.Config{}, zap.NewNop())
+}
+
+// 测试提交作业会保存快照并累计提交次数
+func TestAssignmentDao_CreateSubmission(t *testing.T) {
+	assignmentDao := newTestAssignmentDao(t)
+
+	assignment := &model.Assignment{
+		ClassID:     1,
+		CourseID:    1,
+		LessonID:    1,
+		TeacherID:   1,
+		Title:       "画一个正方形",
+		IsPublished: true,
+	}
+	assert.NoError(t, assignmentDao.CreateAssignment(assignment))
+
+	first := &model.Submission{AssignmentID: assignment.ID, StudentID: 2, ProjectType: model.ProjectTypeScratch, ProjectID: 10}
+	assert.NoError(t, assignmentDao.CreateSubmission(first, []byte(`{"v":1}`)))
+	assert.Equal(t, 1, first.Attempt)
+	assert.False(t, first.IsLate)
+	assert.Len(t, first.ProjectMD5, 32)
+
+	second := &model.Submission{AssignmentID: assignment.ID, StudentID: 2, ProjectType: model.ProjectTypeScratch, ProjectID: 10}
+	assert.NoError(t, assignmentDao.CreateSubmission(second, []byte(`{"v":2}`)))
+	assert.Equal(t, 2, second.Attempt)
+
+	other := &model.Submission{AssignmentID: assignment.ID, StudentID: 3, ProjectType: model.ProjectTypeScratch, ProjectID: 11}
+	assert.NoError(t, assignmentDao.CreateSubmission(other, []byte(`{"v":3}`)))
+	assert.Equal(t, 1, other.Attempt)
+
+	// 快照内容不受后续提交影响
+	content, err := assignmentDao.GetSubmissionContent(first)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"v":1}`, string(content))
+
+	// 每个学生只返回最近一次提交
+	latest, err := assignmentDao.ListSubmissions(assignment.ID, true)
+	assert.NoError(t, err)
+	assert.Len(t, latest, 2)
+	assert.Equal(t, second.ID, latest[0].ID)
+	assert.Equal(t, other.ID, latest[1].ID)
+
+	all, err := assignmentDao.ListSubmissions(assignment.ID, false)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	mine, err := assignmentDao.ListStudentSubmissions(assignment.ID, 2)
+	assert.NoError(t, err)
+	assert.Len(t, mine, 2)
+	assert.Equal(t, second.ID, mine[0].ID)
+
+	// 退回提交
+	assert.NoError(t, assignmentDao.ReturnSubmission(second.ID, 1, "请补充注释"))
+	returned, err := assignmentDao.GetSubmission(second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.SubmissionStatusReturned, returned.Status)
+	assert.Equal(t, "请补充注释", returned.ReviewComment)
+}
+
+// 测试截止时间和迟交设置
+func TestAssignmentDao_CreateSubmissionAfterDue(t *testing.T) {
+	assignmentDao := newTestAssignmentDao(t)
+	dueAt := time.Now().Add(-time.Hour).Unix()
+
+	closed := &model.Assignment{ClassID: 1, CourseID: 1, LessonID: 1, TeacherID: 1, Title: "已截止", DueAt: dueAt}
+	assert.NoError(t, assignmentDao.CreateAssignment(closed))
+	err := assignmentDao.CreateSubmission(&model.Submission{AssignmentID: closed.ID, StudentID: 2, ProjectType: model.ProjectTypeScratch, ProjectID: 10}, []byte("{}"))
+	assert.Error(t, err)
+
+	submissions, err := assignmentDao.ListSubmissions(closed.ID, false)
+	assert.NoError(t, err)
+	assert.Empty(t, submissions)
+
+	late := &model.Assignment{ClassID: 1, CourseID: 1, LessonID: 1, TeacherID: 1, Title: "允许迟交", DueAt: dueAt, AllowLate: true}
+	assert.NoError(t, assignmentDao.CreateAssignment(late))
+	submission := &model.Submission{AssignmentID: late.ID, StudentID: 2, ProjectType: model.ProjectTypeScratch, ProjectID: 10}
+	assert.NoError(t, assignmentDao.CreateSubmission(submission, []byte("{}")))
+	assert.True(t, submission.IsLate)
+}
+
+// 测试作业列表的过滤条件
+func TestAssignmentDao_ListAssignments(t *testing.T) {
+	assignmentDao := newTestAssignmentDao(t)
+
+	assert.NoError(t, assignmentDao.CreateAssignment(&model.Assignment{ClassID: 1, CourseID: 1, LessonID: 1, TeacherID: 1, Title: "课时1", IsPublished: true}))
+	assert.NoError(t, assignmentDao.CreateAssignment(&model.Assignment{ClassID: 1, CourseID: 1, LessonID: 2, TeacherID: 1, Title: "课时2", IsPublished: true}))
+	draft := &model.Assignment{ClassID: 1, CourseID: 1, LessonID: 2, TeacherID: 1, Title: "草稿"}
+	assert.NoError(t, assignmentDao.CreateAssignment(draft))
+	assert.NoError(t, assignmentDao.CreateAssignment(&model.Assignment{ClassID: 2, CourseID: 1, LessonID: 1, TeacherID: 1, Title: "其他班级", IsPublished: true}))
+
+	assignments, err := assignmentDao.ListAssignments(1, 0, false)
+	assert.NoError(t, err)
+	assert.Len(t, assignments, 3)
+
+	assignments, err = assignmentDao.ListAssignments(1, 2, true)
+	assert.NoError(t, err)
+	assert.Len(t, assignments, 1)
+	assert.Equal(t, "课时2", assignments[0].Title)
+
+	assert.NoError(t, assignmentDao.DeleteAssignment(draft.ID))
+	_, err = assignmentDao.GetAssignment(draft.ID)
+	assert.Error(t, err)
+}
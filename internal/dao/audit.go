@@ -0,0 +1,113 @@
+package dao
+
+import (
+	"net/http"
+
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+	"gorm.io/gorm"
+)
+
+type AuditDaoImpl struct {
+	db *gorm.DB
+}
+
+func NewAuditDao(db *gorm.DB) AuditDao {
+	return &AuditDaoImpl{db: db}
+}
+
+// RecordEvent 写入一条审计记录
+func (s *AuditDaoImpl) RecordEvent(event *model.AuditEvent) error {
+	if event.ActorName == "" && event.ActorID > 0 {
+		// 删除自己的帐号时用户已经不存在，Unscoped 仍然可以查到用户名
+		var actor model.User
+		if err := s.db.Unscoped().Select("username").First(&actor, event.ActorID).Error; err == nil {
+			event.ActorName = actor.Username
+		}
+	}
+	event.ResourceID = truncate(event.ResourceID, 100)
+	if err := s.db.Create(event).Error; err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_AUDIT, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+	}
+	return nil
+}
+
+// ListEvents 按条件分页列出审计记录
+// 参数：
+// filter 为查询条件，零值的条件不筛选
+// pageSize 为 uint 类型，代表每页的记录数量
+// beginID 为 uint 类型，代表分页的起始ID
+// forward 为 bool 类型，代表是否向前分页
+// asc 为 bool 类型，代表返回结果是否按ID升序排序
+// 返回值：
+// []model.AuditEvent 类型，代表分页后的审计记录
+// bool 类型，代表是否还有更多记录
+// error 类型，代表错误信息
+func (s *AuditDaoImpl) ListEvents(filter AuditEventFilter, pageSize uint, beginID uint, forward, asc bool) ([]model.AuditEvent, bool, error) {
+	var events []model.AuditEvent
+
+	// 处理 pageSize 为 0 的情况，使用默认值 20
+	if pageSize == 0 {
+		pageSize = 20
+	}
+
+	query := s.db.Model(&model.AuditEvent{})
+	if filter.ActorID > 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	// 记录查询是否按升序排序
+	queryAsc := false
+
+	// 根据 beginID、forward 和 asc 设置查询条件和排序
+	if beginID > 0 {
+		if asc == forward {
+			// 升序向后翻页或降序向前翻页：id > beginID，order 为 id asc
+			query = query.Where("id > ?", beginID).Order("id ASC")
+			queryAsc = true
+		} else {
+			// 升序向前翻页或降序向后翻页：id < beginID，order 为 id desc
+			query = query.Where("id < ?", beginID).Order("id DESC")
+		}
+	} else if asc {
+		query = query.Order("id ASC")
+		queryAsc = true
+	} else {
+		query = query.Order("id DESC")
+	}
+
+	// 执行查询，多查询一条用于判断是否有更多数据
+	if err := query.Limit(int(pageSize + 1)).Find(&events).Error; err != nil {
+		return nil, false, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_AUDIT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	hasMore := len(events) > int(pageSize)
+	if hasMore {
+		events = events[:pageSize]
+	}
+
+	// 如果查询时使用了降序，但用户期望升序结果，则需要反转
+	if queryAsc != asc {
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+	}
+
+	return events, hasMore, nil
+}
@@ -0,0 +1,83 @@
+package dao
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试审计记录：写入时补全操作人用户名，按条件筛选并分页
+func TestAuditDao(t *testing.T) {
+	db := testutils.SetupTestDB()
+	auditDao := NewAuditDao(db)
+	userDao := NewUserDao(db)
+
+	admin := &model.User{Username: "admin1", Password: "password", Email: "admin1@example.com", Role: model.RoleAdmin}
+	assert.NoError(t, userDao.CreateUser(admin))
+	teacher := &model.User{Username: "teacher1", Password: "password", Email: "teacher1@example.com", Role: model.RoleTeacher}
+	assert.NoError(t, userDao.CreateUser(teacher))
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, auditDao.RecordEvent(&model.AuditEvent{
+			ActorID:      admin.ID,
+			Action:       model.AuditActionDeleteClass,
+			ResourceType: model.AuditResourceClass,
+			ResourceID:   "1",
+			Before:       `{"name":"四年级"}`,
+			IP:           "127.0.0.1",
+		}))
+	}
+	assert.NoError(t, auditDao.RecordEvent(&model.AuditEvent{
+		ActorID:      teacher.ID,
+		Action:       model.AuditActionDeleteScratch,
+		ResourceType: model.AuditResourceScratch,
+		ResourceID:   "7",
+	}))
+
+	// 删除操作人后仍然可以记录用户名
+	assert.NoError(t, userDao.DeleteUser(teacher.ID))
+	assert.NoError(t, auditDao.RecordEvent(&model.AuditEvent{
+		ActorID:      teacher.ID,
+		Action:       model.AuditActionDeleteUser,
+		ResourceType: model.AuditResourceUser,
+		ResourceID:   strconv.FormatUint(uint64(teacher.ID), 10),
+	}))
+
+	// 默认最新的记录在前
+	events, hasMore, err := auditDao.ListEvents(AuditEventFilter{}, 0, 0, true, false)
+	assert.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Len(t, events, 7)
+	assert.Equal(t, model.AuditActionDeleteUser, events[0].Action)
+	assert.Equal(t, "teacher1", events[0].ActorName)
+	assert.Equal(t, "admin1", events[6].ActorName)
+
+	// 按操作人和资源筛选
+	events, _, err = auditDao.ListEvents(AuditEventFilter{ActorID: teacher.ID}, 10, 0, true, false)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	events, _, err = auditDao.ListEvents(AuditEventFilter{ResourceType: model.AuditResourceScratch, ResourceID: "7"}, 10, 0, true, false)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	events, _, err = auditDao.ListEvents(AuditEventFilter{Until: time.Now().Add(-time.Hour)}, 10, 0, true, false)
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	// 升序分页，向后翻页再向前翻页
+	first, hasMore, err := auditDao.ListEvents(AuditEventFilter{Action: model.AuditActionDeleteClass}, 2, 0, true, true)
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Len(t, first, 2)
+	second, hasMore, err := auditDao.ListEvents(AuditEventFilter{Action: model.AuditActionDeleteClass}, 2, first[1].ID, true, true)
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Len(t, second, 2)
+	assert.Greater(t, second[0].ID, first[1].ID)
+	back, _, err := auditDao.ListEvents(AuditEventFilter{Action: model.AuditActionDeleteClass}, 2, second[0].ID, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{first[0].ID, first[1].ID}, []uint{back[0].ID, back[1].ID})
+}
@@ -3,10 +3,12 @@ package dao
 import (
 	"errors"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/config"
 	"github.com/jun/fun_code/internal/model"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -18,24 +20,60 @@ type AuthDaoImpl struct {
 	isDemo       bool
 	db           *gorm.DB
 	jwtKey       []byte
+	accessTTL    time.Duration // 访问令牌有效期
+	refreshTTL   time.Duration // 刷新令牌有效期，也是会话不使用时的有效期
+	maxAge       time.Duration // 一次登录的最长有效期
 	sessionCache cache.SessionCache
+
+	loginAttempts   cache.LoginAttemptCache // 按用户名和 IP 记录的登录失败次数
+	loginPending    map[string]int          // 按用户名和 IP 记录的正在校验的登录尝试数
+	loginAttemptsMu sync.Mutex              // 保护 loginAttempts 的读改写和 loginPending
+
+	providers []AuthProvider // 用户名密码的认证来源，最后一个是数据库
 }
 
-// 修改 NewAuthDao 函数，添加缓存参数
-func NewAuthDao(db *gorm.DB, jwtKey []byte, sessionCache cache.SessionCache, isDemo bool) AuthDao {
+// NewAuthDao 创建认证DAO，令牌有效期格式错误时使用默认值，配置已在 Validate 中检查
+// providers 为外部认证来源（如 LDAP），登录时先于数据库中的密码尝试
+func NewAuthDao(db *gorm.DB, jwtConfig config.JWTConfig, sessionCache cache.SessionCache, loginAttempts cache.LoginAttemptCache, isDemo bool, providers ...AuthProvider) AuthDao {
+	accessTTL, err := jwtConfig.AccessTokenTTLDuration()
+	if err != nil || accessTTL <= 0 {
+		accessTTL = config.DefaultAccessTokenTTL
+	}
+	refreshTTL, err := jwtConfig.RefreshTokenTTLDuration()
+	if err != nil || refreshTTL <= 0 {
+		refreshTTL = config.DefaultRefreshTokenTTL
+	}
+	maxAge, err := jwtConfig.SessionMaxAgeDuration()
+	if err != nil || maxAge <= 0 {
+		maxAge = config.DefaultSessionMaxAge
+	}
 	return &AuthDaoImpl{
-		db:           db,
-		jwtKey:       jwtKey,
-		sessionCache: sessionCache,
-		isDemo:       isDemo,
+		db:            db,
+		jwtKey:        []byte(jwtConfig.SecretKey),
+		accessTTL:     accessTTL,
+		refreshTTL:    refreshTTL,
+		maxAge:        maxAge,
+		sessionCache:  sessionCache,
+		loginAttempts: loginAttempts,
+		isDemo:        isDemo,
+		providers:     append(append([]AuthProvider(nil), providers...), &dbAuthProvider{db: db, isDemo: isDemo}),
 	}
 }
 
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid,omitempty"` // 登录会话ID，注销会话后 token 失效
+	// MustChangePassword 需要先修改密码，修改前只能访问修改密码等少数接口
+	MustChangePassword bool `json:"pwc,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// SessionClient 登录设备的信息，记录在会话中供用户查看
+type SessionClient struct {
+	UserAgent string
+	IP        string
+}
+
 // 在 AuthServiceImpl 中实现新方法
 func (s *AuthDaoImpl) GenerateCookie(token string) *http.Cookie {
 	return &http.Cookie{
@@ -45,87 +83,79 @@ func (s *AuthDaoImpl) GenerateCookie(token string) *http.Cookie {
 		HttpOnly: true,
 		Secure:   false, // 仅通过 HTTPS 发送
 		SameSite: http.SameSiteStrictMode,
-		MaxAge:   86400, // 24小时
+		MaxAge:   int(s.accessTTL.Seconds()), // 和访问令牌同时过期，之后用刷新令牌续期
 	}
 }
 
 type LoginResponse struct {
-	Token  string       `json:"token"`
-	Cookie *http.Cookie `json:"cookie"`
-	Role   string       `json:"role"`
+	Token         string       `json:"token"`
+	Cookie        *http.Cookie `json:"cookie"`
+	Role          string       `json:"role"`
+	SessionID     string       `json:"session_id"`
+	ExpiresIn     int          `json:"expires_in"`              // 访问令牌剩余有效秒数
+	RefreshToken  string       `json:"refresh_token,omitempty"` // 新的刷新令牌，宽限期内重复续期时为空
+	RefreshCookie *http.Cookie `json:"refresh_cookie,omitempty"`
+	// MustChangePassword 登录后需要先修改密码
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 }
 
 // Login 方法，返回用户的登录 token 和 cookie，并创建一个 session id，用于后续的请求验证
 // Login 方法，添加缓存逻辑
-func (s *AuthDaoImpl) Login(username, password string) (*LoginResponse, error) {
-	var user model.User
-	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户不存在")
-		}
-		return nil, err
+// 用户不存在和密码错误都返回 ErrInvalidCredentials，失败次数过多时返回 *LoginLockedError
+func (s *AuthDaoImpl) Login(username, password string, client SessionClient) (*LoginResponse, error) {
+	attempt, retryAfter := s.beginLoginAttempt(username, client)
+	if attempt == nil {
+		s.recordLoginFailure(username, 0, client, model.LoginFailureLocked)
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
 	}
+	defer attempt.release()
 
-	// 验证密码
-	if s.isDemo {
-		if password != "demo123456" {
-			return nil, errors.New("密码错误")
-		}
-	} else {
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-			return nil, errors.New("密码错误")
+	user, err := s.authenticate(username, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAuthUserNotFound):
+			// 同样做一次密码校验，避免通过响应时间判断用户是否存在
+			bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+			attempt.failed(0, model.LoginFailureUnknownUser)
+		case errors.Is(err, ErrInvalidCredentials):
+			attempt.failed(authUserID(user), model.LoginFailureWrongPassword)
+		case errors.Is(err, errAuthNoRole):
+			attempt.failed(authUserID(user), model.LoginFailureNoRole)
+		default:
+			return nil, err
 		}
+		return nil, ErrInvalidCredentials
 	}
+	attempt.succeeded()
 
-	// 生成 sessionID
-	sessionID := uuid.New().String()
+	return s.StartSession(user, client)
+}
 
-	// 创建或更新用户会话
+// StartSession 为通过验证的用户创建会话并签发令牌
+// 每次登录创建一个新会话，不影响用户在其他设备上的会话
+func (s *AuthDaoImpl) StartSession(user *model.User, client SessionClient) (*LoginResponse, error) {
+	now := time.Now()
 	session := model.UserSession{
-		UserID:    user.ID,
-		SessionID: sessionID,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		IsActive:  true,
-	}
-
-	// 先尝试查找现有会话
-	var existingSession model.UserSession
-	result := s.db.Where("user_id = ?", user.ID).First(&existingSession)
-
-	if result.Error == nil {
-		// 如果找到现有会话，更新它
-		existingSession.SessionID = sessionID
-		existingSession.ExpiresAt = time.Now().Add(24 * time.Hour)
-		existingSession.IsActive = true
-		s.db.Save(&existingSession)
-
-		// 更新缓存
-		s.sessionCache.SetSession(&existingSession)
-	} else {
-		// 否则创建新会话
-		s.db.Create(&session)
-
-		// 添加到缓存
-		s.sessionCache.SetSession(&session)
-	}
-
-	claims := Claims{
-		UserID: user.ID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "fun_code",
-		},
+		UserID:     user.ID,
+		SessionID:  uuid.New().String(),
+		IsActive:   true,
+		Device:     describeDevice(client.UserAgent),
+		UserAgent:  truncate(client.UserAgent, 512),
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.jwtKey)
-	if err != nil {
+	session.ExpiresAt = s.sessionExpiry(&session, now)
+	if err := s.db.Create(&session).Error; err != nil {
 		return nil, err
 	}
+	s.sessionCache.SetSession(&session)
 
-	cookie := s.GenerateCookie(tokenString)
-	return &LoginResponse{Token: tokenString, Cookie: cookie, Role: user.Role}, nil
+	// 顺便清理该用户已过期的会话和刷新令牌
+	s.db.Where("user_id = ? AND expires_at < ?", user.ID, now).Delete(&model.UserSession{})
+	s.db.Where("user_id = ? AND expires_at < ?", user.ID, now).Delete(&model.RefreshToken{})
+
+	return s.issueTokens(&session, user, true, now)
 }
 
 // Logout 方法，添加缓存清理逻辑
@@ -136,23 +166,20 @@ func (s *AuthDaoImpl) Logout(token string) (*http.Cookie, error) {
 		return nil, errors.New("无效的登录状态")
 	}
 
-	// 查找并使会话失效
-	var session model.UserSession
-	result := s.db.Where("user_id = ? AND is_active = ?", claims.UserID, true).First(&session)
-
+	// 只使当前设备的会话失效
+	result := s.db.Model(&model.UserSession{}).
+		Where("session_id = ? AND user_id = ? AND is_active = ?", claims.SessionID, claims.UserID, true).
+		Update("is_active", false)
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户已经登出")
-		}
 		return nil, result.Error
 	}
-
-	// 将会话标记为非活跃
-	session.IsActive = false
-	s.db.Save(&session)
+	if result.RowsAffected == 0 {
+		return nil, errors.New("用户已经登出")
+	}
 
 	// 从缓存中删除会话
-	s.sessionCache.DeleteSession(claims.UserID)
+	s.sessionCache.DeleteSession(claims.SessionID)
+	s.db.Model(&model.RefreshToken{}).Where("session_id = ? AND revoked_at IS NULL", claims.SessionID).Update("revoked_at", time.Now())
 
 	// 创建一个已过期的 cookie 来覆盖现有的 auth_token
 	expiredCookie := &http.Cookie{
@@ -184,28 +211,36 @@ func (s *AuthDaoImpl) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("无效的token")
 	}
 
-	// 首先从缓存中查找会话
-	session, found := s.sessionCache.GetSession(claims.UserID)
-
-	// 如果缓存中找到有效会话
-	if found && session.IsActive && session.ExpiresAt.After(time.Now()) {
-		return claims, nil
+	// 没有会话ID的 token 是多设备登录之前签发的，需要重新登录
+	if claims.SessionID == "" {
+		return nil, errors.New("会话已过期或已登出")
 	}
 
-	// 缓存未命中，从数据库查询
-	var dbSession model.UserSession
-	result := s.db.Where("user_id = ? AND is_active = ? AND expires_at > ?",
-		claims.UserID, true, time.Now()).First(&dbSession)
+	// 首先从缓存中查找会话
+	session, found := s.sessionCache.GetSession(claims.SessionID)
 
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("会话已过期或已登出")
+	// 缓存未命中，从数据库查询
+	if !found || !session.IsActive || !session.ExpiresAt.After(time.Now()) {
+		var dbSession model.UserSession
+		result := s.db.Where("session_id = ? AND is_active = ? AND expires_at > ?",
+			claims.SessionID, true, time.Now()).First(&dbSession)
+
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return nil, errors.New("会话已过期或已登出")
+			}
+			return nil, result.Error
 		}
-		return nil, result.Error
+
+		// 将查询结果存入缓存
+		s.sessionCache.SetSession(&dbSession)
+		session = &dbSession
 	}
 
-	// 将查询结果存入缓存
-	s.sessionCache.SetSession(&dbSession)
+	if session.UserID != claims.UserID {
+		return nil, errors.New("无效的token")
+	}
+	s.touchSession(session)
 
 	return claims, nil
 }
@@ -0,0 +1,175 @@
+package dao
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/model"
+	"gorm.io/gorm"
+)
+
+// ldapAuthProvider 在 LDAP/AD 目录中验证密码，目录中的帐号首次登录时自动创建本地用户，
+// 之后每次登录按目录同步昵称、邮箱和角色。本地创建的同名帐号不受影响，仍由数据库验证
+type ldapAuthProvider struct {
+	db      *gorm.DB
+	cfg     config.LDAPConfig
+	timeout time.Duration
+}
+
+// NewLDAPAuthProvider 创建 LDAP 认证来源，配置已在 Validate 中检查
+func NewLDAPAuthProvider(db *gorm.DB, cfg config.LDAPConfig) AuthProvider {
+	timeout, err := cfg.TimeoutDuration()
+	if err != nil || timeout <= 0 {
+		timeout = config.DefaultLDAPTimeout
+	}
+	return &ldapAuthProvider{db: db, cfg: cfg.WithDefaults(), timeout: timeout}
+}
+
+func (p *ldapAuthProvider) Name() string {
+	return model.AuthProviderLDAP
+}
+
+func (p *ldapAuthProvider) Authenticate(username, password string) (*model.User, error) {
+	// 本地帐号不去目录中查找，目录不可用时也不影响本地帐号登录
+	user, err := p.localUser(username)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := p.verify(username, password)
+	if err != nil {
+		return user, err
+	}
+
+	// 以目录中的用户名为准，避免大小写不同的输入创建出多个用户
+	if canonical := entry.GetAttributeValue(p.cfg.UsernameAttribute); canonical != "" && canonical != username {
+		if user, err = p.localUser(canonical); err != nil {
+			// 目录中的用户名与本地帐号冲突，不能用目录密码登录本地帐号
+			if errors.Is(err, ErrAuthUserNotFound) {
+				return nil, ErrInvalidCredentials
+			}
+			return nil, err
+		}
+		username = canonical
+	}
+
+	role := p.role(entry)
+	if role == "" {
+		return user, errAuthNoRole
+	}
+	return p.syncUser(user, username, entry, role)
+}
+
+// localUser 查找本地用户，本地创建的帐号返回 ErrAuthUserNotFound，还没有登录过的返回 nil
+func (p *ldapAuthProvider) localUser(username string) (*model.User, error) {
+	var user model.User
+	if err := p.db.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if user.AuthProvider != model.AuthProviderLDAP {
+		return nil, ErrAuthUserNotFound
+	}
+	return &user, nil
+}
+
+// verify 用服务帐号查找用户，再用用户的 DN 和密码绑定
+func (p *ldapAuthProvider) verify(username, password string) (*ldap.Entry, error) {
+	// 密码为空时 LDAP 的绑定是匿名绑定，会直接成功
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP 服务帐号绑定失败: %w", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(p.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	attributes := []string{p.cfg.UsernameAttribute, p.cfg.NicknameAttribute, p.cfg.EmailAttribute, p.cfg.RoleAttribute}
+	request := ldap.NewSearchRequest(p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(p.timeout.Seconds()), false, filter, attributes, nil)
+	result, err := conn.Search(request)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP 查找用户失败: %w", err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrAuthUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("LDAP 中有多个用户匹配 %q，请检查 user_filter", username)
+	}
+
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP 用户绑定失败: %w", err)
+	}
+	return entry, nil
+}
+
+func (p *ldapAuthProvider) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(p.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("连接 LDAP 失败: %w", err)
+	}
+	conn.SetTimeout(p.timeout)
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS 失败: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// role 按角色属性的值映射角色，都不匹配时使用默认角色
+func (p *ldapAuthProvider) role(entry *ldap.Entry) string {
+	return mapRole(entry.GetAttributeValues(p.cfg.RoleAttribute), p.cfg.RoleMapping, p.cfg.DefaultRole)
+}
+
+// syncUser 首次登录时创建本地用户，之后同步目录中变化的昵称、邮箱和角色
+func (p *ldapAuthProvider) syncUser(user *model.User, username string, entry *ldap.Entry, role string) (*model.User, error) {
+	nickname := truncate(entry.GetAttributeValue(p.cfg.NicknameAttribute), 50)
+	email := truncate(entry.GetAttributeValue(p.cfg.EmailAttribute), 100)
+
+	if user == nil {
+		user = &model.User{
+			Username:     username,
+			Nickname:     nickname,
+			Email:        email,
+			Role:         role,
+			AuthProvider: model.AuthProviderLDAP,
+		}
+		if err := p.db.Create(user).Error; err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	if err := updateExternalUser(p.db, user, nickname, email, role); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,250 @@
+package dao
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// fakeLDAPEntry 测试目录中的一个帐号
+type fakeLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeLDAPServer 进程内的 LDAP 服务，只支持简单绑定和按 uid 查找，用来代替真实的目录
+type fakeLDAPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	entries  []fakeLDAPEntry
+}
+
+func newFakeLDAPServer(t *testing.T, entries ...fakeLDAPEntry) *fakeLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeLDAPServer{listener: listener, entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeLDAPServer) setAttribute(dn, name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if entry.dn == dn {
+			entry.attributes[name] = values
+		}
+	}
+}
+
+func (s *fakeLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := s.bind(op.Children[1].Value.(string), op.Children[2].Data.String())
+			conn.Write(ldapResult(messageID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			for _, entry := range s.search(filter) {
+				conn.Write(ldapEntry(messageID, entry).Bytes())
+			}
+			conn.Write(ldapResult(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func (s *fakeLDAPServer) bind(dn, password string) uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dn == "" || password == "" {
+		return ldap.LDAPResultSuccess
+	}
+	for _, entry := range s.entries {
+		if entry.dn == dn && entry.password == password {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+// search 按过滤器中的 (uid=xxx) 查找，不区分大小写
+func (s *fakeLDAPServer) search(filter string) []fakeLDAPEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []fakeLDAPEntry
+	for _, entry := range s.entries {
+		for _, uid := range entry.attributes["uid"] {
+			if strings.Contains(strings.ToLower(filter), "(uid="+strings.ToLower(uid)+")") {
+				found = append(found, entry)
+			}
+		}
+	}
+	return found
+}
+
+func ldapMessage(messageID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapResult(messageID int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return ldapMessage(messageID, op)
+}
+
+func ldapEntry(messageID int64, entry fakeLDAPEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return ldapMessage(messageID, op)
+}
+
+// 测试 LDAP 登录：首次登录自动创建用户，按组映射角色，本地帐号不受目录影响
+func TestAuthService_LDAPLogin(t *testing.T) {
+	const (
+		teachers = "cn=teachers,ou=groups,dc=school,dc=local"
+		admins   = "cn=admins,ou=groups,dc=school,dc=local"
+	)
+	server := newFakeLDAPServer(t,
+		fakeLDAPEntry{dn: "cn=reader,dc=school,dc=local", password: "reader-pass", attributes: map[string][]string{}},
+		fakeLDAPEntry{dn: "uid=alice,ou=people,dc=school,dc=local", password: "alice-pass", attributes: map[string][]string{
+			"uid": {"alice"}, "displayName": {"王老师"}, "mail": {"alice@school.local"}, "memberOf": {"CN=Teachers,OU=Groups,DC=school,DC=local"},
+		}},
+		fakeLDAPEntry{dn: "uid=bob,ou=people,dc=school,dc=local", password: "bob-pass", attributes: map[string][]string{
+			"uid": {"bob"}, "memberOf": {"cn=others,ou=groups,dc=school,dc=local"},
+		}},
+		fakeLDAPEntry{dn: "uid=admin,ou=people,dc=school,dc=local", password: "directory-pass", attributes: map[string][]string{
+			"uid": {"admin"}, "memberOf": {admins},
+		}},
+	)
+
+	db := testutils.SetupTestDB()
+	provider := NewLDAPAuthProvider(db, config.LDAPConfig{
+		Enabled:      true,
+		URL:          server.URL(),
+		BindDN:       "cn=reader,dc=school,dc=local",
+		BindPassword: "reader-pass",
+		BaseDN:       "ou=people,dc=school,dc=local",
+		RoleMapping:  map[string]string{teachers: model.RoleTeacher, admins: model.RoleAdmin},
+	})
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false, provider)
+	client := SessionClient{UserAgent: "test-agent", IP: "10.0.0.3"}
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("local-pass"), bcrypt.DefaultCost)
+	admin := model.User{Username: "admin", Password: string(hash), Email: "admin@example.com", Role: model.RoleAdmin}
+	assert.NoError(t, db.Create(&admin).Error)
+
+	// 首次登录自动创建用户，组名不区分大小写
+	response, err := authService.Login("alice", "alice-pass", client)
+	assert.NoError(t, err)
+	var alice model.User
+	assert.NoError(t, db.Where("username = ?", "alice").First(&alice).Error)
+	assert.Equal(t, model.AuthProviderLDAP, alice.AuthProvider)
+	assert.Equal(t, model.RoleTeacher, alice.Role)
+	assert.Equal(t, "王老师", alice.Nickname)
+	assert.Equal(t, "alice@school.local", alice.Email)
+	assert.Empty(t, alice.Password)
+	claims, err := authService.ValidateToken(response.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.ID, claims.UserID)
+
+	// 大小写不同的用户名登录同一个用户，角色按目录同步
+	server.setAttribute("uid=alice,ou=people,dc=school,dc=local", "memberOf", teachers, admins)
+	response, err = authService.Login("ALICE", "alice-pass", client)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, response.Role)
+	var count int64
+	db.Model(&model.User{}).Where("auth_provider = ?", model.AuthProviderLDAP).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	_, err = authService.Login("alice", "wrong", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	// 密码为空时不能匿名绑定成功
+	_, err = authService.Login("alice", "", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// 不属于任何映射的组，且没有默认角色
+	_, err = authService.Login("bob", "bob-pass", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.ErrorIs(t, db.Where("username = ?", "bob").First(&model.User{}).Error, gorm.ErrRecordNotFound)
+
+	// 本地帐号只能用本地密码登录
+	_, err = authService.Login("admin", "directory-pass", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.Login("admin", "local-pass", client)
+	assert.NoError(t, err)
+
+	_, err = authService.Login("nobody", "pass", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// 目录不可用时本地帐号仍然可以登录
+	server.listener.Close()
+	_, err = authService.Login("admin", "local-pass", client)
+	assert.NoError(t, err)
+	_, err = authService.Login("alice", "alice-pass", client)
+	assert.Error(t, err)
+
+	var failures []model.LoginFailure
+	assert.NoError(t, db.Order("id ASC").Find(&failures).Error)
+	reasons := make([]string, len(failures))
+	for i, failure := range failures {
+		reasons[i] = failure.Reason
+	}
+	assert.Equal(t, []string{
+		model.LoginFailureWrongPassword, model.LoginFailureWrongPassword, model.LoginFailureNoRole,
+		model.LoginFailureWrongPassword, model.LoginFailureUnknownUser,
+	}, reasons)
+	assert.Equal(t, alice.ID, failures[0].UserID)
+}
@@ -0,0 +1,244 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials 用户不存在和密码错误使用同一个错误，不暴露用户名是否存在
+var ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+// LoginLockedError 登录失败次数过多，需要等待 RetryAfter 后再试
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("登录尝试次数过多，请 %d 秒后再试", int(e.RetryAfter.Round(time.Second).Seconds()))
+}
+
+// loginLimit 登录失败限制：前 freeAttempts 次失败不限制，之后每次失败等待时间翻倍，
+// 连续失败 lockAfter 次后锁定 lockFor
+type loginLimit struct {
+	freeAttempts int
+	lockAfter    int
+	lockFor      time.Duration
+}
+
+var (
+	usernameLoginLimit = loginLimit{freeAttempts: 3, lockAfter: 10, lockFor: 15 * time.Minute}
+	// 一个机房的电脑常常共用一个出口 IP，按 IP 的限制要宽松得多
+	ipLoginLimit = loginLimit{freeAttempts: 30, lockAfter: 100, lockFor: 15 * time.Minute}
+)
+
+const (
+	// maxLoginBackoff 锁定之前单次等待时间的上限
+	maxLoginBackoff = 5 * time.Minute
+	// loginAttemptsTTL 这么久没有新的失败后，失败次数清零
+	loginAttemptsTTL = time.Hour
+)
+
+// fail 记录一次失败，返回新的失败记录
+func (l loginLimit) fail(attempts cache.LoginAttempts, now time.Time) cache.LoginAttempts {
+	attempts.Failures++
+	attempts.LastFailure = now
+	switch {
+	case attempts.Failures >= l.lockAfter:
+		attempts.LockedUntil = now.Add(l.lockFor)
+	case attempts.Failures > l.freeAttempts:
+		backoff := maxLoginBackoff
+		if shift := attempts.Failures - l.freeAttempts - 1; shift < 16 {
+			if d := time.Second << shift; d < backoff {
+				backoff = d
+			}
+		}
+		attempts.LockedUntil = now.Add(backoff)
+	}
+	return attempts
+}
+
+func usernameAttemptsKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipAttemptsKey(ip string) string {
+	return "ip:" + ip
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyPasswordHash 用户不存在时用来做一次同样耗时的密码校验
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("fun_code"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// loginRetryAfter 返回用户名或 IP 还要等待多久才能再次尝试登录
+func (s *AuthDaoImpl) loginRetryAfter(username, ip string, now time.Time) time.Duration {
+	var retryAfter time.Duration
+	for key := range loginLimits(username, ip) {
+		attempts, found := s.loginAttempts.GetAttempts(key)
+		if found && attempts.LockedUntil.After(now) {
+			if wait := attempts.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	return retryAfter
+}
+
+// loginLimits 返回需要检查的计数及其限制，用户名或 IP 为空的不计数
+func loginLimits(username, ip string) map[string]loginLimit {
+	limits := make(map[string]loginLimit, 2)
+	if username != "" {
+		limits[usernameAttemptsKey(username)] = usernameLoginLimit
+	}
+	if ip != "" {
+		limits[ipAttemptsKey(ip)] = ipLoginLimit
+	}
+	return limits
+}
+
+// loginBusyRetryAfter 同一用户名或 IP 还有尝试在校验中，需要等它的结果时的等待时间
+const loginBusyRetryAfter = time.Second
+
+// loginAttempt 一次正在校验密码的登录尝试，开始时已经占用了用户名和 IP 的一个名额，
+// 结束时调用 failed、succeeded 或 release 释放
+type loginAttempt struct {
+	s        *AuthDaoImpl
+	username string
+	client   SessionClient
+	limits   map[string]loginLimit
+	done     bool
+}
+
+// beginLoginAttempt 在锁内检查用户名和 IP 是否可以尝试登录并占用名额，不能尝试时返回需要等待的时间。
+// 校验中的尝试也计入次数：只有这些尝试全部失败也不超过免等待次数时才允许并发，
+// 否则一次只能校验一个，避免同时发出的请求在失败被记录之前都通过检查
+func (s *AuthDaoImpl) beginLoginAttempt(username string, client SessionClient) (*loginAttempt, time.Duration) {
+	now := time.Now()
+	limits := loginLimits(username, client.IP)
+
+	s.loginAttemptsMu.Lock()
+	defer s.loginAttemptsMu.Unlock()
+
+	if retryAfter := s.loginRetryAfter(username, client.IP, now); retryAfter > 0 {
+		return nil, retryAfter
+	}
+	for key, limit := range limits {
+		attempts, _ := s.loginAttempts.GetAttempts(key)
+		if pending := s.loginPending[key]; pending > 0 && attempts.Failures+pending >= limit.freeAttempts {
+			return nil, loginBusyRetryAfter
+		}
+	}
+
+	if s.loginPending == nil {
+		s.loginPending = make(map[string]int)
+	}
+	for key := range limits {
+		s.loginPending[key]++
+	}
+	return &loginAttempt{s: s, username: username, client: client, limits: limits}, 0
+}
+
+// finish 释放名额，failed 为 true 时计入失败次数，重复调用不生效
+func (a *loginAttempt) finish(failed bool) {
+	s := a.s
+	now := time.Now()
+	s.loginAttemptsMu.Lock()
+	defer s.loginAttemptsMu.Unlock()
+
+	if a.done {
+		return
+	}
+	a.done = true
+	for key, limit := range a.limits {
+		if s.loginPending[key]--; s.loginPending[key] <= 0 {
+			delete(s.loginPending, key)
+		}
+		if failed {
+			attempts, _ := s.loginAttempts.GetAttempts(key)
+			s.loginAttempts.SetAttempts(key, limit.fail(attempts, now), loginAttemptsTTL+limit.lockFor)
+		}
+	}
+}
+
+// failed 增加用户名和 IP 的失败次数，并写入失败记录
+func (a *loginAttempt) failed(userID uint, reason string) {
+	a.finish(true)
+	a.s.recordLoginFailure(a.username, userID, a.client, reason)
+}
+
+// succeeded 登录成功后清除用户名的失败次数；IP 的不清除，避免用自己的帐号登录来重置计数
+func (a *loginAttempt) succeeded() {
+	a.finish(false)
+	if a.username != "" {
+		a.s.loginAttempts.DeleteAttempts(usernameAttemptsKey(a.username))
+	}
+}
+
+// release 结束尝试但不计入失败次数，用于校验出错等情况，已经结束的不生效
+func (a *loginAttempt) release() {
+	a.finish(false)
+}
+
+// recordLoginFailure 写入一条登录失败记录，写入失败不影响登录结果
+func (s *AuthDaoImpl) recordLoginFailure(username string, userID uint, client SessionClient, reason string) {
+	s.db.Create(&model.LoginFailure{
+		Username:  truncate(username, 255),
+		UserID:    userID,
+		IP:        client.IP,
+		UserAgent: truncate(client.UserAgent, 512),
+		Reason:    reason,
+	})
+}
+
+// UnlockLogin 清除用户名和 IP 的登录失败次数，解除锁定，参数为空的不处理
+func (s *AuthDaoImpl) UnlockLogin(username, ip string) {
+	if username != "" {
+		s.loginAttempts.DeleteAttempts(usernameAttemptsKey(username))
+	}
+	if ip != "" {
+		s.loginAttempts.DeleteAttempts(ipAttemptsKey(ip))
+	}
+}
+
+// ListLoginFailures 按时间倒序列出登录失败记录，username 为空表示全部，beginID 不为 0 时只返回 ID 小于它的记录
+func (s *AuthDaoImpl) ListLoginFailures(username string, pageSize uint, beginID uint) ([]model.LoginFailure, bool, error) {
+	if pageSize == 0 {
+		pageSize = 20
+	}
+
+	query := s.db.Model(&model.LoginFailure{})
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if beginID > 0 {
+		query = query.Where("id < ?", beginID)
+	}
+
+	var failures []model.LoginFailure
+	if err := query.Order("id DESC").Limit(int(pageSize + 1)).Find(&failures).Error; err != nil {
+		return nil, false, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_AUTH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	hasMore := len(failures) > int(pageSize)
+	if hasMore {
+		failures = failures[:pageSize]
+	}
+	return failures, hasMore, nil
+}
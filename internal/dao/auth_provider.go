@@ -0,0 +1,121 @@
+package dao
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jun/fun_code/internal/model"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrAuthUserNotFound 认证来源中没有这个用户，继续尝试下一个认证来源
+var ErrAuthUserNotFound = errors.New("认证来源中没有这个用户")
+
+// errAuthNoRole 目录帐号不属于任何允许登录的组，对外和密码错误一样返回 ErrInvalidCredentials
+var errAuthNoRole = errors.New("帐号没有允许登录的角色")
+
+// AuthProvider 用户名密码的认证来源，Login 按顺序尝试，直到某个认证来源认识这个用户
+type AuthProvider interface {
+	// Name 认证来源名称，与 model.User.AuthProvider 对应，本地帐号为空
+	Name() string
+	// Authenticate 验证用户名和密码，成功时返回对应的本地用户。
+	// 不认识这个用户时返回 ErrAuthUserNotFound；密码错误时返回 ErrInvalidCredentials，
+	// 此时 user 不为空表示用户存在，用于记录失败
+	Authenticate(username, password string) (*model.User, error)
+}
+
+// dbAuthProvider 使用数据库中的 bcrypt 密码验证，演示模式下所有用户使用同一个密码
+type dbAuthProvider struct {
+	db     *gorm.DB
+	isDemo bool
+}
+
+func (p *dbAuthProvider) Name() string {
+	return ""
+}
+
+func (p *dbAuthProvider) Authenticate(username, password string) (*model.User, error) {
+	var user model.User
+	if err := p.db.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAuthUserNotFound
+		}
+		return nil, err
+	}
+
+	if p.isDemo {
+		if password != "demo123456" {
+			return &user, ErrInvalidCredentials
+		}
+		return &user, nil
+	}
+	// 外部目录中的帐号没有本地密码，哈希为空时校验一定失败
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return &user, ErrInvalidCredentials
+	}
+	return &user, nil
+}
+
+// authenticate 按顺序尝试各个认证来源，返回通过验证的用户
+// 所有认证来源都不认识这个用户时返回 ErrAuthUserNotFound
+func (s *AuthDaoImpl) authenticate(username, password string) (*model.User, error) {
+	for _, provider := range s.providers {
+		user, err := provider.Authenticate(username, password)
+		if errors.Is(err, ErrAuthUserNotFound) {
+			continue
+		}
+		return user, err
+	}
+	return nil, ErrAuthUserNotFound
+}
+
+// roleRank 角色映射匹配多个时取权限最高的
+var roleRank = map[string]int{
+	model.RoleStudent: 1,
+	model.RoleTeacher: 2,
+	model.RoleAdmin:   3,
+}
+
+// mapRole 按外部帐号的组或角色映射本地角色，不区分大小写，匹配多个时取权限最高的，
+// 都不匹配时返回 defaultRole
+func mapRole(values []string, mapping map[string]string, defaultRole string) string {
+	role := ""
+	for _, value := range values {
+		for key, mapped := range mapping {
+			if strings.EqualFold(strings.TrimSpace(key), strings.TrimSpace(value)) && roleRank[mapped] > roleRank[role] {
+				role = mapped
+			}
+		}
+	}
+	if role == "" {
+		role = defaultRole
+	}
+	return role
+}
+
+// updateExternalUser 外部帐号每次登录时同步变化的昵称、邮箱和角色，外部没有提供昵称时保留本地的
+func updateExternalUser(db *gorm.DB, user *model.User, nickname, email, role string) error {
+	updates := map[string]interface{}{}
+	if nickname != "" && nickname != user.Nickname {
+		updates["nickname"] = nickname
+	}
+	if email != user.Email {
+		updates["email"] = email
+	}
+	if role != user.Role {
+		updates["role"] = role
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return db.Model(user).Updates(updates).Error
+}
+
+// authUserID 认证失败时用户可能为空
+func authUserID(user *model.User) uint {
+	if user == nil {
+		return 0
+	}
+	return user.ID
+}
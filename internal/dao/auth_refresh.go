@@ -0,0 +1,208 @@
+package dao
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jun/fun_code/internal/model"
+	"gorm.io/gorm"
+)
+
+// RefreshTokenCookieName 保存刷新令牌的 cookie 名称
+const RefreshTokenCookieName = "refresh_token"
+
+// refreshTokenReuseGrace 同一个页面同时发出的多个请求会带着同一个刷新令牌续期，
+// 令牌换发后这么短的时间内再次使用不算盗用，只发新的访问令牌
+const refreshTokenReuseGrace = 30 * time.Second
+
+var (
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用过，该登录已被注销")
+)
+
+// hashRefreshToken 数据库中只保存刷新令牌的哈希
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken 生成随机的刷新令牌
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// sessionExpiry 会话有效期从 now 起顺延 refreshTTL，但不超过登录后的 maxAge
+func (s *AuthDaoImpl) sessionExpiry(session *model.UserSession, now time.Time) time.Time {
+	expiresAt := now.Add(s.refreshTTL)
+	if limit := session.CreatedAt.Add(s.maxAge); expiresAt.After(limit) {
+		return limit
+	}
+	return expiresAt
+}
+
+// generateRefreshCookie 保存刷新令牌的 cookie，和会话同时过期
+func (s *AuthDaoImpl) generateRefreshCookie(token string, expiresAt time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     RefreshTokenCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+	}
+}
+
+// issueTokens 为会话签发访问令牌，withRefresh 为 true 时同时换发新的刷新令牌
+func (s *AuthDaoImpl) issueTokens(session *model.UserSession, user *model.User, withRefresh bool, now time.Time) (*LoginResponse, error) {
+	expiresAt := now.Add(s.accessTTL)
+	if expiresAt.After(session.ExpiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+	claims := Claims{
+		UserID:             session.UserID,
+		SessionID:          session.SessionID,
+		MustChangePassword: user.MustChangePassword,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "fun_code",
+		},
+	}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.jwtKey)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &LoginResponse{
+		Token:              tokenString,
+		Cookie:             s.GenerateCookie(tokenString),
+		Role:               user.Role,
+		SessionID:          session.SessionID,
+		ExpiresIn:          int(expiresAt.Sub(now).Seconds()),
+		MustChangePassword: user.MustChangePassword,
+	}
+	if !withRefresh {
+		return response, nil
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Create(&model.RefreshToken{
+		UserID:    session.UserID,
+		SessionID: session.SessionID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	response.RefreshToken = refreshToken
+	response.RefreshCookie = s.generateRefreshCookie(refreshToken, session.ExpiresAt)
+	return response, nil
+}
+
+// Refresh 用刷新令牌换发新的访问令牌和刷新令牌，并顺延会话有效期。
+// 已经换发过的刷新令牌超过宽限期后再次使用，说明令牌可能被盗用，注销整个会话
+func (s *AuthDaoImpl) Refresh(refreshToken string) (*LoginResponse, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	now := time.Now()
+
+	var token model.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashRefreshToken(refreshToken)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if token.RevokedAt != nil || !token.ExpiresAt.After(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var session model.UserSession
+	if err := s.db.Where("session_id = ? AND is_active = ? AND expires_at > ?", token.SessionID, true, now).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	var user model.User
+	if err := s.db.Select("id", "role", "must_change_password").Where("id = ?", session.UserID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	// 条件更新保证同一个刷新令牌只能换发一次
+	if token.UsedAt == nil {
+		result := s.db.Model(&model.RefreshToken{}).Where("id = ? AND used_at IS NULL", token.ID).Update("used_at", now)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := s.db.First(&token, token.ID).Error; err != nil {
+				return nil, err
+			}
+		} else {
+			session.ExpiresAt = s.sessionExpiry(&session, now)
+			session.LastSeenAt = now
+			err := s.db.Model(&model.UserSession{}).Where("id = ?", session.ID).
+				Updates(map[string]interface{}{"expires_at": session.ExpiresAt, "last_seen_at": now}).Error
+			if err != nil {
+				return nil, err
+			}
+			s.sessionCache.SetSession(&session)
+			return s.issueTokens(&session, &user, true, now)
+		}
+	}
+
+	if token.UsedAt != nil && now.Sub(*token.UsedAt) <= refreshTokenReuseGrace {
+		return s.issueTokens(&session, &user, false, now)
+	}
+	if err := s.revokeTokenFamily(token.SessionID, now); err != nil {
+		return nil, err
+	}
+	return nil, ErrRefreshTokenReused
+}
+
+// RevokeRefreshToken 注销刷新令牌所属的会话，用于访问令牌已过期时退出登录
+func (s *AuthDaoImpl) RevokeRefreshToken(refreshToken string) error {
+	var token model.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashRefreshToken(refreshToken)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return s.revokeTokenFamily(token.SessionID, time.Now())
+}
+
+// revokeTokenFamily 注销会话及其所有刷新令牌
+func (s *AuthDaoImpl) revokeTokenFamily(sessionID string, now time.Time) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.UserSession{}).Where("session_id = ?", sessionID).Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.RefreshToken{}).Where("session_id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.sessionCache.DeleteSession(sessionID)
+	return nil
+}
@@ -0,0 +1,136 @@
+package dao
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// sessionTouchInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+const sessionTouchInterval = 5 * time.Minute
+
+// touchSession 更新会话的最近使用时间
+func (s *AuthDaoImpl) touchSession(session *model.UserSession) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return
+	}
+	if err := s.db.Model(&model.UserSession{}).Where("id = ?", session.ID).UpdateColumn("last_seen_at", now).Error; err != nil {
+		return
+	}
+	// 缓存中的会话可能正被其他请求读取，换成新的副本
+	touched := *session
+	touched.LastSeenAt = now
+	s.sessionCache.SetSession(&touched)
+}
+
+// ListSessions 列出用户所有未过期的登录会话，最近使用的在前
+func (s *AuthDaoImpl) ListSessions(userID uint) ([]model.UserSession, error) {
+	var sessions []model.UserSession
+	err := s.db.Where("user_id = ? AND is_active = ? AND expires_at > ?", userID, true, time.Now()).
+		Order("last_seen_at DESC, id DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_AUTH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession 注销用户的一个会话，id 为会话记录ID
+func (s *AuthDaoImpl) RevokeSession(userID uint, id uint) error {
+	var session model.UserSession
+	if err := s.db.Where("id = ? AND user_id = ? AND is_active = ?", id, userID, true).First(&session).Error; err != nil {
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_AUTH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+	if err := s.db.Model(&session).Update("is_active", false).Error; err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_AUTH, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+	s.sessionCache.DeleteSession(session.SessionID)
+	return nil
+}
+
+// RevokeUserSessions 注销多个用户的全部会话，返回注销的会话数
+func (s *AuthDaoImpl) RevokeUserSessions(userIDs []uint) (int64, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+
+	var sessionIDs []string
+	err := s.db.Model(&model.UserSession{}).Where("user_id IN ? AND is_active = ?", userIDs, true).Pluck("session_id", &sessionIDs).Error
+	if err != nil {
+		return 0, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_AUTH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	result := s.db.Model(&model.UserSession{}).Where("user_id IN ? AND is_active = ?", userIDs, true).Update("is_active", false)
+	if result.Error != nil {
+		return 0, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_AUTH, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, result.Error)
+	}
+	for _, sessionID := range sessionIDs {
+		s.sessionCache.DeleteSession(sessionID)
+	}
+	return result.RowsAffected, nil
+}
+
+// describeDevice 从 User-Agent 识别出简短的设备描述，如 "iPad · Safari"
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return ""
+	}
+
+	var system string
+	switch {
+	case strings.Contains(ua, "ipad"):
+		system = "iPad"
+	case strings.Contains(ua, "iphone"):
+		system = "iPhone"
+	case strings.Contains(ua, "android"):
+		system = "Android"
+	case strings.Contains(ua, "cros "):
+		system = "ChromeOS"
+	case strings.Contains(ua, "windows"):
+		system = "Windows"
+	case strings.Contains(ua, "mac os"):
+		system = "Mac"
+	case strings.Contains(ua, "linux"):
+		system = "Linux"
+	}
+
+	// Edge 和 Chrome 的 UA 都带 Chrome，Chrome 的 UA 又带 Safari，按顺序判断
+	var browser string
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+
+	switch {
+	case system != "" && browser != "":
+		return system + " · " + browser
+	case system != "":
+		return system
+	case browser != "":
+		return browser
+	}
+	return truncate(userAgent, 100)
+}
+
+// truncate 把字符串截断到最多 n 个字节，不截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
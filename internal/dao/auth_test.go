@@ -1,11 +1,16 @@
 package dao
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/config"
 	"github.com/jun/fun_code/internal/model"
 
 	"github.com/jun/fun_code/internal/dao/testutils"
@@ -20,7 +25,7 @@ func TestAuth(t *testing.T) {
 	jwtKey := []byte("test_key")
 	c := cache.NewGoCache()
 	sessionCache := cache.NewUserSessionCache(c)
-	authService := NewAuthDao(db, jwtKey, sessionCache, false)
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: string(jwtKey)}, sessionCache, cache.NewLoginAttemptCache(c), false)
 
 	tests := []struct {
 		name     string
@@ -74,7 +79,7 @@ func TestAuthService_Login(t *testing.T) {
 	jwtKey := []byte("test_key")
 	c := cache.NewGoCache()
 	sessionCache := cache.NewUserSessionCache(c)
-	authService := NewAuthDao(db, jwtKey, sessionCache, false)
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: string(jwtKey)}, sessionCache, cache.NewLoginAttemptCache(c), false)
 
 	// 创建测试用户
 	password := "password123"
@@ -118,7 +123,7 @@ func TestAuthService_Login(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			loginResponse, err := authService.Login(tt.username, tt.password)
+			loginResponse, err := authService.Login(tt.username, tt.password, SessionClient{})
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Empty(t, loginResponse)
@@ -133,7 +138,7 @@ func TestAuthService_Login(t *testing.T) {
 				assert.True(t, loginResponse.Cookie.HttpOnly)
 				assert.True(t, loginResponse.Cookie.Secure)
 				assert.Equal(t, http.SameSiteStrictMode, loginResponse.Cookie.SameSite)
-				assert.Equal(t, 86400, loginResponse.Cookie.MaxAge)
+				assert.Equal(t, int(config.DefaultAccessTokenTTL.Seconds()), loginResponse.Cookie.MaxAge)
 
 				// 验证 token
 				claims := &Claims{}
@@ -155,7 +160,7 @@ func TestAuthService_GenerateCookie(t *testing.T) {
 	jwtKey := []byte("test_key")
 	c := cache.NewGoCache()
 	sessionCache := cache.NewUserSessionCache(c)
-	authService := NewAuthDao(db, jwtKey, sessionCache, false)
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: string(jwtKey)}, sessionCache, cache.NewLoginAttemptCache(c), false)
 
 	token := "test.token.string"
 	cookie := authService.GenerateCookie(token)
@@ -166,7 +171,7 @@ func TestAuthService_GenerateCookie(t *testing.T) {
 	assert.True(t, cookie.HttpOnly)
 	assert.True(t, cookie.Secure)
 	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
-	assert.Equal(t, 86400, cookie.MaxAge)
+	assert.Equal(t, int(config.DefaultAccessTokenTTL.Seconds()), cookie.MaxAge)
 }
 
 func TestAuthService_ValidateToken(t *testing.T) {
@@ -174,7 +179,7 @@ func TestAuthService_ValidateToken(t *testing.T) {
 	jwtKey := []byte("test_key")
 	c := cache.NewGoCache()
 	sessionCache := cache.NewUserSessionCache(c)
-	authService := NewAuthDao(db, jwtKey, sessionCache, false)
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: string(jwtKey)}, sessionCache, cache.NewLoginAttemptCache(c), false)
 
 	// 创建测试用户
 	user := model.User{
@@ -198,7 +203,8 @@ func TestAuthService_ValidateToken(t *testing.T) {
 
 	// 创建一个有效的 token
 	claims := Claims{
-		UserID: 1,
+		UserID:    1,
+		SessionID: "test-session-id",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -212,7 +218,8 @@ func TestAuthService_ValidateToken(t *testing.T) {
 
 	// 创建一个过期的 token
 	expiredClaims := Claims{
-		UserID: 1,
+		UserID:    1,
+		SessionID: "test-session-id",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-48 * time.Hour)),
@@ -260,3 +267,396 @@ func TestAuthService_ValidateToken(t *testing.T) {
 		})
 	}
 }
+
+// 测试同一用户在多台设备上登录，以及注销单个会话和全部会话
+func TestAuthService_MultipleSessions(t *testing.T) {
+	db := testutils.SetupTestDB()
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	user := model.User{Username: "student", Password: string(hashedPassword), Email: "student@example.com"}
+	assert.NoError(t, db.Create(&user).Error)
+
+	labPC, err := authService.Login("student", "password123", SessionClient{
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36",
+		IP:        "10.0.0.2",
+	})
+	assert.NoError(t, err)
+	tablet, err := authService.Login("student", "password123", SessionClient{
+		UserAgent: "Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+		IP:        "10.0.0.3",
+	})
+	assert.NoError(t, err)
+	assert.NotEqual(t, labPC.SessionID, tablet.SessionID)
+
+	// 第二次登录不会让第一台设备掉线
+	for _, token := range []string{labPC.Token, tablet.Token} {
+		claims, err := authService.ValidateToken(token)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+	}
+
+	sessions, err := authService.ListSessions(user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	devices := map[string]string{}
+	for _, session := range sessions {
+		devices[session.SessionID] = session.Device
+	}
+	assert.Equal(t, "Windows · Chrome", devices[labPC.SessionID])
+	assert.Equal(t, "iPad · Safari", devices[tablet.SessionID])
+
+	// 注销实验室电脑上的会话，平板不受影响
+	var labSession model.UserSession
+	assert.NoError(t, db.Where("session_id = ?", labPC.SessionID).First(&labSession).Error)
+	assert.Error(t, authService.RevokeSession(user.ID+1, labSession.ID))
+	assert.NoError(t, authService.RevokeSession(user.ID, labSession.ID))
+	_, err = authService.ValidateToken(labPC.Token)
+	assert.Error(t, err)
+	_, err = authService.ValidateToken(tablet.Token)
+	assert.NoError(t, err)
+
+	// 全部注销
+	revoked, err := authService.RevokeUserSessions([]uint{user.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	_, err = authService.ValidateToken(tablet.Token)
+	assert.Error(t, err)
+
+	sessions, err = authService.ListSessions(user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+// 测试刷新令牌换发、会话顺延和重复使用检测
+func TestAuthService_Refresh(t *testing.T) {
+	db := testutils.SetupTestDB()
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key", AccessTokenTTL: "1m", RefreshTokenTTL: "1h"},
+		cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	user := model.User{Username: "student", Password: string(hashedPassword), Email: "student@example.com", Role: "student"}
+	assert.NoError(t, db.Create(&user).Error)
+
+	login, err := authService.Login("student", "password123", SessionClient{})
+	assert.NoError(t, err)
+	assert.Equal(t, 60, login.ExpiresIn)
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Equal(t, RefreshTokenCookieName, login.RefreshCookie.Name)
+
+	// 把会话有效期改短，续期后应当顺延
+	assert.NoError(t, db.Model(&model.UserSession{}).Where("session_id = ?", login.SessionID).
+		Update("expires_at", time.Now().Add(time.Minute)).Error)
+
+	refreshed, err := authService.Refresh(login.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "student", refreshed.Role)
+	assert.Equal(t, login.SessionID, refreshed.SessionID)
+	assert.NotEmpty(t, refreshed.RefreshToken)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+	claims, err := authService.ValidateToken(refreshed.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UserID)
+
+	var session model.UserSession
+	assert.NoError(t, db.Where("session_id = ?", login.SessionID).First(&session).Error)
+	assert.True(t, session.ExpiresAt.After(time.Now().Add(50*time.Minute)))
+
+	// 宽限期内重复使用旧令牌，只发新的访问令牌
+	again, err := authService.Refresh(login.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, again.Token)
+	assert.Empty(t, again.RefreshToken)
+
+	// 超过宽限期后再次使用旧令牌，整个会话被注销
+	assert.NoError(t, db.Model(&model.RefreshToken{}).Where("token_hash = ?", hashRefreshToken(login.RefreshToken)).
+		Update("used_at", time.Now().Add(-time.Minute)).Error)
+	_, err = authService.Refresh(login.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = authService.Refresh(refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = authService.ValidateToken(refreshed.Token)
+	assert.Error(t, err)
+
+	_, err = authService.Refresh("unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+// 测试登录失败的统一错误、逐次延长等待、锁定和解除锁定
+func TestAuthService_LoginLockout(t *testing.T) {
+	db := testutils.SetupTestDB()
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	user := model.User{Username: "student", Password: string(hashedPassword), Email: "student@example.com"}
+	assert.NoError(t, db.Create(&user).Error)
+
+	client := SessionClient{UserAgent: "test-agent", IP: "10.0.0.2"}
+
+	// 用户不存在和密码错误返回同样的错误
+	_, errUnknown := authService.Login("nobody", "password123", client)
+	_, errWrong := authService.Login("student", "wrong", client)
+	assert.ErrorIs(t, errUnknown, ErrInvalidCredentials)
+	assert.ErrorIs(t, errWrong, ErrInvalidCredentials)
+	assert.Equal(t, errUnknown.Error(), errWrong.Error())
+
+	// 前几次失败不限制，之后需要等待
+	_, err = authService.Login("student", "wrong", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.Login("student", "wrong", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.Login("student", "wrong", client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// 等待期间即使密码正确也拒绝，用户名不区分大小写
+	_, err = authService.Login("Student", "password123", client)
+	var locked *LoginLockedError
+	if assert.ErrorAs(t, err, &locked) {
+		assert.Greater(t, locked.RetryAfter, time.Duration(0))
+		assert.LessOrEqual(t, locked.RetryAfter, time.Second)
+	}
+
+	// 同一机房的其他同学不受影响
+	other := model.User{Username: "classmate", Password: string(hashedPassword), Email: "classmate@example.com"}
+	assert.NoError(t, db.Create(&other).Error)
+	_, err = authService.Login("classmate", "password123", client)
+	assert.NoError(t, err)
+
+	// 失败次数达到上限后锁定
+	impl := authService.(*AuthDaoImpl)
+	for i := 0; i < usernameLoginLimit.lockAfter; i++ {
+		attempts, _ := impl.loginAttempts.GetAttempts(usernameAttemptsKey("student"))
+		impl.loginAttempts.SetAttempts(usernameAttemptsKey("student"), usernameLoginLimit.fail(attempts, time.Now()), time.Hour)
+	}
+	retryAfter := impl.loginRetryAfter("student", "", time.Now())
+	assert.Greater(t, retryAfter, maxLoginBackoff)
+	assert.LessOrEqual(t, retryAfter, usernameLoginLimit.lockFor)
+
+	// 管理员解除锁定后可以立即登录
+	authService.UnlockLogin("student", "")
+	_, err = authService.Login("student", "password123", client)
+	assert.NoError(t, err)
+
+	// 失败记录按时间倒序，可按用户名筛选和翻页
+	failures, hasMore, err := authService.ListLoginFailures("student", 3, 0)
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Len(t, failures, 3)
+	assert.Greater(t, failures[0].ID, failures[1].ID)
+	assert.Equal(t, "10.0.0.2", failures[0].IP)
+
+	failures, _, err = authService.ListLoginFailures("nobody", 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, model.LoginFailureUnknownUser, failures[0].Reason)
+		assert.Equal(t, uint(0), failures[0].UserID)
+	}
+
+	var lockedCount int64
+	assert.NoError(t, db.Model(&model.LoginFailure{}).Where("reason = ?", model.LoginFailureLocked).Count(&lockedCount).Error)
+	assert.Equal(t, int64(1), lockedCount)
+}
+
+// 并发的错误密码不能绕过等待和锁定
+func TestAuthService_LoginLockoutConcurrent(t *testing.T) {
+	db := testutils.SetupTestDB()
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	user := model.User{Username: "student", Password: string(hashedPassword), Email: "student@example.com"}
+	assert.NoError(t, db.Create(&user).Error)
+
+	client := SessionClient{UserAgent: "test-agent", IP: "10.0.0.3"}
+
+	const guesses = 50
+	var checked, locked atomic.Int32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, err := authService.Login("student", fmt.Sprintf("guess%d", i), client)
+			var lockedErr *LoginLockedError
+			if errors.As(err, &lockedErr) {
+				locked.Add(1)
+			} else {
+				checked.Add(1)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// 只有免等待次数内的尝试可以同时校验，之后的要等前面的失败被记录，再按等待时间拒绝
+	assert.Greater(t, checked.Load(), int32(0))
+	assert.LessOrEqual(t, int(checked.Load()), usernameLoginLimit.freeAttempts+1)
+	assert.Equal(t, int32(guesses), checked.Load()+locked.Load())
+
+	// 尝试结束后释放名额，失败次数与校验过的尝试一致
+	impl := authService.(*AuthDaoImpl)
+	assert.Empty(t, impl.loginPending)
+	attempts, _ := impl.loginAttempts.GetAttempts(usernameAttemptsKey("student"))
+	assert.Equal(t, int(checked.Load()), attempts.Failures)
+}
+
+// 测试图片密码和二维码登录卡登录
+func TestAuthService_PictureAndBadgeLogin(t *testing.T) {
+	db := testutils.SetupTestDB()
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+	classDao := NewClassDao(db)
+
+	teacher := model.User{Username: "teacher", Password: "x", Email: "teacher@example.com", Role: model.RoleTeacher}
+	assert.NoError(t, db.Create(&teacher).Error)
+	student := model.User{Username: "kid", Nickname: "小明", Password: "x", Email: "kid@example.com", Role: model.RoleStudent}
+	assert.NoError(t, db.Create(&student).Error)
+	class, err := classDao.CreateClass(teacher.ID, "一年级", "", "2024-09-01", "2025-07-01")
+	assert.NoError(t, err)
+	assert.NoError(t, classDao.AddStudent(class.ID, teacher.ID, student.ID, "student"))
+
+	// 未开启图片登录
+	_, _, err = authService.GetPictureLoginClass(class.Code)
+	assert.ErrorIs(t, err, ErrPictureLoginDisabled)
+	assert.NoError(t, classDao.UpdateClass(class.ID, teacher.ID, map[string]interface{}{"picture_login": true}))
+
+	// 只有班级老师可以生成登录卡
+	_, err = classDao.ResetStudentLogins(class.ID, teacher.ID+100, nil, true, true)
+	assert.Error(t, err)
+	cards, err := classDao.ResetStudentLogins(class.ID, teacher.ID, nil, true, true)
+	assert.NoError(t, err)
+	if !assert.Len(t, cards, 1) {
+		return
+	}
+	assert.Equal(t, student.ID, cards[0].User.ID)
+	assert.Len(t, cards[0].Picture, PicturePasswordLength)
+	assert.NotEmpty(t, cards[0].BadgeToken)
+
+	_, students, err := authService.GetPictureLoginClass(class.Code)
+	assert.NoError(t, err)
+	if assert.Len(t, students, 1) {
+		assert.Equal(t, "小明", students[0].Nickname)
+		assert.Empty(t, students[0].Username)
+	}
+
+	client := SessionClient{UserAgent: "test-agent", IP: "10.0.0.2"}
+
+	// 图片的选择顺序不影响登录
+	picture := cards[0].Picture
+	reversed := []int{picture[2], picture[1], picture[0]}
+	response, err := authService.PictureLogin(class.Code, student.ID, reversed, client)
+	assert.NoError(t, err)
+	claims, err := authService.ValidateToken(response.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, student.ID, claims.UserID)
+	assert.Equal(t, model.RoleStudent, response.Role)
+
+	wrong := []int{}
+	for icon := range PictureLoginIcons {
+		if len(wrong) < PicturePasswordLength && icon != picture[0] && icon != picture[1] && icon != picture[2] {
+			wrong = append(wrong, icon)
+		}
+	}
+	_, err = authService.PictureLogin(class.Code, student.ID, wrong, client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.PictureLogin(class.Code, student.ID, []int{picture[0], picture[0], picture[1]}, client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.PictureLogin(class.Code, teacher.ID, picture, client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// 登录卡
+	response, err = authService.BadgeLogin(cards[0].BadgeToken, client)
+	assert.NoError(t, err)
+	claims, err = authService.ValidateToken(response.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, student.ID, claims.UserID)
+
+	// 只重新生成登录卡，旧卡失效，图片密码不变
+	newCards, err := classDao.ResetStudentLogins(class.ID, teacher.ID, []uint{student.ID}, false, true)
+	assert.NoError(t, err)
+	assert.Empty(t, newCards[0].Picture)
+	_, err = authService.BadgeLogin(cards[0].BadgeToken, client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = authService.BadgeLogin(newCards[0].BadgeToken, client)
+	assert.NoError(t, err)
+	_, err = authService.PictureLogin(class.Code, student.ID, picture, client)
+	assert.NoError(t, err)
+
+	// 关闭图片登录后都不能使用
+	assert.NoError(t, classDao.UpdateClass(class.ID, teacher.ID, map[string]interface{}{"picture_login": false}))
+	_, err = authService.PictureLogin(class.Code, student.ID, picture, client)
+	assert.ErrorIs(t, err, ErrPictureLoginDisabled)
+	_, err = authService.BadgeLogin(newCards[0].BadgeToken, client)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	var reasons []string
+	assert.NoError(t, db.Model(&model.LoginFailure{}).Order("id ASC").Pluck("reason", &reasons).Error)
+	assert.Equal(t, []string{
+		model.LoginFailureWrongPicture, model.LoginFailureWrongPicture, model.LoginFailureUnknownUser,
+		model.LoginFailureInvalidBadge, model.LoginFailureInvalidBadge,
+	}, reasons)
+}
+
+// 同时提交所有图片密码组合不能在锁定之前猜中
+func TestAuthService_PictureLoginConcurrent(t *testing.T) {
+	db := testutils.SetupTestDB()
+	authService := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+	classDao := NewClassDao(db)
+
+	teacher := model.User{Username: "teacher", Password: "x", Email: "teacher@example.com", Role: model.RoleTeacher}
+	assert.NoError(t, db.Create(&teacher).Error)
+	student := model.User{Username: "kid", Password: "x", Email: "kid@example.com", Role: model.RoleStudent}
+	assert.NoError(t, db.Create(&student).Error)
+	class, err := classDao.CreateClass(teacher.ID, "一年级", "", "2024-09-01", "2025-07-01")
+	assert.NoError(t, err)
+	assert.NoError(t, classDao.AddStudent(class.ID, teacher.ID, student.ID, "student"))
+	assert.NoError(t, classDao.UpdateClass(class.ID, teacher.ID, map[string]interface{}{"picture_login": true}))
+	_, err = classDao.ResetStudentLogins(class.ID, teacher.ID, nil, true, false)
+	assert.NoError(t, err)
+
+	var pictures [][]int
+	for a := range PictureLoginIcons {
+		for b := a + 1; b < len(PictureLoginIcons); b++ {
+			for c := b + 1; c < len(PictureLoginIcons); c++ {
+				pictures = append(pictures, []int{a, b, c})
+			}
+		}
+	}
+	assert.Len(t, pictures, 84)
+
+	client := SessionClient{UserAgent: "test-agent", IP: "10.0.0.4"}
+	var succeeded, wrong, locked atomic.Int32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, picture := range pictures {
+		wg.Add(1)
+		go func(picture []int) {
+			defer wg.Done()
+			<-start
+			_, err := authService.PictureLogin(class.Code, student.ID, picture, client)
+			var lockedErr *LoginLockedError
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.As(err, &lockedErr):
+				locked.Add(1)
+			default:
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				wrong.Add(1)
+			}
+		}(picture)
+	}
+	close(start)
+	wg.Wait()
+
+	// 只有免等待次数内的组合被校验，其余的都被拒绝
+	checked := int(succeeded.Load() + wrong.Load())
+	assert.Greater(t, checked, 0)
+	assert.LessOrEqual(t, checked, usernameLoginLimit.freeAttempts+1)
+	assert.Equal(t, len(pictures)-checked, int(locked.Load()))
+	assert.Empty(t, authService.(*AuthDaoImpl).loginPending)
+}
@@ -332,7 +332,7 @@ func (s *ClassDaoImpl) RemoveStudent(classID, teacherID, studentID uint) error {
 	return result.Error
 }
 
-// ListStudents 列出班级中的所有学生
+// ListStudents 列出班级中的所有学生，不含待审核的申请和助教
 func (s *ClassDaoImpl) ListStudents(classID, teacherID uint) ([]model.User, error) {
 	// 检查班级是否存在且属于该教师
 	var class model.Class
@@ -343,9 +343,9 @@ func (s *ClassDaoImpl) ListStudents(classID, teacherID uint) ([]model.User, erro
 		return nil, err
 	}
 
-	// 获取班级中的所有学生
+	// 获取班级中的所有学生，Students 关联不检查成员状态和角色
 	var students []model.User
-	if err := s.db.Model(&class).Association("Students").Find(&students); err != nil {
+	if err := classStudents(s.db, class.ID, nil).Order("users.id ASC").Find(&students).Error; err != nil {
 		return nil, err
 	}
 
@@ -469,15 +469,34 @@ func (s *ClassDaoImpl) ListCoursesByClass(classID uint) ([]model.Course, error)
 	return courses, nil
 }
 
-// JoinClass 学生加入班级
-func (s *ClassDaoImpl) JoinClass(studentID uint, classCode string) error {
+// 学生通过邀请码加入班级时可能返回的错误
+var (
+	ErrClassCodeInvalid = errors.New("班级不存在或邀请码无效")
+	ErrClassCodeExpired = errors.New("邀请码已过期，请联系老师获取新的邀请码")
+	ErrClassFull        = errors.New("班级人数已满")
+	ErrAlreadyInClass   = errors.New("您已经在班级中")
+)
+
+// JoinClass 学生通过邀请码加入班级
+// 班级开启审核时，学生进入待审核状态，老师通过后才成为正式成员
+func (s *ClassDaoImpl) JoinClass(studentID uint, classCode string) (*model.ClassUser, error) {
 	// 查找班级
 	var class model.Class
 	if err := s.db.Where("code = ? AND is_active = ?", classCode, true).First(&class).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("班级不存在或邀请码无效")
+			return nil, ErrClassCodeInvalid
 		}
-		return err
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if class.CodeExpiresAt > 0 && now > class.CodeExpiresAt {
+		return nil, ErrClassCodeExpired
+	}
+
+	status := model.ClassUserStatusActive
+	if class.RequireApproval {
+		status = model.ClassUserStatusPending
 	}
 
 	// 检查学生是否已在班级中
@@ -485,33 +504,160 @@ func (s *ClassDaoImpl) JoinClass(studentID uint, classCode string) error {
 	result := s.db.Where("class_id = ? AND user_id = ?", class.ID, studentID).First(&existingRelation)
 	if result.Error == nil {
 		if existingRelation.IsActive {
-			return errors.New("您已经在班级中")
+			return nil, ErrAlreadyInClass
 		}
-
-		// 重新激活
-		existingRelation.IsActive = true
-		existingRelation.JoinedAt = time.Now().Unix()
-		if err := s.db.Save(&existingRelation).Error; err != nil {
-			return errors.New("加入班级失败")
+		// 已经在等待审核，不重复申请
+		if existingRelation.Status == model.ClassUserStatusPending {
+			return &existingRelation, nil
 		}
-		return nil
 	} else if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return result.Error
+		return nil, result.Error
+	}
+
+	if err := s.checkClassSeats(&class); err != nil {
+		return nil, err
 	}
 
-	// 添加学生到班级
 	classUser := model.ClassUser{
 		ClassID:  class.ID,
 		UserID:   studentID,
-		JoinedAt: time.Now().Unix(),
+		JoinedAt: now,
 		Role:     "student",
-		IsActive: true,
+		IsActive: status == model.ClassUserStatusActive,
+		Status:   status,
 	}
 
-	if err := s.db.Create(&classUser).Error; err != nil {
-		return errors.New("加入班级失败")
+	if result.Error == nil {
+		// 重新激活或重新申请
+		if err := s.db.Model(&model.ClassUser{}).
+			Where("class_id = ? AND user_id = ?", class.ID, studentID).
+			Updates(map[string]interface{}{
+				"is_active": classUser.IsActive,
+				"status":    classUser.Status,
+				"joined_at": now,
+			}).Error; err != nil {
+			return nil, errors.New("加入班级失败")
+		}
+		return &classUser, nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&classUser).Error; err != nil {
+			return err
+		}
+		if status == model.ClassUserStatusActive {
+			return nil
+		}
+		// is_active 的默认值为 true，待审核成员需要单独置为 false
+		classUser.IsActive = false
+		return tx.Model(&model.ClassUser{}).
+			Where("class_id = ? AND user_id = ?", class.ID, studentID).
+			Update("is_active", false).Error
+	})
+	if err != nil {
+		return nil, errors.New("加入班级失败")
 	}
 
+	return &classUser, nil
+}
+
+// checkClassSeats 检查班级是否还有空位
+func (s *ClassDaoImpl) checkClassSeats(class *model.Class) error {
+	if class.MaxStudents <= 0 {
+		return nil
+	}
+	var count int64
+	if err := s.db.Model(&model.ClassUser{}).
+		Where("class_id = ? AND is_active = ? AND role = ?", class.ID, true, "student").
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(class.MaxStudents) {
+		return ErrClassFull
+	}
+	return nil
+}
+
+// RotateClassCode 重新生成班级邀请码，旧邀请码立即失效
+func (s *ClassDaoImpl) RotateClassCode(classID, teacherID uint, expiresAt int64) (*model.Class, error) {
+	var class model.Class
+	if err := s.db.Where("id = ? AND teacher_id = ?", classID, teacherID).First(&class).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("班级不存在或您无权操作")
+		}
+		return nil, err
+	}
+
+	class.Code = uuid.New().String()[:8]
+	class.CodeExpiresAt = expiresAt
+	if err := s.db.Model(&class).Updates(map[string]interface{}{
+		"code":            class.Code,
+		"code_expires_at": class.CodeExpiresAt,
+	}).Error; err != nil {
+		return nil, errors.New("更新邀请码失败")
+	}
+
+	return &class, nil
+}
+
+// ListPendingStudents 列出等待审核的加入申请
+func (s *ClassDaoImpl) ListPendingStudents(classID, teacherID uint) ([]model.User, error) {
+	var class model.Class
+	if err := s.db.Where("id = ? AND teacher_id = ?", classID, teacherID).First(&class).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("班级不存在或您无权查看")
+		}
+		return nil, err
+	}
+
+	var students []model.User
+	if err := s.db.Table("users").
+		Joins("JOIN class_users ON users.id = class_users.user_id").
+		Where("class_users.class_id = ? AND class_users.status = ?", classID, model.ClassUserStatusPending).
+		Order("class_users.joined_at ASC").
+		Find(&students).Error; err != nil {
+		return nil, err
+	}
+
+	return students, nil
+}
+
+// ReviewJoinRequest 审核加入申请，通过后成为正式成员，拒绝则删除申请
+func (s *ClassDaoImpl) ReviewJoinRequest(classID, teacherID, studentID uint, approve bool) error {
+	var class model.Class
+	if err := s.db.Where("id = ? AND teacher_id = ?", classID, teacherID).First(&class).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("班级不存在或您无权操作")
+		}
+		return err
+	}
+
+	query := s.db.Where("class_id = ? AND user_id = ? AND status = ?", classID, studentID, model.ClassUserStatusPending)
+	if !approve {
+		result := query.Delete(&model.ClassUser{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("加入申请不存在")
+		}
+		return nil
+	}
+
+	if err := s.checkClassSeats(&class); err != nil {
+		return err
+	}
+	result := query.Model(&model.ClassUser{}).Updates(map[string]interface{}{
+		"is_active": true,
+		"status":    model.ClassUserStatusActive,
+		"joined_at": time.Now().Unix(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("加入申请不存在")
+	}
 	return nil
 }
 
@@ -615,3 +761,74 @@ func (s *ClassDaoImpl) IsLessonInClass(classID, courseID, lessonID uint) (bool,
 
 	return true, nil
 }
+
+// GetMemberRole 获取用户在班级中的角色
+func (s *ClassDaoImpl) GetMemberRole(classID, userID uint) (*model.Class, string, error) {
+	var class model.Class
+	if err := s.db.First(&class, classID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errors.New("班级不存在")
+		}
+		return nil, "", err
+	}
+	if class.TeacherID == userID {
+		return &class, model.RoleTeacher, nil
+	}
+
+	var member model.ClassUser
+	err := s.db.Where("class_id = ? AND user_id = ? AND is_active = ? AND deleted_at IS NULL", classID, userID, true).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &class, "", nil
+		}
+		return nil, "", err
+	}
+	// 早期添加的成员没有填写角色，都是学生
+	if member.Role == model.ClassRoleAssistant {
+		return &class, model.ClassRoleAssistant, nil
+	}
+	return &class, model.ClassRoleStudent, nil
+}
+
+// SetMemberRole 设置班级正式成员的角色
+func (s *ClassDaoImpl) SetMemberRole(classID, teacherID, userID uint, role string) error {
+	if role != model.ClassRoleStudent && role != model.ClassRoleAssistant {
+		return errors.New("无效的班级角色")
+	}
+
+	// 检查班级是否存在且属于该教师
+	var class model.Class
+	if err := s.db.Where("id = ? AND teacher_id = ?", classID, teacherID).First(&class).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("班级不存在或您无权操作")
+		}
+		return err
+	}
+
+	// 助教可以重置学生的密码、查看登录卡，只有本身就能管理学生的用户（如教师）可以担任，学生不能当助教
+	if role == model.ClassRoleAssistant {
+		var permissions []string
+		err := s.db.Model(&model.RolePermission{}).
+			Joins("JOIN roles ON roles.id = role_permissions.role_id").
+			Joins("JOIN users ON users.role = roles.name").
+			Where("users.id = ? AND users.deleted_at IS NULL", userID).
+			Pluck("role_permissions.permission", &permissions).Error
+		if err != nil {
+			return err
+		}
+		if !containsString(permissions, model.PermissionManageOwnStudents) && !containsString(permissions, model.PermissionManageAll) {
+			return errors.New("只有教师等可以管理学生的用户才能担任助教")
+		}
+	}
+
+	result := s.db.Model(&model.ClassUser{}).
+		Where("class_id = ? AND user_id = ? AND is_active = ? AND deleted_at IS NULL", classID, userID, true).
+		Updates(map[string]interface{}{"role": role, "updated_at": time.Now().Unix()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该用户不是班级的正式成员")
+	}
+	return nil
+}
@@ -398,3 +398,97 @@ func TestDeleteClass(t *testing.T) {
 		})
 	}
 }
+
+// 测试通过邀请码加入班级
+func TestJoinClass(t *testing.T) {
+	db := testutils.SetupTestDB()
+	classService := NewClassDao(db)
+
+	teacherID := uint(1)
+	class, err := classService.CreateClass(teacherID, "测试班级", "", "2023-01-01", "2023-12-31")
+	assert.NoError(t, err)
+
+	// 无效的邀请码
+	_, err = classService.JoinClass(2, "invalid")
+	assert.ErrorIs(t, err, ErrClassCodeInvalid)
+
+	// 正常加入
+	member, err := classService.JoinClass(2, class.Code)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ClassUserStatusActive, member.Status)
+
+	// 重复加入
+	_, err = classService.JoinClass(2, class.Code)
+	assert.ErrorIs(t, err, ErrAlreadyInClass)
+
+	// 人数上限
+	assert.NoError(t, classService.UpdateClass(class.ID, teacherID, map[string]interface{}{"max_students": 1}))
+	_, err = classService.JoinClass(3, class.Code)
+	assert.ErrorIs(t, err, ErrClassFull)
+
+	// 重新生成邀请码后旧邀请码失效
+	oldCode := class.Code
+	rotated, err := classService.RotateClassCode(class.ID, teacherID, time.Now().Add(-time.Minute).Unix())
+	assert.NoError(t, err)
+	assert.NotEqual(t, oldCode, rotated.Code)
+	_, err = classService.JoinClass(3, oldCode)
+	assert.ErrorIs(t, err, ErrClassCodeInvalid)
+
+	// 过期的邀请码
+	_, err = classService.JoinClass(3, rotated.Code)
+	assert.ErrorIs(t, err, ErrClassCodeExpired)
+
+	// 其他老师不能重新生成邀请码
+	_, err = classService.RotateClassCode(class.ID, 99, 0)
+	assert.Error(t, err)
+}
+
+// 测试需要老师审核的加入申请
+func TestJoinClassWithApproval(t *testing.T) {
+	db := testutils.SetupTestDB()
+	classService := NewClassDao(db)
+
+	teacherID := uint(1)
+	class, err := classService.CreateClass(teacherID, "审核班级", "", "2023-01-01", "2023-12-31")
+	assert.NoError(t, err)
+	assert.NoError(t, classService.UpdateClass(class.ID, teacherID, map[string]interface{}{"require_approval": true}))
+
+	for _, userID := range []uint{2, 3} {
+		assert.NoError(t, db.Create(&model.User{ID: userID, Username: fmt.Sprintf("student%d", userID)}).Error)
+		member, err := classService.JoinClass(userID, class.Code)
+		assert.NoError(t, err)
+		assert.Equal(t, model.ClassUserStatusPending, member.Status)
+		assert.False(t, member.IsActive)
+	}
+
+	// 重复申请不会报错
+	member, err := classService.JoinClass(2, class.Code)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ClassUserStatusPending, member.Status)
+
+	pending, err := classService.ListPendingStudents(class.ID, teacherID)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	// 待审核的申请不算班级学生
+	students, err := classService.ListStudents(class.ID, teacherID)
+	assert.NoError(t, err)
+	assert.Empty(t, students)
+
+	assert.NoError(t, classService.ReviewJoinRequest(class.ID, teacherID, 2, true))
+	assert.NoError(t, classService.ReviewJoinRequest(class.ID, teacherID, 3, false))
+	assert.Error(t, classService.ReviewJoinRequest(class.ID, teacherID, 3, true))
+
+	pending, err = classService.ListPendingStudents(class.ID, teacherID)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	students, err = classService.ListStudents(class.ID, teacherID)
+	assert.NoError(t, err)
+	if assert.Len(t, students, 1) {
+		assert.Equal(t, uint(2), students[0].ID)
+	}
+
+	_, err = classService.JoinClass(2, class.Code)
+	assert.ErrorIs(t, err, ErrAlreadyInClass)
+}
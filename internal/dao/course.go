@@ -507,7 +507,8 @@ func (c *CourseDaoImpl) DuplicateCourse(courseID, authorID uint) (*model.Course,
 // SearchCourses 搜索课程
 func (c *CourseDaoImpl) SearchCourses(keyword string, authorID uint) ([]model.Course, error) {
 	var courses []model.Course
-	query := c.db.Where("title LIKE ? OR description LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	condition, args := likeCondition(keyword, "title", "description")
+	query := c.db.Where(condition, args...)
 
 	if authorID > 0 {
 		query = query.Where("author_id = ?", authorID)
@@ -197,7 +197,8 @@ func (d *ExcalidrawDAOImpl) SearchBoardsByName(ctx context.Context, userID uint,
 	}
 
 	// 按名称模糊搜索
-	query = query.Where("name LIKE ?", "%"+keyword+"%")
+	condition, args := likeCondition(keyword, "name")
+	query = query.Where(condition, args...)
 
 	// 查询数据
 	if err := query.Preload("User").
@@ -171,7 +171,8 @@ func (d *FileDaoImpl) CountFiles() (int64, gorails.Error) {
 // SearchFiles 搜索文件
 func (d *FileDaoImpl) SearchFiles(keyword string) ([]*model.File, gorails.Error) {
 	var files []*model.File
-	if err := d.db.Where("original_name LIKE ? or description LIKE ?", "%"+keyword+"%", "%"+keyword+"%").Find(&files).Error; err != nil {
+	condition, args := likeCondition(keyword, "original_name", "description")
+	if err := d.db.Where(condition, args...).Find(&files).Error; err != nil {
 		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_FILE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
 	}
 	return files, nil
@@ -0,0 +1,205 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+	"gorm.io/gorm"
+)
+
+// GradeDaoImpl 评分数据访问实现
+type GradeDaoImpl struct {
+	db *gorm.DB
+}
+
+// NewGradeDao 创建评分DAO实例
+func NewGradeDao(db *gorm.DB) GradeDao {
+	return &GradeDaoImpl{db: db}
+}
+
+// CreateCriterion 为课程添加评分项
+func (d *GradeDaoImpl) CreateCriterion(criterion *model.RubricCriterion) error {
+	if criterion.MaxPoints <= 0 {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeGradePointsOutOfRange, global.ErrorMsgGradePointsOutOfRange, errors.New("评分项满分必须大于0"))
+	}
+	if err := d.db.Create(criterion).Error; err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+	}
+	return nil
+}
+
+// UpdateCriterion 更新课程的评分项
+func (d *GradeDaoImpl) UpdateCriterion(courseID, criterionID uint, updates map[string]interface{}) error {
+	if maxPoints, ok := updates["max_points"].(int); ok && maxPoints <= 0 {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeGradePointsOutOfRange, global.ErrorMsgGradePointsOutOfRange, errors.New("评分项满分必须大于0"))
+	}
+	result := d.db.Model(&model.RubricCriterion{}).
+		Where("id = ? AND course_id = ? AND deleted_at IS NULL", criterionID, courseID).
+		Updates(updates)
+	if result.Error != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, nil)
+	}
+	return nil
+}
+
+// DeleteCriterion 软删除课程的评分项
+func (d *GradeDaoImpl) DeleteCriterion(courseID, criterionID uint) error {
+	result := d.db.Model(&model.RubricCriterion{}).
+		Where("id = ? AND course_id = ? AND deleted_at IS NULL", criterionID, courseID).
+		Update("deleted_at", time.Now().Unix())
+	if result.Error != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, nil)
+	}
+	return nil
+}
+
+// ListCriteria 列出课程的评分标准
+func (d *GradeDaoImpl) ListCriteria(courseID uint) ([]model.RubricCriterion, error) {
+	var criteria []model.RubricCriterion
+	if err := d.db.Where("course_id = ? AND deleted_at IS NULL", courseID).
+		Order("sort_order ASC, id ASC").
+		Find(&criteria).Error; err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return criteria, nil
+}
+
+// SaveGrade 保存评分
+// 评分项必须属于作业所在课程的评分标准，得分不能超过该项满分；
+// 评分项和角色评语整体替换，同时把提交状态标记为已评分
+func (d *GradeDaoImpl) SaveGrade(grade *model.Grade) error {
+	var submission model.Submission
+	if err := d.db.First(&submission, grade.SubmissionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, err)
+		}
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	var assignment model.Assignment
+	if err := d.db.First(&assignment, submission.AssignmentID).Error; err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	grade.AssignmentID = assignment.ID
+	grade.ClassID = assignment.ClassID
+	grade.StudentID = submission.StudentID
+
+	if len(grade.Items) > 0 {
+		criteria, err := d.ListCriteria(assignment.CourseID)
+		if err != nil {
+			return err
+		}
+		criteriaMap := make(map[uint]model.RubricCriterion, len(criteria))
+		for _, criterion := range criteria {
+			criteriaMap[criterion.ID] = criterion
+		}
+
+		grade.Score = 0
+		grade.MaxScore = 0
+		for i := range grade.Items {
+			item := &grade.Items[i]
+			criterion, ok := criteriaMap[item.CriterionID]
+			if !ok {
+				return gorails.NewError(http.StatusBadRequest, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeGradeCriterionInvalid, global.ErrorMsgGradeCriterionInvalid, fmt.Errorf("评分项 %d 不存在", item.CriterionID))
+			}
+			if item.Points < 0 || item.Points > criterion.MaxPoints {
+				return gorails.NewError(http.StatusBadRequest, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeGradePointsOutOfRange, global.ErrorMsgGradePointsOutOfRange, fmt.Errorf("评分项 %s 的得分应在 0 到 %d 之间", criterion.Title, criterion.MaxPoints))
+			}
+			item.ID = 0
+			item.Title = criterion.Title
+			item.MaxPoints = criterion.MaxPoints
+			grade.Score += item.Points
+			grade.MaxScore += criterion.MaxPoints
+		}
+	} else if grade.Score < 0 || (grade.MaxScore > 0 && grade.Score > grade.MaxScore) {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeGradePointsOutOfRange, global.ErrorMsgGradePointsOutOfRange, nil)
+	}
+	for i := range grade.SpriteComments {
+		grade.SpriteComments[i].ID = 0
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var existing model.Grade
+		err := tx.Where("submission_id = ?", grade.SubmissionID).First(&existing).Error
+		switch {
+		case err == nil:
+			grade.ID = existing.ID
+			grade.CreatedAt = existing.CreatedAt
+			if err := tx.Where("grade_id = ?", existing.ID).Delete(&model.GradeItem{}).Error; err != nil {
+				return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, err)
+			}
+			if err := tx.Where("grade_id = ?", existing.ID).Delete(&model.GradeSpriteComment{}).Error; err != nil {
+				return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, err)
+			}
+			// Save 会同时写入 Items 和 SpriteComments
+			if err := tx.Save(grade).Error; err != nil {
+				return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(grade).Error; err != nil {
+				return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+			}
+		default:
+			return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+		}
+
+		if err := tx.Model(&model.Submission{}).Where("id = ?", grade.SubmissionID).Updates(map[string]interface{}{
+			"status":      model.SubmissionStatusGraded,
+			"reviewer_id": grade.GraderID,
+			"reviewed_at": time.Now().Unix(),
+		}).Error; err != nil {
+			return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+		}
+		return nil
+	})
+}
+
+// GetGradeBySubmission 获取某次提交的评分
+func (d *GradeDaoImpl) GetGradeBySubmission(submissionID uint) (*model.Grade, error) {
+	var grade model.Grade
+	if err := d.db.Preload("Items").Preload("SpriteComments").
+		Where("submission_id = ?", submissionID).
+		First(&grade).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, err)
+		}
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return &grade, nil
+}
+
+// ListStudentLessonGrades 列出学生在某个课时下已发布作业的评分
+func (d *GradeDaoImpl) ListStudentLessonGrades(studentID, lessonID uint) ([]model.Grade, error) {
+	var grades []model.Grade
+	if err := d.db.Preload("Items").Preload("SpriteComments").Preload("Assignment").
+		Joins("JOIN assignments ON assignments.id = grades.assignment_id").
+		Where("grades.student_id = ? AND assignments.lesson_id = ?", studentID, lessonID).
+		Where("assignments.is_published = ? AND assignments.deleted_at IS NULL", true).
+		Order("grades.id DESC").
+		Find(&grades).Error; err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return grades, nil
+}
+
+// ListClassGrades 列出班级所有作业的评分
+func (d *GradeDaoImpl) ListClassGrades(classID uint) ([]model.Grade, error) {
+	var grades []model.Grade
+	if err := d.db.Where("class_id = ?", classID).
+		Order("student_id ASC, assignment_id ASC, id ASC").
+		Find(&grades).Error; err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return grades, nil
+}
@@ -0,0 +1,86 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// 测试按评分标准评分、重复评分覆盖以及学生端反馈查询
+func TestGradeDao_SaveGrade(t *testing.T) {
+	db := testutils.SetupTestDB()
+	assignmentDao := NewAssignmentDao(db, t.TempDir(), &config.Config{}, zap.NewNop())
+	gradeDao := NewGradeDao(db)
+
+	loop := &model.RubricCriterion{CourseID: 1, Title: "使用循环", MaxPoints: 10}
+	event := &model.RubricCriterion{CourseID: 1, Title: "使用事件", MaxPoints: 5}
+	other := &model.RubricCriterion{CourseID: 2, Title: "其他课程", MaxPoints: 5}
+	assert.NoError(t, gradeDao.CreateCriterion(loop))
+	assert.NoError(t, gradeDao.CreateCriterion(event))
+	assert.NoError(t, gradeDao.CreateCriterion(other))
+	assert.Error(t, gradeDao.CreateCriterion(&model.RubricCriterion{CourseID: 1, Title: "无效", MaxPoints: 0}))
+
+	criteria, err := gradeDao.ListCriteria(1)
+	assert.NoError(t, err)
+	assert.Len(t, criteria, 2)
+
+	assignment := &model.Assignment{ClassID: 3, CourseID: 1, LessonID: 4, TeacherID: 1, Title: "小猫走路", IsPublished: true}
+	assert.NoError(t, assignmentDao.CreateAssignment(assignment))
+	submission := &model.Submission{AssignmentID: assignment.ID, StudentID: 2, ProjectType: model.ProjectTypeScratch, ProjectID: 10}
+	assert.NoError(t, assignmentDao.CreateSubmission(submission, []byte("{}")))
+
+	// 超出满分
+	err = gradeDao.SaveGrade(&model.Grade{SubmissionID: submission.ID, GraderID: 1, Items: []model.GradeItem{{CriterionID: loop.ID, Points: 11}}})
+	assert.Error(t, err)
+	// 其他课程的评分项
+	err = gradeDao.SaveGrade(&model.Grade{SubmissionID: submission.ID, GraderID: 1, Items: []model.GradeItem{{CriterionID: other.ID, Points: 1}}})
+	assert.Error(t, err)
+
+	grade := &model.Grade{
+		SubmissionID: submission.ID,
+		GraderID:     1,
+		Comment:      "不错",
+		Items: []model.GradeItem{
+			{CriterionID: loop.ID, Points: 8},
+			{CriterionID: event.ID, Points: 5},
+		},
+		SpriteComments: []model.GradeSpriteComment{{Sprite: "Sprite1", Comment: "动作很流畅"}},
+	}
+	assert.NoError(t, gradeDao.SaveGrade(grade))
+	assert.Equal(t, 13, grade.Score)
+	assert.Equal(t, 15, grade.MaxScore)
+	assert.Equal(t, uint(3), grade.ClassID)
+
+	// 重新评分会覆盖评分项
+	regrade := &model.Grade{
+		SubmissionID: submission.ID,
+		GraderID:     1,
+		Items:        []model.GradeItem{{CriterionID: loop.ID, Points: 10}},
+	}
+	assert.NoError(t, gradeDao.SaveGrade(regrade))
+	assert.Equal(t, grade.ID, regrade.ID)
+
+	saved, err := gradeDao.GetGradeBySubmission(submission.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, saved.Score)
+	assert.Len(t, saved.Items, 1)
+	assert.Equal(t, "使用循环", saved.Items[0].Title)
+	assert.Empty(t, saved.SpriteComments)
+
+	updated, err := assignmentDao.GetSubmission(submission.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.SubmissionStatusGraded, updated.Status)
+
+	feedback, err := gradeDao.ListStudentLessonGrades(2, 4)
+	assert.NoError(t, err)
+	assert.Len(t, feedback, 1)
+	assert.Equal(t, "小猫走路", feedback[0].Assignment.Title)
+
+	classGrades, err := gradeDao.ListClassGrades(3)
+	assert.NoError(t, err)
+	assert.Len(t, classGrades, 1)
+}
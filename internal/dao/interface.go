@@ -18,14 +18,46 @@ type Dao struct {
 	ShareDao      ShareDao
 	ExcalidrawDao ExcalidrawDAO
 	ProgramDao    ProgramDao
+	AssignmentDao AssignmentDao
+	GradeDao      GradeDao
+	OIDCDao       OIDCDao // 未开启 OIDC 时为 nil
+	PasswordDao   PasswordDao
+	RoleDao       RoleDao
+	AuditDao      AuditDao
 }
 
 type AuthDao interface {
 	Register(username, password, email string) error
-	Login(username, password string) (*LoginResponse, error)
+	Login(username, password string, client SessionClient) (*LoginResponse, error)
+	// StartSession 为已经通过其他方式验证的用户（如单点登录）创建会话并签发令牌
+	StartSession(user *model.User, client SessionClient) (*LoginResponse, error)
 	Logout(token string) (*http.Cookie, error)
 	ValidateToken(tokenString string) (*Claims, error)
 	GenerateCookie(token string) *http.Cookie
+
+	// Refresh 用刷新令牌换发新的访问令牌和刷新令牌
+	Refresh(refreshToken string) (*LoginResponse, error)
+	// RevokeRefreshToken 注销刷新令牌所属的会话
+	RevokeRefreshToken(refreshToken string) error
+
+	// UnlockLogin 清除用户名和 IP 的登录失败次数，解除锁定
+	UnlockLogin(username, ip string)
+	// ListLoginFailures 按时间倒序分页列出登录失败记录
+	ListLoginFailures(username string, pageSize uint, beginID uint) ([]model.LoginFailure, bool, error)
+
+	// ListSessions 列出用户所有未过期的登录会话，最近使用的在前
+	ListSessions(userID uint) ([]model.UserSession, error)
+	// RevokeSession 注销用户的一个会话，id 为会话记录ID
+	RevokeSession(userID uint, id uint) error
+	// RevokeUserSessions 注销多个用户的全部会话，返回注销的会话数
+	RevokeUserSessions(userIDs []uint) (int64, error)
+
+	// GetPictureLoginClass 通过邀请码获取开启了图片登录的班级，以及可以选择的学生
+	GetPictureLoginClass(classCode string) (*model.Class, []model.User, error)
+	// PictureLogin 学生选中自己的名字和图片密码登录
+	PictureLogin(classCode string, userID uint, icons []int, client SessionClient) (*LoginResponse, error)
+	// BadgeLogin 扫描二维码登录卡登录
+	BadgeLogin(token string, client SessionClient) (*LoginResponse, error)
 }
 
 // ProgramDao 定义通用程序的数据访问接口
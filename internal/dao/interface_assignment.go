@@ -0,0 +1,41 @@
+package dao
+
+import "github.com/jun/fun_code/internal/model"
+
+// AssignmentDao 定义了作业和作业提交的数据访问接口
+type AssignmentDao interface {
+	// CreateAssignment 创建作业
+	CreateAssignment(assignment *model.Assignment) error
+
+	// UpdateAssignment 更新作业信息
+	UpdateAssignment(assignmentID uint, updates map[string]interface{}) error
+
+	// GetAssignment 获取作业详情
+	GetAssignment(assignmentID uint) (*model.Assignment, error)
+
+	// DeleteAssignment 删除作业（软删除）
+	DeleteAssignment(assignmentID uint) error
+
+	// ListAssignments 列出班级的作业，lessonID 为 0 时不按课时过滤
+	// publishedOnly 为 true 时只返回已发布的作业（学生端用）
+	ListAssignments(classID, lessonID uint, publishedOnly bool) ([]model.Assignment, error)
+
+	// CreateSubmission 创建一次作业提交，并把 content 保存为快照文件
+	// Attempt 和 IsLate 由 DAO 根据已有提交和作业截止时间计算
+	CreateSubmission(submission *model.Submission, content []byte) error
+
+	// GetSubmission 获取提交详情
+	GetSubmission(submissionID uint) (*model.Submission, error)
+
+	// GetSubmissionContent 读取提交时保存的项目快照
+	GetSubmissionContent(submission *model.Submission) ([]byte, error)
+
+	// ListSubmissions 列出作业的提交记录，latestOnly 为 true 时每个学生只返回最近一次提交
+	ListSubmissions(assignmentID uint, latestOnly bool) ([]model.Submission, error)
+
+	// ListStudentSubmissions 列出某个学生在某个作业下的所有提交（最新的在前）
+	ListStudentSubmissions(assignmentID, studentID uint) ([]model.Submission, error)
+
+	// ReturnSubmission 老师退回提交，学生可以修改后重新提交
+	ReturnSubmission(submissionID, reviewerID uint, comment string) error
+}
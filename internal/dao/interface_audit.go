@@ -0,0 +1,25 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/jun/fun_code/internal/model"
+)
+
+// AuditDao 管理操作和删除操作的审计记录
+type AuditDao interface {
+	// RecordEvent 写入一条审计记录，ActorName 为空时按 ActorID 查询用户名
+	RecordEvent(event *model.AuditEvent) error
+	// ListEvents 按条件分页列出审计记录，分页方式与其他列表相同
+	ListEvents(filter AuditEventFilter, pageSize uint, beginID uint, forward, asc bool) ([]model.AuditEvent, bool, error)
+}
+
+// AuditEventFilter 审计记录的查询条件，零值的条件不筛选
+type AuditEventFilter struct {
+	ActorID      uint
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Since        time.Time // 包含
+	Until        time.Time // 不包含
+}
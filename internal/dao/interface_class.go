@@ -43,8 +43,17 @@ type ClassDao interface {
 	// ListCoursesByClass 列出班级中的所有课程（学生端用，不需要权限检查）
 	ListCoursesByClass(classID uint) ([]model.Course, error)
 
-	// JoinClass 学生加入班级
-	JoinClass(studentID uint, classCode string) error
+	// JoinClass 学生通过邀请码加入班级，返回的成员状态可能是待审核
+	JoinClass(studentID uint, classCode string) (*model.ClassUser, error)
+
+	// RotateClassCode 重新生成班级邀请码，expiresAt 为 0 表示不过期
+	RotateClassCode(classID, teacherID uint, expiresAt int64) (*model.Class, error)
+
+	// ListPendingStudents 列出等待审核的加入申请
+	ListPendingStudents(classID, teacherID uint) ([]model.User, error)
+
+	// ReviewJoinRequest 审核加入申请
+	ReviewJoinRequest(classID, teacherID, studentID uint, approve bool) error
 
 	// ListJoinedClasses 列出学生加入的所有班级
 	ListJoinedClasses(studentID uint) ([]model.Class, error)
@@ -57,4 +66,14 @@ type ClassDao interface {
 
 	// IsLessonInClass 检查课时是否在班级中
 	IsLessonInClass(classID, courseID, lessonID uint) (bool, error)
+
+	// ResetStudentLogins 为班级学生重新生成图片密码和（或）二维码登录卡，studentIDs 为空表示所有学生
+	ResetStudentLogins(classID, teacherID uint, studentIDs []uint, picture, badge bool) ([]StudentLoginCard, error)
+
+	// GetMemberRole 获取用户在班级中的角色：班级的老师为 teacher，其他正式成员为 assistant 或 student，
+	// 不是成员时为空。返回的班级没有加载学生和课程
+	GetMemberRole(classID, userID uint) (*model.Class, string, error)
+
+	// SetMemberRole 设置班级正式成员的角色（student 或 assistant），只有角色可以管理学生的用户能设为助教
+	SetMemberRole(classID, teacherID, userID uint, role string) error
 }
@@ -0,0 +1,31 @@
+package dao
+
+import "github.com/jun/fun_code/internal/model"
+
+// GradeDao 定义了评分标准和作业评分的数据访问接口
+type GradeDao interface {
+	// CreateCriterion 为课程添加评分项
+	CreateCriterion(criterion *model.RubricCriterion) error
+
+	// UpdateCriterion 更新课程的评分项
+	UpdateCriterion(courseID, criterionID uint, updates map[string]interface{}) error
+
+	// DeleteCriterion 删除课程的评分项（软删除，已有评分中的记录保留）
+	DeleteCriterion(courseID, criterionID uint) error
+
+	// ListCriteria 列出课程的评分标准
+	ListCriteria(courseID uint) ([]model.RubricCriterion, error)
+
+	// SaveGrade 保存对某次提交的评分，已评分时覆盖原有评分
+	// 传入了评分项得分时，总分和满分按评分标准计算
+	SaveGrade(grade *model.Grade) error
+
+	// GetGradeBySubmission 获取某次提交的评分
+	GetGradeBySubmission(submissionID uint) (*model.Grade, error)
+
+	// ListStudentLessonGrades 列出学生在某个课时下所有作业的评分（学生端查看反馈用）
+	ListStudentLessonGrades(studentID, lessonID uint) ([]model.Grade, error)
+
+	// ListClassGrades 列出班级所有作业的评分（导出成绩用）
+	ListClassGrades(classID uint) ([]model.Grade, error)
+}
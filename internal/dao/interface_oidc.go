@@ -0,0 +1,22 @@
+package dao
+
+import "github.com/jun/fun_code/internal/model"
+
+// OIDCDao 定义 OpenID Connect 单点登录和外部身份关联的接口，未开启 OIDC 时为 nil
+type OIDCDao interface {
+	// Name 登录按钮上显示的名称
+	Name() string
+
+	// AuthCodeURL 生成跳转到身份提供方的登录地址和 state，redirectURL 为配置的回调地址为空时使用的地址，
+	// linkUserID 不为 0 时表示已登录的用户关联外部身份
+	AuthCodeURL(redirectURL, returnTo string, linkUserID uint) (string, string, error)
+
+	// Callback 处理身份提供方的回调，返回登录或关联的用户
+	Callback(state, code string, client OIDCCallbackClient) (*OIDCLoginResult, error)
+
+	// ListIdentities 列出用户关联的外部身份
+	ListIdentities(userID uint) ([]model.UserIdentity, error)
+
+	// UnlinkIdentity 解除用户关联的一个外部身份
+	UnlinkIdentity(userID, identityID uint) error
+}
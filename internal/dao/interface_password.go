@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/model"
+)
+
+// PasswordDao 修改密码、密码策略和重置密码
+type PasswordDao interface {
+	// Policy 当前的密码策略
+	Policy() config.PasswordConfig
+	// CheckPolicy 检查新密码是否符合密码策略
+	CheckPolicy(password string) error
+	// ChangePassword 用户修改自己的密码，修改后不再要求强制修改密码
+	ChangePassword(userID uint, oldPassword, newPassword string) error
+
+	// CreateResetCode 老师为自己班级中的学生生成一次性重置码，学生之前未使用的重置码失效
+	CreateResetCode(classID, teacherID, studentID uint) (*PasswordResetCode, error)
+	// ResetPassword 用用户名和重置码设置新密码，返回被重置的用户
+	ResetPassword(username, code, newPassword string) (*model.User, error)
+
+	// EmailResetEnabled 是否配置了发信服务器，可以通过邮件找回密码
+	EmailResetEnabled() bool
+	// SendResetEmail 给邮箱对应的本地帐号发送带重置码的链接，
+	// 邮箱不存在时也返回 nil，避免泄露哪些邮箱已注册
+	SendResetEmail(email string) error
+}
+
+// PasswordResetCode 新生成的重置码，明文只在生成时返回这一次
+type PasswordResetCode struct {
+	User      model.User
+	Code      string
+	ExpiresAt time.Time
+}
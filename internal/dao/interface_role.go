@@ -0,0 +1,29 @@
+package dao
+
+// RoleDao 角色和角色拥有的权限
+type RoleDao interface {
+	// ListRoles 列出所有角色及其权限
+	ListRoles() ([]RoleInfo, error)
+	// GetRolePermissions 获取角色拥有的权限，角色不存在时返回空列表
+	GetRolePermissions(role string) ([]string, error)
+	// GetRole 获取角色及其权限，角色不存在时返回 ErrRoleNotFound
+	GetRole(name string) (*RoleInfo, error)
+	// RoleExists 检查角色是否存在
+	RoleExists(role string) (bool, error)
+
+	// CreateRole 创建自定义角色
+	CreateRole(name, description string, permissions []string) (*RoleInfo, error)
+	// UpdateRole 修改角色的说明和权限，权限整体替换
+	UpdateRole(name, description string, permissions []string) (*RoleInfo, error)
+	// DeleteRole 删除自定义角色，内置角色和还有用户使用的角色不能删除
+	DeleteRole(name string) error
+}
+
+// RoleInfo 角色及其权限
+type RoleInfo struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	BuiltIn     bool     `json:"built_in"`
+	Permissions []string `json:"permissions"`
+}
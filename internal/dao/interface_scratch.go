@@ -20,6 +20,18 @@ type ScratchDao interface {
 	// SaveProject 保存Scratch项目
 	SaveProject(userID uint, projectID uint, name string, content []byte) (uint, error)
 
+	// GetProjectHistory 读取项目指定 MD5 的历史版本
+	GetProjectHistory(projectID uint, md5 string) ([]byte, error)
+
+	// RestoreProjectHistory 把指定 MD5 的历史版本设为当前版本
+	RestoreProjectHistory(projectID uint, md5 string) (*model.ScratchProject, error)
+
+	// CompactHistories 按保留策略清理所有项目的历史文件，dryRun 为 true 时只统计不删除
+	CompactHistories(dryRun bool) (*HistoryCompactResult, error)
+
+	// CollectOrphanAssets 回收没有被任何项目引用的资源文件和 user_assets 记录
+	CollectOrphanAssets(opts AssetGCOptions) (*AssetGCResult, error)
+
 	// ListProjectsWithPagination 分页列出用户的所有项目
 	ListProjectsWithPagination(userID uint, pageSize uint, beginID uint, forward, asc bool) ([]model.ScratchProject, bool, error)
 
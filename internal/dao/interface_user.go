@@ -17,4 +17,23 @@ type UserDao interface {
 	CountUsers() (int64, error)
 	GetUsersByIDs(ids []uint) ([]model.User, error)
 	SearchUsers(keyword string) ([]model.User, error)
+	// ImportUsers 批量导入学生用户，返回创建的用户和行级错误
+	ImportUsers(rows []UserImportRow, dryRun bool) ([]model.User, []UserImportRowError, error)
+}
+
+// UserImportRow 批量导入的一行用户数据
+type UserImportRow struct {
+	Line      int    // 在导入文件中的行号，用于报告错误
+	Username  string // 用户名
+	Nickname  string // 昵称，为空时使用用户名
+	Password  string // 初始密码明文
+	Email     string // 邮箱，可为空
+	ClassCode string // 班级邀请码，可为空
+}
+
+// UserImportRowError 批量导入的行级错误
+type UserImportRowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
@@ -358,7 +358,8 @@ func (l *LessonDaoImpl) GetPreviousLesson(courseID uint, currentSortOrder int) (
 // SearchLessons 搜索课时
 func (l *LessonDaoImpl) SearchLessons(keyword string, courseID uint) ([]model.Lesson, error) {
 	var lessons []model.Lesson
-	query := l.db.Where("lessons.title LIKE ? OR lessons.content LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	condition, args := likeCondition(keyword, "lessons.title", "lessons.content")
+	query := l.db.Where(condition, args...)
 
 	if courseID > 0 {
 		query = query.Joins("JOIN lesson_courses lc ON lc.lesson_id = lessons.id").
@@ -0,0 +1,285 @@
+package dao
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/oidc"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOIDCStateInvalid 回调的 state 不存在、已过期或不是这个浏览器发起的，需要重新发起登录
+	ErrOIDCStateInvalid = errors.New("登录请求已过期，请重新登录")
+	// ErrOIDCLinkUserChanged 关联外部身份的回调中，当前登录的用户不是发起关联的用户
+	ErrOIDCLinkUserChanged = errors.New("当前登录的用户已变化，请重新关联")
+	// ErrOIDCNoRole 外部帐号不属于任何允许登录的组
+	ErrOIDCNoRole = errors.New("您的帐号没有使用本系统的权限，请联系管理员")
+	// ErrOIDCIdentityLinked 外部身份已经关联了其他用户
+	ErrOIDCIdentityLinked = errors.New("这个外部帐号已经关联了其他用户")
+	// ErrOIDCLastIdentity 通过单点登录创建的用户没有本地密码，不能解除最后一个外部身份
+	ErrOIDCLastIdentity = errors.New("这是您唯一的登录方式，不能解除关联")
+)
+
+// OIDCStateTTL 跳转到身份提供方后需要在这段时间内完成登录
+const OIDCStateTTL = 10 * time.Minute
+
+// OIDCStateCookieName 发起登录时在浏览器中保存 state 摘要的 cookie，
+// 回调时核对，防止把别人发起的登录回调发给受害者完成（登录 CSRF）
+const OIDCStateCookieName = "oidc_state"
+
+// OIDCStateHash cookie 中保存的 state 摘要
+func OIDCStateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// OIDCCallbackClient 回调请求中浏览器的登录状态
+type OIDCCallbackClient struct {
+	StateCookie   string // OIDCStateCookieName cookie 的值
+	SessionUserID uint   // 当前登录的用户，未登录时为 0
+}
+
+// OIDCLoginResult OIDC 回调的处理结果
+type OIDCLoginResult struct {
+	User     *model.User
+	ReturnTo string // 登录后返回的页面
+	Linked   bool   // 已登录的用户关联了外部身份，不需要重新登录
+}
+
+// OIDCDaoImpl 通过 OpenID Connect 身份提供方登录，首次登录时自动创建用户，
+// 之后按 issuer + subject 找到关联的用户
+type OIDCDaoImpl struct {
+	db       *gorm.DB
+	cfg      config.OIDCConfig
+	provider *oidc.Provider
+	states   cache.OIDCStateCache
+}
+
+// NewOIDCDao 创建 OIDC DAO，配置已在 Validate 中检查
+func NewOIDCDao(db *gorm.DB, cfg config.OIDCConfig, states cache.OIDCStateCache) OIDCDao {
+	return &OIDCDaoImpl{
+		db:       db,
+		cfg:      cfg.WithDefaults(),
+		provider: oidc.NewProvider(cfg.Issuer, cfg.ClientID, cfg.ClientSecret, cfg.Scopes),
+		states:   states,
+	}
+}
+
+func (s *OIDCDaoImpl) Name() string {
+	return s.cfg.Name
+}
+
+// AuthCodeURL 生成登录地址，并保存回调时需要的 nonce 和 code_verifier，
+// 返回的 state 由调用方摘要后保存在浏览器的 cookie 中
+func (s *OIDCDaoImpl) AuthCodeURL(redirectURL, returnTo string, linkUserID uint) (string, string, error) {
+	if s.cfg.RedirectURL != "" {
+		redirectURL = s.cfg.RedirectURL
+	}
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err := s.provider.AuthCodeURL(req, redirectURL)
+	if err != nil {
+		return "", "", err
+	}
+	s.states.SetState(req.State, cache.OIDCState{
+		Nonce:        req.Nonce,
+		CodeVerifier: req.CodeVerifier,
+		RedirectURL:  redirectURL,
+		ReturnTo:     returnTo,
+		LinkUserID:   linkUserID,
+	}, OIDCStateTTL)
+	return authURL, req.State, nil
+}
+
+// Callback 用授权码换取 ID Token，找到或创建对应的用户。
+// state 必须是这个浏览器发起的；关联外部身份时，当前登录的用户必须是发起关联的用户
+func (s *OIDCDaoImpl) Callback(state, code string, client OIDCCallbackClient) (*OIDCLoginResult, error) {
+	if state == "" || subtle.ConstantTimeCompare([]byte(OIDCStateHash(state)), []byte(client.StateCookie)) != 1 {
+		return nil, ErrOIDCStateInvalid
+	}
+	st, ok := s.states.TakeState(state)
+	if !ok {
+		return nil, ErrOIDCStateInvalid
+	}
+	if st.LinkUserID != 0 && st.LinkUserID != client.SessionUserID {
+		return nil, ErrOIDCLinkUserChanged
+	}
+	claims, err := s.provider.Exchange(code, st.RedirectURL, &oidc.AuthRequest{
+		State:        state,
+		Nonce:        st.Nonce,
+		CodeVerifier: st.CodeVerifier,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OIDCLoginResult{ReturnTo: st.ReturnTo, Linked: st.LinkUserID != 0}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var identity model.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", s.provider.Issuer(), claims.Subject()).First(&identity).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		found := err == nil
+
+		var user *model.User
+		switch {
+		case st.LinkUserID != 0:
+			if found && identity.UserID != st.LinkUserID {
+				return ErrOIDCIdentityLinked
+			}
+			user = &model.User{}
+			if err := tx.First(user, st.LinkUserID).Error; err != nil {
+				return err
+			}
+		case found:
+			user = &model.User{}
+			if err := tx.First(user, identity.UserID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrInvalidCredentials
+				}
+				return err
+			}
+			// 关联到本地帐号的不按外部的组修改角色
+			if user.AuthProvider == model.AuthProviderOIDC {
+				role := mapRole(claims.Strings(s.cfg.RoleClaim), s.cfg.RoleMapping, s.cfg.DefaultRole)
+				if role == "" {
+					return ErrOIDCNoRole
+				}
+				if err := updateExternalUser(tx, user, s.nickname(claims), s.email(claims), role); err != nil {
+					return err
+				}
+			}
+		default:
+			if user, err = s.createUser(tx, claims); err != nil {
+				return err
+			}
+		}
+
+		identity.UserID = user.ID
+		identity.Provider = model.AuthProviderOIDC
+		identity.Issuer = s.provider.Issuer()
+		identity.Subject = claims.Subject()
+		identity.Email = s.email(claims)
+		identity.LastLoginAt = time.Now()
+		if err := tx.Save(&identity).Error; err != nil {
+			return err
+		}
+		result.User = user
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// createUser 首次登录时按声明创建用户
+func (s *OIDCDaoImpl) createUser(tx *gorm.DB, claims oidc.Claims) (*model.User, error) {
+	role := mapRole(claims.Strings(s.cfg.RoleClaim), s.cfg.RoleMapping, s.cfg.DefaultRole)
+	if role == "" {
+		return nil, ErrOIDCNoRole
+	}
+	username, err := s.availableUsername(tx, claims)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		Username:     username,
+		Nickname:     s.nickname(claims),
+		Email:        s.email(claims),
+		Role:         role,
+		AuthProvider: model.AuthProviderOIDC,
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *OIDCDaoImpl) nickname(claims oidc.Claims) string {
+	return truncate(claims.String(s.cfg.NicknameClaim), 50)
+}
+
+func (s *OIDCDaoImpl) email(claims oidc.Claims) string {
+	return truncate(claims.String(s.cfg.EmailClaim), 100)
+}
+
+// availableUsername 用声明中的用户名或邮箱前缀生成不重复的用户名，重名时加上数字后缀
+func (s *OIDCDaoImpl) availableUsername(tx *gorm.DB, claims oidc.Claims) (string, error) {
+	base := claims.String(s.cfg.UsernameClaim)
+	if base == "" {
+		base, _, _ = strings.Cut(s.email(claims), "@")
+	}
+	base = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return -1
+	}, base)
+	base = truncate(base, 40)
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 1000; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		// 已删除的用户仍然占用用户名
+		var count int64
+		if err := tx.Unscoped().Model(&model.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("无法为 %q 生成不重复的用户名", base)
+}
+
+// ListIdentities 列出用户关联的外部身份
+func (s *OIDCDaoImpl) ListIdentities(userID uint) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	if err := s.db.Where("user_id = ?", userID).Order("id ASC").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// UnlinkIdentity 解除关联，通过单点登录创建的用户至少要保留一个外部身份
+func (s *OIDCDaoImpl) UnlinkIdentity(userID, identityID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+		var identity model.UserIdentity
+		if err := tx.Where("id = ? AND user_id = ?", identityID, userID).First(&identity).Error; err != nil {
+			return err
+		}
+		if user.AuthProvider == model.AuthProviderOIDC {
+			var count int64
+			if err := tx.Model(&model.UserIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count <= 1 {
+				return ErrOIDCLastIdentity
+			}
+		}
+		return tx.Delete(&identity).Error
+	})
+}
@@ -0,0 +1,143 @@
+package dao
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试 OIDC 登录：首次登录创建用户，之后按 subject 找到同一个用户，已有用户可以关联外部身份
+func TestOIDCDao_Callback(t *testing.T) {
+	server := oidctest.NewServer("fun_code", "secret")
+	defer server.Close()
+
+	db := testutils.SetupTestDB()
+	oidcDao := NewOIDCDao(db, config.OIDCConfig{
+		Enabled:      true,
+		Issuer:       server.Issuer(),
+		ClientID:     "fun_code",
+		ClientSecret: "secret",
+		RoleMapping:  map[string]string{"teachers": model.RoleTeacher, "students": model.RoleStudent},
+	}, cache.NewOIDCStateCache(cache.NewGoCache()))
+
+	// start 发起登录并在身份提供方完成登录，返回回调中的 state、code 和浏览器中的 state cookie
+	start := func(linkUserID uint, claims map[string]interface{}) (string, string, string) {
+		authURL, state, err := oidcDao.AuthCodeURL("http://localhost:8080/api/auth/oidc/callback", "/classes", linkUserID)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		callback, err := server.Login(authURL, claims)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		u, _ := url.Parse(callback)
+		assert.Equal(t, state, u.Query().Get("state"))
+		return state, u.Query().Get("code"), OIDCStateHash(state)
+	}
+	// login 模拟完整的登录流程，关联外部身份时由发起关联的用户完成回调，返回回调的处理结果
+	var lastState string
+	login := func(linkUserID uint, claims map[string]interface{}) (*OIDCLoginResult, error) {
+		state, code, cookie := start(linkUserID, claims)
+		lastState = state
+		return oidcDao.Callback(state, code, OIDCCallbackClient{StateCookie: cookie, SessionUserID: linkUserID})
+	}
+
+	// 首次登录创建用户
+	result, err := login(0, map[string]interface{}{
+		"sub": "sub-alice", "preferred_username": "alice", "name": "王老师", "email": "alice@school.local", "groups": []string{"teachers"},
+	})
+	assert.NoError(t, err)
+	assert.False(t, result.Linked)
+	assert.Equal(t, "/classes", result.ReturnTo)
+	alice := result.User
+	assert.Equal(t, "alice", alice.Username)
+	assert.Equal(t, "王老师", alice.Nickname)
+	assert.Equal(t, model.RoleTeacher, alice.Role)
+	assert.Equal(t, model.AuthProviderOIDC, alice.AuthProvider)
+	assert.Empty(t, alice.Password)
+
+	// 登录后签发的令牌与密码登录的一样，认证中间件不需要区分
+	authDao := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+	response, err := authDao.StartSession(alice, SessionClient{UserAgent: "test-agent", IP: "10.0.0.4"})
+	assert.NoError(t, err)
+	claims, err := authDao.ValidateToken(response.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.ID, claims.UserID)
+
+	// state 只能使用一次
+	_, err = oidcDao.Callback(lastState, "any", OIDCCallbackClient{StateCookie: OIDCStateHash(lastState)})
+	assert.ErrorIs(t, err, ErrOIDCStateInvalid)
+
+	// 回调必须来自发起登录的浏览器，把别人发起的登录回调发给受害者不能完成登录
+	state, code, _ := start(0, map[string]interface{}{"sub": "sub-alice", "groups": []string{"teachers"}})
+	_, err = oidcDao.Callback(state, code, OIDCCallbackClient{})
+	assert.ErrorIs(t, err, ErrOIDCStateInvalid)
+	_, err = oidcDao.Callback(state, code, OIDCCallbackClient{StateCookie: OIDCStateHash("other")})
+	assert.ErrorIs(t, err, ErrOIDCStateInvalid)
+
+	// 再次登录是同一个用户，角色按声明同步
+	result, err = login(0, map[string]interface{}{"sub": "sub-alice", "preferred_username": "alice", "groups": []string{"students"}})
+	assert.NoError(t, err)
+	assert.Equal(t, alice.ID, result.User.ID)
+	assert.Equal(t, model.RoleStudent, result.User.Role)
+	assert.Equal(t, "王老师", result.User.Nickname)
+
+	// 不同的 subject 用户名重复时加上数字后缀
+	result, err = login(0, map[string]interface{}{"sub": "sub-alice-2", "preferred_username": "alice", "groups": []string{"students"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice2", result.User.Username)
+
+	// 没有允许登录的角色时不创建用户
+	_, err = login(0, map[string]interface{}{"sub": "sub-guest", "preferred_username": "guest", "groups": []string{"guests"}})
+	assert.ErrorIs(t, err, ErrOIDCNoRole)
+	var count int64
+	db.Model(&model.User{}).Where("username = ?", "guest").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// 本地帐号关联外部身份，之后用外部身份登录，角色不受外部的组影响
+	local := model.User{Username: "teacher1", Password: "x", Email: "teacher1@example.com", Role: model.RoleTeacher}
+	assert.NoError(t, db.Create(&local).Error)
+	result, err = login(local.ID, map[string]interface{}{"sub": "sub-teacher1", "groups": []string{"students"}})
+	assert.NoError(t, err)
+	assert.True(t, result.Linked)
+	assert.Equal(t, local.ID, result.User.ID)
+	result, err = login(0, map[string]interface{}{"sub": "sub-teacher1", "groups": []string{"students"}})
+	assert.NoError(t, err)
+	assert.Equal(t, local.ID, result.User.ID)
+	assert.Equal(t, model.RoleTeacher, result.User.Role)
+
+	// 关联外部身份的回调中，当前登录的用户必须是发起关联的用户
+	state, code, cookie := start(local.ID, map[string]interface{}{"sub": "sub-teacher1-b"})
+	_, err = oidcDao.Callback(state, code, OIDCCallbackClient{StateCookie: cookie, SessionUserID: alice.ID})
+	assert.ErrorIs(t, err, ErrOIDCLinkUserChanged)
+	state, code, cookie = start(local.ID, map[string]interface{}{"sub": "sub-teacher1-b"})
+	_, err = oidcDao.Callback(state, code, OIDCCallbackClient{StateCookie: cookie})
+	assert.ErrorIs(t, err, ErrOIDCLinkUserChanged)
+
+	// 已关联其他用户的外部身份不能再关联
+	_, err = login(local.ID, map[string]interface{}{"sub": "sub-alice"})
+	assert.ErrorIs(t, err, ErrOIDCIdentityLinked)
+
+	// 单点登录创建的用户不能解除最后一个外部身份，本地帐号可以
+	identities, err := oidcDao.ListIdentities(alice.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, identities, 1) {
+		assert.Equal(t, "sub-alice", identities[0].Subject)
+		assert.Equal(t, server.Issuer(), identities[0].Issuer)
+		assert.ErrorIs(t, oidcDao.UnlinkIdentity(alice.ID, identities[0].ID), ErrOIDCLastIdentity)
+		assert.Error(t, oidcDao.UnlinkIdentity(local.ID, identities[0].ID))
+	}
+	identities, err = oidcDao.ListIdentities(local.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, identities, 1) {
+		assert.NoError(t, oidcDao.UnlinkIdentity(local.ID, identities[0].ID))
+	}
+	identities, _ = oidcDao.ListIdentities(local.ID)
+	assert.Empty(t, identities)
+}
@@ -0,0 +1,339 @@
+package dao
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/mail"
+	"github.com/jun/fun_code/internal/model"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPasswordPolicy 新密码不符合密码策略，具体原因包装在错误信息中
+	ErrPasswordPolicy = errors.New("新密码不符合要求")
+	// ErrWrongPassword 修改密码时旧密码不正确
+	ErrWrongPassword = errors.New("原密码不正确")
+	// ErrPasswordExternal 外部目录或单点登录的帐号没有本地密码
+	ErrPasswordExternal = errors.New("该帐号的密码由学校的统一身份认证管理，请在那里修改")
+	// ErrResetCodeInvalid 用户名或重置码不正确，或重置码已过期
+	ErrResetCodeInvalid = errors.New("重置码无效或已过期")
+	// ErrNotClassStudent 老师只能重置自己班级中学生的密码
+	ErrNotClassStudent = errors.New("班级不存在或该学生不在您的班级中")
+	// ErrEmailResetDisabled 没有配置发信服务器
+	ErrEmailResetDisabled = errors.New("未开启邮件找回密码")
+)
+
+const (
+	// resetCodeAlphabet 重置码去掉了容易看错的 0、O、1、I、L
+	resetCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	// teacherResetCodeLength 老师抄给学生的重置码，显示为 XXXX-XXXX
+	teacherResetCodeLength = 8
+	// emailResetCodeLength 邮件中的重置码放在链接里，不需要手动输入
+	emailResetCodeLength = 16
+	// resetCodeMaxAttempts 输错这么多次后重置码作废
+	resetCodeMaxAttempts = 5
+	// emailResetInterval 同一个帐号两封找回密码邮件的最短间隔
+	emailResetInterval = time.Minute
+)
+
+type PasswordDaoImpl struct {
+	db            *gorm.DB
+	policy        config.PasswordConfig
+	resetCodeTTL  time.Duration
+	emailResetTTL time.Duration
+	sender        mail.Sender // 为 nil 表示不能通过邮件找回密码
+	resetURL      string      // 邮件中链接指向的重置密码页面
+}
+
+// NewPasswordDao 创建密码DAO，有效期格式错误时使用默认值，配置已在 Validate 中检查。
+// sender 为 nil 表示不开启邮件找回密码，resetURL 为邮件中链接指向的重置密码页面
+func NewPasswordDao(db *gorm.DB, policy config.PasswordConfig, sender mail.Sender, resetURL string) PasswordDao {
+	resetCodeTTL, err := policy.ResetCodeTTLDuration()
+	if err != nil || resetCodeTTL <= 0 {
+		resetCodeTTL = config.DefaultResetCodeTTL
+	}
+	emailResetTTL, err := policy.EmailResetTTLDuration()
+	if err != nil || emailResetTTL <= 0 {
+		emailResetTTL = config.DefaultEmailResetTTL
+	}
+	return &PasswordDaoImpl{
+		db:            db,
+		policy:        policy.WithDefaults(),
+		resetCodeTTL:  resetCodeTTL,
+		emailResetTTL: emailResetTTL,
+		sender:        sender,
+		resetURL:      resetURL,
+	}
+}
+
+func (s *PasswordDaoImpl) Policy() config.PasswordConfig {
+	return s.policy
+}
+
+func (s *PasswordDaoImpl) CheckPolicy(password string) error {
+	if utf8.RuneCountInString(password) < s.policy.MinLength {
+		return fmt.Errorf("%w: 至少需要 %d 个字符", ErrPasswordPolicy, s.policy.MinLength)
+	}
+	if len(password) > 72 {
+		return fmt.Errorf("%w: 不能超过 72 个字节", ErrPasswordPolicy)
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if s.policy.RequireLetter && !hasLetter {
+		return fmt.Errorf("%w: 需要包含字母", ErrPasswordPolicy)
+	}
+	if s.policy.RequireDigit && !hasDigit {
+		return fmt.Errorf("%w: 需要包含数字", ErrPasswordPolicy)
+	}
+	return nil
+}
+
+func (s *PasswordDaoImpl) ChangePassword(userID uint, oldPassword, newPassword string) error {
+	var user model.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.AuthProvider != "" {
+		return ErrPasswordExternal
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+		return ErrWrongPassword
+	}
+	if newPassword == oldPassword {
+		return fmt.Errorf("%w: 不能与原密码相同", ErrPasswordPolicy)
+	}
+	if err := s.CheckPolicy(newPassword); err != nil {
+		return err
+	}
+	return setPassword(s.db, user.ID, newPassword)
+}
+
+// setPassword 保存新密码的哈希，并清除强制修改密码的标记
+func setPassword(db *gorm.DB, userID uint, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return db.Model(&model.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"password": string(hash), "must_change_password": false}).Error
+}
+
+// newResetCode 从 resetCodeAlphabet 中随机生成 n 位的重置码
+func newResetCode(n int) (string, error) {
+	code := make([]byte, n)
+	max := big.NewInt(int64(len(resetCodeAlphabet)))
+	for i := range code {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = resetCodeAlphabet[idx.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeResetCode 去掉输入中的分隔符和空格并转为大写
+func normalizeResetCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, code)
+}
+
+// formatResetCode 老师的重置码每 4 位加一个 -，方便抄写
+func formatResetCode(code string) string {
+	if len(code) != teacherResetCodeLength {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+// createReset 生成重置码，同一用户之前未使用的重置码同时作废
+func (s *PasswordDaoImpl) createReset(userID, createdBy uint, kind string, length int, ttl time.Duration) (string, time.Time, error) {
+	code, err := newResetCode(length)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	reset := model.PasswordReset{
+		UserID:    userID,
+		CodeHash:  hashRefreshToken(code),
+		Kind:      kind,
+		CreatedBy: createdBy,
+		ExpiresAt: now.Add(ttl),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PasswordReset{}).Where("user_id = ? AND used_at IS NULL", userID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&reset).Error
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return code, reset.ExpiresAt, nil
+}
+
+func (s *PasswordDaoImpl) CreateResetCode(classID, teacherID, studentID uint) (*PasswordResetCode, error) {
+	var class model.Class
+	if err := s.db.Where("id = ? AND teacher_id = ?", classID, teacherID).First(&class).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotClassStudent
+		}
+		return nil, err
+	}
+	var student model.User
+	if err := classStudents(s.db, classID, []uint{studentID}).First(&student).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotClassStudent
+		}
+		return nil, err
+	}
+	if student.AuthProvider != "" {
+		return nil, ErrPasswordExternal
+	}
+
+	code, expiresAt, err := s.createReset(student.ID, teacherID, model.PasswordResetTeacher, teacherResetCodeLength, s.resetCodeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &PasswordResetCode{User: student, Code: formatResetCode(code), ExpiresAt: expiresAt}, nil
+}
+
+func (s *PasswordDaoImpl) ResetPassword(username, code, newPassword string) (*model.User, error) {
+	if err := s.CheckPolicy(newPassword); err != nil {
+		return nil, err
+	}
+	code = normalizeResetCode(code)
+	if username == "" || code == "" {
+		return nil, ErrResetCodeInvalid
+	}
+
+	var user model.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrResetCodeInvalid
+		}
+		return nil, err
+	}
+	if user.AuthProvider != "" {
+		return nil, ErrResetCodeInvalid
+	}
+
+	now := time.Now()
+	var resets []model.PasswordReset
+	err := s.db.Where("user_id = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?", user.ID, now, resetCodeMaxAttempts).
+		Find(&resets).Error
+	if err != nil {
+		return nil, err
+	}
+	hash := hashRefreshToken(code)
+	matched := false
+	for _, reset := range resets {
+		if subtle.ConstantTimeCompare([]byte(reset.CodeHash), []byte(hash)) == 1 {
+			matched = true
+		}
+	}
+	if !matched {
+		// 输错的次数记在用户所有有效的重置码上，防止逐个猜测
+		if len(resets) > 0 {
+			s.db.Model(&model.PasswordReset{}).Where("user_id = ? AND used_at IS NULL", user.ID).
+				UpdateColumn("attempts", gorm.Expr("attempts + ?", 1))
+		}
+		return nil, ErrResetCodeInvalid
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证同一个重置码只能使用一次
+		result := tx.Model(&model.PasswordReset{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hash).Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetCodeInvalid
+		}
+		if err := tx.Model(&model.PasswordReset{}).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return setPassword(tx, user.ID, newPassword)
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.MustChangePassword = false
+	return &user, nil
+}
+
+func (s *PasswordDaoImpl) EmailResetEnabled() bool {
+	return s.sender != nil
+}
+
+func (s *PasswordDaoImpl) SendResetEmail(email string) error {
+	if s.sender == nil {
+		return ErrEmailResetDisabled
+	}
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil
+	}
+
+	var user model.User
+	if err := s.db.Where("email = ? AND (auth_provider = ? OR auth_provider IS NULL)", email, "").First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// 限制发送频率，避免被用来向别人的邮箱发送大量邮件
+	var recent int64
+	err := s.db.Model(&model.PasswordReset{}).
+		Where("user_id = ? AND kind = ? AND created_at > ?", user.ID, model.PasswordResetEmail, time.Now().Add(-emailResetInterval)).
+		Count(&recent).Error
+	if err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	code, _, err := s.createReset(user.ID, 0, model.PasswordResetEmail, emailResetCodeLength, s.emailResetTTL)
+	if err != nil {
+		return err
+	}
+	link := s.resetURL + "?" + url.Values{"username": {user.Username}, "code": {code}}.Encode()
+	return s.sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "重置您的密码",
+		Body: fmt.Sprintf("%s，您好：\n\n有人请求重置您的帐号 %s 的密码。如果是您本人操作，请在 %d 分钟内打开下面的链接设置新密码：\n\n%s\n\n如果不是您本人操作，请忽略这封邮件，您的密码不会改变。\n",
+			displayName(&user), user.Username, int(s.emailResetTTL.Minutes()), link),
+	})
+}
+
+// displayName 优先使用昵称称呼用户
+func displayName(user *model.User) string {
+	if user.Nickname != "" {
+		return user.Nickname
+	}
+	return user.Username
+}
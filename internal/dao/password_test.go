@@ -0,0 +1,168 @@
+package dao
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/mail"
+	"github.com/jun/fun_code/internal/mail/mailtest"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试修改密码：检查旧密码和密码策略，临时密码登录后令牌要求先修改密码，修改后不再要求
+func TestPasswordDao_ChangePassword(t *testing.T) {
+	db := testutils.SetupTestDB()
+	passwordDao := NewPasswordDao(db, config.PasswordConfig{MinLength: 8, RequireDigit: true}, nil, "")
+	authDao := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+
+	user := &model.User{Username: "kid", Password: "temp1234", Email: "kid@example.com", Role: model.RoleStudent, MustChangePassword: true}
+	assert.NoError(t, NewUserDao(db).CreateUser(user))
+
+	client := SessionClient{UserAgent: "test-agent", IP: "10.0.0.5"}
+	response, err := authDao.Login("kid", "temp1234", client)
+	assert.NoError(t, err)
+	assert.True(t, response.MustChangePassword)
+	claims, err := authDao.ValidateToken(response.Token)
+	assert.NoError(t, err)
+	assert.True(t, claims.MustChangePassword)
+
+	assert.ErrorIs(t, passwordDao.ChangePassword(user.ID, "wrong", "newpass123"), ErrWrongPassword)
+	assert.ErrorIs(t, passwordDao.ChangePassword(user.ID, "temp1234", "short1"), ErrPasswordPolicy)
+	assert.ErrorIs(t, passwordDao.ChangePassword(user.ID, "temp1234", "nodigitsatall"), ErrPasswordPolicy)
+	assert.ErrorIs(t, passwordDao.ChangePassword(user.ID, "temp1234", "temp1234"), ErrPasswordPolicy)
+	assert.NoError(t, passwordDao.ChangePassword(user.ID, "temp1234", "newpass123"))
+
+	response, err = authDao.Login("kid", "newpass123", client)
+	assert.NoError(t, err)
+	assert.False(t, response.MustChangePassword)
+	claims, err = authDao.ValidateToken(response.Token)
+	assert.NoError(t, err)
+	assert.False(t, claims.MustChangePassword)
+
+	// 外部目录的帐号没有本地密码
+	external := model.User{Username: "ldapuser", Role: model.RoleStudent, AuthProvider: model.AuthProviderLDAP}
+	assert.NoError(t, db.Create(&external).Error)
+	assert.ErrorIs(t, passwordDao.ChangePassword(external.ID, "", "newpass123"), ErrPasswordExternal)
+}
+
+// 测试老师生成的重置码：只能重置自己班级中的学生，只能使用一次，输错太多次后作废
+func TestPasswordDao_ResetCode(t *testing.T) {
+	db := testutils.SetupTestDB()
+	passwordDao := NewPasswordDao(db, config.PasswordConfig{}, nil, "")
+	classDao := NewClassDao(db)
+	userDao := NewUserDao(db)
+
+	teacher := &model.User{Username: "teacher", Password: "x", Email: "teacher@example.com", Role: model.RoleTeacher}
+	assert.NoError(t, userDao.CreateUser(teacher))
+	student := &model.User{Username: "kid", Nickname: "小明", Password: "forgotten", Email: "kid@example.com", Role: model.RoleStudent}
+	assert.NoError(t, userDao.CreateUser(student))
+	other := &model.User{Username: "other", Password: "x", Email: "other@example.com", Role: model.RoleStudent}
+	assert.NoError(t, userDao.CreateUser(other))
+	class, err := classDao.CreateClass(teacher.ID, "三年级", "", "2024-09-01", "2025-07-01")
+	assert.NoError(t, err)
+	assert.NoError(t, classDao.AddStudent(class.ID, teacher.ID, student.ID, "student"))
+
+	// 不是班级的老师，或学生不在班级中
+	_, err = passwordDao.CreateResetCode(class.ID, teacher.ID+100, student.ID)
+	assert.ErrorIs(t, err, ErrNotClassStudent)
+	_, err = passwordDao.CreateResetCode(class.ID, teacher.ID, other.ID)
+	assert.ErrorIs(t, err, ErrNotClassStudent)
+
+	reset, err := passwordDao.CreateResetCode(class.ID, teacher.ID, student.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, student.ID, reset.User.ID)
+	assert.Len(t, reset.Code, teacherResetCodeLength+1)
+	assert.WithinDuration(t, time.Now().Add(config.DefaultResetCodeTTL), reset.ExpiresAt, time.Minute)
+
+	// 重新生成后旧的重置码失效
+	old := reset.Code
+	reset, err = passwordDao.CreateResetCode(class.ID, teacher.ID, student.ID)
+	assert.NoError(t, err)
+	_, err = passwordDao.ResetPassword("kid", old, "newpass")
+	assert.ErrorIs(t, err, ErrResetCodeInvalid)
+
+	// 新密码不符合策略时不消耗重置码
+	_, err = passwordDao.ResetPassword("kid", reset.Code, "abc")
+	assert.ErrorIs(t, err, ErrPasswordPolicy)
+	_, err = passwordDao.ResetPassword("other", reset.Code, "newpass")
+	assert.ErrorIs(t, err, ErrResetCodeInvalid)
+
+	// 输入时大小写和分隔符不影响
+	user, err := passwordDao.ResetPassword("kid", strings.ToLower(strings.ReplaceAll(reset.Code, "-", " ")), "newpass")
+	assert.NoError(t, err)
+	assert.Equal(t, student.ID, user.ID)
+	authDao := NewAuthDao(db, config.JWTConfig{SecretKey: "test_key"}, cache.NewUserSessionCache(cache.NewGoCache()), cache.NewLoginAttemptCache(cache.NewGoCache()), false)
+	_, err = authDao.Login("kid", "newpass", SessionClient{IP: "10.0.0.6"})
+	assert.NoError(t, err)
+
+	// 只能使用一次
+	_, err = passwordDao.ResetPassword("kid", reset.Code, "another")
+	assert.ErrorIs(t, err, ErrResetCodeInvalid)
+
+	// 输错太多次后正确的重置码也不能再用
+	reset, err = passwordDao.CreateResetCode(class.ID, teacher.ID, student.ID)
+	assert.NoError(t, err)
+	for i := 0; i < resetCodeMaxAttempts; i++ {
+		_, err = passwordDao.ResetPassword("kid", "AAAA-AAAA", "another")
+		assert.ErrorIs(t, err, ErrResetCodeInvalid)
+	}
+	_, err = passwordDao.ResetPassword("kid", reset.Code, "another")
+	assert.ErrorIs(t, err, ErrResetCodeInvalid)
+
+	// 过期的重置码不能使用
+	reset, err = passwordDao.CreateResetCode(class.ID, teacher.ID, student.ID)
+	assert.NoError(t, err)
+	db.Model(&model.PasswordReset{}).Where("user_id = ? AND used_at IS NULL", student.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	_, err = passwordDao.ResetPassword("kid", reset.Code, "another")
+	assert.ErrorIs(t, err, ErrResetCodeInvalid)
+}
+
+// 测试通过邮件找回密码：邮件经过本地的 SMTP 服务器，邮件中的链接可以重置密码
+func TestPasswordDao_SendResetEmail(t *testing.T) {
+	server := mailtest.NewServer()
+	defer server.Close()
+
+	db := testutils.SetupTestDB()
+	sender := mail.NewSMTPSender(config.SMTPConfig{Host: server.Host(), Port: server.Port(), From: "noreply@school.local"})
+	passwordDao := NewPasswordDao(db, config.PasswordConfig{}, sender, "https://code.school.local/www/reset_password")
+	assert.True(t, passwordDao.EmailResetEnabled())
+	assert.False(t, NewPasswordDao(db, config.PasswordConfig{}, nil, "").EmailResetEnabled())
+
+	user := &model.User{Username: "alice", Nickname: "王老师", Password: "forgotten", Email: "alice@school.local", Role: model.RoleTeacher}
+	assert.NoError(t, NewUserDao(db).CreateUser(user))
+
+	// 邮箱不存在时同样返回成功，但不发送邮件
+	assert.NoError(t, passwordDao.SendResetEmail("nobody@school.local"))
+	assert.Empty(t, server.Messages())
+
+	assert.NoError(t, passwordDao.SendResetEmail("alice@school.local"))
+	messages := server.Messages()
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	assert.Equal(t, "noreply@school.local", messages[0].From)
+	assert.Equal(t, []string{"alice@school.local"}, messages[0].To)
+	assert.Equal(t, "重置您的密码", messages[0].Subject())
+	body := messages[0].Body()
+	assert.Contains(t, body, "王老师")
+
+	// 短时间内不重复发送
+	assert.NoError(t, passwordDao.SendResetEmail("alice@school.local"))
+	assert.Len(t, server.Messages(), 1)
+
+	start := strings.Index(body, "https://code.school.local/www/reset_password?")
+	if !assert.True(t, start >= 0) {
+		return
+	}
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", link.Query().Get("username"))
+	_, err = passwordDao.ResetPassword(link.Query().Get("username"), link.Query().Get("code"), "newpass")
+	assert.NoError(t, err)
+}
@@ -371,7 +371,8 @@ func (d *ProgramDaoImpl) CountAllPrograms(userID *uint) (int64, error) {
 func (d *ProgramDaoImpl) SearchPrograms(keyword string, userID *uint) ([]model.Program, error) {
 	var programs []model.Program
 
-	query := d.db.Model(&model.Program{}).Where("name LIKE ?", "%"+keyword+"%")
+	condition, args := likeCondition(keyword, "name")
+	query := d.db.Model(&model.Program{}).Where(condition, args...)
 
 	// 如果指定了用户ID，则添加用户筛选
 	if userID != nil {
@@ -0,0 +1,216 @@
+package dao
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/jun/fun_code/internal/model"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRoleNotFound 角色不存在
+	ErrRoleNotFound = errors.New("角色不存在")
+	// ErrRoleExists 角色名称已被使用
+	ErrRoleExists = errors.New("角色已存在")
+	// ErrRoleName 角色名称格式不正确
+	ErrRoleName = errors.New("角色名称只能包含小写字母、数字和下划线，最长 20 个字符")
+	// ErrRoleBuiltIn 内置角色不能删除
+	ErrRoleBuiltIn = errors.New("内置角色不能删除")
+	// ErrRoleInUse 还有用户使用该角色
+	ErrRoleInUse = errors.New("还有用户使用该角色，不能删除")
+	// ErrUnknownPermission 权限不存在
+	ErrUnknownPermission = errors.New("权限不存在")
+	// ErrAdminPermission 管理员角色必须保留管理所有资源的权限，否则没有人能再修改角色
+	ErrAdminPermission = errors.New("管理员角色必须拥有 manage_all 权限")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+type RoleDaoImpl struct {
+	db *gorm.DB
+}
+
+func NewRoleDao(db *gorm.DB) RoleDao {
+	return &RoleDaoImpl{db: db}
+}
+
+func (s *RoleDaoImpl) ListRoles() ([]RoleInfo, error) {
+	var roles []model.Role
+	if err := s.db.Preload("Permissions").Order("id ASC").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	infos := make([]RoleInfo, 0, len(roles))
+	for i := range roles {
+		infos = append(infos, toRoleInfo(&roles[i]))
+	}
+	return infos, nil
+}
+
+func (s *RoleDaoImpl) GetRolePermissions(role string) ([]string, error) {
+	var permissions []string
+	err := s.db.Model(&model.RolePermission{}).
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ?", role).
+		Order("role_permissions.permission").
+		Pluck("role_permissions.permission", &permissions).Error
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (s *RoleDaoImpl) GetRole(name string) (*RoleInfo, error) {
+	var role model.Role
+	if err := s.db.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	info := toRoleInfo(&role)
+	return &info, nil
+}
+
+func (s *RoleDaoImpl) RoleExists(role string) (bool, error) {
+	var count int64
+	if err := s.db.Model(&model.Role{}).Where("name = ?", role).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *RoleDaoImpl) CreateRole(name, description string, permissions []string) (*RoleInfo, error) {
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrRoleName
+	}
+	rolePermissions, err := toRolePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := s.RoleExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrRoleExists
+	}
+
+	role := model.Role{Name: name, Description: description, Permissions: rolePermissions}
+	if err := s.db.Create(&role).Error; err != nil {
+		return nil, err
+	}
+	info := toRoleInfo(&role)
+	return &info, nil
+}
+
+func (s *RoleDaoImpl) UpdateRole(name, description string, permissions []string) (*RoleInfo, error) {
+	rolePermissions, err := toRolePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+	if name == model.RoleAdmin && !containsString(permissions, model.PermissionManageAll) {
+		return nil, ErrAdminPermission
+	}
+
+	var role model.Role
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+		if err := tx.Model(&role).Update("description", description).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		for i := range rolePermissions {
+			rolePermissions[i].RoleID = role.ID
+		}
+		if len(rolePermissions) > 0 {
+			if err := tx.Create(&rolePermissions).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	role.Description = description
+	role.Permissions = rolePermissions
+	info := toRoleInfo(&role)
+	return &info, nil
+}
+
+func (s *RoleDaoImpl) DeleteRole(name string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var role model.Role
+		if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+		if role.BuiltIn {
+			return ErrRoleBuiltIn
+		}
+		var users int64
+		if err := tx.Model(&model.User{}).Where("role = ?", name).Count(&users).Error; err != nil {
+			return err
+		}
+		if users > 0 {
+			return ErrRoleInUse
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+}
+
+// toRolePermissions 检查权限是否都已定义，去掉重复的权限
+func toRolePermissions(permissions []string) ([]model.RolePermission, error) {
+	seen := make(map[string]bool, len(permissions))
+	rolePermissions := make([]model.RolePermission, 0, len(permissions))
+	for _, p := range permissions {
+		if !model.IsPermission(p) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		rolePermissions = append(rolePermissions, model.RolePermission{Permission: p})
+	}
+	return rolePermissions, nil
+}
+
+func toRoleInfo(role *model.Role) RoleInfo {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		permissions = append(permissions, p.Permission)
+	}
+	sort.Strings(permissions)
+	return RoleInfo{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		BuiltIn:     role.BuiltIn,
+		Permissions: permissions,
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试角色管理：迁移写入内置角色，自定义角色可以创建、修改和删除
+func TestRoleDao(t *testing.T) {
+	db := testutils.SetupTestDB()
+	roleDao := NewRoleDao(db)
+
+	// 内置角色与原来写死的权限相同
+	roles, err := roleDao.ListRoles()
+	assert.NoError(t, err)
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+		assert.True(t, role.BuiltIn)
+	}
+	assert.Equal(t, []string{model.RoleAdmin, model.RoleTeacher, model.RoleStudent, model.RoleAssistant}, names)
+	permissions, err := roleDao.GetRolePermissions(model.RoleTeacher)
+	assert.NoError(t, err)
+	assert.Contains(t, permissions, model.PermissionManageOwnClass)
+	assert.Contains(t, permissions, model.PermissionManageOwnStudents)
+	permissions, err = roleDao.GetRolePermissions("nobody")
+	assert.NoError(t, err)
+	assert.Empty(t, permissions)
+
+	// 创建自定义角色
+	_, err = roleDao.CreateRole("Bad Name", "", nil)
+	assert.ErrorIs(t, err, ErrRoleName)
+	_, err = roleDao.CreateRole("librarian", "", []string{"fly"})
+	assert.ErrorIs(t, err, ErrUnknownPermission)
+	_, err = roleDao.CreateRole(model.RoleTeacher, "", nil)
+	assert.ErrorIs(t, err, ErrRoleExists)
+	role, err := roleDao.CreateRole("librarian", "管理课程资料", []string{model.PermissionViewCourseScratch, model.PermissionCreateScratch, model.PermissionCreateScratch})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{model.PermissionCreateScratch, model.PermissionViewCourseScratch}, role.Permissions)
+	exists, err := roleDao.RoleExists("librarian")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	// 修改权限整体替换
+	role, err = roleDao.UpdateRole("librarian", "只读", []string{model.PermissionViewClassScratch})
+	assert.NoError(t, err)
+	assert.Equal(t, "只读", role.Description)
+	permissions, err = roleDao.GetRolePermissions("librarian")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{model.PermissionViewClassScratch}, permissions)
+	_, err = roleDao.UpdateRole("nobody", "", nil)
+	assert.ErrorIs(t, err, ErrRoleNotFound)
+	_, err = roleDao.UpdateRole(model.RoleAdmin, "", []string{model.PermissionManageUsers})
+	assert.ErrorIs(t, err, ErrAdminPermission)
+
+	// 内置角色和还有用户使用的角色不能删除
+	assert.ErrorIs(t, roleDao.DeleteRole(model.RoleStudent), ErrRoleBuiltIn)
+	assert.NoError(t, NewUserDao(db).CreateUser(&model.User{Username: "lib", Password: "password", Email: "lib@example.com", Role: "librarian"}))
+	assert.ErrorIs(t, roleDao.DeleteRole("librarian"), ErrRoleInUse)
+	assert.NoError(t, db.Model(&model.User{}).Where("username = ?", "lib").Update("role", model.RoleTeacher).Error)
+	assert.NoError(t, roleDao.DeleteRole("librarian"))
+	permissions, err = roleDao.GetRolePermissions("librarian")
+	assert.NoError(t, err)
+	assert.Empty(t, permissions)
+	assert.ErrorIs(t, roleDao.DeleteRole("librarian"), ErrRoleNotFound)
+}
+
+// 测试班级成员角色：老师可以把其他教师设为助教，学生不能当助教，助教不算作学生
+func TestClassDao_MemberRole(t *testing.T) {
+	db := testutils.SetupTestDB()
+	classDao := NewClassDao(db)
+	userDao := NewUserDao(db)
+
+	teacher := &model.User{Username: "teacher", Password: "password", Email: "teacher@example.com", Role: model.RoleTeacher}
+	assert.NoError(t, userDao.CreateUser(teacher))
+	helper := &model.User{Username: "helper", Password: "password", Email: "helper@example.com", Role: model.RoleTeacher}
+	assert.NoError(t, userDao.CreateUser(helper))
+	classmate := &model.User{Username: "classmate", Password: "password", Email: "classmate@example.com", Role: model.RoleStudent}
+	assert.NoError(t, userDao.CreateUser(classmate))
+	stranger := &model.User{Username: "stranger", Password: "password", Email: "stranger@example.com", Role: model.RoleStudent}
+	assert.NoError(t, userDao.CreateUser(stranger))
+	class, err := classDao.CreateClass(teacher.ID, "四年级", "", "2024-09-01", "2025-07-01")
+	assert.NoError(t, err)
+	assert.NoError(t, classDao.AddStudent(class.ID, teacher.ID, helper.ID, model.ClassRoleStudent))
+	assert.NoError(t, classDao.AddStudent(class.ID, teacher.ID, classmate.ID, model.ClassRoleStudent))
+
+	got, role, err := classDao.GetMemberRole(class.ID, teacher.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, teacher.ID, got.TeacherID)
+	assert.Equal(t, model.RoleTeacher, role)
+	_, role, err = classDao.GetMemberRole(class.ID, helper.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ClassRoleStudent, role)
+	_, role, err = classDao.GetMemberRole(class.ID, stranger.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, role)
+	_, _, err = classDao.GetMemberRole(class.ID+100, teacher.ID)
+	assert.Error(t, err)
+
+	assert.Error(t, classDao.SetMemberRole(class.ID, teacher.ID, helper.ID, "admin"))
+	assert.Error(t, classDao.SetMemberRole(class.ID, stranger.ID, helper.ID, model.ClassRoleAssistant))
+	assert.Error(t, classDao.SetMemberRole(class.ID, teacher.ID, stranger.ID, model.ClassRoleAssistant))
+	// 助教可以重置学生的密码，学生当助教就能接管同学的帐号
+	assert.Error(t, classDao.SetMemberRole(class.ID, teacher.ID, classmate.ID, model.ClassRoleAssistant))
+	assert.NoError(t, classDao.SetMemberRole(class.ID, teacher.ID, classmate.ID, model.ClassRoleStudent))
+	assert.NoError(t, classDao.SetMemberRole(class.ID, teacher.ID, helper.ID, model.ClassRoleAssistant))
+	_, role, err = classDao.GetMemberRole(class.ID, helper.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ClassRoleAssistant, role)
+
+	// 助教不会被当作学生重置登录方式或密码
+	var students []model.User
+	assert.NoError(t, classStudents(db, class.ID, nil).Find(&students).Error)
+	if assert.Len(t, students, 1) {
+		assert.Equal(t, classmate.ID, students[0].ID)
+	}
+	listed, err := classDao.ListStudents(class.ID, teacher.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, classmate.ID, listed[0].ID)
+	}
+}
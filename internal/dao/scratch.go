@@ -9,7 +9,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
+	"regexp"
+	"sync"
 	"time"
 
 	"github.com/jun/fun_code/internal/config"
@@ -33,15 +34,21 @@ type ScratchDaoImpl struct {
 	basePath string // 文件存储的基础路径
 	cfg      *config.Config
 	logger   *zap.Logger
+
+	// 保存后在后台清理历史文件，同一个项目同时只有一个清理任务。
+	// 项目ID -> 清理期间又保存了的项目，为 nil 表示没有
+	compactMu  sync.Mutex
+	compacting map[uint]*model.ScratchProject
 }
 
 // NewScratchDao 创建一个新的ScratchService实例
 func NewScratchDao(db *gorm.DB, basePath string, cfg *config.Config, logger *zap.Logger) ScratchDao {
 	return &ScratchDaoImpl{
-		db:       db,
-		basePath: basePath,
-		cfg:      cfg,
-		logger:   logger,
+		db:         db,
+		basePath:   basePath,
+		cfg:        cfg,
+		logger:     logger,
+		compacting: make(map[uint]*model.ScratchProject),
 	}
 }
 
@@ -206,53 +213,71 @@ func (s *ScratchDaoImpl) SaveProject(userID uint, projectID uint, name string, c
 		}
 	}
 
-	// 删除超出配置限制的历史文件
-	go s.deleteHistoryFile(projectID, project.FilePath)
+	// 按保留策略清理历史文件
+	s.scheduleCompactProjectHistory(project)
 
 	return project.ID, nil
 }
 
-const (
-	defaultHistoryFileLimit = 20
-)
+// md5Pattern 历史版本的 MD5，只允许 32 位小写十六进制，避免拼出目录外的路径
+var md5Pattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
 
-// 异步删除超出配置限制的历史文件，默认最多20个历史文件
-func (s *ScratchDaoImpl) deleteHistoryFile(projectID uint, path string) error {
-	// 获取项目文件
-	files, err := filepath.Glob(filepath.Join(s.basePath, path, fmt.Sprintf("%d_*.json", projectID)))
-	if err != nil {
-		return err
+// historyFilename 项目指定 MD5 的历史文件路径，文件不存在时返回错误
+func (s *ScratchDaoImpl) historyFilename(project *model.ScratchProject, md5 string) (string, error) {
+	if !md5Pattern.MatchString(md5) {
+		return "", gorails.NewError(http.StatusBadRequest, gorails.ERR_DAO, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
 	}
-
-	// 获取文件创建时间
-
-	histories := make([]model.History, len(files))
-	for i, file := range files {
-		info, err := os.Stat(file)
-		if err != nil {
-			return err
-		}
-		histories[i] = model.History{
-			Filename:  file,
-			CreatedAt: info.ModTime(),
-		}
+	filename := filepath.Join(s.basePath, project.FilePath, fmt.Sprintf("%d_%s.json", project.ID, md5))
+	if _, err := os.Stat(filename); err != nil {
+		return "", gorails.NewError(http.StatusNotFound, gorails.ERR_DAO, global.ERR_MODULE_SCRATCH, global.ErrorCodeFileNotFound, global.ErrorMsgFileNotFound, err)
 	}
+	return filename, nil
+}
 
-	// 删除超出配置限制的历史文件
-	if len(files) > defaultHistoryFileLimit {
+// GetProjectHistory 读取项目指定 MD5 的历史版本
+// 与 GetProjectBinary 不同，版本不存在时返回错误而不是示例项目
+func (s *ScratchDaoImpl) GetProjectHistory(projectID uint, md5 string) ([]byte, error) {
+	project, err := s.GetProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	filename, err := s.historyFilename(project, md5)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_SCRATCH, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+	}
+	return content, nil
+}
 
-		// 按创建时间逆序排序
-		sort.Slice(histories, func(i, j int) bool {
-			return histories[i].CreatedAt.Before(histories[j].CreatedAt)
-		})
+// RestoreProjectHistory 把指定 MD5 的历史版本设为当前版本
+func (s *ScratchDaoImpl) RestoreProjectHistory(projectID uint, md5 string) (*model.ScratchProject, error) {
+	project, err := s.GetProject(projectID)
+	if err != nil {
+		return nil, err
+	}
+	filename, err := s.historyFilename(project, md5)
+	if err != nil {
+		return nil, err
+	}
 
-		// 删除超出配置限制的历史文件
-		for i := 0; i < len(files)-defaultHistoryFileLimit; i++ {
-			os.Remove(histories[i].Filename)
-		}
+	// 更新文件时间，让恢复的版本排在历史记录最前面，也不会被当作最旧的历史文件清理掉
+	now := time.Now()
+	if err := os.Chtimes(filename, now, now); err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_SCRATCH, global.ErrorCodeWriteFileFailed, global.ErrorMsgWriteFileFailed, err)
 	}
 
-	return nil
+	if err := s.db.Model(project).Updates(map[string]interface{}{
+		"md5":        md5,
+		"updated_at": now,
+	}).Error; err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_SCRATCH, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+	project.MD5 = md5
+	project.UpdatedAt = now
+	return project, nil
 }
 
 func (s *ScratchDaoImpl) CountProjects(userID uint) (int64, error) {
@@ -456,12 +481,13 @@ func (s *ScratchDaoImpl) GetScratchBasePath() string {
 func (s *ScratchDaoImpl) SearchProjects(userID uint, keyword string) ([]model.ScratchProject, error) {
 	var projects []model.ScratchProject
 
+	condition, args := likeCondition(keyword, "name")
 	if userID == 0 {
-		if err := s.db.Where("name LIKE ?", "%"+keyword+"%").Find(&projects).Error; err != nil {
+		if err := s.db.Where(condition, args...).Find(&projects).Error; err != nil {
 			return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
 		}
 	} else {
-		if err := s.db.Where("user_id = ? AND name LIKE ?", userID, "%"+keyword+"%").Find(&projects).Error; err != nil {
+		if err := s.db.Where("user_id = ?", userID).Where(condition, args...).Find(&projects).Error; err != nil {
 			return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
 		}
 	}
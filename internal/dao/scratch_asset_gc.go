@@ -0,0 +1,219 @@
+package dao
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/sb3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// DefaultAssetGCMinAge 资源上传后多久才允许被回收，避免删除刚上传、项目还没保存的资源
+const DefaultAssetGCMinAge = 24 * time.Hour
+
+// AssetGCOptions 资源回收参数
+type AssetGCOptions struct {
+	DryRun bool          // 只统计不删除
+	MinAge time.Duration // 比这个时间更新的资源不回收
+	// ReferenceDirs 除项目历史外，还需要扫描引用的项目快照目录，例如作业提交快照
+	ReferenceDirs []string
+}
+
+// AssetGCResult 资源回收结果
+type AssetGCResult struct {
+	ProjectsScanned  int      `json:"projects_scanned"`  // 扫描的项目数
+	FilesScanned     int      `json:"files_scanned"`     // 扫描的 project.json 文件数
+	UnreadableFiles  int      `json:"unreadable_files"`  // 无法解析的 project.json 文件数
+	ReferencedAssets int      `json:"referenced_assets"` // 被引用的资源数
+	OrphanAssets     []string `json:"orphan_assets"`     // 未被引用的资源
+	FilesRemoved     int      `json:"files_removed"`     // 删除的资源文件数
+	RowsRemoved      int      `json:"rows_removed"`      // 删除的 user_assets 记录数
+	BytesReclaimed   int64    `json:"bytes_reclaimed"`   // 释放的磁盘空间
+}
+
+// collectAssetRefs 把 project.json 引用的资源名加入 refs
+func collectAssetRefs(data []byte, refs map[string]bool) error {
+	names, err := sb3.AssetNames(data)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		refs[name] = true
+	}
+	return nil
+}
+
+// assetNameFromPath 由资源文件的存储路径还原资源名，存储路径把资源名平分成 4 段，压缩资源带 .gz 后缀
+func assetNameFromPath(assetsDir, path string) (string, bool) {
+	rel, err := filepath.Rel(assetsDir, path)
+	if err != nil {
+		return "", false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != 4 {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.Join(parts, ""), ".gz"), true
+}
+
+// markAssetFile 读取一个 project.json 文件并记录其中引用的资源
+func (s *ScratchDaoImpl) markAssetFile(path string, refs map[string]bool, result *AssetGCResult) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	result.FilesScanned++
+	if err := collectAssetRefs(data, refs); err != nil {
+		result.UnreadableFiles++
+		s.logger.Warn("解析项目文件失败", zap.String("path", path), zap.Error(err))
+	}
+	return nil
+}
+
+// markReferencedAssets 扫描所有未删除项目的全部历史版本和快照目录，返回被引用的资源名
+func (s *ScratchDaoImpl) markReferencedAssets(opts AssetGCOptions, result *AssetGCResult) (map[string]bool, error) {
+	refs := make(map[string]bool)
+
+	var projects []model.ScratchProject
+	err := s.db.Select("id", "file_path").FindInBatches(&projects, 200, func(tx *gorm.DB, batch int) error {
+		for _, project := range projects {
+			paths, err := filepath.Glob(filepath.Join(s.basePath, project.FilePath, fmt.Sprintf("%d_*.json", project.ID)))
+			if err != nil {
+				return err
+			}
+			for _, path := range paths {
+				if err := s.markAssetFile(path, refs, result); err != nil {
+					return err
+				}
+			}
+			result.ProjectsScanned++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range opts.ReferenceDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == dir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() || filepath.Ext(path) != ".json" {
+				return nil
+			}
+			return s.markAssetFile(path, refs, result)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// CollectOrphanAssets 回收没有被任何项目引用的资源文件和 user_assets 记录
+// 先扫描所有未删除项目的历史版本标记被引用的资源，再删除未被引用且超过 MinAge 的资源文件和记录
+func (s *ScratchDaoImpl) CollectOrphanAssets(opts AssetGCOptions) (*AssetGCResult, error) {
+	result := &AssetGCResult{OrphanAssets: []string{}}
+	cutoff := time.Now().Add(-opts.MinAge)
+
+	refs, err := s.markReferencedAssets(opts, result)
+	if err != nil {
+		return result, err
+	}
+	result.ReferencedAssets = len(refs)
+	// 有项目文件无法解析时不知道它引用了哪些资源，为避免误删停止回收
+	if result.UnreadableFiles > 0 && !opts.DryRun {
+		return result, fmt.Errorf("%d 个项目文件无法解析，已停止回收资源", result.UnreadableFiles)
+	}
+
+	orphans := make(map[string]bool)
+
+	// 清理资源文件
+	assetsDir := filepath.Join(s.basePath, "assets")
+	var emptyDirs []string
+	err = filepath.WalkDir(assetsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == assetsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != assetsDir {
+				emptyDirs = append(emptyDirs, path)
+			}
+			return nil
+		}
+		name, ok := assetNameFromPath(assetsDir, path)
+		if !ok || refs[name] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if !opts.DryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		orphans[name] = true
+		result.FilesRemoved++
+		result.BytesReclaimed += info.Size()
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// 删除清空后的目录，从最深的开始；目录非空时 Remove 会失败，忽略即可
+	if !opts.DryRun {
+		for i := len(emptyDirs) - 1; i >= 0; i-- {
+			os.Remove(emptyDirs[i])
+		}
+	}
+
+	// 清理 user_assets 记录
+	var assets []model.UserAsset
+	err = s.db.Select("id", "asset_id", "created_at").Where("created_at < ?", cutoff).FindInBatches(&assets, 500, func(tx *gorm.DB, batch int) error {
+		var ids []uint
+		for _, asset := range assets {
+			if refs[asset.AssetID] {
+				continue
+			}
+			orphans[asset.AssetID] = true
+			ids = append(ids, asset.ID)
+		}
+		result.RowsRemoved += len(ids)
+		if opts.DryRun || len(ids) == 0 {
+			return nil
+		}
+		return s.db.Delete(&model.UserAsset{}, ids).Error
+	}).Error
+	if err != nil {
+		return result, err
+	}
+
+	for name := range orphans {
+		result.OrphanAssets = append(result.OrphanAssets, name)
+	}
+	sort.Strings(result.OrphanAssets)
+	return result, nil
+}
@@ -0,0 +1,163 @@
+package dao
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// HistoryCompactResult 历史版本清理结果
+type HistoryCompactResult struct {
+	Projects       int   `json:"projects"`        // 检查的项目数
+	FilesRemoved   int   `json:"files_removed"`   // 删除的历史文件数
+	BytesReclaimed int64 `json:"bytes_reclaimed"` // 释放的磁盘空间
+}
+
+// historyFile 磁盘上的一个历史版本文件
+type historyFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// selectExpiredHistories 按保留策略选出要删除的历史文件，current 为当前版本文件，始终保留
+// 保留最近 KeepLast 个版本；KeepHourly 小时内每小时保留最新的一个，KeepDaily 天内每天保留最新的一个
+func selectExpiredHistories(files []historyFile, current string, policy config.HistoryConfig, now time.Time) []historyFile {
+	policy = policy.WithDefaults()
+
+	sorted := make([]historyFile, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].modTime.After(sorted[j].modTime) })
+
+	keepHourly, keepDaily := *policy.KeepHourly, *policy.KeepDaily
+	hourlySince := now.Add(-time.Duration(keepHourly) * time.Hour)
+	dailySince := now.AddDate(0, 0, -keepDaily)
+	hours := map[time.Time]bool{}
+	days := map[string]bool{}
+
+	var expired []historyFile
+	for i, file := range sorted {
+		keep := i < policy.KeepLast || file.path == current
+
+		// 从新到旧遍历，每个小时、每一天第一个遇到的就是最新的
+		if keepHourly > 0 && file.modTime.After(hourlySince) {
+			hour := file.modTime.Truncate(time.Hour)
+			if !hours[hour] {
+				hours[hour] = true
+				keep = true
+			}
+		}
+		if keepDaily > 0 && file.modTime.After(dailySince) {
+			day := file.modTime.Format("2006-01-02")
+			if !days[day] {
+				days[day] = true
+				keep = true
+			}
+		}
+
+		if !keep {
+			expired = append(expired, file)
+		}
+	}
+	return expired
+}
+
+// compactProjectHistory 按保留策略清理一个项目的历史文件，dryRun 为 true 时只统计不删除
+func (s *ScratchDaoImpl) compactProjectHistory(project *model.ScratchProject, now time.Time, dryRun bool) (int, int64, error) {
+	dir := filepath.Join(s.basePath, project.FilePath)
+	paths, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%d_*.json", project.ID)))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	files := make([]historyFile, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, historyFile{path: path, modTime: info.ModTime(), size: info.Size()})
+	}
+
+	var policy config.HistoryConfig
+	if s.cfg != nil {
+		policy = s.cfg.History
+	}
+	current := filepath.Join(dir, fmt.Sprintf("%d_%s.json", project.ID, project.MD5))
+
+	var removed int
+	var reclaimed int64
+	for _, file := range selectExpiredHistories(files, current, policy, now) {
+		if !dryRun {
+			if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+				return removed, reclaimed, err
+			}
+		}
+		removed++
+		reclaimed += file.size
+	}
+	return removed, reclaimed, nil
+}
+
+// scheduleCompactProjectHistory 在后台清理项目的历史文件。
+// 项目正在清理时只记下最新的项目，由正在运行的任务结束后再清理一次，
+// 连续保存时不会为同一个项目同时启动多个清理任务
+func (s *ScratchDaoImpl) scheduleCompactProjectHistory(project model.ScratchProject) {
+	s.compactMu.Lock()
+	if _, running := s.compacting[project.ID]; running {
+		s.compacting[project.ID] = &project
+		s.compactMu.Unlock()
+		return
+	}
+	s.compacting[project.ID] = nil
+	s.compactMu.Unlock()
+
+	go func() {
+		next := &project
+		for next != nil {
+			if _, _, err := s.compactProjectHistory(next, time.Now(), false); err != nil {
+				s.logger.Error("清理历史文件失败", zap.Uint("project_id", next.ID), zap.Error(err))
+			}
+
+			s.compactMu.Lock()
+			next = s.compacting[project.ID]
+			if next == nil {
+				delete(s.compacting, project.ID)
+			} else {
+				s.compacting[project.ID] = nil
+			}
+			s.compactMu.Unlock()
+		}
+	}()
+}
+
+// CompactHistories 按保留策略清理所有项目的历史文件
+func (s *ScratchDaoImpl) CompactHistories(dryRun bool) (*HistoryCompactResult, error) {
+	result := &HistoryCompactResult{}
+	now := time.Now()
+
+	var projects []model.ScratchProject
+	err := s.db.Select("id", "file_path", "md5").FindInBatches(&projects, 200, func(tx *gorm.DB, batch int) error {
+		for i := range projects {
+			removed, reclaimed, err := s.compactProjectHistory(&projects[i], now, dryRun)
+			if err != nil {
+				return err
+			}
+			result.Projects++
+			result.FilesRemoved += removed
+			result.BytesReclaimed += reclaimed
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
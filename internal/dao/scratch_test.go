@@ -1,12 +1,19 @@
 package dao
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jun/fun_code/internal/config"
 	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
 
@@ -460,3 +467,251 @@ func TestCountProjects(t *testing.T) {
 		})
 	}
 }
+
+// 测试读取和恢复历史版本
+func TestRestoreProjectHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	db := testutils.SetupTestDB()
+	scratchDao := NewScratchDao(db, tempDir, &config.Config{}, zap.NewNop())
+
+	v1 := []byte(`{"targets":[],"version":1}`)
+	v2 := []byte(`{"targets":[],"version":2}`)
+	projectID, err := scratchDao.SaveProject(1, 0, "测试项目", v1)
+	assert.NoError(t, err)
+	v1Sum := md5.Sum(v1)
+	v1MD5 := hex.EncodeToString(v1Sum[:])
+	_, err = scratchDao.SaveProject(1, projectID, "测试项目", v2)
+	assert.NoError(t, err)
+
+	content, err := scratchDao.GetProjectHistory(projectID, v1MD5)
+	assert.NoError(t, err)
+	assert.Equal(t, v1, content)
+
+	project, err := scratchDao.RestoreProjectHistory(projectID, v1MD5)
+	assert.NoError(t, err)
+	assert.Equal(t, v1MD5, project.MD5)
+
+	content, err = scratchDao.GetProjectBinary(projectID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, v1, content)
+
+	// 不存在的版本和非法的 MD5
+	_, err = scratchDao.RestoreProjectHistory(projectID, "0123456789abcdef0123456789abcdef")
+	assert.Error(t, err)
+	_, err = scratchDao.GetProjectHistory(projectID, "../../etc/passwd")
+	assert.Error(t, err)
+}
+
+// 测试历史版本保留策略
+func TestSelectExpiredHistories(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 30, 0, 0, time.Local)
+	policy := config.HistoryConfig{KeepLast: 2, KeepHourly: config.Int(3), KeepDaily: config.Int(2)}
+
+	files := []historyFile{
+		{path: "latest", modTime: now.Add(-1 * time.Minute)},
+		{path: "second", modTime: now.Add(-2 * time.Minute)},
+		{path: "same-hour", modTime: now.Add(-3 * time.Minute)},
+		{path: "hour-1", modTime: now.Add(-61 * time.Minute)},
+		{path: "hour-1-older", modTime: now.Add(-70 * time.Minute)},
+		{path: "yesterday", modTime: now.Add(-25 * time.Hour)},
+		{path: "yesterday-older", modTime: now.Add(-26 * time.Hour)},
+		{path: "last-week", modTime: now.AddDate(0, 0, -7)},
+		{path: "current", modTime: now.AddDate(0, -1, 0)},
+	}
+
+	expired := selectExpiredHistories(files, "current", policy, now)
+	var names []string
+	for _, file := range expired {
+		names = append(names, file.path)
+	}
+	assert.Equal(t, []string{"same-hour", "hour-1-older", "yesterday-older", "last-week"}, names)
+
+	// 0 表示不按小时、不按天保留，只保留最近的版本和当前版本
+	policy.KeepHourly, policy.KeepDaily = config.Int(0), config.Int(0)
+	names = nil
+	for _, file := range selectExpiredHistories(files, "current", policy, now) {
+		names = append(names, file.path)
+	}
+	assert.Equal(t, []string{"same-hour", "hour-1", "hour-1-older", "yesterday", "yesterday-older", "last-week"}, names)
+
+	// 未配置时使用默认值
+	names = nil
+	for _, file := range selectExpiredHistories(files, "current", config.HistoryConfig{KeepLast: 2}, now) {
+		names = append(names, file.path)
+	}
+	assert.Equal(t, []string{"same-hour", "hour-1-older", "yesterday-older"}, names)
+}
+
+// 测试清理所有项目的历史文件
+func TestCompactHistories(t *testing.T) {
+	tempDir := t.TempDir()
+	db := testutils.SetupTestDB()
+	cfg := &config.Config{History: config.HistoryConfig{KeepLast: 2, KeepHourly: config.Int(1), KeepDaily: config.Int(1)}}
+	scratchDao := NewScratchDao(db, tempDir, cfg, zap.NewNop())
+
+	// 不用 SaveProject，避免它在后台清理时和下面写入的文件冲突
+	projectID, err := scratchDao.CreateProject(1)
+	assert.NoError(t, err)
+	project, err := scratchDao.GetProject(projectID)
+	assert.NoError(t, err)
+	current := []byte(`{"version":0}`)
+	currentSum := md5.Sum(current)
+	currentMD5 := hex.EncodeToString(currentSum[:])
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, project.FilePath, fmt.Sprintf("%d_%s.json", projectID, currentMD5)), current, 0644))
+	_, err = scratchDao.RestoreProjectHistory(projectID, currentMD5)
+	assert.NoError(t, err)
+
+	// 写入 5 个很久以前的历史版本
+	old := time.Now().AddDate(-1, 0, 0)
+	for i := 1; i <= 5; i++ {
+		path := filepath.Join(tempDir, project.FilePath, fmt.Sprintf("%d_%032d.json", projectID, i))
+		assert.NoError(t, os.WriteFile(path, []byte("0123456789"), 0644))
+		modTime := old.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	result, err := scratchDao.CompactHistories(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Projects)
+	assert.Equal(t, 4, result.FilesRemoved)
+	assert.Equal(t, int64(40), result.BytesReclaimed)
+
+	result, err = scratchDao.CompactHistories(false)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, result.FilesRemoved)
+
+	files, err := filepath.Glob(filepath.Join(tempDir, project.FilePath, fmt.Sprintf("%d_*.json", projectID)))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// 当前版本仍然可以读取
+	content, err := scratchDao.GetProjectBinary(projectID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, current, content)
+}
+
+// 测试连续保存时同一项目的后台清理合并执行，结束后不留下清理任务
+func TestScheduleCompactProjectHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	db := testutils.SetupTestDB()
+	cfg := &config.Config{History: config.HistoryConfig{KeepLast: 2, KeepHourly: config.Int(1), KeepDaily: config.Int(1)}}
+	scratchDao := NewScratchDao(db, tempDir, cfg, zap.NewNop()).(*ScratchDaoImpl)
+
+	projectID, err := scratchDao.CreateProject(1)
+	assert.NoError(t, err)
+	project, err := scratchDao.GetProject(projectID)
+	assert.NoError(t, err)
+	old := time.Now().AddDate(-1, 0, 0)
+	for i := 1; i <= 5; i++ {
+		path := filepath.Join(tempDir, project.FilePath, fmt.Sprintf("%d_%032d.json", projectID, i))
+		assert.NoError(t, os.WriteFile(path, []byte("0123456789"), 0644))
+		modTime := old.Add(time.Duration(i) * time.Minute)
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scratchDao.scheduleCompactProjectHistory(*project)
+		}()
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		scratchDao.compactMu.Lock()
+		defer scratchDao.compactMu.Unlock()
+		return len(scratchDao.compacting) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	files, err := filepath.Glob(filepath.Join(tempDir, project.FilePath, fmt.Sprintf("%d_*.json", projectID)))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+// writeTestAsset 按上传接口的目录规则写入一个资源文件
+func writeTestAsset(t *testing.T, basePath, name string, modTime time.Time) {
+	n := len(name)
+	dir := filepath.Join(basePath, "assets", name[:n/4], name[n/4:n/2], name[n/2:n*3/4])
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, name[n*3/4:])
+	assert.NoError(t, os.WriteFile(path, []byte("0123456789"), 0644))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// 测试回收没有被引用的资源
+func TestCollectOrphanAssets(t *testing.T) {
+	tempDir := t.TempDir()
+	submissionsDir := t.TempDir()
+	db := testutils.SetupTestDB()
+	scratchDao := NewScratchDao(db, tempDir, &config.Config{}, zap.NewNop())
+	userAssetDao := NewUserAssetDao(db)
+
+	used := fmt.Sprintf("%032x.svg", 1)
+	submitted := fmt.Sprintf("%032x.wav", 2)
+	orphan := fmt.Sprintf("%032x.png", 3)
+	fresh := fmt.Sprintf("%032x.png", 4)
+	deleted := fmt.Sprintf("%032x.svg", 5)
+
+	// 存活项目引用 used，已删除项目引用 deleted
+	project := []byte(fmt.Sprintf(`{"targets":[{"costumes":[{"assetId":"%s","dataFormat":"svg"}],"sounds":[]}]}`, used[:32]))
+	projectID, err := scratchDao.CreateProject(1)
+	assert.NoError(t, err)
+	liveProject, err := scratchDao.GetProject(projectID)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, liveProject.FilePath, fmt.Sprintf("%d_%032d.json", projectID, 1)), project, 0644))
+
+	deletedID, err := scratchDao.CreateProject(1)
+	assert.NoError(t, err)
+	deletedProject, err := scratchDao.GetProject(deletedID)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, deletedProject.FilePath, fmt.Sprintf("%d_%032d.json", deletedID, 1)),
+		[]byte(fmt.Sprintf(`{"targets":[{"costumes":[{"md5ext":"%s"}]}]}`, deleted)), 0644))
+	assert.NoError(t, scratchDao.DeleteProject(1, deletedID))
+
+	// 作业提交快照引用 submitted
+	snapshotDir := filepath.Join(submissionsDir, "2024", "01", "01", "1")
+	assert.NoError(t, os.MkdirAll(snapshotDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(snapshotDir, "1_abc.json"),
+		[]byte(fmt.Sprintf(`{"targets":[{"sounds":[{"md5ext":"%s"}]}]}`, submitted)), 0644))
+
+	old := time.Now().AddDate(0, 0, -2)
+	for _, name := range []string{used, submitted, orphan, deleted} {
+		writeTestAsset(t, tempDir, name, old)
+		assert.NoError(t, userAssetDao.CreateUserAsset(&model.UserAsset{UserID: 1, AssetID: name, CreatedAt: old}))
+	}
+	writeTestAsset(t, tempDir, orphan+".gz", old)
+	writeTestAsset(t, tempDir, fresh, time.Now())
+	assert.NoError(t, userAssetDao.CreateUserAsset(&model.UserAsset{UserID: 1, AssetID: fresh}))
+
+	opts := AssetGCOptions{DryRun: true, MinAge: DefaultAssetGCMinAge, ReferenceDirs: []string{submissionsDir}}
+	result, err := scratchDao.CollectOrphanAssets(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.ProjectsScanned)
+	assert.Equal(t, 2, result.FilesScanned)
+	assert.Equal(t, 2, result.ReferencedAssets)
+	assert.Equal(t, []string{orphan, deleted}, result.OrphanAssets)
+	assert.Equal(t, 3, result.FilesRemoved)
+	assert.Equal(t, 2, result.RowsRemoved)
+	assert.Equal(t, int64(30), result.BytesReclaimed)
+
+	opts.DryRun = false
+	result, err = scratchDao.CollectOrphanAssets(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.FilesRemoved)
+	assert.Equal(t, 2, result.RowsRemoved)
+
+	var remaining []string
+	assert.NoError(t, db.Model(&model.UserAsset{}).Order("asset_id").Pluck("asset_id", &remaining).Error)
+	assert.Equal(t, []string{used, submitted, fresh}, remaining)
+	for name, exists := range map[string]bool{used: true, submitted: true, fresh: true, orphan: false, orphan + ".gz": false, deleted: false} {
+		n := len(name)
+		_, err := os.Stat(filepath.Join(tempDir, "assets", name[:n/4], name[n/4:n/2], name[n/2:n*3/4], name[n*3/4:]))
+		assert.Equal(t, exists, err == nil, name)
+	}
+
+	// 无法解析的项目文件会阻止删除
+	assert.NoError(t, os.WriteFile(filepath.Join(tempDir, liveProject.FilePath, fmt.Sprintf("%d_%032d.json", projectID, 2)), []byte("{"), 0644))
+	_, err = scratchDao.CollectOrphanAssets(opts)
+	assert.Error(t, err)
+}
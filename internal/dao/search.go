@@ -0,0 +1,24 @@
+package dao
+
+import "strings"
+
+// likeEscapeChar LIKE 语句的转义字符
+// 不用反斜杠，因为 MySQL 会在字符串字面量中把反斜杠再转义一次
+const likeEscapeChar = "!"
+
+var likeEscaper = strings.NewReplacer(likeEscapeChar, likeEscapeChar+likeEscapeChar, "%", likeEscapeChar+"%", "_", likeEscapeChar+"_")
+
+// likeCondition 构造在多个列中模糊搜索关键字的查询条件
+// 两边统一转为小写再比较，让 SQLite、MySQL 和 PostgreSQL 的大小写行为一致；
+// 关键字中的 % 和 _ 按字面匹配
+func likeCondition(keyword string, columns ...string) (string, []interface{}) {
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(keyword)) + "%"
+
+	conditions := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		conditions[i] = "LOWER(" + column + ") LIKE ? ESCAPE '" + likeEscapeChar + "'"
+		args[i] = pattern
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
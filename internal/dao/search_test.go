@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLikeCondition(t *testing.T) {
+	condition, args := likeCondition("50%_a!", "title", "description")
+	assert.Equal(t, "(LOWER(title) LIKE ? ESCAPE '!' OR LOWER(description) LIKE ? ESCAPE '!')", condition)
+	assert.Equal(t, []interface{}{"%50!%!_a!!%", "%50!%!_a!!%"}, args)
+}
+
+// 测试模糊搜索不区分大小写，且 % 和 _ 按字面匹配
+func TestSearchUsers(t *testing.T) {
+	db := testutils.SetupTestDB()
+	userDao := NewUserDao(db)
+
+	for _, user := range []*model.User{
+		{Username: "Alice", Nickname: "爱丽丝", Password: "123456"},
+		{Username: "bob_1", Nickname: "鲍勃", Password: "123456"},
+		{Username: "bobx1", Nickname: "100%", Password: "123456"},
+	} {
+		assert.NoError(t, userDao.CreateUser(user))
+	}
+
+	users, err := userDao.SearchUsers("alice")
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	users, err = userDao.SearchUsers("b_1")
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "bob_1", users[0].Username)
+
+	users, err = userDao.SearchUsers("0%")
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "bobx1", users[0].Username)
+
+	users, err = userDao.SearchUsers("丽")
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
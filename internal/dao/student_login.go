@@ -0,0 +1,277 @@
+package dao
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jun/fun_code/internal/model"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PictureLoginIcons 图片密码可选的 9 个图标，前端按这个顺序排成 3x3 的格子，图片密码保存的是下标
+var PictureLoginIcons = []string{"cat", "dog", "rabbit", "fish", "bird", "sun", "star", "flower", "apple"}
+
+// PicturePasswordLength 图片密码需要选中的图标数，选中的顺序不重要
+const PicturePasswordLength = 3
+
+// ErrPictureLoginDisabled 班级不存在或没有开启图片登录
+var ErrPictureLoginDisabled = errors.New("班级不存在或未开启图片登录")
+
+// StudentLoginCard 重新生成的图片密码和登录卡，明文只在生成时返回这一次
+type StudentLoginCard struct {
+	User       model.User
+	Picture    []int  // 图片密码，PictureLoginIcons 的下标，没有重新生成时为空
+	BadgeToken string // 登录卡令牌，没有重新生成时为空
+}
+
+// normalizePicture 检查图片密码并转换为排序后的字符串，如 "1,4,7"
+func normalizePicture(icons []int) (string, bool) {
+	if len(icons) != PicturePasswordLength {
+		return "", false
+	}
+	sorted := append([]int(nil), icons...)
+	sort.Ints(sorted)
+	parts := make([]string, len(sorted))
+	for i, icon := range sorted {
+		if icon < 0 || icon >= len(PictureLoginIcons) || (i > 0 && icon == sorted[i-1]) {
+			return "", false
+		}
+		parts[i] = strconv.Itoa(icon)
+	}
+	return strings.Join(parts, ","), true
+}
+
+// randomPicture 随机选出不重复的图标作为图片密码
+func randomPicture() ([]int, error) {
+	candidates := make([]int, len(PictureLoginIcons))
+	for i := range candidates {
+		candidates[i] = i
+	}
+	for i := 0; i < PicturePasswordLength; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates)-i)))
+		if err != nil {
+			return nil, err
+		}
+		j := i + int(n.Int64())
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	picture := candidates[:PicturePasswordLength]
+	sort.Ints(picture)
+	return picture, nil
+}
+
+// classStudents 查询班级中正式成员里的学生账号，不包括助教，studentIDs 为空表示全部
+func classStudents(db *gorm.DB, classID uint, studentIDs []uint) *gorm.DB {
+	query := db.Model(&model.User{}).
+		Joins("JOIN class_users ON class_users.user_id = users.id").
+		Where("class_users.class_id = ? AND class_users.is_active = ? AND class_users.deleted_at IS NULL", classID, true).
+		Where("users.role = ?", model.RoleStudent).
+		Where("class_users.role IS NULL OR class_users.role <> ?", model.ClassRoleAssistant)
+	if len(studentIDs) > 0 {
+		query = query.Where("users.id IN ?", studentIDs)
+	}
+	return query
+}
+
+// ResetStudentLogins 为班级学生重新生成图片密码和（或）登录卡，旧的立即失效。
+// studentIDs 为空表示班级中的所有学生，只处理学生角色的正式成员
+func (s *ClassDaoImpl) ResetStudentLogins(classID, teacherID uint, studentIDs []uint, picture, badge bool) ([]StudentLoginCard, error) {
+	var class model.Class
+	if err := s.db.Where("id = ? AND teacher_id = ?", classID, teacherID).First(&class).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("班级不存在或您无权操作")
+		}
+		return nil, err
+	}
+
+	var students []model.User
+	if err := classStudents(s.db, classID, studentIDs).Order("users.id ASC").Find(&students).Error; err != nil {
+		return nil, err
+	}
+
+	// 先生成密码和哈希，避免计算 bcrypt 时长时间占用事务
+	now := time.Now()
+	cards := make([]StudentLoginCard, len(students))
+	updates := make([]map[string]interface{}, len(students))
+	for i, student := range students {
+		cards[i].User = student
+		updates[i] = map[string]interface{}{}
+		if picture {
+			icons, err := randomPicture()
+			if err != nil {
+				return nil, err
+			}
+			normalized, _ := normalizePicture(icons)
+			hash, err := bcrypt.GenerateFromPassword([]byte(normalized), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, err
+			}
+			cards[i].Picture = icons
+			updates[i]["picture_hash"] = string(hash)
+		}
+		if badge {
+			// 与刷新令牌相同的生成和哈希方式
+			token, err := newRefreshToken()
+			if err != nil {
+				return nil, err
+			}
+			cards[i].BadgeToken = token
+			updates[i]["badge_hash"] = hashRefreshToken(token)
+			updates[i]["badge_issued_at"] = now
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i, card := range cards {
+			login := model.StudentLogin{ClassID: classID, UserID: card.User.ID}
+			if err := tx.Where(&login).FirstOrCreate(&login).Error; err != nil {
+				return err
+			}
+			if len(updates[i]) > 0 {
+				if err := tx.Model(&login).Updates(updates[i]).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// pictureLoginClass 按邀请码或ID查找开启了图片登录的班级，关闭后已发出的登录卡也不能使用
+func (s *AuthDaoImpl) pictureLoginClass(column string, value interface{}) (*model.Class, error) {
+	var class model.Class
+	err := s.db.Where(column+" = ? AND is_active = ? AND picture_login = ?", value, true, true).First(&class).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPictureLoginDisabled
+		}
+		return nil, err
+	}
+	return &class, nil
+}
+
+// GetPictureLoginClass 返回开启了图片登录的班级，以及已经设置图片密码、可以选择的学生。
+// 登录页不需要登录就能访问，只返回学生的ID和昵称，不返回可以用于密码登录的用户名
+func (s *AuthDaoImpl) GetPictureLoginClass(classCode string) (*model.Class, []model.User, error) {
+	class, err := s.pictureLoginClass("code", classCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var students []model.User
+	err = classStudents(s.db, class.ID, nil).
+		Joins("JOIN student_logins ON student_logins.user_id = users.id AND student_logins.class_id = ?", class.ID).
+		Where("student_logins.picture_hash <> ''").
+		Select("users.id", "users.nickname").
+		Order("users.id ASC").
+		Find(&students).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return class, students, nil
+}
+
+// PictureLogin 学生在班级登录页选中自己的名字和图片密码登录，与密码登录共用失败次数限制
+func (s *AuthDaoImpl) PictureLogin(classCode string, userID uint, icons []int, client SessionClient) (*LoginResponse, error) {
+	class, err := s.pictureLoginClass("code", classCode)
+	if err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	var login model.StudentLogin
+	err = classStudents(s.db, class.ID, []uint{userID}).First(&user).Error
+	if err == nil {
+		err = s.db.Where("class_id = ? AND user_id = ? AND picture_hash <> ''", class.ID, userID).First(&login).Error
+	}
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		attempt, retryAfter := s.beginLoginAttempt("", client)
+		if attempt == nil {
+			return nil, &LoginLockedError{RetryAfter: retryAfter}
+		}
+		attempt.failed(0, model.LoginFailureUnknownUser)
+		return nil, ErrInvalidCredentials
+	}
+
+	// 图片密码只有 84 种，必须先占用名额再校验，否则同时提交所有组合就能在被锁定前猜中
+	attempt, retryAfter := s.beginLoginAttempt(user.Username, client)
+	if attempt == nil {
+		s.recordLoginFailure(user.Username, user.ID, client, model.LoginFailureLocked)
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+	defer attempt.release()
+
+	normalized, ok := normalizePicture(icons)
+	if !ok || bcrypt.CompareHashAndPassword([]byte(login.PictureHash), []byte(normalized)) != nil {
+		attempt.failed(user.ID, model.LoginFailureWrongPicture)
+		return nil, ErrInvalidCredentials
+	}
+	attempt.succeeded()
+
+	return s.StartSession(&user, client)
+}
+
+// BadgeLogin 扫描二维码登录卡登录。令牌是随机生成的，不会被猜中，
+// 所以只按 IP 限制失败次数，别人输错图片密码不会让学生的登录卡也被锁定
+func (s *AuthDaoImpl) BadgeLogin(token string, client SessionClient) (*LoginResponse, error) {
+	attempt, retryAfter := s.beginLoginAttempt("", client)
+	if attempt == nil {
+		s.recordLoginFailure("", 0, client, model.LoginFailureLocked)
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+	defer attempt.release()
+
+	user, err := s.badgeUser(token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			attempt.failed(0, model.LoginFailureInvalidBadge)
+		}
+		return nil, err
+	}
+	attempt.succeeded()
+	return s.StartSession(user, client)
+}
+
+// badgeUser 查找登录卡对应的学生。登录卡已重新生成、班级关闭了图片登录或学生已离开班级时，
+// 返回 ErrInvalidCredentials
+func (s *AuthDaoImpl) badgeUser(token string) (*model.User, error) {
+	if token == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var login model.StudentLogin
+	if err := s.db.Where("badge_hash = ?", hashRefreshToken(token)).First(&login).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if _, err := s.pictureLoginClass("id", login.ClassID); err != nil {
+		if errors.Is(err, ErrPictureLoginDisabled) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	var user model.User
+	if err := classStudents(s.db, login.ClassID, []uint{login.UserID}).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	return &user, nil
+}
@@ -3,21 +3,33 @@ package testutils
 import (
 	"fmt"
 	"math/rand"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/jun/fun_code/internal/database"
 
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// 设置 FUN_CODE_TEST_POSTGRES_DSN 后，DAO 测试会在该 PostgreSQL 中为每个测试创建独立的 schema，
+// 用来验证查询在 PostgreSQL 上的行为，例如:
+//
+//	FUN_CODE_TEST_POSTGRES_DSN='host=127.0.0.1 user=postgres password=postgres dbname=fun_code_test sslmode=disable' go test ./internal/dao/...
+const postgresDSNEnv = "FUN_CODE_TEST_POSTGRES_DSN"
+
 func SetupTestDB() *gorm.DB {
 	// 使用随机数生成唯一的数据库名称，确保每个测试使用独立的数据库实例
 	// 使用新的随机数生成方式
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	if dsn := os.Getenv(postgresDSNEnv); dsn != "" {
+		return setupPostgresTestDB(dsn, fmt.Sprintf("test_%d", r.Int31()))
+	}
+
 	dbName := fmt.Sprintf("file:memdb%d?mode=memory&cache=shared", r.Int())
 
-	db, err := gorm.Open(sqlite.Open(dbName), &gorm.Config{})
+	db, err := database.Open(database.DriverSQLite, dbName, &gorm.Config{})
 	if err != nil {
 		panic("failed to connect database")
 	}
@@ -26,3 +38,36 @@ func SetupTestDB() *gorm.DB {
 
 	return db
 }
+
+// setupPostgresTestDB 创建独立的 schema 并通过 search_path 使用它
+func setupPostgresTestDB(dsn, schema string) *gorm.DB {
+	admin, err := database.Open(database.DriverPostgres, dsn, &gorm.Config{})
+	if err != nil {
+		panic(fmt.Sprintf("failed to connect postgres: %v", err))
+	}
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		panic(fmt.Sprintf("failed to create schema: %v", err))
+	}
+	if sqlDB, err := admin.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	if strings.Contains(dsn, "://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+
+	db, err := database.Open(database.DriverPostgres, dsn, &gorm.Config{})
+	if err != nil {
+		panic(fmt.Sprintf("failed to connect postgres: %v", err))
+	}
+	if err := database.RunMigrations(db); err != nil {
+		panic(fmt.Sprintf("failed to migrate postgres: %v", err))
+	}
+	return db
+}
@@ -390,7 +390,8 @@ func (s *UserDaoImpl) GetUsersByIDs(ids []uint) ([]model.User, error) {
 // SearchUsers 搜索用户
 func (s *UserDaoImpl) SearchUsers(keyword string) ([]model.User, error) {
 	var users []model.User
-	if err := s.db.Where("username LIKE ? OR email LIKE ? OR nickname LIKE ?", "%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%").Find(&users).Error; err != nil {
+	condition, args := likeCondition(keyword, "username", "email", "nickname")
+	if err := s.db.Where(condition, args...).Find(&users).Error; err != nil {
 		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
 	}
 	return users, nil
@@ -0,0 +1,187 @@
+package dao
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ImportUsers 批量导入用户
+// 先校验所有行，只要有一行出错就不写入任何数据；dryRun 为 true 时只做校验。
+// 校验通过后在一个事务中创建用户，并把填写了班级邀请码的用户加入对应班级
+func (s *UserDaoImpl) ImportUsers(rows []UserImportRow, dryRun bool) ([]model.User, []UserImportRowError, error) {
+	rowErrors, classes, err := s.validateImportRows(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rowErrors) > 0 || dryRun {
+		return nil, rowErrors, nil
+	}
+
+	// 先在事务外计算所有密码哈希，bcrypt 很慢，放在事务中会长时间占用 SQLite 的写锁
+	users := make([]model.User, len(rows))
+	for i, row := range rows {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(row.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+		}
+		nickname := row.Nickname
+		if nickname == "" {
+			nickname = row.Username
+		}
+		users[i] = model.User{
+			Username: row.Username,
+			Nickname: nickname,
+			Password: string(hashedPassword),
+			Email:    row.Email,
+			Role:     model.RoleStudent,
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		for i, row := range rows {
+			if err := tx.Create(&users[i]).Error; err != nil {
+				return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+			}
+
+			if row.ClassCode == "" {
+				continue
+			}
+			classUser := model.ClassUser{
+				ClassID:  classes[row.ClassCode].ID,
+				UserID:   users[i].ID,
+				JoinedAt: now,
+				Role:     model.RoleStudent,
+				IsActive: true,
+				Status:   model.ClassUserStatusActive,
+			}
+			if err := tx.Create(&classUser).Error; err != nil {
+				return gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeInsertFailed, global.ErrorMsgInsertFailed, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return users, nil, nil
+}
+
+// validateImportRows 校验导入数据，返回行级错误以及用到的班级
+func (s *UserDaoImpl) validateImportRows(rows []UserImportRow) ([]UserImportRowError, map[string]model.Class, error) {
+	var rowErrors []UserImportRowError
+	addError := func(row UserImportRow, field, message string) {
+		rowErrors = append(rowErrors, UserImportRowError{Line: row.Line, Field: field, Message: message})
+	}
+
+	// 收集文件内的用户名、邮箱和班级邀请码，同时检查文件内是否重复
+	usernameLines := make(map[string]int)
+	emailLines := make(map[string]int)
+	var usernames, emails, codes []string
+	for _, row := range rows {
+		switch {
+		case row.Username == "":
+			addError(row, "username", "用户名不能为空")
+		case len(row.Username) > 50 || strings.ContainsAny(row.Username, " \t"):
+			addError(row, "username", "用户名不能包含空格且不能超过50个字符")
+		case usernameLines[row.Username] > 0:
+			addError(row, "username", fmt.Sprintf("用户名与第 %d 行重复", usernameLines[row.Username]))
+		default:
+			usernameLines[row.Username] = row.Line
+			usernames = append(usernames, row.Username)
+		}
+
+		if row.Password == "" {
+			addError(row, "password", "密码不能为空")
+		}
+
+		if row.Email != "" {
+			switch {
+			case !strings.Contains(row.Email, "@"):
+				addError(row, "email", "邮箱格式无效")
+			case emailLines[row.Email] > 0:
+				addError(row, "email", fmt.Sprintf("邮箱与第 %d 行重复", emailLines[row.Email]))
+			default:
+				emailLines[row.Email] = row.Line
+				emails = append(emails, row.Email)
+			}
+		}
+
+		if row.ClassCode != "" {
+			codes = append(codes, row.ClassCode)
+		}
+	}
+
+	// 检查数据库中已存在的用户名和邮箱，已删除的用户仍占用用户名
+	if len(usernames) > 0 {
+		var existing []string
+		if err := s.db.Unscoped().Model(&model.User{}).Where("username IN ?", usernames).Pluck("username", &existing).Error; err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+		}
+		for _, username := range existing {
+			line := usernameLines[username]
+			rowErrors = append(rowErrors, UserImportRowError{Line: line, Field: "username", Message: "用户名已存在"})
+		}
+	}
+	if len(emails) > 0 {
+		var existing []string
+		if err := s.db.Model(&model.User{}).Where("email IN ?", emails).Pluck("email", &existing).Error; err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+		}
+		for _, email := range existing {
+			rowErrors = append(rowErrors, UserImportRowError{Line: emailLines[email], Field: "email", Message: "邮箱已被使用"})
+		}
+	}
+
+	// 检查班级邀请码和班级人数上限
+	classes := make(map[string]model.Class)
+	if len(codes) > 0 {
+		var found []model.Class
+		if err := s.db.Where("code IN ? AND is_active = ?", codes, true).Find(&found).Error; err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+		}
+		remaining := make(map[string]int64)
+		for _, class := range found {
+			classes[class.Code] = class
+			if class.MaxStudents <= 0 {
+				continue
+			}
+			var count int64
+			if err := s.db.Model(&model.ClassUser{}).
+				Where("class_id = ? AND is_active = ? AND role = ?", class.ID, true, model.RoleStudent).
+				Count(&count).Error; err != nil {
+				return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_DAO, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+			}
+			remaining[class.Code] = int64(class.MaxStudents) - count
+		}
+		for _, row := range rows {
+			if row.ClassCode == "" {
+				continue
+			}
+			class, ok := classes[row.ClassCode]
+			if !ok {
+				addError(row, "class_code", "班级不存在或邀请码无效")
+				continue
+			}
+			if class.MaxStudents <= 0 {
+				continue
+			}
+			if remaining[row.ClassCode] <= 0 {
+				addError(row, "class_code", fmt.Sprintf("班级 %s 人数已满", class.Name))
+				continue
+			}
+			remaining[row.ClassCode]--
+		}
+	}
+
+	return rowErrors, classes, nil
+}
@@ -0,0 +1,73 @@
+package dao
+
+import (
+	"testing"
+
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试批量导入的校验、试运行以及加入班级
+func TestImportUsers(t *testing.T) {
+	db := testutils.SetupTestDB()
+	userDao := NewUserDao(db)
+	classDao := NewClassDao(db)
+
+	assert.NoError(t, userDao.CreateUser(&model.User{Username: "exists", Password: "123456", Email: "exists@example.com"}))
+	class, err := classDao.CreateClass(1, "一班", "", "2023-01-01", "2023-12-31")
+	assert.NoError(t, err)
+	assert.NoError(t, classDao.UpdateClass(class.ID, 1, map[string]interface{}{"max_students": 2}))
+
+	// 有错误的行会全部报告出来，并且不写入任何数据
+	badRows := []UserImportRow{
+		{Line: 2, Username: "exists", Password: "123456"},
+		{Line: 3, Username: "tom", Password: ""},
+		{Line: 4, Username: "tom", Password: "123456"},
+		{Line: 5, Username: "jerry", Password: "123456", Email: "exists@example.com"},
+		{Line: 6, Username: "spike", Password: "123456", ClassCode: "nocode"},
+	}
+	users, rowErrors, err := userDao.ImportUsers(badRows, false)
+	assert.NoError(t, err)
+	assert.Nil(t, users)
+	lines := make(map[int]string)
+	for _, rowError := range rowErrors {
+		lines[rowError.Line] = rowError.Field
+	}
+	assert.Equal(t, map[int]string{2: "username", 3: "password", 4: "username", 5: "email", 6: "class_code"}, lines)
+	count, _ := userDao.CountUsers()
+	assert.Equal(t, int64(1), count)
+
+	// 超出班级人数上限
+	rows := []UserImportRow{
+		{Line: 2, Username: "tom", Nickname: "汤姆", Password: "123456", ClassCode: class.Code},
+		{Line: 3, Username: "jerry", Password: "654321", ClassCode: class.Code},
+		{Line: 4, Username: "spike", Password: "123456", ClassCode: class.Code},
+	}
+	_, rowErrors, err = userDao.ImportUsers(rows, false)
+	assert.NoError(t, err)
+	assert.Len(t, rowErrors, 1)
+	assert.Equal(t, 4, rowErrors[0].Line)
+
+	// 试运行只校验不写入
+	rows = rows[:2]
+	users, rowErrors, err = userDao.ImportUsers(rows, true)
+	assert.NoError(t, err)
+	assert.Empty(t, rowErrors)
+	assert.Nil(t, users)
+	count, _ = userDao.CountUsers()
+	assert.Equal(t, int64(1), count)
+
+	users, rowErrors, err = userDao.ImportUsers(rows, false)
+	assert.NoError(t, err)
+	assert.Empty(t, rowErrors)
+	assert.Len(t, users, 2)
+	assert.Equal(t, "汤姆", users[0].Nickname)
+	assert.Equal(t, "jerry", users[1].Nickname)
+	assert.Equal(t, model.RoleStudent, users[1].Role)
+	assert.NotEqual(t, "654321", users[1].Password)
+
+	students, err := classDao.ListStudents(class.ID, 1)
+	assert.NoError(t, err)
+	assert.Len(t, students, 2)
+}
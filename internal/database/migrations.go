@@ -1,76 +1,874 @@
 package database
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/jun/fun_code/internal/model"
 	"gorm.io/gorm"
 )
 
-// RunMigrations 运行所有数据库迁移
+// Migrations 所有版本化迁移，按版本号顺序追加，已发布的迁移不要修改。
+// 迁移中使用本文件末尾的表结构快照而不是 model 中的模型，模型以后的修改不会改变已发布迁移的结果
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "初始数据库结构",
+		Up:          migrateBaseline,
+	},
+	{
+		Version:     2,
+		Description: "课时项目ID迁移到 project_id_1/2/3 列",
+		Up:          migrateLessonProjectColumns,
+	},
+	{
+		Version:     3,
+		Description: "作业和作业提交",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&assignmentV3{}, &submissionV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&submissionV3{}, &assignmentV3{})
+		},
+	},
+	{
+		Version:     4,
+		Description: "评分标准和评分",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&rubricCriterionV4{}, &gradeV4{}, &gradeItemV4{}, &gradeSpriteCommentV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&gradeSpriteCommentV4{}, &gradeItemV4{}, &gradeV4{}, &rubricCriterionV4{})
+		},
+	},
+	{
+		Version:     5,
+		Description: "班级邀请码有效期、人数上限和加入审核",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &classV5{}, "CodeExpiresAt", "MaxStudents", "RequireApproval"); err != nil {
+				return err
+			}
+			return addColumns(tx, &classUserV5{}, "Status")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &classV5{}, "CodeExpiresAt", "MaxStudents", "RequireApproval"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &classUserV5{}, "Status")
+		},
+	},
+	{
+		Version:     6,
+		Description: "用户会话支持多设备登录",
+		Up:          migrateMultiDeviceSessions,
+	},
+	{
+		Version:     7,
+		Description: "刷新令牌",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&refreshTokenV7{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&refreshTokenV7{})
+		},
+	},
+	{
+		Version:     8,
+		Description: "登录失败记录",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&loginFailureV8{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&loginFailureV8{})
+		},
+	},
+	{
+		Version:     9,
+		Description: "图片密码和二维码登录卡",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &classV9{}, "PictureLogin"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&studentLoginV9{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&studentLoginV9{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &classV9{}, "PictureLogin")
+		},
+	},
+	{
+		Version:     10,
+		Description: "用户认证来源",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &userV10{}, "AuthProvider")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &userV10{}, "AuthProvider")
+		},
+	},
+	{
+		Version:     11,
+		Description: "用户关联的外部身份",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userIdentityV11{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&userIdentityV11{})
+		},
+	},
+	{
+		Version:     12,
+		Description: "重置密码和强制修改密码",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &userV12{}, "MustChangePassword"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&passwordResetV12{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&passwordResetV12{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &userV12{}, "MustChangePassword")
+		},
+	},
+	{
+		Version:     13,
+		Description: "角色和权限",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&roleV13{}, &rolePermissionV13{}); err != nil {
+				return err
+			}
+			return seedRoles(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&rolePermissionV13{}, &roleV13{})
+		},
+	},
+	{
+		Version:     14,
+		Description: "审计记录",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&auditEventV14{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&auditEventV14{})
+		},
+	},
+	{
+		Version:     15,
+		Description: "作业提交次数唯一索引",
+		Up:          migrateSubmissionAttemptIndex,
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex(&submissionV15{}, "idx_submission_attempt")
+		},
+	},
+}
+
+// RunMigrations 执行所有未执行的迁移
+// 数据库版本比程序新时返回 ErrSchemaAhead，此时不应继续启动
 func RunMigrations(db *gorm.DB) error {
+	_, err := NewMigrator(db, Migrations).Up(0)
+	return err
+}
+
+// migrateBaseline 引入版本化迁移之前由 AutoMigrate 维护的表结构，使用文件末尾当时的模型快照，
+// 不随模型变化。已有的数据库再执行一次 AutoMigrate 不会改变数据
+func migrateBaseline(db *gorm.DB) error {
 	// 迁移现有模型
-	if err := db.AutoMigrate(&model.User{}); err != nil {
+	if err := db.AutoMigrate(&userV1{}); err != nil {
 		return err
 	}
 
 	// 迁移会话模型
-	if err := db.AutoMigrate(&model.UserSession{}); err != nil {
+	if err := db.AutoMigrate(&userSessionV1{}); err != nil {
 		return err
 	}
 
 	// 迁移班级模型
-	if err := db.AutoMigrate(&model.Class{}); err != nil {
+	if err := db.AutoMigrate(&classV1{}); err != nil {
 		return err
 	}
 	// 迁移班级成员模型
-	if err := db.AutoMigrate(&model.ClassUser{}); err != nil {
+	if err := db.AutoMigrate(&classUserV1{}); err != nil {
 		return err
 	}
 	// 迁移班级课程模型
-	if err := db.AutoMigrate(&model.ClassCourse{}); err != nil {
+	if err := db.AutoMigrate(&classCourseV1{}); err != nil {
 		return err
 	}
 
 	// 迁移课程模型
-	if err := db.AutoMigrate(&model.Course{}); err != nil {
+	if err := db.AutoMigrate(&courseV1{}); err != nil {
 		return err
 	}
 
 	// 迁移课时资源文件关联模型
-	if err := db.AutoMigrate(&model.LessonFile{}); err != nil {
+	if err := db.AutoMigrate(&lessonFileV1{}); err != nil {
 		return err
 	}
 
 	// 迁移课时模型
-	if err := db.AutoMigrate(&model.Lesson{}); err != nil {
+	if err := db.AutoMigrate(&lessonV1{}); err != nil {
 		return err
 	}
 
 	// 迁移课时课程关联模型
-	if err := db.AutoMigrate(&model.LessonCourse{}); err != nil {
+	if err := db.AutoMigrate(&lessonCourseV1{}); err != nil {
 		return err
 	}
 
-
-
 	// 迁移文件模型 ScratchProject
-	if err := db.AutoMigrate(&model.File{}, &model.ScratchProject{}, &model.Program{}); err != nil {
+	if err := db.AutoMigrate(&fileV1{}, &scratchProjectV1{}, &programV1{}); err != nil {
 		return err
 	}
 
 	// 迁移用户资源模型
-	if err := db.AutoMigrate(&model.UserAsset{}); err != nil {
+	if err := db.AutoMigrate(&userAssetV1{}); err != nil {
 		return err
 	}
 
 	// 迁移分享模型
-	if err := db.AutoMigrate(&model.Share{}); err != nil {
+	if err := db.AutoMigrate(&shareV1{}); err != nil {
 		return err
 	}
 
 	// 迁移Excalidraw画板模型
-	if err := db.AutoMigrate(&model.ExcalidrawBoard{}); err != nil {
+	if err := db.AutoMigrate(&excalidrawBoardV1{}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// migrateLessonProjectColumns 早期版本的 ProjectID1/2/3 没有指定列名，
+// AutoMigrate 建出的是 project_id1/2/3 列；加上列名后 AutoMigrate 只会新建列，旧数据留在旧列中。
+// 这里把旧列的数据搬到新列后删除旧列
+func migrateLessonProjectColumns(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	for i := 1; i <= 3; i++ {
+		oldColumn := fmt.Sprintf("project_id%d", i)
+		newColumn := fmt.Sprintf("project_id_%d", i)
+		if !migrator.HasColumn(&lessonV1{}, oldColumn) {
+			continue
+		}
+		if err := tx.Exec(fmt.Sprintf(
+			"UPDATE lessons SET %s = %s WHERE (%s IS NULL OR %s = 0) AND %s IS NOT NULL",
+			newColumn, oldColumn, newColumn, newColumn, oldColumn,
+		)).Error; err != nil {
+			return err
+		}
+		if err := migrator.DropColumn(&lessonV1{}, oldColumn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateMultiDeviceSessions user_id 上原来是唯一索引，同一用户只能有一个会话，改为普通索引并加上设备信息。
+// 两种索引同名，都重建一次；同一用户有多个会话后无法再恢复唯一索引，所以没有 Down
+func migrateMultiDeviceSessions(tx *gorm.DB) error {
+	if err := addColumns(tx, &userSessionV6{}, "Device", "UserAgent", "IP", "LastSeenAt"); err != nil {
+		return err
+	}
+	migrator := tx.Migrator()
+	if migrator.HasIndex(&userSessionV6{}, "idx_user_sessions_user_id") {
+		if err := migrator.DropIndex(&userSessionV6{}, "idx_user_sessions_user_id"); err != nil {
+			return err
+		}
+	}
+	return migrator.CreateIndex(&userSessionV6{}, "UserID")
+}
+
+// migrateSubmissionAttemptIndex 之前同一学生同时提交可能得到相同的提交次数，
+// 按提交顺序重新编号后再建唯一索引
+func migrateSubmissionAttemptIndex(tx *gorm.DB) error {
+	var submissions []submissionV15
+	if err := tx.Order("assignment_id, student_id, id").Find(&submissions).Error; err != nil {
 		return err
 	}
+	var assignmentID, studentID uint
+	attempt := 0
+	for _, submission := range submissions {
+		if submission.AssignmentID != assignmentID || submission.StudentID != studentID {
+			assignmentID, studentID, attempt = submission.AssignmentID, submission.StudentID, 0
+		}
+		attempt++
+		if submission.Attempt == attempt {
+			continue
+		}
+		if err := tx.Model(&submissionV15{}).Where("id = ?", submission.ID).Update("attempt", attempt).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Migrator().CreateIndex(&submissionV15{}, "idx_submission_attempt")
+}
+
+// seedRoles 写入内置角色，权限与之前代码中写死的角色权限相同。
+// 已经存在的角色保持不变，避免覆盖管理员修改过的权限
+func seedRoles(tx *gorm.DB) error {
+	roles := []struct {
+		name        string
+		description string
+		permissions []string
+	}{
+		{model.RoleAdmin, "管理员", []string{"manage_all"}},
+		{model.RoleTeacher, "教师", []string{
+			"manage_own_class", "manage_own_students", "create_scratch", "view_own_scratch",
+			"edit_own_scratch", "view_class_scratch", "view_course_scratch",
+		}},
+		{model.RoleStudent, "学生", []string{
+			"create_scratch", "view_own_scratch", "edit_own_scratch", "view_class_scratch", "view_course_scratch",
+		}},
+		{model.RoleAssistant, "助教，只在担任助教的班级中生效", []string{
+			"manage_own_students", "view_class_scratch", "view_course_scratch",
+		}},
+	}
+	for _, r := range roles {
+		var count int64
+		if err := tx.Model(&roleV13{}).Where("name = ?", r.name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		role := roleV13{Name: r.name, Description: r.description, BuiltIn: true}
+		for _, p := range r.permissions {
+			role.Permissions = append(role.Permissions, rolePermissionV13{Permission: p})
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumns 添加不存在的列
+func addColumns(tx *gorm.DB, value interface{}, fields ...string) error {
+	migrator := tx.Migrator()
+	for _, field := range fields {
+		if migrator.HasColumn(value, field) {
+			continue
+		}
+		if err := migrator.AddColumn(value, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// dropColumns 删除存在的列
+func dropColumns(tx *gorm.DB, value interface{}, fields ...string) error {
+	migrator := tx.Migrator()
+	for _, field := range fields {
+		if !migrator.HasColumn(value, field) {
+			continue
+		}
+		if err := migrator.DropColumn(value, field); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// 以下是各个迁移执行时的表结构快照，只保留建表需要的字段和标签。
+// 修改模型时新增迁移和对应的快照，不要修改已有的快照
+
+// v1 引入版本化迁移之前的表结构，多对多关联用于建出和当时相同的关联表
+
+type userV1 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Username  string         `gorm:"uniqueIndex;size:50"`
+	Nickname  string         `gorm:"size:50"`
+	Password  string         `gorm:"size:100"`
+	Email     string         `gorm:"size:100"`
+	Role      string         `gorm:"size:20;default:'student'"`
+}
+
+func (userV1) TableName() string { return "users" }
+
+type userSessionV1 struct {
+	ID        uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	UserID    uint           `gorm:"uniqueIndex;not null"`
+	SessionID string         `gorm:"size:255;not null;uniqueIndex"`
+	ExpiresAt time.Time      `gorm:"not null"`
+	IsActive  bool           `gorm:"default:true"`
+}
+
+func (userSessionV1) TableName() string { return "user_sessions" }
+
+type classV1 struct {
+	ID          uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt   int64
+	UpdatedAt   int64
+	DeletedAt   *int64 `gorm:"index"`
+	Name        string `gorm:"size:100;not null"`
+	Description string `gorm:"size:500"`
+	Code        string `gorm:"size:20;unique;not null"`
+	StartDate   time.Time
+	EndDate     time.Time
+	TeacherID   uint       `gorm:"not null"`
+	Students    []userV1   `gorm:"many2many:class_users;joinForeignKey:ClassID;joinReferences:UserID"`
+	Courses     []courseV1 `gorm:"many2many:class_courses;joinForeignKey:ClassID;joinReferences:CourseID"`
+	IsActive    bool       `gorm:"default:true"`
+}
+
+func (classV1) TableName() string { return "classes" }
+
+type classUserV1 struct {
+	ClassID   uint `gorm:"not null;index"`
+	UserID    uint `gorm:"not null;index"`
+	JoinedAt  int64
+	Role      string `gorm:"size:20"`
+	IsActive  bool   `gorm:"default:true"`
+	CreatedAt int64
+	UpdatedAt int64
+	DeletedAt *int64 `gorm:"index"`
+}
+
+func (classUserV1) TableName() string { return "class_users" }
+
+type classCourseV1 struct {
+	ClassID     uint `gorm:"not null;uniqueIndex:idx_class_course"`
+	CourseID    uint `gorm:"not null;uniqueIndex:idx_class_course"`
+	StartDate   int64
+	EndDate     int64
+	IsPublished bool `gorm:"default:false"`
+	CreatedAt   int64
+	UpdatedAt   int64
+	DeletedAt   *int64 `gorm:"index"`
+}
+
+func (classCourseV1) TableName() string { return "class_courses" }
+
+type courseV1 struct {
+	ID            uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt     int64
+	UpdatedAt     int64
+	DeletedAt     *int64     `gorm:"index"`
+	Title         string     `gorm:"size:200;not null"`
+	Description   string     `gorm:"size:1000"`
+	AuthorID      uint       `gorm:"not null"`
+	Content       string     `gorm:"type:text"`
+	IsPublished   bool       `gorm:"default:false"`
+	SortOrder     int        `gorm:"default:0;index"`
+	Duration      int        `gorm:"default:0"`
+	Difficulty    string     `gorm:"size:20;default:'beginner'"`
+	ThumbnailPath string     `gorm:"size:500"`
+	Classes       []classV1  `gorm:"many2many:class_courses;joinForeignKey:CourseID;joinReferences:ClassID"`
+	Lessons       []lessonV1 `gorm:"many2many:lesson_courses;joinForeignKey:CourseID;joinReferences:LessonID"`
+}
+
+func (courseV1) TableName() string { return "courses" }
+
+type lessonFileV1 struct {
+	ID       uint `gorm:"primaryKey;autoIncrement"`
+	LessonID uint `gorm:"index;not null;uniqueIndex:idx_lesson_file_unique"`
+	FileID   uint `gorm:"index;not null;uniqueIndex:idx_lesson_file_unique"`
+}
+
+func (lessonFileV1) TableName() string { return "lesson_files" }
+
+type lessonV1 struct {
+	ID           uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt    int64
+	UpdatedAt    int64
+	DeletedAt    *int64     `gorm:"index"`
+	Title        string     `gorm:"size:200;not null"`
+	Content      string     `gorm:"type:text"`
+	Courses      []courseV1 `gorm:"many2many:lesson_courses;joinForeignKey:LessonID;joinReferences:CourseID"`
+	Files        []fileV1   `gorm:"many2many:lesson_files;joinForeignKey:LessonID;joinReferences:FileID"`
+	DocumentName string     `gorm:"size:255"`
+	DocumentPath string     `gorm:"size:500"`
+	FlowChartID  uint       `gorm:"index"`
+	ProjectType  string     `gorm:"size:50"`
+	ProjectID1   uint       `gorm:"column:project_id_1;index"`
+	ProjectID2   uint       `gorm:"column:project_id_2;index"`
+	ProjectID3   uint       `gorm:"column:project_id_3;index"`
+	Video1       string     `gorm:"size:500"`
+	Video2       string     `gorm:"size:500"`
+	Video3       string     `gorm:"size:500"`
+	Duration     int        `gorm:"default:0"`
+	Difficulty   string     `gorm:"size:20"`
+	Description  string     `gorm:"size:1000"`
+}
+
+func (lessonV1) TableName() string { return "lessons" }
+
+type lessonCourseV1 struct {
+	LessonID  uint `gorm:"not null;uniqueIndex:idx_lesson_course"`
+	CourseID  uint `gorm:"not null;uniqueIndex:idx_lesson_course"`
+	SortOrder int  `gorm:"default:0;index"`
+	CreatedAt int64
+	UpdatedAt int64
+	DeletedAt *int64 `gorm:"index"`
+}
+
+func (lessonCourseV1) TableName() string { return "lesson_courses" }
+
+type fileV1 struct {
+	ID           uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	ExtName      string `gorm:"size:255"`
+	SHA1         string `gorm:"size:40;unique"`
+	OriginalName string `gorm:"size:255"`
+	Description  string `gorm:"size:1000"`
+	Size         int64
+	UserID       uint `gorm:"index"`
+	TagID        uint `gorm:"index"`
+	ContentType  uint `gorm:"index"`
+}
+
+func (fileV1) TableName() string { return "files" }
+
+type scratchProjectV1 struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	MD5       string
+	UserID    uint `gorm:"index"`
+	Name      string
+	ClassID   uint  `gorm:"index"`
+	CourseID  uint  `gorm:"index"`
+	BoardID   *uint `gorm:"index"`
+	FilePath  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (scratchProjectV1) TableName() string { return "scratch_projects" }
+
+type programV1 struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	UserID    uint `gorm:"index"`
+	Name      string
+	Ext       int `gorm:"index"`
+	MD5       string
+	FilePath  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (programV1) TableName() string { return "programs" }
+
+type userAssetV1 struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	UserID    uint `gorm:"index"`
+	AssetID   string
+	AssetType string
+	Size      int64
+	CreatedAt time.Time
+}
+
+func (userAssetV1) TableName() string { return "user_assets" }
+
+type shareV1 struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement"`
+	ShareToken     string     `gorm:"type:varchar(64);uniqueIndex;not null;comment:分享链接的唯一标识符"`
+	ProjectID      uint       `gorm:"not null;index:idx_project,unique;comment:被分享的项目ID，每个项目只能被分享一次"`
+	ProjectType    int        `gorm:"not null;default:1;index:idx_project,unique;comment:项目类型，1=Scratch项目"`
+	UserID         uint       `gorm:"not null;index;comment:分享者的用户ID"`
+	Title          string     `gorm:"type:varchar(255);comment:分享链接的标题"`
+	Description    string     `gorm:"type:text;comment:分享链接的描述"`
+	ViewCount      int64      `gorm:"default:0;comment:当前分享周期的访问次数"`
+	TotalViewCount int64      `gorm:"default:0;comment:总访问次数"`
+	MaxViews       int64      `gorm:"default:0;comment:最大访问次数，0表示无限制"`
+	IsActive       bool       `gorm:"default:true;comment:分享链接是否有效"`
+	ExpiresAt      *time.Time `gorm:"comment:分享链接过期时间，null表示永不过期"`
+	Password       string     `gorm:"type:varchar(255);comment:访问密码，为空表示无需密码"`
+	AllowDownload  bool       `gorm:"default:false;comment:是否允许下载"`
+	AllowRemix     bool       `gorm:"default:false;comment:是否允许Remix"`
+	LikeCount      int64      `gorm:"default:0;comment:点赞次数"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime"`
+}
+
+func (shareV1) TableName() string { return "shares" }
+
+type excalidrawBoardV1 struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	MD5       string
+	Name      string
+	UserID    uint `gorm:"index"`
+	FilePath  string
+	CreatedAt int64
+	UpdatedAt int64
+	DeletedAt *int64
+}
+
+func (excalidrawBoardV1) TableName() string { return "excalidraw_boards" }
+
+// v3 作业和作业提交
+
+type assignmentV3 struct {
+	ID          uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt   int64
+	UpdatedAt   int64
+	DeletedAt   *int64 `gorm:"index"`
+	ClassID     uint   `gorm:"not null;index:idx_assignment_class_lesson"`
+	CourseID    uint   `gorm:"not null;index"`
+	LessonID    uint   `gorm:"not null;index:idx_assignment_class_lesson"`
+	TeacherID   uint   `gorm:"not null;index"`
+	Title       string `gorm:"size:200;not null"`
+	Description string `gorm:"type:text"`
+	ProjectType int    `gorm:"default:0"`
+	DueAt       int64  `gorm:"default:0;index"`
+	AllowLate   bool   `gorm:"default:false"`
+	IsPublished bool   `gorm:"default:false"`
+}
+
+func (assignmentV3) TableName() string { return "assignments" }
+
+type submissionV3 struct {
+	ID            uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt     int64
+	UpdatedAt     int64
+	AssignmentID  uint   `gorm:"not null;index:idx_submission_assignment_student"`
+	StudentID     uint   `gorm:"not null;index:idx_submission_assignment_student"`
+	ProjectType   int    `gorm:"not null"`
+	ProjectID     uint   `gorm:"not null;index"`
+	ProjectMD5    string `gorm:"size:32"`
+	FilePath      string `gorm:"size:500"`
+	Attempt       int    `gorm:"default:1"`
+	IsLate        bool   `gorm:"default:false"`
+	Note          string `gorm:"size:1000"`
+	Status        string `gorm:"size:20;default:'submitted'"`
+	ReviewComment string `gorm:"size:1000"`
+	ReviewerID    uint   `gorm:"default:0"`
+	ReviewedAt    int64  `gorm:"default:0"`
+}
+
+func (submissionV3) TableName() string { return "submissions" }
+
+// v4 评分标准和评分
+
+type rubricCriterionV4 struct {
+	ID          uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt   int64
+	UpdatedAt   int64
+	DeletedAt   *int64 `gorm:"index"`
+	CourseID    uint   `gorm:"not null;index"`
+	Title       string `gorm:"size:200;not null"`
+	Description string `gorm:"size:1000"`
+	MaxPoints   int    `gorm:"not null"`
+	SortOrder   int    `gorm:"default:0"`
+}
+
+func (rubricCriterionV4) TableName() string { return "rubric_criteria" }
+
+type gradeV4 struct {
+	ID           uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt    int64
+	UpdatedAt    int64
+	SubmissionID uint `gorm:"not null;uniqueIndex"`
+	AssignmentID uint `gorm:"not null;index"`
+	ClassID      uint `gorm:"not null;index"`
+	StudentID    uint `gorm:"not null;index"`
+	GraderID     uint `gorm:"not null"`
+	Score        int
+	MaxScore     int
+	Comment      string `gorm:"type:text"`
+}
+
+func (gradeV4) TableName() string { return "grades" }
+
+type gradeItemV4 struct {
+	ID          uint   `gorm:"primarykey;autoIncrement"`
+	GradeID     uint   `gorm:"not null;index"`
+	CriterionID uint   `gorm:"not null"`
+	Title       string `gorm:"size:200"`
+	Points      int
+	MaxPoints   int
+	Comment     string `gorm:"size:1000"`
+}
+
+func (gradeItemV4) TableName() string { return "grade_items" }
+
+type gradeSpriteCommentV4 struct {
+	ID      uint   `gorm:"primarykey;autoIncrement"`
+	GradeID uint   `gorm:"not null;index"`
+	Sprite  string `gorm:"size:200;not null"`
+	Comment string `gorm:"type:text"`
+}
+
+func (gradeSpriteCommentV4) TableName() string { return "grade_sprite_comments" }
+
+// v5 班级邀请码有效期、人数上限和加入审核
+
+type classV5 struct {
+	CodeExpiresAt   int64 `gorm:"default:0"`
+	MaxStudents     int   `gorm:"default:0"`
+	RequireApproval bool  `gorm:"default:false"`
+}
+
+func (classV5) TableName() string { return "classes" }
+
+type classUserV5 struct {
+	Status string `gorm:"size:20;default:'active'"`
+}
+
+func (classUserV5) TableName() string { return "class_users" }
+
+// v6 用户会话支持多设备登录
+
+type userSessionV6 struct {
+	UserID     uint   `gorm:"index;not null"`
+	Device     string `gorm:"size:100"`
+	UserAgent  string `gorm:"size:512"`
+	IP         string `gorm:"size:64"`
+	LastSeenAt time.Time
+}
+
+func (userSessionV6) TableName() string { return "user_sessions" }
+
+// v7 刷新令牌
+
+type refreshTokenV7 struct {
+	ID        uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt time.Time
+	UserID    uint      `gorm:"index;not null"`
+	SessionID string    `gorm:"size:255;not null;index"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+func (refreshTokenV7) TableName() string { return "refresh_tokens" }
+
+// v8 登录失败记录
+
+type loginFailureV8 struct {
+	ID        uint      `gorm:"primarykey;autoIncrement"`
+	CreatedAt time.Time `gorm:"index"`
+	Username  string    `gorm:"size:255;index"`
+	UserID    uint
+	IP        string `gorm:"size:64;index"`
+	UserAgent string `gorm:"size:512"`
+	Reason    string `gorm:"size:32"`
+}
+
+func (loginFailureV8) TableName() string { return "login_failures" }
+
+// v9 图片密码和二维码登录卡
+
+type classV9 struct {
+	PictureLogin bool `gorm:"default:false"`
+}
+
+func (classV9) TableName() string { return "classes" }
+
+type studentLoginV9 struct {
+	ID            uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	ClassID       uint   `gorm:"not null;uniqueIndex:idx_student_logins_class_user"`
+	UserID        uint   `gorm:"not null;uniqueIndex:idx_student_logins_class_user"`
+	PictureHash   string `gorm:"size:255"`
+	BadgeHash     string `gorm:"size:64;index"`
+	BadgeIssuedAt *time.Time
+}
+
+func (studentLoginV9) TableName() string { return "student_logins" }
+
+// v10 用户认证来源
+
+type userV10 struct {
+	AuthProvider string `gorm:"size:20"`
+}
+
+func (userV10) TableName() string { return "users" }
+
+// v11 用户关联的外部身份
+
+type userIdentityV11 struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uint   `gorm:"index;not null"`
+	Provider    string `gorm:"size:20"`
+	Issuer      string `gorm:"size:255;uniqueIndex:idx_user_identities_subject"`
+	Subject     string `gorm:"size:255;uniqueIndex:idx_user_identities_subject"`
+	Email       string `gorm:"size:100"`
+	LastLoginAt time.Time
+}
+
+func (userIdentityV11) TableName() string { return "user_identities" }
+
+// v12 重置密码和强制修改密码
+
+type userV12 struct {
+	MustChangePassword bool `gorm:"default:false"`
+}
+
+func (userV12) TableName() string { return "users" }
+
+type passwordResetV12 struct {
+	ID        uint `gorm:"primarykey;autoIncrement"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null"`
+	Kind      string `gorm:"size:20;not null"`
+	CreatedBy uint
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	Attempts  int `gorm:"not null;default:0"`
+}
+
+func (passwordResetV12) TableName() string { return "password_resets" }
+
+// v13 角色和权限
+
+type roleV13 struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string              `gorm:"uniqueIndex;size:20;not null"`
+	Description string              `gorm:"size:200"`
+	BuiltIn     bool                `gorm:"default:false"`
+	Permissions []rolePermissionV13 `gorm:"foreignKey:RoleID"`
+}
+
+func (roleV13) TableName() string { return "roles" }
+
+type rolePermissionV13 struct {
+	RoleID     uint   `gorm:"primaryKey;autoIncrement:false"`
+	Permission string `gorm:"primaryKey;size:50"`
+}
+
+func (rolePermissionV13) TableName() string { return "role_permissions" }
+
+// v14 审计记录
+
+type auditEventV14 struct {
+	ID           uint      `gorm:"primarykey;autoIncrement"`
+	CreatedAt    time.Time `gorm:"index"`
+	ActorID      uint      `gorm:"index"`
+	ActorName    string    `gorm:"size:50"`
+	Action       string    `gorm:"size:50;index"`
+	ResourceType string    `gorm:"size:50;index:idx_audit_resource"`
+	ResourceID   string    `gorm:"size:100;index:idx_audit_resource"`
+	Before       string    `gorm:"type:text"`
+	After        string    `gorm:"type:text"`
+	IP           string    `gorm:"size:64"`
+}
+
+func (auditEventV14) TableName() string { return "audit_events" }
+
+// v15 作业提交次数唯一索引
+
+type submissionV15 struct {
+	ID           uint `gorm:"primarykey"`
+	AssignmentID uint `gorm:"uniqueIndex:idx_submission_attempt"`
+	StudentID    uint `gorm:"uniqueIndex:idx_submission_attempt"`
+	Attempt      int  `gorm:"uniqueIndex:idx_submission_attempt"`
+}
+
+func (submissionV15) TableName() string { return "submissions" }
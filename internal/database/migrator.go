@@ -0,0 +1,221 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaAhead 数据库中已执行的迁移比当前程序新，通常是用旧版本程序打开了新版本的数据库
+var ErrSchemaAhead = errors.New("数据库结构版本比当前程序新，请升级程序后再启动")
+
+// ErrIrreversible 迁移不支持回滚
+var ErrIrreversible = errors.New("该迁移不支持回滚")
+
+// Migration 一个版本化的数据库迁移步骤
+// Version 必须唯一且递增，已发布的迁移不要再修改，结构变化请追加新的迁移
+type Migration struct {
+	Version     int64
+	Description string
+	Up          func(tx *gorm.DB) error
+	Down        func(tx *gorm.DB) error // 为 nil 表示不支持回滚
+}
+
+// SchemaMigration 记录已执行的迁移
+type SchemaMigration struct {
+	Version     int64  `gorm:"primaryKey;autoIncrement:false"`
+	Description string `gorm:"size:255"`
+	AppliedAt   int64
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version     int64
+	Description string
+	Applied     bool
+	AppliedAt   int64
+	Unknown     bool // 数据库中有记录，但当前程序不认识
+}
+
+// Migrator 执行版本化迁移
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator 创建迁移执行器，migrations 会按版本号排序
+func NewMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{db: db, migrations: sorted}
+}
+
+// LatestVersion 当前程序认识的最新版本
+func (m *Migrator) LatestVersion() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// CurrentVersion 数据库中已执行的最大版本，没有执行过迁移时为 0
+func (m *Migrator) CurrentVersion() (int64, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	var current int64
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	return m.db.AutoMigrate(&SchemaMigration{})
+}
+
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := m.db.Order("version ASC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Status 列出所有迁移及执行状态，包括数据库中存在但程序不认识的版本
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]bool, len(m.migrations))
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		record, ok := applied[migration.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Applied:     ok,
+			AppliedAt:   record.AppliedAt,
+		})
+	}
+	for version, record := range applied {
+		if known[version] {
+			continue
+		}
+		statuses = append(statuses, MigrationStatus{
+			Version:     version,
+			Description: record.Description,
+			Applied:     true,
+			AppliedAt:   record.AppliedAt,
+			Unknown:     true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Check 检查数据库是否比程序新
+func (m *Migrator) Check() error {
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+	latest := m.LatestVersion()
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("%w: 数据库版本 %d，程序最新版本 %d", ErrSchemaAhead, version, latest)
+		}
+	}
+	return nil
+}
+
+// Up 按顺序执行未执行的迁移，target 为 0 表示执行到最新版本
+// 每个迁移在单独的事务中执行，并在同一事务中写入 schema_migrations
+func (m *Migrator) Up(target int64) ([]Migration, error) {
+	if err := m.Check(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if target > 0 && migration.Version > target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:     migration.Version,
+				Description: migration.Description,
+				AppliedAt:   time.Now().Unix(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("执行迁移 %d (%s) 失败: %w", migration.Version, migration.Description, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down 从最新的已执行迁移开始回滚 steps 个
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if err := m.Check(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("回滚迁移 %d (%s) 失败: %w", migration.Version, migration.Description, ErrIrreversible)
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("回滚迁移 %d (%s) 失败: %w", migration.Version, migration.Description, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
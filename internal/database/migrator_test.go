@@ -0,0 +1,222 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:migrate%d?mode=memory&cache=shared", time.Now().UnixNano())
+	db, err := Open(DriverSQLite, dsn, &gorm.Config{})
+	require.NoError(t, err)
+	return db
+}
+
+type migrationNote struct {
+	ID   uint
+	Text string
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version:     2,
+			Description: "添加 text 列",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().AddColumn(&migrationNote{}, "Text")
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&migrationNote{}, "Text")
+			},
+		},
+		{
+			Version:     1,
+			Description: "创建 notes 表",
+			Up: func(tx *gorm.DB) error {
+				return tx.Exec("CREATE TABLE migration_notes (id integer PRIMARY KEY)").Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("migration_notes")
+			},
+		},
+	}
+}
+
+// 测试按版本顺序执行、回滚和状态查询
+func TestMigrator_UpDown(t *testing.T) {
+	db := openTestDB(t)
+	m := NewMigrator(db, testMigrations())
+	assert.Equal(t, int64(2), m.LatestVersion())
+
+	done, err := m.Up(1)
+	require.NoError(t, err)
+	assert.Len(t, done, 1)
+	assert.False(t, db.Migrator().HasColumn(&migrationNote{}, "text"))
+
+	done, err = m.Up(0)
+	require.NoError(t, err)
+	assert.Len(t, done, 1)
+	assert.True(t, db.Migrator().HasColumn(&migrationNote{}, "text"))
+
+	// 重复执行不会再次运行
+	done, err = m.Up(0)
+	require.NoError(t, err)
+	assert.Empty(t, done)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.True(t, statuses[1].Applied)
+
+	done, err = m.Down(1)
+	require.NoError(t, err)
+	require.Len(t, done, 1)
+	assert.Equal(t, int64(2), done[0].Version)
+	assert.False(t, db.Migrator().HasColumn(&migrationNote{}, "text"))
+	assert.True(t, db.Migrator().HasTable("migration_notes"))
+
+	statuses, err = m.Status()
+	require.NoError(t, err)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+}
+
+// 测试迁移失败时回滚事务，不记录版本
+func TestMigrator_UpFailure(t *testing.T) {
+	db := openTestDB(t)
+	migrations := append(testMigrations(), Migration{
+		Version:     3,
+		Description: "失败的迁移",
+		Up: func(tx *gorm.DB) error {
+			return errors.New("boom")
+		},
+	})
+	m := NewMigrator(db, migrations)
+
+	done, err := m.Up(0)
+	assert.Error(t, err)
+	assert.Len(t, done, 2)
+
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	assert.False(t, statuses[2].Applied)
+
+	// 不支持回滚的迁移
+	irreversible := NewMigrator(openTestDB(t), []Migration{{Version: 1, Up: func(tx *gorm.DB) error { return nil }}})
+	_, err = irreversible.Up(0)
+	require.NoError(t, err)
+	_, err = irreversible.Down(1)
+	assert.ErrorIs(t, err, ErrIrreversible)
+}
+
+// 测试数据库比程序新时拒绝继续
+func TestMigrator_SchemaAhead(t *testing.T) {
+	db := openTestDB(t)
+	_, err := NewMigrator(db, testMigrations()).Up(0)
+	require.NoError(t, err)
+
+	older := NewMigrator(db, testMigrations()[1:])
+	assert.ErrorIs(t, older.Check(), ErrSchemaAhead)
+	_, err = older.Up(0)
+	assert.ErrorIs(t, err, ErrSchemaAhead)
+
+	statuses, err := older.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[1].Unknown)
+}
+
+// 测试旧的课时项目列会被搬到新列
+func TestRunMigrations_LessonProjectColumns(t *testing.T) {
+	db := openTestDB(t)
+	require.NoError(t, migrateBaseline(db))
+	require.NoError(t, db.Exec("ALTER TABLE lessons ADD COLUMN `project_id1` integer").Error)
+	require.NoError(t, db.Exec("INSERT INTO lessons (title, project_id1, project_id_1) VALUES ('旧课时', 42, 0)").Error)
+
+	require.NoError(t, RunMigrations(db))
+	assert.False(t, db.Migrator().HasColumn(&model.Lesson{}, "project_id1"))
+
+	var lesson model.Lesson
+	require.NoError(t, db.First(&lesson).Error)
+	assert.Equal(t, uint(42), lesson.ProjectID1)
+
+	// 再次执行不会报错
+	require.NoError(t, RunMigrations(db))
+}
+
+func TestRunMigrations_MultiDeviceSessions(t *testing.T) {
+	db := openTestDB(t)
+	require.NoError(t, migrateBaseline(db))
+	// 旧版本的 user_sessions 表 user_id 上是唯一索引，没有设备信息列
+	require.NoError(t, db.Migrator().DropTable(&model.UserSession{}))
+	require.NoError(t, db.Exec("CREATE TABLE user_sessions (id integer PRIMARY KEY AUTOINCREMENT, created_at datetime, updated_at datetime, deleted_at datetime, "+
+		"`user_id` integer NOT NULL, `session_id` varchar(255) NOT NULL, `expires_at` datetime NOT NULL, `is_active` numeric DEFAULT true)").Error)
+	require.NoError(t, db.Exec("CREATE UNIQUE INDEX `idx_user_sessions_user_id` ON user_sessions(`user_id`)").Error)
+	require.NoError(t, db.Exec("CREATE UNIQUE INDEX `idx_user_sessions_session_id` ON user_sessions(`session_id`)").Error)
+
+	require.NoError(t, RunMigrations(db))
+	assert.True(t, db.Migrator().HasColumn(&model.UserSession{}, "Device"))
+	assert.True(t, db.Migrator().HasIndex(&model.UserSession{}, "idx_user_sessions_user_id"))
+
+	// 同一用户可以有多个会话
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, db.Create(&model.UserSession{UserID: 1, SessionID: "a", ExpiresAt: expiresAt}).Error)
+	require.NoError(t, db.Create(&model.UserSession{UserID: 1, SessionID: "b", ExpiresAt: expiresAt}).Error)
+}
+
+// 测试执行所有迁移后，模型的每个字段都有对应的列，修改模型时需要同时新增迁移
+func TestRunMigrations_CoversModels(t *testing.T) {
+	db := openTestDB(t)
+	require.NoError(t, RunMigrations(db))
+
+	models := []interface{}{
+		&model.User{}, &model.UserSession{}, &model.RefreshToken{}, &model.Class{}, &model.ClassUser{},
+		&model.ClassCourse{}, &model.Course{}, &model.LessonFile{}, &model.Lesson{}, &model.LessonCourse{},
+		&model.File{}, &model.ScratchProject{}, &model.Program{}, &model.UserAsset{}, &model.Share{},
+		&model.ExcalidrawBoard{}, &model.Assignment{}, &model.Submission{}, &model.RubricCriterion{},
+		&model.Grade{}, &model.GradeItem{}, &model.GradeSpriteComment{}, &model.LoginFailure{},
+		&model.StudentLogin{}, &model.UserIdentity{}, &model.PasswordReset{}, &model.Role{},
+		&model.RolePermission{}, &model.AuditEvent{},
+	}
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		require.NoError(t, stmt.Parse(m))
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			assert.True(t, db.Migrator().HasColumn(m, field.DBName), "%s.%s", stmt.Schema.Table, field.DBName)
+		}
+	}
+}
+
+// 测试同时提交留下的重复提交次数按提交顺序重新编号，之后不能再出现重复
+func TestRunMigrations_SubmissionAttemptIndex(t *testing.T) {
+	db := openTestDB(t)
+	_, err := NewMigrator(db, Migrations).Up(14)
+	require.NoError(t, err)
+	for _, attempt := range []int{1, 2, 2, 3} {
+		require.NoError(t, db.Exec("INSERT INTO submissions (assignment_id, student_id, project_type, project_id, attempt) VALUES (1, 2, 1, 10, ?)", attempt).Error)
+	}
+	require.NoError(t, db.Exec("INSERT INTO submissions (assignment_id, student_id, project_type, project_id, attempt) VALUES (1, 3, 1, 11, 1)").Error)
+
+	require.NoError(t, RunMigrations(db))
+	var submissions []model.Submission
+	require.NoError(t, db.Order("id").Find(&submissions).Error)
+	attempts := []int{}
+	for _, submission := range submissions {
+		attempts = append(attempts, submission.Attempt)
+	}
+	assert.Equal(t, []int{1, 2, 3, 4, 1}, attempts)
+
+	err = db.Exec("INSERT INTO submissions (assignment_id, student_id, project_type, project_id, attempt) VALUES (1, 2, 1, 10, 4)").Error
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// 支持的数据库驱动
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+// NormalizeDriver 统一驱动名称，空值默认为 sqlite
+func NormalizeDriver(driver string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "sqlite", "sqlite3":
+		return DriverSQLite, nil
+	case "postgres", "postgresql":
+		return DriverPostgres, nil
+	case "mysql":
+		return DriverMySQL, nil
+	default:
+		return "", fmt.Errorf("不支持的数据库驱动: %s", driver)
+	}
+}
+
+// Open 根据驱动类型打开数据库连接
+func Open(driver, dsn string, gormConfig *gorm.Config) (*gorm.DB, error) {
+	name, err := NormalizeDriver(driver)
+	if err != nil {
+		return nil, err
+	}
+	if gormConfig == nil {
+		gormConfig = &gorm.Config{}
+	}
+	// SQLite 默认不检查外键，为了在各数据库上行为一致，迁移时都不创建外键约束
+	gormConfig.DisableForeignKeyConstraintWhenMigrating = true
+
+	var dialector gorm.Dialector
+	switch name {
+	case DriverPostgres:
+		dialector = postgres.Open(dsn)
+	case DriverMySQL:
+		// 时间字段需要 parseTime 才能扫描到 time.Time
+		if !strings.Contains(dsn, "parseTime=") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&parseTime=true"
+			} else {
+				dsn += "?parseTime=true"
+			}
+		}
+		dialector = mysql.Open(dsn)
+	default:
+		dialector = sqlite.Open(dsn)
+	}
+	return gorm.Open(dialector, gormConfig)
+}
+
+// SQLiteFilePath 从 SQLite 的 DSN 中取出数据库文件路径，去掉 file: 前缀和连接参数
+func SQLiteFilePath(dsn string) string {
+	path := strings.TrimPrefix(dsn, "file:")
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	return path
+}
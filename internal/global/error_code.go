@@ -42,6 +42,20 @@ const (
 	ErrorCodeRecordNotFound   = 305 // 记录不存在
 	ErrorCodeWriteFileFailed  = 306 // 写入文件失败
 
+	// Assignment 模块错误码 (500-599)
+	ErrorCodeAssignmentClosed      = 500 // 作业已截止
+	ErrorCodeAssignmentProjectType = 501 // 提交的项目类型与作业要求不符
+
+	// Grade 模块错误码 (600-699)
+	ErrorCodeGradePointsOutOfRange = 600 // 评分超出范围
+	ErrorCodeGradeCriterionInvalid = 601 // 评分项不属于该课程
+
+	// Class 模块错误码 (700-799)
+	ErrorCodeClassCodeInvalid = 700 // 邀请码无效
+	ErrorCodeClassCodeExpired = 701 // 邀请码已过期
+	ErrorCodeClassFull        = 702 // 班级人数已满
+	ErrorCodeAlreadyInClass   = 703 // 已经在班级中
+
 	// 系统错误码 (1000+)
 	ErrorCodeSystemError = 1000 // 系统错误
 	ErrorCodeDBError     = 1001 // 数据库错误
@@ -103,6 +117,20 @@ const (
 	ErrorMsgRecordNotFound   = "记录不存在"
 	ErrorMsgWriteFileFailed  = "写入文件失败"
 
+	// Assignment 模块错误消息
+	ErrorMsgAssignmentClosed      = "作业已截止，不能再提交"
+	ErrorMsgAssignmentProjectType = "提交的项目类型与作业要求不符"
+
+	// Grade 模块错误消息
+	ErrorMsgGradePointsOutOfRange = "评分超出范围"
+	ErrorMsgGradeCriterionInvalid = "评分项不属于该课程"
+
+	// Class 模块错误消息
+	ErrorMsgClassCodeInvalid = "班级不存在或邀请码无效"
+	ErrorMsgClassCodeExpired = "邀请码已过期"
+	ErrorMsgClassFull        = "班级人数已满"
+	ErrorMsgAlreadyInClass   = "您已经在班级中"
+
 	// 系统错误消息
 	ErrorMsgSystemError = "系统错误"
 	ErrorMsgDBError     = "数据库错误"
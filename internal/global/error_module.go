@@ -12,3 +12,7 @@ const ERR_MODULE_CLASS gorails.ErrorModule = 7
 const ERR_MODULE_COURSE gorails.ErrorModule = 8
 const ERR_MODULE_LESSON gorails.ErrorModule = 9
 const ERR_MODULE_PROGRAM gorails.ErrorModule = 10
+const ERR_MODULE_ASSIGNMENT gorails.ErrorModule = 11
+const ERR_MODULE_GRADE gorails.ErrorModule = 12
+const ERR_MODULE_ROLE gorails.ErrorModule = 13
+const ERR_MODULE_AUDIT gorails.ErrorModule = 14
@@ -0,0 +1,521 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// ===== 教师端：作业管理 =====
+
+// CreateAssignmentParams 布置作业请求参数
+type CreateAssignmentParams struct {
+	ClassID     uint   `json:"-" uri:"class_id"`
+	CourseID    uint   `json:"course_id" binding:"required"`
+	LessonID    uint   `json:"lesson_id" binding:"required"`
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	ProjectType int    `json:"project_type"`
+	DueAt       int64  `json:"due_at"`
+	AllowLate   bool   `json:"allow_late"`
+	IsPublished *bool  `json:"is_published"`
+}
+
+func (p *CreateAssignmentParams) Parse(c *gin.Context) gorails.Error {
+	// 先绑定 JSON 再绑定路径参数：ShouldBindUri 会校验整个结构体，JSON 中的必填字段需要先就位
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if !isValidAssignmentProjectType(p.ProjectType) {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("无效的项目类型"))
+	}
+	return nil
+}
+
+// CreateAssignmentHandler 布置作业
+func (h *Handler) CreateAssignmentHandler(c *gin.Context, params *CreateAssignmentParams) (*model.Assignment, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.getUserID(c)
+
+	// 作业只能布置在班级已添加的课程课时上
+	ok, err := h.dao.ClassDao.IsLessonInClass(params.ClassID, params.CourseID, params.LessonID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	if !ok {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("课时不属于该班级"))
+	}
+
+	assignment := &model.Assignment{
+		ClassID:     params.ClassID,
+		CourseID:    params.CourseID,
+		LessonID:    params.LessonID,
+		TeacherID:   userID,
+		Title:       params.Title,
+		Description: params.Description,
+		ProjectType: params.ProjectType,
+		DueAt:       params.DueAt,
+		AllowLate:   params.AllowLate,
+		IsPublished: params.IsPublished == nil || *params.IsPublished,
+	}
+	if err := h.dao.AssignmentDao.CreateAssignment(assignment); err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+
+	return assignment, nil, nil
+}
+
+// ListClassAssignmentsParams 班级作业列表请求参数
+type ListClassAssignmentsParams struct {
+	ClassID  uint `json:"class_id" uri:"class_id" binding:"required"`
+	LessonID uint `json:"lesson_id" form:"lesson_id"`
+}
+
+func (p *ListClassAssignmentsParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if lessonIDStr := c.Query("lesson_id"); lessonIDStr != "" {
+		lessonID, err := strconv.ParseUint(lessonIDStr, 10, 32)
+		if err != nil {
+			return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+		p.LessonID = uint(lessonID)
+	}
+	return nil
+}
+
+// ListClassAssignmentsHandler 列出班级的所有作业（包括未发布的）
+func (h *Handler) ListClassAssignmentsHandler(c *gin.Context, params *ListClassAssignmentsParams) ([]model.Assignment, *gorails.ResponseMeta, gorails.Error) {
+	assignments, err := h.dao.AssignmentDao.ListAssignments(params.ClassID, params.LessonID, false)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+
+	return assignments, &gorails.ResponseMeta{
+		HasNext: false,
+		Total:   len(assignments),
+	}, nil
+}
+
+// ClassAssignmentParams 班级作业路径参数
+type ClassAssignmentParams struct {
+	ClassID      uint `json:"class_id" uri:"class_id" binding:"required"`
+	AssignmentID uint `json:"assignment_id" uri:"assignment_id" binding:"required"`
+}
+
+func (p *ClassAssignmentParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// GetClassAssignmentHandler 获取班级作业详情
+func (h *Handler) GetClassAssignmentHandler(c *gin.Context, params *ClassAssignmentParams) (*model.Assignment, *gorails.ResponseMeta, gorails.Error) {
+	assignment, gerr := h.getClassAssignment(params.ClassID, params.AssignmentID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+	return assignment, nil, nil
+}
+
+// UpdateAssignmentParams 更新作业请求参数，未传的字段保持不变
+type UpdateAssignmentParams struct {
+	ClassID      uint    `json:"-" uri:"class_id"`
+	AssignmentID uint    `json:"-" uri:"assignment_id"`
+	Title        *string `json:"title"`
+	Description  *string `json:"description"`
+	ProjectType  *int    `json:"project_type"`
+	DueAt        *int64  `json:"due_at"`
+	AllowLate    *bool   `json:"allow_late"`
+	IsPublished  *bool   `json:"is_published"`
+}
+
+func (p *UpdateAssignmentParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.Title != nil && strings.TrimSpace(*p.Title) == "" {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("作业标题不能为空"))
+	}
+	if p.ProjectType != nil && !isValidAssignmentProjectType(*p.ProjectType) {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("无效的项目类型"))
+	}
+	return nil
+}
+
+// UpdateAssignmentHandler 更新作业
+func (h *Handler) UpdateAssignmentHandler(c *gin.Context, params *UpdateAssignmentParams) (*model.Assignment, *gorails.ResponseMeta, gorails.Error) {
+	if _, gerr := h.getClassAssignment(params.ClassID, params.AssignmentID); gerr != nil {
+		return nil, nil, gerr
+	}
+
+	updates := map[string]interface{}{}
+	if params.Title != nil {
+		updates["title"] = *params.Title
+	}
+	if params.Description != nil {
+		updates["description"] = *params.Description
+	}
+	if params.ProjectType != nil {
+		updates["project_type"] = *params.ProjectType
+	}
+	if params.DueAt != nil {
+		updates["due_at"] = *params.DueAt
+	}
+	if params.AllowLate != nil {
+		updates["allow_late"] = *params.AllowLate
+	}
+	if params.IsPublished != nil {
+		updates["is_published"] = *params.IsPublished
+	}
+
+	if len(updates) > 0 {
+		if err := h.dao.AssignmentDao.UpdateAssignment(params.AssignmentID, updates); err != nil {
+			return nil, nil, toAssignmentError(err)
+		}
+	}
+
+	assignment, err := h.dao.AssignmentDao.GetAssignment(params.AssignmentID)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+	return assignment, nil, nil
+}
+
+// DeleteAssignmentHandler 删除作业
+func (h *Handler) DeleteAssignmentHandler(c *gin.Context, params *ClassAssignmentParams) (*gorails.ResponseEmpty, *gorails.ResponseMeta, gorails.Error) {
+	if _, gerr := h.getClassAssignment(params.ClassID, params.AssignmentID); gerr != nil {
+		return nil, nil, gerr
+	}
+
+	if err := h.dao.AssignmentDao.DeleteAssignment(params.AssignmentID); err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+	return &gorails.ResponseEmpty{}, nil, nil
+}
+
+// ListAssignmentSubmissionsParams 作业提交列表请求参数
+type ListAssignmentSubmissionsParams struct {
+	ClassID      uint `json:"class_id" uri:"class_id" binding:"required"`
+	AssignmentID uint `json:"assignment_id" uri:"assignment_id" binding:"required"`
+	All          bool `json:"all" form:"all"` // 为 true 时返回所有提交，否则每个学生只返回最近一次
+}
+
+func (p *ListAssignmentSubmissionsParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	p.All = c.DefaultQuery("all", "false") == "true"
+	return nil
+}
+
+// ListAssignmentSubmissionsHandler 列出作业的提交情况
+func (h *Handler) ListAssignmentSubmissionsHandler(c *gin.Context, params *ListAssignmentSubmissionsParams) ([]model.Submission, *gorails.ResponseMeta, gorails.Error) {
+	if _, gerr := h.getClassAssignment(params.ClassID, params.AssignmentID); gerr != nil {
+		return nil, nil, gerr
+	}
+
+	submissions, err := h.dao.AssignmentDao.ListSubmissions(params.AssignmentID, !params.All)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+
+	return submissions, &gorails.ResponseMeta{
+		HasNext: false,
+		Total:   len(submissions),
+	}, nil
+}
+
+// ClassSubmissionParams 班级作业提交路径参数
+type ClassSubmissionParams struct {
+	ClassID      uint `json:"class_id" uri:"class_id" binding:"required"`
+	SubmissionID uint `json:"submission_id" uri:"submission_id" binding:"required"`
+}
+
+func (p *ClassSubmissionParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// GetClassSubmissionHandler 获取提交详情
+func (h *Handler) GetClassSubmissionHandler(c *gin.Context, params *ClassSubmissionParams) (*model.Submission, *gorails.ResponseMeta, gorails.Error) {
+	submission, gerr := h.getClassSubmission(params.ClassID, params.SubmissionID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+	return submission, nil, nil
+}
+
+// GetClassSubmissionContentHandler 获取提交时保存的项目快照内容
+func (h *Handler) GetClassSubmissionContentHandler(c *gin.Context, params *ClassSubmissionParams) ([]byte, *gorails.ResponseMeta, gorails.Error) {
+	submission, gerr := h.getClassSubmission(params.ClassID, params.SubmissionID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	content, err := h.dao.AssignmentDao.GetSubmissionContent(submission)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+	return content, nil, nil
+}
+
+// ReturnSubmissionParams 退回提交请求参数
+type ReturnSubmissionParams struct {
+	ClassID      uint   `json:"-" uri:"class_id"`
+	SubmissionID uint   `json:"-" uri:"submission_id"`
+	Comment      string `json:"comment"`
+}
+
+func (p *ReturnSubmissionParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ReturnSubmissionHandler 退回提交，学生可以修改后重新提交
+func (h *Handler) ReturnSubmissionHandler(c *gin.Context, params *ReturnSubmissionParams) (*model.Submission, *gorails.ResponseMeta, gorails.Error) {
+	if _, gerr := h.getClassSubmission(params.ClassID, params.SubmissionID); gerr != nil {
+		return nil, nil, gerr
+	}
+
+	if err := h.dao.AssignmentDao.ReturnSubmission(params.SubmissionID, h.getUserID(c), params.Comment); err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+
+	submission, err := h.dao.AssignmentDao.GetSubmission(params.SubmissionID)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+	return submission, nil, nil
+}
+
+// ===== 学生端：查看和提交作业 =====
+
+// GetMyClassAssignmentsHandler 列出我所在班级的作业（学生端，只返回已发布的作业）
+func (h *Handler) GetMyClassAssignmentsHandler(c *gin.Context, params *ListClassAssignmentsParams) ([]model.Assignment, *gorails.ResponseMeta, gorails.Error) {
+	if !h.isClassMember(c, params.ClassID) {
+		return nil, nil, gorails.NewError(http.StatusForbidden, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, errors.New("您不是该班级的成员"))
+	}
+
+	assignments, err := h.dao.AssignmentDao.ListAssignments(params.ClassID, params.LessonID, true)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+
+	return assignments, &gorails.ResponseMeta{
+		HasNext: false,
+		Total:   len(assignments),
+	}, nil
+}
+
+// MyAssignmentParams 学生端作业路径参数
+type MyAssignmentParams struct {
+	AssignmentID uint `json:"assignment_id" uri:"assignment_id" binding:"required"`
+}
+
+func (p *MyAssignmentParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// GetMyAssignmentResponse 学生端作业详情响应
+type GetMyAssignmentResponse struct {
+	Assignment  *model.Assignment  `json:"assignment"`
+	IsOverdue   bool               `json:"is_overdue"`
+	Submissions []model.Submission `json:"submissions"`
+}
+
+// GetMyAssignmentHandler 获取作业详情以及我的提交记录（学生端）
+func (h *Handler) GetMyAssignmentHandler(c *gin.Context, params *MyAssignmentParams) (*GetMyAssignmentResponse, *gorails.ResponseMeta, gorails.Error) {
+	assignment, gerr := h.getMyAssignment(c, params.AssignmentID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	submissions, err := h.dao.AssignmentDao.ListStudentSubmissions(assignment.ID, h.getUserID(c))
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+
+	return &GetMyAssignmentResponse{
+		Assignment:  assignment,
+		IsOverdue:   assignment.IsOverdue(time.Now()),
+		Submissions: submissions,
+	}, nil, nil
+}
+
+// SubmitAssignmentParams 提交作业请求参数
+type SubmitAssignmentParams struct {
+	AssignmentID uint   `json:"-" uri:"assignment_id"`
+	ProjectType  int    `json:"project_type" binding:"required"`
+	ProjectID    uint   `json:"project_id" binding:"required"`
+	Note         string `json:"note"`
+}
+
+func (p *SubmitAssignmentParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.ProjectType != model.ProjectTypeScratch && p.ProjectType != model.ProjectTypeProgram {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("无效的项目类型"))
+	}
+	return nil
+}
+
+// SubmitAssignmentHandler 提交作业（学生端）
+// 提交时读取项目当前版本的内容并保存快照，之后学生继续修改项目不会影响已提交的内容
+func (h *Handler) SubmitAssignmentHandler(c *gin.Context, params *SubmitAssignmentParams) (*model.Submission, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.getUserID(c)
+
+	assignment, gerr := h.getMyAssignment(c, params.AssignmentID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+	if assignment.ProjectType != 0 && assignment.ProjectType != params.ProjectType {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeAssignmentProjectType, global.ErrorMsgAssignmentProjectType, nil)
+	}
+
+	var content []byte
+	switch params.ProjectType {
+	case model.ProjectTypeScratch:
+		project, err := h.dao.ScratchDao.GetProject(params.ProjectID)
+		if err != nil || project.UserID != userID {
+			return nil, nil, gorails.NewError(http.StatusForbidden, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeProjectAccessDenied, global.ErrorMsgProjectAccessDenied, err)
+		}
+		content, err = h.dao.ScratchDao.GetProjectBinary(project.ID, project.MD5)
+		if err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+		}
+	case model.ProjectTypeProgram:
+		program, err := h.dao.ProgramDao.Get(params.ProjectID)
+		if err != nil || program.UserID != userID {
+			return nil, nil, gorails.NewError(http.StatusForbidden, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeProjectAccessDenied, global.ErrorMsgProjectAccessDenied, err)
+		}
+		content, err = h.dao.ProgramDao.GetContent(program.ID, program.MD5)
+		if err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+		}
+	}
+
+	submission := &model.Submission{
+		AssignmentID: assignment.ID,
+		StudentID:    userID,
+		ProjectType:  params.ProjectType,
+		ProjectID:    params.ProjectID,
+		Note:         params.Note,
+	}
+	if err := h.dao.AssignmentDao.CreateSubmission(submission, content); err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+
+	return submission, nil, nil
+}
+
+// MySubmissionParams 学生端提交路径参数
+type MySubmissionParams struct {
+	SubmissionID uint `json:"submission_id" uri:"submission_id" binding:"required"`
+}
+
+func (p *MySubmissionParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// GetMySubmissionContentHandler 获取我提交的项目快照（学生端）
+func (h *Handler) GetMySubmissionContentHandler(c *gin.Context, params *MySubmissionParams) ([]byte, *gorails.ResponseMeta, gorails.Error) {
+	submission, err := h.dao.AssignmentDao.GetSubmission(params.SubmissionID)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+	if submission.StudentID != h.getUserID(c) {
+		return nil, nil, gorails.NewError(http.StatusForbidden, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, nil)
+	}
+
+	content, err := h.dao.AssignmentDao.GetSubmissionContent(submission)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+	return content, nil, nil
+}
+
+// ===== 辅助函数 =====
+
+// getClassAssignment 获取作业并确认它属于指定班级
+func (h *Handler) getClassAssignment(classID, assignmentID uint) (*model.Assignment, gorails.Error) {
+	assignment, err := h.dao.AssignmentDao.GetAssignment(assignmentID)
+	if err != nil {
+		return nil, toAssignmentError(err)
+	}
+	if assignment.ClassID != classID {
+		return nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, nil)
+	}
+	return assignment, nil
+}
+
+// getClassSubmission 获取提交记录并确认它属于指定班级的作业
+func (h *Handler) getClassSubmission(classID, submissionID uint) (*model.Submission, gorails.Error) {
+	submission, err := h.dao.AssignmentDao.GetSubmission(submissionID)
+	if err != nil {
+		return nil, toAssignmentError(err)
+	}
+	if _, gerr := h.getClassAssignment(classID, submission.AssignmentID); gerr != nil {
+		return nil, gerr
+	}
+	return submission, nil
+}
+
+// getMyAssignment 获取当前用户可见的作业：作业已发布且用户是班级成员
+func (h *Handler) getMyAssignment(c *gin.Context, assignmentID uint) (*model.Assignment, gorails.Error) {
+	assignment, err := h.dao.AssignmentDao.GetAssignment(assignmentID)
+	if err != nil {
+		return nil, toAssignmentError(err)
+	}
+	if !assignment.IsPublished {
+		return nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeRecordNotFound, global.ErrorMsgRecordNotFound, nil)
+	}
+	if !h.isClassMember(c, assignment.ClassID) {
+		return nil, gorails.NewError(http.StatusForbidden, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, errors.New("您不是该班级的成员"))
+	}
+	return assignment, nil
+}
+
+// isValidAssignmentProjectType 作业要求的项目类型，0 表示不限
+func isValidAssignmentProjectType(projectType int) bool {
+	return projectType == 0 || projectType == model.ProjectTypeScratch || projectType == model.ProjectTypeProgram
+}
+
+// toAssignmentError AssignmentDao 返回的是自定义错误时直接透传，否则按系统错误处理
+func toAssignmentError(err error) gorails.Error {
+	if ce, ok := err.(gorails.Error); ok {
+		return ce
+	}
+	return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_ASSIGNMENT, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+}
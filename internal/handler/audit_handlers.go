@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/csvutil"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+	"go.uber.org/zap"
+)
+
+// maxAuditExportRows 一次最多导出的审计记录数，超过时需要缩小时间范围
+const maxAuditExportRows = 50000
+
+// audit 记录一次操作。before 和 after 为操作前后的资源，没有时传 nil。
+// 操作已经完成，审计记录写入失败只记录日志，不影响请求结果
+func (h *Handler) audit(c *gin.Context, action, resourceType, resourceID string, before, after interface{}) {
+	if h.dao.AuditDao == nil {
+		return
+	}
+
+	event := &model.AuditEvent{
+		ActorID:      h.getUserID(c),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Before:       auditJSON(before),
+		After:        auditJSON(after),
+		IP:           c.ClientIP(),
+	}
+	if err := h.dao.AuditDao.RecordEvent(event); err != nil && h.logger != nil {
+		h.logger.Error("写入审计记录失败", zap.String("action", action), zap.String("resource_id", resourceID), zap.Error(err))
+	}
+}
+
+// auditID 将数字ID转换为审计记录中的资源ID
+func auditID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// auditJSON 将资源转换为 JSON，nil 转换为空字符串
+func auditJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// parseAuditFilter 解析审计记录的查询条件，时间可以是 RFC3339 或日期
+func parseAuditFilter(c *gin.Context) (dao.AuditEventFilter, gorails.Error) {
+	filter := dao.AuditEventFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resourceType"),
+		ResourceID:   c.Query("resourceID"),
+	}
+	if actorID := c.Query("actorID"); actorID != "" {
+		id, err := strconv.ParseUint(actorID, 10, 32)
+		if err != nil {
+			return filter, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUDIT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+		filter.ActorID = uint(id)
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseTimeQuery(value)
+		if err != nil {
+			return filter, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUDIT, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+		*t = parsed
+	}
+	return filter, nil
+}
+
+// parseTimeQuery 解析查询参数中的时间，可以是 RFC3339 或日期，日期按本地时区的零点
+func parseTimeQuery(value string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		parsed, err = time.ParseInLocation(time.DateOnly, value, time.Local)
+	}
+	return parsed, err
+}
+
+// ListAuditEventsParams 列出审计记录请求参数
+type ListAuditEventsParams struct {
+	Filter   dao.AuditEventFilter
+	PageSize uint `json:"page_size" form:"pageSize"`
+	BeginID  uint `json:"begin_id" form:"beginID"`
+	Forward  bool `json:"forward" form:"forward"`
+	Asc      bool `json:"asc" form:"asc"`
+}
+
+func (p *ListAuditEventsParams) Parse(c *gin.Context) gorails.Error {
+	filter, gerr := parseAuditFilter(c)
+	if gerr != nil {
+		return gerr
+	}
+	p.Filter = filter
+
+	// 设置默认值，默认最新的记录在前
+	p.PageSize = 20
+	p.BeginID = 0
+	p.Forward = true
+	p.Asc = false
+
+	if pageSize, err := strconv.ParseUint(c.DefaultQuery("pageSize", "20"), 10, 32); err == nil && pageSize > 0 && pageSize <= 100 {
+		p.PageSize = uint(pageSize)
+	}
+	if beginID, err := strconv.ParseUint(c.DefaultQuery("beginID", "0"), 10, 32); err == nil {
+		p.BeginID = uint(beginID)
+	}
+	p.Forward = c.DefaultQuery("forward", "true") != "false"
+	p.Asc = c.DefaultQuery("asc", "false") == "true"
+	return nil
+}
+
+// ListAuditEventsHandler 按条件分页列出审计记录
+func (h *Handler) ListAuditEventsHandler(c *gin.Context, params *ListAuditEventsParams) ([]model.AuditEvent, *gorails.ResponseMeta, gorails.Error) {
+	events, hasMore, err := h.dao.AuditDao.ListEvents(params.Filter, params.PageSize, params.BeginID, params.Forward, params.Asc)
+	if err != nil {
+		return nil, nil, auditError(err)
+	}
+	return events, &gorails.ResponseMeta{HasNext: hasMore}, nil
+}
+
+// ExportAuditEventsParams 导出审计记录请求参数，条件与列表相同
+type ExportAuditEventsParams struct {
+	Filter dao.AuditEventFilter
+}
+
+func (p *ExportAuditEventsParams) Parse(c *gin.Context) gorails.Error {
+	filter, gerr := parseAuditFilter(c)
+	if gerr != nil {
+		return gerr
+	}
+	p.Filter = filter
+	return nil
+}
+
+// ExportAuditEventsHandler 按时间顺序导出符合条件的审计记录 CSV
+func (h *Handler) ExportAuditEventsHandler(c *gin.Context, params *ExportAuditEventsParams) ([]byte, *gorails.ResponseMeta, gorails.Error) {
+	var buf bytes.Buffer
+	// 写入 UTF-8 BOM，避免 Excel 打开中文乱码
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"ID", "时间", "操作人ID", "操作人", "操作", "资源类型", "资源ID", "操作前", "操作后", "IP"})
+
+	var beginID uint
+	for rows := 0; rows < maxAuditExportRows; {
+		events, hasMore, err := h.dao.AuditDao.ListEvents(params.Filter, 500, beginID, true, true)
+		if err != nil {
+			return nil, nil, auditError(err)
+		}
+		for _, event := range events {
+			w.Write([]string{
+				strconv.FormatUint(uint64(event.ID), 10),
+				event.CreatedAt.Format(time.RFC3339),
+				strconv.FormatUint(uint64(event.ActorID), 10),
+				csvutil.SafeCell(event.ActorName),
+				event.Action,
+				event.ResourceType,
+				csvutil.SafeCell(event.ResourceID),
+				csvutil.SafeCell(event.Before),
+				csvutil.SafeCell(event.After),
+				csvutil.SafeCell(event.IP),
+			})
+			beginID = event.ID
+		}
+		rows += len(events)
+		if !hasMore {
+			break
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUDIT, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"audit_events_%s.csv\"", time.Now().Format("20060102")))
+	return buf.Bytes(), nil, nil
+}
+
+// auditError AuditDao 返回的是自定义错误时直接透传，否则按查询失败处理
+func auditError(err error) gorails.Error {
+	if ce, ok := err.(gorails.Error); ok {
+		return ce
+	}
+	return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUDIT, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+// 测试导出审计记录时转义用户可以控制的单元格，避免在 Excel 中被当作公式执行
+func TestHandler_ExportAuditEventsEscapesFormulas(t *testing.T) {
+	auditDao := new(MockAuditDao)
+	auditDao.On("ListEvents", mock.Anything, uint(500), uint(0), true, true).Return([]model.AuditEvent{{
+		ID:           1,
+		CreatedAt:    time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC),
+		ActorID:      2,
+		ActorName:    `=HYPERLINK("http://evil.example","x")`,
+		Action:       "user.update",
+		ResourceType: "role",
+		ResourceID:   "+teacher",
+		Before:       `{"role":"student"}`,
+		After:        "@SUM(A1)",
+		IP:           "10.0.0.1",
+	}}, false, nil).Once()
+
+	h := NewHandler(&dao.Dao{AuditDao: auditDao}, nil, zap.NewNop(), &config.Config{})
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/admin/audit_events/export", nil)
+
+	data, _, gerr := h.ExportAuditEventsHandler(c, &ExportAuditEventsParams{})
+	assert.Nil(t, gerr)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Contains(t, lines[1], `"'=HYPERLINK(""http://evil.example"",""x"")"`)
+		assert.Contains(t, lines[1], ",'+teacher,")
+		assert.Contains(t, lines[1], `,"{""role"":""student""}",'@SUM(A1),`)
+	}
+	auditDao.AssertExpectations(t)
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao"
 	"github.com/jun/fun_code/internal/global"
 	"github.com/mail2fish/gorails/gorails"
 )
@@ -52,30 +56,96 @@ func (p *LoginParams) Parse(c *gin.Context) gorails.Error {
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Token string `json:"token"`
-	Role  string `json:"role"`
+	Token        string `json:"token"`
+	Role         string `json:"role"`
+	ExpiresIn    int    `json:"expires_in"`              // 访问令牌剩余有效秒数
+	RefreshToken string `json:"refresh_token,omitempty"` // 不使用 cookie 的客户端用它调用 /api/auth/refresh
+	// MustChangePassword 需要先调用 /api/auth/password 修改密码，之前其他接口都返回 403
+	MustChangePassword bool `json:"must_change_password,omitempty"`
 }
 
 // LoginHandler 用户登录 gorails.Wrap 形式
 func (h *Handler) LoginHandler(c *gin.Context, params *LoginParams) (*LoginResponse, *gorails.ResponseMeta, gorails.Error) {
 
-	loginResponse, err := h.dao.AuthDao.Login(params.Username, params.Password)
+	loginResponse, err := h.dao.AuthDao.Login(params.Username, params.Password, dao.SessionClient{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
 	if err != nil {
-		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLoginFailed, global.ErrorMsgLoginFailed, err)
+		return nil, nil, loginError(c, err)
 	}
 
-	// 设置 cookie
-	c.SetCookie(
-		loginResponse.Cookie.Name,
-		loginResponse.Cookie.Value,
-		loginResponse.Cookie.MaxAge,
-		loginResponse.Cookie.Path,
-		loginResponse.Cookie.Domain,
-		loginResponse.Cookie.Secure,
-		loginResponse.Cookie.HttpOnly,
-	)
+	setLoginCookies(c, loginResponse)
+
+	return &LoginResponse{
+		Token:              loginResponse.Token,
+		Role:               loginResponse.Role,
+		ExpiresIn:          loginResponse.ExpiresIn,
+		RefreshToken:       loginResponse.RefreshToken,
+		MustChangePassword: loginResponse.MustChangePassword,
+	}, nil, nil
+}
 
-	return &LoginResponse{Token: loginResponse.Token, Role: loginResponse.Role}, nil, nil
+// loginError 将登录错误转换为接口错误，失败次数过多时返回 429 并设置 Retry-After
+func loginError(c *gin.Context, err error) gorails.Error {
+	var locked *dao.LoginLockedError
+	if errors.As(err, &locked) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		return gorails.NewError(http.StatusTooManyRequests, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeTooManyRequests, global.ErrorMsgTooManyRequests, err)
+	}
+	// 用户不存在和密码错误返回同样的错误
+	return gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLoginFailed, global.ErrorMsgLoginFailed, err)
+}
+
+// RefreshTokenParams 续期请求参数
+type RefreshTokenParams struct {
+	RefreshToken string `json:"refresh_token"` // 为空时从 cookie 读取
+}
+
+func (p *RefreshTokenParams) Parse(c *gin.Context) gorails.Error {
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(p); err != nil {
+			return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+	}
+	if p.RefreshToken == "" {
+		p.RefreshToken, _ = c.Cookie(dao.RefreshTokenCookieName)
+	}
+	return nil
+}
+
+// RefreshTokenHandler 用刷新令牌换发访问令牌，刷新令牌同时被换成新的
+func (h *Handler) RefreshTokenHandler(c *gin.Context, params *RefreshTokenParams) (*LoginResponse, *gorails.ResponseMeta, gorails.Error) {
+	response, err := h.dao.AuthDao.Refresh(params.RefreshToken)
+	if err != nil {
+		clearAuthCookies(c)
+		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeUnauthorized, global.ErrorMsgUnauthorized, err)
+	}
+	setLoginCookies(c, response)
+
+	return &LoginResponse{
+		Token:              response.Token,
+		Role:               response.Role,
+		ExpiresIn:          response.ExpiresIn,
+		RefreshToken:       response.RefreshToken,
+		MustChangePassword: response.MustChangePassword,
+	}, nil, nil
+}
+
+// setLoginCookies 设置访问令牌和刷新令牌 cookie，直接写出 DAO 生成的 cookie，保留 SameSite 等属性
+func setLoginCookies(c *gin.Context, response *dao.LoginResponse) {
+	for _, cookie := range []*http.Cookie{response.Cookie, response.RefreshCookie} {
+		if cookie == nil {
+			continue
+		}
+		http.SetCookie(c.Writer, cookie)
+	}
+}
+
+// clearAuthCookies 清除访问令牌和刷新令牌 cookie
+func clearAuthCookies(c *gin.Context) {
+	c.SetCookie("auth_token", "", -1, "/", "", false, true)
+	c.SetCookie(dao.RefreshTokenCookieName, "", -1, "/", "", false, true)
 }
 
 // LogoutParams 登出请求参数
@@ -96,26 +166,38 @@ type LogoutResponse struct {
 // LogoutHandler 用户登出 gorails.Wrap 形式
 func (h *Handler) LogoutHandler(c *gin.Context, params *LogoutParams) (*LogoutResponse, *gorails.ResponseMeta, gorails.Error) {
 	token := getToken(c)
-	if token == "" {
+	refreshToken, _ := c.Cookie(dao.RefreshTokenCookieName)
+	if token == "" && refreshToken == "" {
 		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
 	}
 
 	// 调用服务层登出方法
-	expiredCookie, err := h.dao.AuthDao.Logout(token)
+	var expiredCookie *http.Cookie
+	err := errors.New("无效的登录状态")
+	if token != "" {
+		expiredCookie, err = h.dao.AuthDao.Logout(token)
+	}
+	// 访问令牌已过期时用刷新令牌注销
+	if err != nil && refreshToken != "" {
+		err = h.dao.AuthDao.RevokeRefreshToken(refreshToken)
+	}
 	if err != nil {
 		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLogoutFailed, global.ErrorMsgLogoutFailed, err)
 	}
 
 	// 设置过期的 cookie
-	c.SetCookie(
-		expiredCookie.Name,
-		expiredCookie.Value,
-		expiredCookie.MaxAge,
-		expiredCookie.Path,
-		expiredCookie.Domain,
-		expiredCookie.Secure,
-		expiredCookie.HttpOnly,
-	)
+	clearAuthCookies(c)
+	if expiredCookie != nil {
+		c.SetCookie(
+			expiredCookie.Name,
+			expiredCookie.Value,
+			expiredCookie.MaxAge,
+			expiredCookie.Path,
+			expiredCookie.Domain,
+			expiredCookie.Secure,
+			expiredCookie.HttpOnly,
+		)
+	}
 
 	return &LogoutResponse{Message: "登出成功"}, nil, nil
 }
@@ -123,13 +205,14 @@ func (h *Handler) LogoutHandler(c *gin.Context, params *LogoutParams) (*LogoutRe
 // TryAuthMiddleware 认证中间件, 用于验证用户身份
 func (h *Handler) TryAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := getToken(c)
-		if token == "" {
-			c.Next()
-			return
+		if getToken(c) == "" {
+			if _, err := c.Cookie(dao.RefreshTokenCookieName); err != nil {
+				c.Next()
+				return
+			}
 		}
 
-		claims, err := h.dao.AuthDao.ValidateToken(token)
+		claims, err := h.authenticate(c)
 		if err != nil {
 			if h.config.Server.Mode == config.ModeAPIGateway {
 				c.Set("userID", 0)
@@ -139,6 +222,7 @@ func (h *Handler) TryAuthMiddleware() gin.HandlerFunc {
 		}
 
 		c.Set("userID", claims.UserID)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
 	}
 }
@@ -146,8 +230,8 @@ func (h *Handler) TryAuthMiddleware() gin.HandlerFunc {
 // AuthMiddleware 认证中间件, 用于验证用户身份
 func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := getToken(c)
-		if token == "" {
+		claims, err := h.authenticate(c)
+		if err != nil {
 			// 在重定向前设置 response header 为未登录
 			c.Header("Unauthorized", "true")
 			// 重定向到首页
@@ -156,21 +240,45 @@ func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := h.dao.AuthDao.ValidateToken(token)
-		if err != nil {
-			// 在重定向前设置 response header 为未登录
-			c.Header("Unauthorized", "true")
-			// 重定向到首页
-			c.Redirect(http.StatusFound, "/")
+		// 管理员设置的临时密码，修改密码前只能访问少数接口
+		if claims.MustChangePassword && !passwordChangeAllowedPaths[c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                "请先修改密码",
+				"must_change_password": true,
+			})
 			c.Abort()
 			return
 		}
 
 		c.Set("userID", claims.UserID)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
 	}
 }
 
+// authenticate 验证访问令牌；访问令牌缺失或过期时，用刷新令牌 cookie 自动续期，
+// 所以只要持续使用，登录就不会在上课中途过期
+func (h *Handler) authenticate(c *gin.Context) (*dao.Claims, error) {
+	if token := getToken(c); token != "" {
+		claims, err := h.dao.AuthDao.ValidateToken(token)
+		if err == nil {
+			return claims, nil
+		}
+	}
+
+	refreshToken, err := c.Cookie(dao.RefreshTokenCookieName)
+	if err != nil || refreshToken == "" {
+		return nil, errors.New("未登录")
+	}
+	response, err := h.dao.AuthDao.Refresh(refreshToken)
+	if err != nil {
+		clearAuthCookies(c)
+		return nil, err
+	}
+	setLoginCookies(c, response)
+	return h.dao.AuthDao.ValidateToken(response.Token)
+}
+
 func getToken(c *gin.Context) string {
 	// 优先从Header获取token
 	token := c.GetHeader("Authorization")
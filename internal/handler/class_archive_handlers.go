@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/classarchive"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+	"go.uber.org/zap"
+)
+
+// ExportClassArchiveParams 导出班级作品归档请求参数
+type ExportClassArchiveParams struct {
+	ClassID uint `json:"class_id" uri:"class_id" binding:"required"`
+	Options classarchive.Options
+}
+
+func (p *ExportClassArchiveParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	// since 包含，until 不包含，可以是 RFC3339 或日期
+	for name, t := range map[string]*time.Time{"since": &p.Options.Since, "until": &p.Options.Until} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseTimeQuery(value)
+		if err != nil {
+			return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+		*t = parsed
+	}
+	return nil
+}
+
+// ClassArchive 待导出的班级作品，由 RenderClassArchive 边读取边写入响应
+type ClassArchive struct {
+	Class    *model.Class
+	Students []model.User
+	Options  classarchive.Options
+	archiver *classarchive.Archiver
+	logger   *zap.Logger
+}
+
+// ExportClassArchiveHandler 导出班级学生在时间范围内的 Scratch 项目、程序和画板，用于学期归档
+func (h *Handler) ExportClassArchiveHandler(c *gin.Context, params *ExportClassArchiveParams) (*ClassArchive, *gorails.ResponseMeta, gorails.Error) {
+	class, err := h.dao.ClassDao.GetClass(params.ClassID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+	students, err := h.dao.ClassDao.ListStudents(params.ClassID, h.classTeacherID(c))
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	logger := h.logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ClassArchive{
+		Class:    class,
+		Students: students,
+		Options:  params.Options,
+		archiver: classarchive.New(h.dao, h.readScratchAsset, logger),
+		logger:   logger,
+	}, nil, nil
+}
+
+// RenderClassArchive 以 zip 附件的形式流式返回班级作品。
+// 开始写入后响应头已经发出，出错时只能记录日志并中断连接
+func RenderClassArchive(c *gin.Context, archive *ClassArchive, meta *gorails.ResponseMeta) {
+	filename := fmt.Sprintf("%s_%s.zip", archive.Class.Name, time.Now().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"class_%d.zip\"; filename*=UTF-8''%s", archive.Class.ID, url.PathEscape(filename)))
+	c.Status(http.StatusOK)
+
+	index, err := archive.archiver.Write(c.Request.Context(), c.Writer, archive.Class, archive.Students, archive.Options)
+	if err != nil {
+		archive.logger.Error("导出班级作品失败", zap.Uint("class_id", archive.Class.ID), zap.Error(err))
+		abortConnection(c)
+		return
+	}
+	archive.logger.Info("导出班级作品", zap.Uint("class_id", archive.Class.ID), zap.Int("students", index.Students), zap.Int("entries", len(index.Entries)))
+}
+
+// abortConnection 响应已经开始写入后出错时中断连接，客户端收到不完整的响应，不会把截断的文件当作下载成功。
+// HTTP/1.x 接管连接后直接关闭，不能接管时 panic(http.ErrAbortHandler) 由 net/http 中断响应
+func abortConnection(c *gin.Context) {
+	c.Abort()
+	// gin 的 Hijack 在底层不支持接管时会 panic，先检查底层的 ResponseWriter
+	if w, ok := c.Writer.(interface{ Unwrap() http.ResponseWriter }); ok {
+		if _, ok := w.Unwrap().(http.Hijacker); ok {
+			if conn, _, err := c.Writer.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+	panic(http.ErrAbortHandler)
+}
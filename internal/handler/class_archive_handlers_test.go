@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试写入一部分后中断连接，客户端读取响应时出错，而不是收到一个完整的截断文件
+func TestAbortConnection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/archive", func(c *gin.Context) {
+		c.Header("Content-Type", "application/zip")
+		c.Status(http.StatusOK)
+		c.Writer.Write([]byte("PK partial"))
+		c.Writer.Flush()
+		abortConnection(c)
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/archive")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
@@ -154,6 +154,10 @@ type ClassResponse struct {
 // ListClassesHandler 列出班级 gorails.Wrap 形式
 func (h *Handler) ListClassesHandler(c *gin.Context, params *ListClassesParams) ([]ClassResponse, *gorails.ResponseMeta, gorails.Error) {
 	userID := h.getUserID(c)
+	// 可以管理所有班级的用户列出所有班级
+	if h.hasPermission(c, PermissionManageClass) {
+		userID = 0
+	}
 
 	// 获取班级列表
 	classes, hasMore, err := h.dao.ClassDao.ListClassesWithPagination(userID, params.PageSize, params.BeginID, params.Forward, params.Asc)
@@ -229,6 +233,8 @@ type GetClassResponse struct {
 		AuthorID    uint   `json:"author_id"`
 	} `json:"courses,omitempty"`
 	CoursesCount int `json:"courses_count"`
+
+	PictureLogin bool `json:"picture_login"` // 是否开启图片密码和登录卡登录
 }
 
 // GetClassHandler 获取班级信息 gorails.Wrap 形式
@@ -253,6 +259,8 @@ func (h *Handler) GetClassHandler(c *gin.Context, params *GetClassParams) (*GetC
 		IsActive:    class.IsActive,
 		CreatedAt:   time.Unix(class.CreatedAt, 0).Format("2006-01-02 15:04:05"),
 		UpdatedAt:   time.Unix(class.UpdatedAt, 0).Format("2006-01-02 15:04:05"),
+
+		PictureLogin: class.PictureLogin,
 	}
 
 	// 如果预加载了教师信息，则添加到响应中
@@ -388,7 +396,7 @@ type UpdateClassResponse struct {
 
 // UpdateClassHandler 更新班级信息 gorails.Wrap 形式
 func (h *Handler) UpdateClassHandler(c *gin.Context, params *UpdateClassParams) (*UpdateClassResponse, *gorails.ResponseMeta, gorails.Error) {
-	userID := h.getUserID(c)
+	userID := h.classTeacherID(c)
 
 	// 构建更新参数
 	updates := map[string]interface{}{
@@ -514,16 +522,23 @@ type DeleteClassResponse struct {
 
 // DeleteClassHandler 删除班级 gorails.Wrap 形式
 func (h *Handler) DeleteClassHandler(c *gin.Context, params *DeleteClassParams) (*DeleteClassResponse, *gorails.ResponseMeta, gorails.Error) {
-	userID := h.getUserID(c)
+	userID := h.classTeacherID(c)
+
+	// 删除前的班级信息写入审计记录
+	class, err := h.dao.ClassDao.GetClass(params.ClassID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
 
 	// 调用服务层删除班级
-	err := h.dao.ClassDao.DeleteClass(params.ClassID, userID)
+	err = h.dao.ClassDao.DeleteClass(params.ClassID, userID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) || err.Error() == "班级不存在或您无权修改" {
 			return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
 		}
 		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, err)
 	}
+	h.audit(c, model.AuditActionDeleteClass, model.AuditResourceClass, auditID(params.ClassID), class, nil)
 
 	return &DeleteClassResponse{Message: "班级删除成功"}, nil, nil
 }
@@ -551,7 +566,7 @@ type AddCourseToClassResponse struct {
 
 // AddCourseToClassHandler 为班级添加课程
 func (h *Handler) AddCourseToClassHandler(c *gin.Context, params *AddCourseToClassParams) (*AddCourseToClassResponse, *gorails.ResponseMeta, gorails.Error) {
-	userID := h.getUserID(c)
+	userID := h.classTeacherID(c)
 
 	// 调用服务层为班级添加课程
 	// 添加课程时使用班级的日期范围作为默认值
@@ -592,7 +607,7 @@ type RemoveCourseFromClassResponse struct {
 
 // RemoveCourseFromClassHandler 从班级移除课程
 func (h *Handler) RemoveCourseFromClassHandler(c *gin.Context, params *RemoveCourseFromClassParams) (*RemoveCourseFromClassResponse, *gorails.ResponseMeta, gorails.Error) {
-	userID := h.getUserID(c)
+	userID := h.classTeacherID(c)
 
 	// 调用服务层从班级移除课程
 	if err := h.dao.ClassDao.RemoveCourse(params.ClassID, userID, params.CourseID); err != nil {
@@ -659,7 +674,7 @@ type GetClassCoursesResponse struct {
 
 // GetClassCoursesHandler 获取班级课程列表
 func (h *Handler) GetClassCoursesHandler(c *gin.Context, params *GetClassCoursesParams) (*GetClassCoursesResponse, *gorails.ResponseMeta, gorails.Error) {
-	userID := h.getUserID(c)
+	userID := h.classTeacherID(c)
 
 	// 获取班级课程列表（使用现有的ListCourses方法）
 	courses, err := h.dao.ClassDao.ListCourses(params.ClassID, userID)
@@ -737,7 +752,7 @@ type GetClassLessonsResponse struct {
 
 // GetClassLessonsHandler 获取班级所有课时
 func (h *Handler) GetClassLessonsHandler(c *gin.Context, params *GetClassLessonsParams) (*GetClassLessonsResponse, *gorails.ResponseMeta, gorails.Error) {
-	userID := h.getUserID(c)
+	userID := h.classTeacherID(c)
 
 	if params.CourseID != 0 {
 		// 获取指定课程的课时
@@ -788,7 +803,7 @@ func (p *GetClassStudentsParams) Parse(c *gin.Context) gorails.Error {
 }
 
 func (h *Handler) GetClassStudentsHandler(c *gin.Context, params *GetClassStudentsParams) ([]UserResponse, *gorails.ResponseMeta, gorails.Error) {
-	userID := h.getUserID(c)
+	userID := h.classTeacherID(c)
 
 	students, err := h.dao.ClassDao.ListStudents(params.ClassID, userID)
 	if err != nil {
@@ -1152,6 +1167,7 @@ type GetMyLessonResponse struct {
 	UpdatedAt       string         `json:"updated_at"`
 	ResourceFileIDs []uint         `json:"resource_file_ids"`
 	ResourceFiles   []FileResponse `json:"resource_files"`
+	Feedback        []model.Grade  `json:"feedback,omitempty"` // 老师对我在本课时作业的评分和评语
 }
 
 // GetMyLessonHandler 获取我的课件详情（学生端）
@@ -1215,5 +1231,10 @@ func (h *Handler) GetMyLessonHandler(c *gin.Context, params *GetMyLessonParams)
 		}
 	}
 
+	// 添加作业评分反馈
+	if grades, err := h.dao.GradeDao.ListStudentLessonGrades(userID, lesson.ID); err == nil {
+		response.Feedback = grades
+	}
+
 	return response, nil, nil
 }
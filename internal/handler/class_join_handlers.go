@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+const (
+	// joinClassMaxFailures 每个用户在限流窗口内最多允许输错邀请码的次数
+	joinClassMaxFailures = 5
+	// joinClassFailureWindow 输错邀请码的限流窗口
+	joinClassFailureWindow = 10 * time.Minute
+)
+
+// ===== 学生端：通过邀请码加入班级 =====
+
+// JoinClassParams 加入班级请求参数
+type JoinClassParams struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (p *JoinClassParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	p.Code = strings.TrimSpace(p.Code)
+	if p.Code == "" {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("邀请码不能为空"))
+	}
+	return nil
+}
+
+// JoinClassResponse 加入班级响应
+type JoinClassResponse struct {
+	ClassID uint   `json:"class_id"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// JoinClassHandler 学生通过邀请码加入班级
+// 班级开启审核时返回 pending 状态，需要等老师通过
+func (h *Handler) JoinClassHandler(c *gin.Context, params *JoinClassParams) (*JoinClassResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.getUserID(c)
+
+	if h.isJoinClassLimited(userID) {
+		return nil, nil, gorails.NewError(http.StatusTooManyRequests, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeTooManyRequests, global.ErrorMsgTooManyRequests, nil)
+	}
+
+	classUser, err := h.dao.ClassDao.JoinClass(userID, params.Code)
+	if err != nil {
+		// 只有输错或使用过期邀请码才计入限流，防止暴力猜测邀请码
+		if errors.Is(err, dao.ErrClassCodeInvalid) || errors.Is(err, dao.ErrClassCodeExpired) {
+			h.recordJoinClassFailure(userID)
+		}
+		return nil, nil, toJoinClassError(err)
+	}
+
+	response := &JoinClassResponse{
+		ClassID: classUser.ClassID,
+		Status:  classUser.Status,
+		Message: "加入班级成功",
+	}
+	if classUser.Status == model.ClassUserStatusPending {
+		response.Message = "已提交加入申请，请等待老师审核"
+	}
+	return response, nil, nil
+}
+
+// isJoinClassLimited 检查用户输错邀请码的次数是否已达上限
+func (h *Handler) isJoinClassLimited(userID uint) bool {
+	h.joinClassLimiterLock.Lock()
+	defer h.joinClassLimiterLock.Unlock()
+
+	// 清理超出时间窗口的记录
+	now := time.Now()
+	var validTimes []time.Time
+	for _, t := range h.joinClassLimiter[userID] {
+		if now.Sub(t) < joinClassFailureWindow {
+			validTimes = append(validTimes, t)
+		}
+	}
+	if len(validTimes) == 0 {
+		delete(h.joinClassLimiter, userID)
+		return false
+	}
+	h.joinClassLimiter[userID] = validTimes
+	return len(validTimes) >= joinClassMaxFailures
+}
+
+// recordJoinClassFailure 记录一次输错邀请码
+func (h *Handler) recordJoinClassFailure(userID uint) {
+	h.joinClassLimiterLock.Lock()
+	defer h.joinClassLimiterLock.Unlock()
+	h.joinClassLimiter[userID] = append(h.joinClassLimiter[userID], time.Now())
+}
+
+// toJoinClassError 将加入班级的错误转换为接口错误
+func toJoinClassError(err error) gorails.Error {
+	switch {
+	case errors.Is(err, dao.ErrClassCodeInvalid):
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeClassCodeInvalid, global.ErrorMsgClassCodeInvalid, err)
+	case errors.Is(err, dao.ErrClassCodeExpired):
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeClassCodeExpired, global.ErrorMsgClassCodeExpired, err)
+	case errors.Is(err, dao.ErrClassFull):
+		return gorails.NewError(http.StatusConflict, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeClassFull, global.ErrorMsgClassFull, err)
+	case errors.Is(err, dao.ErrAlreadyInClass):
+		return gorails.NewError(http.StatusConflict, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeAlreadyInClass, global.ErrorMsgAlreadyInClass, err)
+	default:
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+}
+
+// ===== 教师端：邀请码与加入审核 =====
+
+// RotateClassCodeParams 重新生成邀请码请求参数
+type RotateClassCodeParams struct {
+	ClassID uint `json:"-" uri:"class_id"`
+	// ExpiresInHours 新邀请码的有效期（小时），0 表示不过期
+	ExpiresInHours int `json:"expires_in_hours"`
+}
+
+func (p *RotateClassCodeParams) Parse(c *gin.Context) gorails.Error {
+	// 请求体可以为空，此时生成不过期的邀请码
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(p); err != nil {
+			return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.ClassID == 0 || p.ExpiresInHours < 0 {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
+	}
+	return nil
+}
+
+// ClassCodeResponse 邀请码响应
+type ClassCodeResponse struct {
+	ClassID       uint   `json:"class_id"`
+	Code          string `json:"code"`
+	CodeExpiresAt int64  `json:"code_expires_at"`
+}
+
+// RotateClassCodeHandler 重新生成班级邀请码，旧邀请码立即失效
+func (h *Handler) RotateClassCodeHandler(c *gin.Context, params *RotateClassCodeParams) (*ClassCodeResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.classTeacherID(c)
+
+	var expiresAt int64
+	if params.ExpiresInHours > 0 {
+		expiresAt = time.Now().Add(time.Duration(params.ExpiresInHours) * time.Hour).Unix()
+	}
+
+	class, err := h.dao.ClassDao.RotateClassCode(params.ClassID, userID, expiresAt)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+
+	return &ClassCodeResponse{
+		ClassID:       class.ID,
+		Code:          class.Code,
+		CodeExpiresAt: class.CodeExpiresAt,
+	}, nil, nil
+}
+
+// UpdateClassJoinSettingsParams 更新加入设置请求参数
+type UpdateClassJoinSettingsParams struct {
+	ClassID         uint  `json:"-" uri:"class_id"`
+	MaxStudents     *int  `json:"max_students"`
+	RequireApproval *bool `json:"require_approval"`
+}
+
+func (p *UpdateClassJoinSettingsParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.ClassID == 0 {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
+	}
+	if p.MaxStudents != nil && *p.MaxStudents < 0 {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("人数上限不能小于0"))
+	}
+	return nil
+}
+
+// UpdateClassJoinSettingsResponse 更新加入设置响应
+type UpdateClassJoinSettingsResponse struct {
+	Message string `json:"message"`
+}
+
+// UpdateClassJoinSettingsHandler 更新班级人数上限和是否需要审核
+func (h *Handler) UpdateClassJoinSettingsHandler(c *gin.Context, params *UpdateClassJoinSettingsParams) (*UpdateClassJoinSettingsResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.classTeacherID(c)
+
+	updates := make(map[string]interface{})
+	if params.MaxStudents != nil {
+		updates["max_students"] = *params.MaxStudents
+	}
+	if params.RequireApproval != nil {
+		updates["require_approval"] = *params.RequireApproval
+	}
+	if len(updates) == 0 {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("没有需要更新的字段"))
+	}
+
+	if err := h.dao.ClassDao.UpdateClass(params.ClassID, userID, updates); err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+
+	return &UpdateClassJoinSettingsResponse{Message: "班级加入设置更新成功"}, nil, nil
+}
+
+// ListClassJoinRequestsParams 加入申请列表请求参数
+type ListClassJoinRequestsParams struct {
+	ClassID uint `json:"class_id" uri:"class_id" binding:"required"`
+}
+
+func (p *ListClassJoinRequestsParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ListClassJoinRequestsHandler 列出等待审核的加入申请
+func (h *Handler) ListClassJoinRequestsHandler(c *gin.Context, params *ListClassJoinRequestsParams) ([]UserResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.classTeacherID(c)
+
+	students, err := h.dao.ClassDao.ListPendingStudents(params.ClassID, userID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	userResponses := make([]UserResponse, len(students))
+	for i, student := range students {
+		userResponses[i] = UserResponse{
+			ID:       student.ID,
+			Username: student.Username,
+			Email:    student.Email,
+		}
+	}
+
+	return userResponses, nil, nil
+}
+
+// ReviewClassJoinRequestParams 审核加入申请请求参数
+type ReviewClassJoinRequestParams struct {
+	ClassID uint `json:"class_id" uri:"class_id" binding:"required"`
+	UserID  uint `json:"user_id" uri:"user_id" binding:"required"`
+}
+
+func (p *ReviewClassJoinRequestParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ReviewClassJoinRequestResponse 审核加入申请响应
+type ReviewClassJoinRequestResponse struct {
+	Message string `json:"message"`
+}
+
+// ApproveClassJoinRequestHandler 通过加入申请
+func (h *Handler) ApproveClassJoinRequestHandler(c *gin.Context, params *ReviewClassJoinRequestParams) (*ReviewClassJoinRequestResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.classTeacherID(c)
+
+	if err := h.dao.ClassDao.ReviewJoinRequest(params.ClassID, userID, params.UserID, true); err != nil {
+		if errors.Is(err, dao.ErrClassFull) {
+			return nil, nil, toJoinClassError(err)
+		}
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+
+	return &ReviewClassJoinRequestResponse{Message: "已通过加入申请"}, nil, nil
+}
+
+// RejectClassJoinRequestHandler 拒绝加入申请
+func (h *Handler) RejectClassJoinRequestHandler(c *gin.Context, params *ReviewClassJoinRequestParams) (*ReviewClassJoinRequestResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.classTeacherID(c)
+
+	if err := h.dao.ClassDao.ReviewJoinRequest(params.ClassID, userID, params.UserID, false); err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+
+	return &ReviewClassJoinRequestResponse{Message: "已拒绝加入申请"}, nil, nil
+}
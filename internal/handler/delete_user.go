@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
 	"github.com/mail2fish/gorails/gorails"
 )
 
@@ -40,8 +41,14 @@ func (h *Handler) DeleteUserHandler(c *gin.Context, params *DeleteUserParams) (*
 		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
 	}
 
+	// 删除前的用户信息写入审计记录
+	user, err := h.dao.UserDao.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+
 	// 执行删除操作
-	err := h.dao.UserDao.DeleteUser(userID)
+	err = h.dao.UserDao.DeleteUser(userID)
 	if err != nil {
 		// 判断是否为自定义错误
 		if ce, ok := err.(gorails.Error); ok {
@@ -51,6 +58,9 @@ func (h *Handler) DeleteUserHandler(c *gin.Context, params *DeleteUserParams) (*
 		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, err)
 	}
 
+	h.invalidatePermissions()
+	h.audit(c, model.AuditActionDeleteUser, model.AuditResourceUser, auditID(userID), user, nil)
+
 	// 返回成功响应
 	return &DeleteUserResponse{Message: "用户删除成功"}, nil, nil
 }
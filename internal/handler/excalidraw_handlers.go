@@ -54,6 +54,11 @@ func (h *Handler) CreateExcalidrawBoardHandler(c *gin.Context, params *CreateExc
 		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, "文件内容格式错误", err)
 	}
 
+	return h.createExcalidrawBoard(c, userID, params.Name, contentBytes)
+}
+
+// createExcalidrawBoard 创建画板记录并保存画板文件
+func (h *Handler) createExcalidrawBoard(c *gin.Context, userID uint, name string, contentBytes []byte) (*model.ExcalidrawBoard, *gorails.ResponseMeta, gorails.Error) {
 	// 计算MD5
 	hash := md5.Sum(contentBytes)
 	md5Hash := hex.EncodeToString(hash[:])
@@ -69,7 +74,7 @@ func (h *Handler) CreateExcalidrawBoardHandler(c *gin.Context, params *CreateExc
 
 	// 创建画板记录（先创建以获取ID）
 	board := &model.ExcalidrawBoard{
-		Name:     params.Name,
+		Name:     name,
 		UserID:   userID,
 		MD5:      md5Hash,
 		FilePath: relativeDir,
@@ -87,7 +92,7 @@ func (h *Handler) CreateExcalidrawBoardHandler(c *gin.Context, params *CreateExc
 	}
 
 	// 使用生成的ID保存文件
-	_, err = h.dao.ExcalidrawDao.SaveExcalidrawFile(userID, board.ID, board.FilePath, contentBytes)
+	_, err := h.dao.ExcalidrawDao.SaveExcalidrawFile(userID, board.ID, board.FilePath, contentBytes)
 	if err != nil {
 		// 如果保存文件失败，删除数据库记录
 		h.dao.ExcalidrawDao.Delete(c.Request.Context(), board.ID)
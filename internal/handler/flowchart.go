@@ -8,78 +8,151 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jun/fun_code/internal/global"
 	"github.com/jun/fun_code/internal/mermaid"
+	"github.com/jun/fun_code/internal/model"
 	"github.com/mail2fish/gorails/gorails"
 )
 
 // GetFlowchartScratchParams 获取流程图请求参数
 type GetFlowchartScratchParams struct {
 	ProjectID string `json:"project_id" uri:"project_id" binding:"required"`
+	// Format 输出格式：mermaid（默认）、dot、plantuml 或 excalidraw
+	Format string `json:"format" form:"format"`
 }
 
 func (p *GetFlowchartScratchParams) Parse(c *gin.Context) gorails.Error {
 	if err := c.ShouldBindUri(p); err != nil {
 		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
 	}
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
 	return nil
 }
 
 // GetFlowchartScratchResponse 获取流程图响应
 type GetFlowchartScratchResponse struct {
+	// Mermaid 兼容只读取这个字段的旧客户端，始终返回：
+	// mermaid 格式时与 Content 相同，其他格式时为空字符串
 	Mermaid     string `json:"mermaid"`
+	Format      string `json:"format"`
+	Content     string `json:"content"`
 	ProjectName string `json:"project_name"`
 }
 
-// GetFlowchartScratchHandler 获取Scratch项目的流程图
+// GetFlowchartScratchHandler 获取Scratch项目的流程图，标签使用请求的语言
 func (h *Handler) GetFlowchartScratchHandler(c *gin.Context, params *GetFlowchartScratchParams) (*GetFlowchartScratchResponse, *gorails.ResponseMeta, gorails.Error) {
+	// 在处理函数中检查格式，错误信息使用请求的语言
+	format := mermaid.Format(params.Format)
+	switch format {
+	case "":
+		format = mermaid.FormatMermaid
+	case mermaid.FormatMermaid, mermaid.FormatDOT, mermaid.FormatPlantUML, mermaid.FormatExcalidraw:
+	default:
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, h.T("flowchart.unsupported_format", c), nil)
+	}
+
+	scratchProject, projectName, gerr := h.loadFlowchartProject(c, params.ProjectID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	// 按请求语言生成流程图
+	translator := mermaid.NewOpcodeTranslatorForLanguage(h.GetLanguage(c))
+	content, err := mermaid.GenerateFlowchart(scratchProject, projectName, format, translator)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	// 返回响应
+	response := &GetFlowchartScratchResponse{
+		Format:      string(format),
+		Content:     content,
+		ProjectName: projectName,
+	}
+	if format == mermaid.FormatMermaid {
+		response.Mermaid = content
+	}
+
+	return response, nil, nil
+}
+
+// CreateFlowchartScratchBoardParams 将流程图保存为画板的请求参数
+type CreateFlowchartScratchBoardParams struct {
+	ProjectID string `json:"project_id" uri:"project_id" binding:"required"`
+}
+
+func (p *CreateFlowchartScratchBoardParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// CreateFlowchartScratchBoardHandler 将Scratch项目的流程图保存为当前用户的 Excalidraw 画板
+func (h *Handler) CreateFlowchartScratchBoardHandler(c *gin.Context, params *CreateFlowchartScratchBoardParams) (*model.ExcalidrawBoard, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.getUserID(c)
+	if userID == 0 {
+		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeUnauthorized, global.ErrorMsgUnauthorized, nil)
+	}
+
+	scratchProject, projectName, gerr := h.loadFlowchartProject(c, params.ProjectID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	// 生成 Excalidraw 场景
+	translator := mermaid.NewOpcodeTranslatorForLanguage(h.GetLanguage(c))
+	contentBytes, err := mermaid.RenderExcalidraw(mermaid.BuildFlowchart(scratchProject, projectName, translator))
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeCreateFailed, global.ErrorMsgCreateFailed, err)
+	}
+
+	name := h.TWithData("flowchart.board_name", c, map[string]interface{}{"Name": projectName})
+	return h.createExcalidrawBoard(c, userID, name, contentBytes)
+}
+
+// loadFlowchartProject 读取并解析Scratch项目，只有项目创建者或管理员可以查看，返回项目和项目名称
+func (h *Handler) loadFlowchartProject(c *gin.Context, projectIDStr string) (*mermaid.Project, string, gorails.Error) {
 	// 将 projectID 字符串转换为 uint 类型
-	projectID, err := strconv.ParseUint(params.ProjectID, 10, 64)
+	projectID, err := strconv.ParseUint(projectIDStr, 10, 64)
 	if err != nil {
-		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		return nil, "", gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
 	}
 
 	// 获取项目信息（用于获取项目名称）
 	project, err := h.dao.ScratchDao.GetProject(uint(projectID))
 	if err != nil {
-		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+		return nil, "", gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
 	}
 
 	// 获取项目创建者ID
 	userID, ok := h.dao.ScratchDao.GetProjectUserID(uint(projectID))
 	if !ok {
-		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, nil)
+		return nil, "", gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, nil)
 	}
 
 	// 判断用户是否是项目创建者或者为管理员
 	if userID != h.getUserID(c) && !h.hasPermission(c, PermissionManageAll) {
-		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, nil)
+		return nil, "", gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, nil)
 	}
 
 	// 从数据库获取 scratch project JSON
 	projectData, err := h.dao.ScratchDao.GetProjectBinary(uint(projectID), "")
 	if err != nil {
-		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+		return nil, "", gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
 	}
 
 	// 解析 JSON 为 mermaid.Project 结构
 	var scratchProject mermaid.Project
 	if err := json.Unmarshal(projectData, &scratchProject); err != nil {
-		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, "解析项目数据失败", err)
+		return nil, "", gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, "解析项目数据失败", err)
 	}
 
 	// 获取项目名称
 	projectName := project.Name
 	if projectName == "" {
-		projectName = "未命名项目"
+		projectName = h.T("flowchart.untitled_project", c)
 	}
 
-	// 调用 GenerateMermaid 方法生成 mermaid 字符串
-	mermaidString := mermaid.GenerateMermaid(&scratchProject, projectName)
-
-	// 返回响应
-	response := &GetFlowchartScratchResponse{
-		Mermaid:     mermaidString,
-		ProjectName: projectName,
-	}
-
-	return response, nil, nil
+	return &scratchProject, projectName, nil
 }
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/i18n"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// 测试不支持的流程图格式在读取项目前返回 400，错误信息按请求语言翻译
+func TestHandler_GetFlowchartScratchUnsupportedFormat(t *testing.T) {
+	i18nService, err := i18n.NewI18nService("en")
+	assert.NoError(t, err)
+	h := NewHandler(&dao.Dao{}, i18nService, zap.NewNop(), &config.Config{})
+	gin.SetMode(gin.TestMode)
+
+	for lang, want := range map[string]string{"en": "Unsupported flowchart format", "zh-CN": "不支持的流程图格式"} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/scratch/projects/1/flowchart?format=svg&lang="+lang, nil)
+
+		_, _, gerr := h.GetFlowchartScratchHandler(c, &GetFlowchartScratchParams{ProjectID: "1", Format: "svg"})
+		if assert.NotNil(t, gerr, lang) {
+			assert.Equal(t, http.StatusBadRequest, gerr.HTTPCode())
+		}
+		assert.Equal(t, want, h.T("flowchart.unsupported_format", c))
+	}
+}
@@ -253,6 +253,7 @@ func TestDeleteUserHandler(t *testing.T) {
 
 			// 设置mock期望
 			if !tt.wantError || tt.errorCode != 40010 {
+				mockDao.UserDao.On("GetUserByID", tt.userID).Return(tt.mockUser, nil).Maybe()
 				mockDao.UserDao.On("DeleteUser", tt.userID).Return(tt.mockErr).Maybe()
 			}
 
@@ -0,0 +1,322 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/csvutil"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// ===== 课程评分标准 =====
+
+// CourseRubricParams 课程评分标准路径参数
+type CourseRubricParams struct {
+	CourseID uint `json:"course_id" uri:"course_id" binding:"required"`
+}
+
+func (p *CourseRubricParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ListRubricCriteriaHandler 获取课程的评分标准
+func (h *Handler) ListRubricCriteriaHandler(c *gin.Context, params *CourseRubricParams) ([]model.RubricCriterion, *gorails.ResponseMeta, gorails.Error) {
+	criteria, err := h.dao.GradeDao.ListCriteria(params.CourseID)
+	if err != nil {
+		return nil, nil, toGradeError(err)
+	}
+	return criteria, &gorails.ResponseMeta{
+		HasNext: false,
+		Total:   len(criteria),
+	}, nil
+}
+
+// CreateRubricCriterionParams 添加评分项请求参数
+type CreateRubricCriterionParams struct {
+	CourseID    uint   `json:"-" uri:"course_id"`
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	MaxPoints   int    `json:"max_points" binding:"required"`
+	SortOrder   int    `json:"sort_order"`
+}
+
+func (p *CreateRubricCriterionParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// CreateRubricCriterionHandler 为课程添加评分项
+func (h *Handler) CreateRubricCriterionHandler(c *gin.Context, params *CreateRubricCriterionParams) (*model.RubricCriterion, *gorails.ResponseMeta, gorails.Error) {
+	if _, err := h.dao.CourseDao.GetCourse(params.CourseID); err != nil {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+
+	criterion := &model.RubricCriterion{
+		CourseID:    params.CourseID,
+		Title:       params.Title,
+		Description: params.Description,
+		MaxPoints:   params.MaxPoints,
+		SortOrder:   params.SortOrder,
+	}
+	if err := h.dao.GradeDao.CreateCriterion(criterion); err != nil {
+		return nil, nil, toGradeError(err)
+	}
+	return criterion, nil, nil
+}
+
+// UpdateRubricCriterionParams 更新评分项请求参数，未传的字段保持不变
+type UpdateRubricCriterionParams struct {
+	CourseID    uint    `json:"-" uri:"course_id"`
+	CriterionID uint    `json:"-" uri:"criterion_id"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	MaxPoints   *int    `json:"max_points"`
+	SortOrder   *int    `json:"sort_order"`
+}
+
+func (p *UpdateRubricCriterionParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// UpdateRubricCriterionHandler 更新评分项，已有评分中保存的名称和满分不受影响
+func (h *Handler) UpdateRubricCriterionHandler(c *gin.Context, params *UpdateRubricCriterionParams) (*gorails.ResponseEmpty, *gorails.ResponseMeta, gorails.Error) {
+	updates := map[string]interface{}{}
+	if params.Title != nil {
+		updates["title"] = *params.Title
+	}
+	if params.Description != nil {
+		updates["description"] = *params.Description
+	}
+	if params.MaxPoints != nil {
+		updates["max_points"] = *params.MaxPoints
+	}
+	if params.SortOrder != nil {
+		updates["sort_order"] = *params.SortOrder
+	}
+	if len(updates) == 0 {
+		return &gorails.ResponseEmpty{}, nil, nil
+	}
+
+	if err := h.dao.GradeDao.UpdateCriterion(params.CourseID, params.CriterionID, updates); err != nil {
+		return nil, nil, toGradeError(err)
+	}
+	return &gorails.ResponseEmpty{}, nil, nil
+}
+
+// RubricCriterionParams 评分项路径参数
+type RubricCriterionParams struct {
+	CourseID    uint `json:"course_id" uri:"course_id" binding:"required"`
+	CriterionID uint `json:"criterion_id" uri:"criterion_id" binding:"required"`
+}
+
+func (p *RubricCriterionParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// DeleteRubricCriterionHandler 删除评分项
+func (h *Handler) DeleteRubricCriterionHandler(c *gin.Context, params *RubricCriterionParams) (*gorails.ResponseEmpty, *gorails.ResponseMeta, gorails.Error) {
+	if err := h.dao.GradeDao.DeleteCriterion(params.CourseID, params.CriterionID); err != nil {
+		return nil, nil, toGradeError(err)
+	}
+	return &gorails.ResponseEmpty{}, nil, nil
+}
+
+// ===== 作业评分 =====
+
+// SaveSubmissionGradeParams 评分请求参数
+// 传入 items 时按评分标准计算总分，否则使用 score 和 max_score
+type SaveSubmissionGradeParams struct {
+	ClassID        uint                       `json:"-" uri:"class_id"`
+	SubmissionID   uint                       `json:"-" uri:"submission_id"`
+	Score          int                        `json:"score"`
+	MaxScore       int                        `json:"max_score"`
+	Comment        string                     `json:"comment"`
+	Items          []GradeItemParams          `json:"items" binding:"dive"`
+	SpriteComments []GradeSpriteCommentParams `json:"sprite_comments" binding:"dive"`
+}
+
+// GradeItemParams 评分项得分
+type GradeItemParams struct {
+	CriterionID uint   `json:"criterion_id" binding:"required"`
+	Points      int    `json:"points"`
+	Comment     string `json:"comment"`
+}
+
+// GradeSpriteCommentParams 角色评语
+type GradeSpriteCommentParams struct {
+	Sprite  string `json:"sprite" binding:"required"`
+	Comment string `json:"comment"`
+}
+
+func (p *SaveSubmissionGradeParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// SaveSubmissionGradeHandler 给提交评分，重复评分会覆盖之前的结果
+func (h *Handler) SaveSubmissionGradeHandler(c *gin.Context, params *SaveSubmissionGradeParams) (*model.Grade, *gorails.ResponseMeta, gorails.Error) {
+	if _, gerr := h.getClassSubmission(params.ClassID, params.SubmissionID); gerr != nil {
+		return nil, nil, gerr
+	}
+
+	grade := &model.Grade{
+		SubmissionID: params.SubmissionID,
+		GraderID:     h.getUserID(c),
+		Score:        params.Score,
+		MaxScore:     params.MaxScore,
+		Comment:      params.Comment,
+	}
+	for _, item := range params.Items {
+		grade.Items = append(grade.Items, model.GradeItem{
+			CriterionID: item.CriterionID,
+			Points:      item.Points,
+			Comment:     item.Comment,
+		})
+	}
+	for _, comment := range params.SpriteComments {
+		grade.SpriteComments = append(grade.SpriteComments, model.GradeSpriteComment{
+			Sprite:  comment.Sprite,
+			Comment: comment.Comment,
+		})
+	}
+
+	if err := h.dao.GradeDao.SaveGrade(grade); err != nil {
+		return nil, nil, toGradeError(err)
+	}
+	return grade, nil, nil
+}
+
+// GetSubmissionGradeHandler 获取提交的评分
+func (h *Handler) GetSubmissionGradeHandler(c *gin.Context, params *ClassSubmissionParams) (*model.Grade, *gorails.ResponseMeta, gorails.Error) {
+	if _, gerr := h.getClassSubmission(params.ClassID, params.SubmissionID); gerr != nil {
+		return nil, nil, gerr
+	}
+
+	grade, err := h.dao.GradeDao.GetGradeBySubmission(params.SubmissionID)
+	if err != nil {
+		return nil, nil, toGradeError(err)
+	}
+	return grade, nil, nil
+}
+
+// ===== 成绩导出 =====
+
+// ExportClassGradesParams 导出班级成绩请求参数
+type ExportClassGradesParams struct {
+	ClassID uint `json:"class_id" uri:"class_id" binding:"required"`
+}
+
+func (p *ExportClassGradesParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// RenderCSV 以 CSV 文件形式返回数据
+func RenderCSV(c *gin.Context, data []byte, meta *gorails.ResponseMeta) {
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// ExportClassGradesHandler 导出班级成绩 CSV
+// 每个学生一行，每个作业一列；同一作业多次提交时取最后一次评分
+func (h *Handler) ExportClassGradesHandler(c *gin.Context, params *ExportClassGradesParams) ([]byte, *gorails.ResponseMeta, gorails.Error) {
+	class, err := h.dao.ClassDao.GetClass(params.ClassID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+	// 只导出学生，不含助教
+	students, err := h.dao.ClassDao.ListStudents(params.ClassID, h.classTeacherID(c))
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	assignments, err := h.dao.AssignmentDao.ListAssignments(params.ClassID, 0, false)
+	if err != nil {
+		return nil, nil, toAssignmentError(err)
+	}
+	grades, err := h.dao.GradeDao.ListClassGrades(params.ClassID)
+	if err != nil {
+		return nil, nil, toGradeError(err)
+	}
+
+	// 学生ID -> 作业ID -> 评分，按ID升序遍历，后面的评分覆盖前面的
+	gradeMap := make(map[uint]map[uint]model.Grade)
+	for _, grade := range grades {
+		if gradeMap[grade.StudentID] == nil {
+			gradeMap[grade.StudentID] = make(map[uint]model.Grade)
+		}
+		gradeMap[grade.StudentID][grade.AssignmentID] = grade
+	}
+
+	var buf bytes.Buffer
+	// 写入 UTF-8 BOM，避免 Excel 打开中文乱码
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+
+	header := []string{"学生ID", "用户名", "昵称"}
+	for _, assignment := range assignments {
+		header = append(header, csvutil.SafeCell(assignment.Title))
+	}
+	header = append(header, "总分", "满分")
+	w.Write(header)
+
+	for _, student := range students {
+		row := []string{strconv.FormatUint(uint64(student.ID), 10), csvutil.SafeCell(student.Username), csvutil.SafeCell(student.Nickname)}
+		total, maxTotal := 0, 0
+		for _, assignment := range assignments {
+			grade, ok := gradeMap[student.ID][assignment.ID]
+			if !ok {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, strconv.Itoa(grade.Score))
+			total += grade.Score
+			maxTotal += grade.MaxScore
+		}
+		row = append(row, strconv.Itoa(total), strconv.Itoa(maxTotal))
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"class_%d_grades.csv\"", class.ID))
+	return buf.Bytes(), nil, nil
+}
+
+// toGradeError GradeDao 返回的是自定义错误时直接透传，否则按系统错误处理
+func toGradeError(err error) gorails.Error {
+	if ce, ok := err.(gorails.Error); ok {
+		return ce
+	}
+	return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_GRADE, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+}
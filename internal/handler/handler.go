@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jun/fun_code/internal/cache"
 	"github.com/jun/fun_code/internal/config"
 	"github.com/jun/fun_code/internal/dao"
 	"github.com/jun/fun_code/internal/i18n"
@@ -21,7 +22,12 @@ type Handler struct {
 	// 用于限流的映射和互斥锁
 	createProjectLimiter     map[uint][]time.Time
 	createProjectLimiterLock sync.Mutex
+	joinClassLimiter         map[uint][]time.Time
+	joinClassLimiterLock     sync.Mutex
 	logger                   *zap.Logger
+
+	// 用户和角色权限的缓存，修改用户角色或角色权限后需要调用 Invalidate
+	permissionCache cache.PermissionCache
 }
 
 func NewHandler(dao *dao.Dao, i18n i18n.I18nService, logger *zap.Logger,
@@ -31,7 +37,9 @@ func NewHandler(dao *dao.Dao, i18n i18n.I18nService, logger *zap.Logger,
 		i18n:                 i18n,
 		config:               cfg, // 初始化配置字段
 		createProjectLimiter: make(map[uint][]time.Time),
+		joinClassLimiter:     make(map[uint][]time.Time),
 		logger:               logger,
+		permissionCache:      cache.NewPermissionCache(cache.NewGoCache()),
 	}
 }
 
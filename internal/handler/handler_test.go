@@ -40,7 +40,7 @@ func (m *MockAuthService) Register(username, password, email string) error {
 }
 
 // 修改 MockAuthService 的 Login 方法
-func (m *MockAuthService) Login(username, password string) (*dao.LoginResponse, error) {
+func (m *MockAuthService) Login(username, password string, client dao.SessionClient) (*dao.LoginResponse, error) {
 	args := m.Called(username, password)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -48,6 +48,81 @@ func (m *MockAuthService) Login(username, password string) (*dao.LoginResponse,
 	return args.Get(0).(*dao.LoginResponse), args.Error(1)
 }
 
+func (m *MockAuthService) StartSession(user *model.User, client dao.SessionClient) (*dao.LoginResponse, error) {
+	args := m.Called(user)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.LoginResponse), args.Error(1)
+}
+
+func (m *MockAuthService) ListSessions(userID uint) ([]model.UserSession, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.UserSession), args.Error(1)
+}
+
+func (m *MockAuthService) RevokeSession(userID uint, id uint) error {
+	args := m.Called(userID, id)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) RevokeUserSessions(userIDs []uint) (int64, error) {
+	args := m.Called(userIDs)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockAuthService) Refresh(refreshToken string) (*dao.LoginResponse, error) {
+	args := m.Called(refreshToken)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.LoginResponse), args.Error(1)
+}
+
+func (m *MockAuthService) RevokeRefreshToken(refreshToken string) error {
+	args := m.Called(refreshToken)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) GetPictureLoginClass(classCode string) (*model.Class, []model.User, error) {
+	args := m.Called(classCode)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*model.Class), args.Get(1).([]model.User), args.Error(2)
+}
+
+func (m *MockAuthService) PictureLogin(classCode string, userID uint, icons []int, client dao.SessionClient) (*dao.LoginResponse, error) {
+	args := m.Called(classCode, userID, icons, client)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.LoginResponse), args.Error(1)
+}
+
+func (m *MockAuthService) BadgeLogin(token string, client dao.SessionClient) (*dao.LoginResponse, error) {
+	args := m.Called(token, client)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.LoginResponse), args.Error(1)
+}
+
+func (m *MockAuthService) UnlockLogin(username, ip string) {
+	m.Called(username, ip)
+}
+
+func (m *MockAuthService) ListLoginFailures(username string, pageSize uint, beginID uint) ([]model.LoginFailure, bool, error) {
+	args := m.Called(username, pageSize, beginID)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1), args.Error(2)
+	}
+	return args.Get(0).([]model.LoginFailure), args.Bool(1), args.Error(2)
+}
+
 // Logout 方法的模拟实现
 func (m *MockAuthService) Logout(token string) (*http.Cookie, error) {
 	args := m.Called(token)
@@ -233,6 +308,38 @@ func (m *MockScratchDao) GetProjectBinary(projectID uint, md5 string) ([]byte, e
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *MockScratchDao) GetProjectHistory(projectID uint, md5 string) ([]byte, error) {
+	args := m.Called(projectID, md5)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+func (m *MockScratchDao) RestoreProjectHistory(projectID uint, md5 string) (*model.ScratchProject, error) {
+	args := m.Called(projectID, md5)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ScratchProject), args.Error(1)
+}
+
+func (m *MockScratchDao) CompactHistories(dryRun bool) (*dao.HistoryCompactResult, error) {
+	args := m.Called(dryRun)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.HistoryCompactResult), args.Error(1)
+}
+
+func (m *MockScratchDao) CollectOrphanAssets(opts dao.AssetGCOptions) (*dao.AssetGCResult, error) {
+	args := m.Called(opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.AssetGCResult), args.Error(1)
+}
+
 func (m *MockScratchDao) SaveProject(userID uint, projectID uint, name string, content []byte) (uint, error) {
 	args := m.Called(userID, projectID, name, content)
 	return args.Get(0).(uint), args.Error(1)
@@ -300,6 +407,19 @@ func (m *MockUserDao) SearchUsers(keyword string) ([]model.User, error) {
 	return args.Get(0).([]model.User), args.Error(1)
 }
 
+func (m *MockUserDao) ImportUsers(rows []dao.UserImportRow, dryRun bool) ([]model.User, []dao.UserImportRowError, error) {
+	args := m.Called(rows, dryRun)
+	var users []model.User
+	if args.Get(0) != nil {
+		users = args.Get(0).([]model.User)
+	}
+	var rowErrors []dao.UserImportRowError
+	if args.Get(1) != nil {
+		rowErrors = args.Get(1).([]dao.UserImportRowError)
+	}
+	return users, rowErrors, args.Error(2)
+}
+
 func (m *MockUserDao) GetUserByID(id uint) (*model.User, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
@@ -480,8 +600,32 @@ func (m *MockClassDao) ListCoursesByClass(classID uint) ([]model.Course, error)
 	return args.Get(0).([]model.Course), args.Error(1)
 }
 
-func (m *MockClassDao) JoinClass(studentID uint, classCode string) error {
+func (m *MockClassDao) JoinClass(studentID uint, classCode string) (*model.ClassUser, error) {
 	args := m.Called(studentID, classCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ClassUser), args.Error(1)
+}
+
+func (m *MockClassDao) RotateClassCode(classID, teacherID uint, expiresAt int64) (*model.Class, error) {
+	args := m.Called(classID, teacherID, expiresAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Class), args.Error(1)
+}
+
+func (m *MockClassDao) ListPendingStudents(classID, teacherID uint) ([]model.User, error) {
+	args := m.Called(classID, teacherID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.User), args.Error(1)
+}
+
+func (m *MockClassDao) ReviewJoinRequest(classID, teacherID, studentID uint, approve bool) error {
+	args := m.Called(classID, teacherID, studentID, approve)
 	return args.Error(0)
 }
 
@@ -511,6 +655,98 @@ func (m *MockClassDao) IsLessonInClass(classID, courseID, lessonID uint) (bool,
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockClassDao) ResetStudentLogins(classID, teacherID uint, studentIDs []uint, picture, badge bool) ([]dao.StudentLoginCard, error) {
+	args := m.Called(classID, teacherID, studentIDs, picture, badge)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]dao.StudentLoginCard), args.Error(1)
+}
+
+func (m *MockClassDao) GetMemberRole(classID, userID uint) (*model.Class, string, error) {
+	args := m.Called(classID, userID)
+	if args.Get(0) == nil {
+		return nil, args.String(1), args.Error(2)
+	}
+	return args.Get(0).(*model.Class), args.String(1), args.Error(2)
+}
+
+func (m *MockClassDao) SetMemberRole(classID, teacherID, userID uint, role string) error {
+	args := m.Called(classID, teacherID, userID, role)
+	return args.Error(0)
+}
+
+type MockRoleDao struct {
+	mock.Mock
+}
+
+func (m *MockRoleDao) ListRoles() ([]dao.RoleInfo, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]dao.RoleInfo), args.Error(1)
+}
+
+func (m *MockRoleDao) GetRolePermissions(role string) ([]string, error) {
+	args := m.Called(role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRoleDao) GetRole(name string) (*dao.RoleInfo, error) {
+	args := m.Called(name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.RoleInfo), args.Error(1)
+}
+
+func (m *MockRoleDao) RoleExists(role string) (bool, error) {
+	args := m.Called(role)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRoleDao) CreateRole(name, description string, permissions []string) (*dao.RoleInfo, error) {
+	args := m.Called(name, description, permissions)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.RoleInfo), args.Error(1)
+}
+
+func (m *MockRoleDao) UpdateRole(name, description string, permissions []string) (*dao.RoleInfo, error) {
+	args := m.Called(name, description, permissions)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*dao.RoleInfo), args.Error(1)
+}
+
+func (m *MockRoleDao) DeleteRole(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+type MockAuditDao struct {
+	mock.Mock
+}
+
+func (m *MockAuditDao) RecordEvent(event *model.AuditEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockAuditDao) ListEvents(filter dao.AuditEventFilter, pageSize uint, beginID uint, forward, asc bool) ([]model.AuditEvent, bool, error) {
+	args := m.Called(filter, pageSize, beginID, forward, asc)
+	if args.Get(0) == nil {
+		return nil, args.Bool(1), args.Error(2)
+	}
+	return args.Get(0).([]model.AuditEvent), args.Bool(1), args.Error(2)
+}
+
 type MockDao struct {
 	AuthDao      *MockAuthService
 	FileDao      *MockFileService
@@ -518,6 +754,8 @@ type MockDao struct {
 	ScratchDao   *MockScratchDao
 	UserAssetDao *MockUserAssetDao
 	ClassDao     *MockClassDao
+	RoleDao      *MockRoleDao
+	AuditDao     *MockAuditDao
 }
 
 // 修改 setupTestHandler 函数，添加 MockFileService 并调整返回顺序
@@ -531,6 +769,15 @@ func setupTestHandler() (*gin.Engine, *MockDao) {
 	mockScratch := new(MockScratchDao)
 	mockUserAsset := new(MockUserAssetDao)
 	mockClass := new(MockClassDao)
+	// 内置角色的默认权限，测试可以在此之前设置其他期望
+	mockRole := new(MockRoleDao)
+	mockRole.On("GetRolePermissions", RoleAdmin).Return([]string{PermissionManageAll}, nil).Maybe()
+	mockRole.On("GetRolePermissions", RoleTeacher).Return([]string{PermissionManageOwnClass, PermissionManageOwnStudents}, nil).Maybe()
+	mockRole.On("GetRolePermissions", RoleAssistant).Return([]string{PermissionManageOwnStudents}, nil).Maybe()
+	mockRole.On("GetRolePermissions", mock.Anything).Return([]string{}, nil).Maybe()
+	mockRole.On("RoleExists", mock.Anything).Return(true, nil).Maybe()
+	mockAudit := new(MockAuditDao)
+	mockAudit.On("RecordEvent", mock.Anything).Return(nil).Maybe()
 
 	i18n, err := i18n.NewI18nService("en")
 	if err != nil {
@@ -549,6 +796,8 @@ func setupTestHandler() (*gin.Engine, *MockDao) {
 		ScratchDao:   mockScratch,
 		UserAssetDao: mockUserAsset,
 		ClassDao:     mockClass,
+		RoleDao:      mockRole,
+		AuditDao:     mockAudit,
 	}
 	h := NewHandler(mockDao, i18n, zap.NewNop(), cfg)
 
@@ -640,6 +889,8 @@ func setupTestHandler() (*gin.Engine, *MockDao) {
 		ScratchDao:   mockScratch,
 		UserAssetDao: mockUserAsset,
 		ClassDao:     mockClass,
+		RoleDao:      mockRole,
+		AuditDao:     mockAudit,
 	}
 
 	return r, d
@@ -733,6 +984,42 @@ func TestHandler_AuthMiddleware(t *testing.T) {
 	}
 }
 
+// 访问令牌过期时用刷新令牌 cookie 自动续期
+func TestHandler_AuthMiddleware_Refresh(t *testing.T) {
+	r, mockDao := setupTestHandler()
+
+	mockDao.AuthDao.On("ValidateToken", "expired.token").Return(nil, assert.AnError)
+	mockDao.AuthDao.On("Refresh", "refresh-1").Return(&dao.LoginResponse{
+		Token:         "new.token",
+		Cookie:        &http.Cookie{Name: "auth_token", Value: "new.token", Path: "/", MaxAge: 900},
+		RefreshCookie: &http.Cookie{Name: dao.RefreshTokenCookieName, Value: "refresh-2", Path: "/", MaxAge: 3600, HttpOnly: true, SameSite: http.SameSiteStrictMode},
+	}, nil)
+	mockDao.AuthDao.On("ValidateToken", "new.token").Return(&dao.Claims{UserID: 1, SessionID: "s1"}, nil)
+	mockDao.AuthDao.On("Refresh", "reused").Return(nil, dao.ErrRefreshTokenReused)
+
+	req := httptest.NewRequest("GET", "/api/files", nil)
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: "expired.token"})
+	req.AddCookie(&http.Cookie{Name: dao.RefreshTokenCookieName, Value: "refresh-1"})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Header().Values("Set-Cookie")
+	assert.Len(t, cookies, 2)
+	assert.Contains(t, cookies[0], "auth_token=new.token")
+	assert.Contains(t, cookies[1], dao.RefreshTokenCookieName+"=refresh-2")
+	assert.Contains(t, cookies[1], "SameSite=Strict")
+
+	// 刷新令牌被重复使用时要求重新登录
+	req = httptest.NewRequest("GET", "/api/files", nil)
+	req.AddCookie(&http.Cookie{Name: dao.RefreshTokenCookieName, Value: "reused"})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	mockDao.AuthDao.AssertExpectations(t)
+}
+
 func TestHandler_CreateDirectory(t *testing.T) {
 	r, mockDao := setupTestHandler()
 
@@ -699,8 +699,8 @@ func (h *Handler) UpdateLessonHandler(c *gin.Context, params *UpdateLessonParams
 
 	if len(courses) == 0 {
 		// 没有关联课程的课时，检查是否为管理员
-		userInfo, err := h.dao.UserDao.GetUserByID(userID)
-		if err != nil || userInfo.Role != "admin" {
+		permissions, err := h.userPermissions(c)
+		if err != nil || permissions.Role != RoleAdmin {
 			hasPermission = false
 		} else {
 			hasPermission = true
@@ -1195,8 +1195,8 @@ func (h *Handler) DeleteLessonHandler(c *gin.Context, params *DeleteLessonParams
 
 	if len(courses) == 0 {
 		// 没有关联课程的课时，检查是否为管理员
-		userInfo, err := h.dao.UserDao.GetUserByID(userID)
-		if err != nil || userInfo.Role != "admin" {
+		permissions, err := h.userPermissions(c)
+		if err != nil || permissions.Role != RoleAdmin {
 			hasPermission = false
 		} else {
 			hasPermission = true
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// ListLoginFailuresParams 列出登录失败记录请求参数
+type ListLoginFailuresParams struct {
+	Username string `form:"username"`
+	PageSize uint   `form:"pageSize"`
+	BeginID  uint   `form:"beginID"`
+}
+
+func (p *ListLoginFailuresParams) Parse(c *gin.Context) gorails.Error {
+	p.Username = c.Query("username")
+	p.PageSize = 20
+	if pageSize, err := strconv.ParseUint(c.DefaultQuery("pageSize", "20"), 10, 32); err == nil && pageSize > 0 && pageSize <= 100 {
+		p.PageSize = uint(pageSize)
+	}
+	if beginID, err := strconv.ParseUint(c.DefaultQuery("beginID", "0"), 10, 32); err == nil {
+		p.BeginID = uint(beginID)
+	}
+	return nil
+}
+
+// LoginFailureResponse 登录失败记录
+type LoginFailureResponse struct {
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Username  string    `json:"username"`
+	UserID    uint      `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `json:"reason"`
+}
+
+// ListLoginFailuresHandler 按时间倒序列出登录失败记录，可按用户名筛选
+func (h *Handler) ListLoginFailuresHandler(c *gin.Context, params *ListLoginFailuresParams) ([]LoginFailureResponse, *gorails.ResponseMeta, gorails.Error) {
+	failures, hasMore, err := h.dao.AuthDao.ListLoginFailures(params.Username, params.PageSize, params.BeginID)
+	if err != nil {
+		if ge, ok := err.(gorails.Error); ok {
+			return nil, nil, ge
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	response := make([]LoginFailureResponse, len(failures))
+	for i, failure := range failures {
+		response[i] = LoginFailureResponse{
+			ID:        failure.ID,
+			CreatedAt: failure.CreatedAt,
+			Username:  failure.Username,
+			UserID:    failure.UserID,
+			IP:        failure.IP,
+			UserAgent: failure.UserAgent,
+			Reason:    failure.Reason,
+		}
+	}
+	return response, &gorails.ResponseMeta{HasNext: hasMore}, nil
+}
+
+// UnlockLoginParams 解除登录锁定请求参数，用户名和 IP 至少填一个
+type UnlockLoginParams struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+}
+
+func (p *UnlockLoginParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.Username == "" && p.IP == "" {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
+	}
+	return nil
+}
+
+// UnlockLoginResponse 解除登录锁定响应
+type UnlockLoginResponse struct {
+	Message string `json:"message"`
+}
+
+// UnlockLoginHandler 清除用户名或 IP 的登录失败次数，被锁定的学生可以马上重新登录
+func (h *Handler) UnlockLoginHandler(c *gin.Context, params *UnlockLoginParams) (*UnlockLoginResponse, *gorails.ResponseMeta, gorails.Error) {
+	h.dao.AuthDao.UnlockLogin(params.Username, params.IP)
+	return &UnlockLoginResponse{Message: "已解除登录锁定"}, nil, nil
+}
@@ -33,8 +33,8 @@ func (h *Handler) GetMenuListHandler(c *gin.Context, params *gorails.EmptyParams
 		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeUnauthorized, global.ErrorMsgUnauthorized, nil)
 	}
 
-	// 从数据库获取用户信息
-	user, err := h.dao.UserDao.GetUserByID(userID)
+	// 获取用户角色，权限检查时已经查询过
+	permissions, err := h.userPermissions(c)
 	if err != nil {
 		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
 	}
@@ -43,7 +43,7 @@ func (h *Handler) GetMenuListHandler(c *gin.Context, params *gorails.EmptyParams
 	var menuGroups []MenuGroup
 
 	// 管理员和教师可以看到管理菜单
-	if user.Role == "admin" || user.Role == "teacher" {
+	if permissions.Role == RoleAdmin || permissions.Role == RoleTeacher {
 		menuGroups = append(menuGroups, MenuGroup{
 			Title: "用户管理",
 			URL:   "#",
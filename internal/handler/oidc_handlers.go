@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/mail2fish/gorails/gorails"
+	"gorm.io/gorm"
+)
+
+// errOIDCDisabled 没有配置单点登录
+var errOIDCDisabled = errors.New("未开启单点登录")
+
+// oidcDisabledError 未开启单点登录时返回 404
+func oidcDisabledError() gorails.Error {
+	return gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, errOIDCDisabled)
+}
+
+// safeReturnTo 只允许跳转到本站的页面，避免被用作开放重定向
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	return returnTo
+}
+
+// GetOIDCConfigParams 获取单点登录配置请求参数
+type GetOIDCConfigParams struct {
+}
+
+func (p *GetOIDCConfigParams) Parse(c *gin.Context) gorails.Error {
+	return nil
+}
+
+// GetOIDCConfigResponse 登录页根据这个决定是否显示单点登录按钮
+type GetOIDCConfigResponse struct {
+	Enabled bool   `json:"enabled"`
+	Name    string `json:"name,omitempty"`
+}
+
+// GetOIDCConfigHandler 获取单点登录配置
+func (h *Handler) GetOIDCConfigHandler(c *gin.Context, params *GetOIDCConfigParams) (*GetOIDCConfigResponse, *gorails.ResponseMeta, gorails.Error) {
+	if h.dao.OIDCDao == nil {
+		return &GetOIDCConfigResponse{}, nil, nil
+	}
+	return &GetOIDCConfigResponse{Enabled: true, Name: h.dao.OIDCDao.Name()}, nil, nil
+}
+
+// OIDCLoginParams 发起单点登录请求参数
+type OIDCLoginParams struct {
+	ReturnTo string `form:"return_to"` // 登录后返回的页面，只能是本站的路径
+}
+
+func (p *OIDCLoginParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	p.ReturnTo = safeReturnTo(p.ReturnTo)
+	return nil
+}
+
+// OIDCRedirectResponse 单点登录过程中需要跳转的地址
+type OIDCRedirectResponse struct {
+	URL string `json:"url"`
+}
+
+// RenderOIDCRedirect 跳转到身份提供方或登录后的页面
+func RenderOIDCRedirect(c *gin.Context, response *OIDCRedirectResponse, meta *gorails.ResponseMeta) {
+	c.Redirect(http.StatusFound, response.URL)
+}
+
+// OIDCLoginHandler 跳转到身份提供方登录
+func (h *Handler) OIDCLoginHandler(c *gin.Context, params *OIDCLoginParams) (*OIDCRedirectResponse, *gorails.ResponseMeta, gorails.Error) {
+	return h.oidcRedirect(c, params.ReturnTo, 0)
+}
+
+// LinkOIDCHandler 已登录的用户跳转到身份提供方登录，回调后关联到当前用户
+func (h *Handler) LinkOIDCHandler(c *gin.Context, params *OIDCLoginParams) (*OIDCRedirectResponse, *gorails.ResponseMeta, gorails.Error) {
+	return h.oidcRedirect(c, params.ReturnTo, h.getUserID(c))
+}
+
+func (h *Handler) oidcRedirect(c *gin.Context, returnTo string, linkUserID uint) (*OIDCRedirectResponse, *gorails.ResponseMeta, gorails.Error) {
+	if h.dao.OIDCDao == nil {
+		return nil, nil, oidcDisabledError()
+	}
+	authURL, state, err := h.dao.OIDCDao.AuthCodeURL(requestBaseURL(c)+"/api/auth/oidc/callback", returnTo, linkUserID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadGateway, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLoginFailed, global.ErrorMsgLoginFailed, err)
+	}
+	setOIDCStateCookie(c, dao.OIDCStateHash(state), int(dao.OIDCStateTTL/time.Second))
+	return &OIDCRedirectResponse{URL: authURL}, nil, nil
+}
+
+// setOIDCStateCookie 设置或清除（maxAge 为 -1）保存 state 摘要的 cookie。
+// 身份提供方跳转回来是顶层 GET 请求，SameSite=Lax 时 cookie 会被带上
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(dao.OIDCStateCookieName, value, maxAge, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+}
+
+// OIDCCallbackParams 身份提供方回调参数
+type OIDCCallbackParams struct {
+	Code             string `form:"code"`
+	State            string `form:"state"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+func (p *OIDCCallbackParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// OIDCCallbackHandler 身份提供方登录后跳转回来，登录或关联外部身份后跳转到发起登录时的页面
+func (h *Handler) OIDCCallbackHandler(c *gin.Context, params *OIDCCallbackParams) (*OIDCRedirectResponse, *gorails.ResponseMeta, gorails.Error) {
+	if h.dao.OIDCDao == nil {
+		return nil, nil, oidcDisabledError()
+	}
+	// 用户在身份提供方取消了登录
+	if params.Error != "" {
+		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLoginFailed, global.ErrorMsgLoginFailed,
+			errors.New(params.Error+" "+params.ErrorDescription))
+	}
+
+	// state cookie 只能使用一次
+	stateCookie, _ := c.Cookie(dao.OIDCStateCookieName)
+	setOIDCStateCookie(c, "", -1)
+	result, err := h.dao.OIDCDao.Callback(params.State, params.Code, dao.OIDCCallbackClient{
+		StateCookie:   stateCookie,
+		SessionUserID: h.getUserID(c),
+	})
+	if err != nil {
+		if errors.Is(err, dao.ErrOIDCIdentityLinked) {
+			return nil, nil, gorails.NewError(http.StatusConflict, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeUpdateConflict, global.ErrorMsgUpdateConflict, err)
+		}
+		if errors.Is(err, dao.ErrOIDCNoRole) || errors.Is(err, dao.ErrOIDCLinkUserChanged) {
+			return nil, nil, gorails.NewError(http.StatusForbidden, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, err)
+		}
+		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLoginFailed, global.ErrorMsgLoginFailed, err)
+	}
+
+	if !result.Linked {
+		loginResponse, err := h.dao.AuthDao.StartSession(result.User, dao.SessionClient{
+			UserAgent: c.Request.UserAgent(),
+			IP:        c.ClientIP(),
+		})
+		if err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLoginFailed, global.ErrorMsgLoginFailed, err)
+		}
+		setLoginCookies(c, loginResponse)
+	}
+	return &OIDCRedirectResponse{URL: safeReturnTo(result.ReturnTo)}, nil, nil
+}
+
+// ListMyIdentitiesParams 列出我关联的外部身份请求参数
+type ListMyIdentitiesParams struct {
+}
+
+func (p *ListMyIdentitiesParams) Parse(c *gin.Context) gorails.Error {
+	return nil
+}
+
+// IdentityResponse 关联的外部身份
+type IdentityResponse struct {
+	ID          uint      `json:"id"`
+	Provider    string    `json:"provider"`
+	Issuer      string    `json:"issuer"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// ListMyIdentitiesResponse 列出我关联的外部身份响应
+type ListMyIdentitiesResponse struct {
+	Identities []IdentityResponse `json:"identities"`
+}
+
+// ListMyIdentitiesHandler 列出当前用户关联的外部身份，未开启单点登录时为空
+func (h *Handler) ListMyIdentitiesHandler(c *gin.Context, params *ListMyIdentitiesParams) (*ListMyIdentitiesResponse, *gorails.ResponseMeta, gorails.Error) {
+	response := &ListMyIdentitiesResponse{Identities: []IdentityResponse{}}
+	if h.dao.OIDCDao == nil {
+		return response, nil, nil
+	}
+
+	identities, err := h.dao.OIDCDao.ListIdentities(h.getUserID(c))
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	for _, identity := range identities {
+		response.Identities = append(response.Identities, IdentityResponse{
+			ID:          identity.ID,
+			Provider:    identity.Provider,
+			Issuer:      identity.Issuer,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+	return response, nil, nil
+}
+
+// UnlinkMyIdentityParams 解除关联外部身份请求参数
+type UnlinkMyIdentityParams struct {
+	ID uint `uri:"id" binding:"required"`
+}
+
+func (p *UnlinkMyIdentityParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// UnlinkMyIdentityResponse 解除关联外部身份响应
+type UnlinkMyIdentityResponse struct {
+	Message string `json:"message"`
+}
+
+// UnlinkMyIdentityHandler 解除当前用户关联的一个外部身份
+func (h *Handler) UnlinkMyIdentityHandler(c *gin.Context, params *UnlinkMyIdentityParams) (*UnlinkMyIdentityResponse, *gorails.ResponseMeta, gorails.Error) {
+	if h.dao.OIDCDao == nil {
+		return nil, nil, oidcDisabledError()
+	}
+	if err := h.dao.OIDCDao.UnlinkIdentity(h.getUserID(c), params.ID); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+		case errors.Is(err, dao.ErrOIDCLastIdentity):
+			return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeUpdateConflict, global.ErrorMsgUpdateConflict, err)
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+	return &UnlinkMyIdentityResponse{Message: "已解除关联"}, nil, nil
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/mail2fish/gorails/gorails"
+	"go.uber.org/zap"
+)
+
+// passwordChangeAllowedPaths 需要先修改密码时仍然可以访问的接口
+var passwordChangeAllowedPaths = map[string]bool{
+	"/api/auth/password": true,
+	"/api/user/info":     true,
+}
+
+// passwordError 将修改和重置密码的错误转换为接口错误
+func passwordError(err error) gorails.Error {
+	switch {
+	case errors.Is(err, dao.ErrPasswordPolicy):
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	case errors.Is(err, dao.ErrWrongPassword), errors.Is(err, dao.ErrResetCodeInvalid):
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	case errors.Is(err, dao.ErrPasswordExternal), errors.Is(err, dao.ErrNotClassStudent):
+		return gorails.NewError(http.StatusForbidden, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, err)
+	}
+	return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+}
+
+// GetPasswordPolicyParams 获取密码策略请求参数
+type GetPasswordPolicyParams struct {
+}
+
+func (p *GetPasswordPolicyParams) Parse(c *gin.Context) gorails.Error {
+	return nil
+}
+
+// GetPasswordPolicyResponse 密码策略，前端用来提示和检查新密码
+type GetPasswordPolicyResponse struct {
+	MinLength         int  `json:"min_length"`
+	RequireLetter     bool `json:"require_letter"`
+	RequireDigit      bool `json:"require_digit"`
+	EmailResetEnabled bool `json:"email_reset_enabled"` // 登录页是否显示"通过邮件找回密码"
+}
+
+// GetPasswordPolicyHandler 获取密码策略
+func (h *Handler) GetPasswordPolicyHandler(c *gin.Context, params *GetPasswordPolicyParams) (*GetPasswordPolicyResponse, *gorails.ResponseMeta, gorails.Error) {
+	policy := h.dao.PasswordDao.Policy()
+	return &GetPasswordPolicyResponse{
+		MinLength:         policy.MinLength,
+		RequireLetter:     policy.RequireLetter,
+		RequireDigit:      policy.RequireDigit,
+		EmailResetEnabled: h.dao.PasswordDao.EmailResetEnabled(),
+	}, nil, nil
+}
+
+// ChangeMyPasswordParams 修改自己的密码请求参数
+type ChangeMyPasswordParams struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+func (p *ChangeMyPasswordParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ChangeMyPasswordHandler 修改自己的密码。修改后注销所有设备上的登录，并为当前设备重新登录，
+// 新的令牌不再要求修改密码
+func (h *Handler) ChangeMyPasswordHandler(c *gin.Context, params *ChangeMyPasswordParams) (*LoginResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.getUserID(c)
+	if err := h.dao.PasswordDao.ChangePassword(userID, params.OldPassword, params.NewPassword); err != nil {
+		return nil, nil, passwordError(err)
+	}
+
+	if _, err := h.dao.AuthDao.RevokeUserSessions([]uint{userID}); err != nil {
+		return nil, nil, passwordError(err)
+	}
+	user, err := h.dao.UserDao.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, passwordError(err)
+	}
+	loginResponse, err := h.dao.AuthDao.StartSession(user, dao.SessionClient{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeLoginFailed, global.ErrorMsgLoginFailed, err)
+	}
+	setLoginCookies(c, loginResponse)
+
+	return &LoginResponse{
+		Token:              loginResponse.Token,
+		Role:               loginResponse.Role,
+		ExpiresIn:          loginResponse.ExpiresIn,
+		RefreshToken:       loginResponse.RefreshToken,
+		MustChangePassword: loginResponse.MustChangePassword,
+	}, nil, nil
+}
+
+// ResetPasswordParams 用重置码设置新密码请求参数
+type ResetPasswordParams struct {
+	Username    string `json:"username" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+func (p *ResetPasswordParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ResetPasswordResponse 重置密码响应
+type ResetPasswordResponse struct {
+	Message string `json:"message"`
+}
+
+// ResetPasswordHandler 用老师给的或邮件中的重置码设置新密码，之后需要用新密码重新登录。
+// 重置后注销该用户所有设备上的登录，并解除登录锁定
+func (h *Handler) ResetPasswordHandler(c *gin.Context, params *ResetPasswordParams) (*ResetPasswordResponse, *gorails.ResponseMeta, gorails.Error) {
+	user, err := h.dao.PasswordDao.ResetPassword(params.Username, params.Code, params.NewPassword)
+	if err != nil {
+		return nil, nil, passwordError(err)
+	}
+	if _, err := h.dao.AuthDao.RevokeUserSessions([]uint{user.ID}); err != nil {
+		return nil, nil, passwordError(err)
+	}
+	h.dao.AuthDao.UnlockLogin(user.Username, "")
+	return &ResetPasswordResponse{Message: "密码已重置，请使用新密码登录"}, nil, nil
+}
+
+// ForgotPasswordParams 通过邮件找回密码请求参数
+type ForgotPasswordParams struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (p *ForgotPasswordParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ForgotPasswordHandler 给邮箱对应的帐号发送重置密码的邮件。
+// 无论邮箱是否存在、发送是否成功都返回同样的结果，避免泄露哪些邮箱已注册
+func (h *Handler) ForgotPasswordHandler(c *gin.Context, params *ForgotPasswordParams) (*ResetPasswordResponse, *gorails.ResponseMeta, gorails.Error) {
+	if !h.dao.PasswordDao.EmailResetEnabled() {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, dao.ErrEmailResetDisabled)
+	}
+	if err := h.dao.PasswordDao.SendResetEmail(params.Email); err != nil {
+		h.logger.Error("发送找回密码邮件失败", zap.Error(err))
+	}
+	return &ResetPasswordResponse{Message: "如果该邮箱已注册，您将收到一封重置密码的邮件"}, nil, nil
+}
+
+// CreateStudentResetCodeParams 老师为学生生成重置码请求参数
+type CreateStudentResetCodeParams struct {
+	ClassID uint `uri:"class_id" binding:"required"`
+	UserID  uint `uri:"user_id" binding:"required"`
+}
+
+func (p *CreateStudentResetCodeParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// CreateStudentResetCodeResponse 新生成的重置码，只返回这一次
+type CreateStudentResetCodeResponse struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Nickname  string    `json:"nickname"`
+	Code      string    `json:"code"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CreateStudentResetCodeHandler 老师为自己班级中忘记密码的学生生成一次性重置码，
+// 学生在登录页用用户名和重置码设置新密码
+func (h *Handler) CreateStudentResetCodeHandler(c *gin.Context, params *CreateStudentResetCodeParams) (*CreateStudentResetCodeResponse, *gorails.ResponseMeta, gorails.Error) {
+	reset, err := h.dao.PasswordDao.CreateResetCode(params.ClassID, h.classTeacherID(c), params.UserID)
+	if err != nil {
+		return nil, nil, passwordError(err)
+	}
+	return &CreateStudentResetCodeResponse{
+		UserID:    reset.User.ID,
+		Username:  reset.User.Username,
+		Nickname:  reset.User.Nickname,
+		Code:      reset.Code,
+		ExpiresAt: reset.ExpiresAt,
+	}, nil, nil
+}
@@ -1,88 +1,125 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/cache"
+	"github.com/jun/fun_code/internal/model"
 )
 
 // 角色常量
 const (
-	RoleAdmin   = "admin"   // 管理员
-	RoleTeacher = "teacher" // 教师
-	RoleStudent = "student" // 学生
+	RoleAdmin     = model.RoleAdmin     // 管理员
+	RoleTeacher   = model.RoleTeacher   // 教师
+	RoleStudent   = model.RoleStudent   // 学生
+	RoleAssistant = model.RoleAssistant // 助教，只在担任助教的班级中生效
 )
 
-// 权限常量
+// 权限常量，角色拥有哪些权限保存在数据库中，管理员可以修改
 const (
-	PermissionManageAll         = "manage_all"          // 管理所有资源
-	PermissionManageClass       = "manage_class"        // 管理班级
-	PermissionManageOwnClass    = "manage_own_class"    // 管理自己的班级
-	PermissionManageOwnStudents = "manage_own_students" // 管理自己班级的学生
-	PermissionCreateScratch     = "create_scratch"      // 创建Scratch项目
-	PermissionViewOwnScratch    = "view_own_scratch"    // 查看自己的Scratch项目
-	PermissionEditOwnScratch    = "edit_own_scratch"    // 编辑自己的Scratch项目
-	PermissionViewClassScratch  = "view_class_scratch"  // 查看班级的Scratch项目
-	PermissionViewCourseScratch = "view_course_scratch" // 查看课程的Scratch项目
+	PermissionManageAll         = model.PermissionManageAll         // 管理所有资源
+	PermissionManageClass       = model.PermissionManageClass       // 管理所有班级
+	PermissionManageUsers       = model.PermissionManageUsers       // 管理用户
+	PermissionManageOwnClass    = model.PermissionManageOwnClass    // 管理自己的班级
+	PermissionManageOwnStudents = model.PermissionManageOwnStudents // 管理自己班级的学生
+	PermissionCreateScratch     = model.PermissionCreateScratch     // 创建Scratch项目
+	PermissionViewOwnScratch    = model.PermissionViewOwnScratch    // 查看自己的Scratch项目
+	PermissionEditOwnScratch    = model.PermissionEditOwnScratch    // 编辑自己的Scratch项目
+	PermissionViewClassScratch  = model.PermissionViewClassScratch  // 查看班级的Scratch项目
+	PermissionViewCourseScratch = model.PermissionViewCourseScratch // 查看课程的Scratch项目
 )
 
-// 角色权限映射
-var rolePermissions = map[string][]string{
-	RoleAdmin: {
-		PermissionManageAll,
-	},
-	RoleTeacher: {
-		PermissionManageOwnClass,
-		PermissionManageOwnStudents,
-		PermissionCreateScratch,
-		PermissionViewOwnScratch,
-		PermissionEditOwnScratch,
-		PermissionViewClassScratch,
-		PermissionViewCourseScratch,
-	},
-	RoleStudent: {
-		PermissionCreateScratch,
-		PermissionViewOwnScratch,
-		PermissionEditOwnScratch,
-		PermissionViewClassScratch,
-		PermissionViewCourseScratch,
-	},
+// classTeacherIDKey 通过班级权限检查后，上下文中保存的班级老师ID
+const classTeacherIDKey = "classTeacherID"
+
+// permissionsKey 上下文中保存的当前用户角色和权限，同一个请求中只查询一次
+const permissionsKey = "permissions"
+
+// permissionsAllow 检查权限列表中是否有指定权限，manage_all 包含所有权限
+func permissionsAllow(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission || p == PermissionManageAll {
+			return true
+		}
+	}
+	return false
 }
 
-// 检查用户是否有指定权限
-func (h *Handler) hasPermission(c *gin.Context, permission string) bool {
-	// 获取当前用户ID
+// rolePermissions 获取角色拥有的权限，优先使用缓存
+func (h *Handler) rolePermissions(role string) ([]string, error) {
+	var version uint64
+	if h.permissionCache != nil {
+		version = h.permissionCache.Version()
+		if permissions, found := h.permissionCache.GetRolePermissions(role); found {
+			return permissions, nil
+		}
+	}
+
+	permissions, err := h.dao.RoleDao.GetRolePermissions(role)
+	if err != nil {
+		return nil, err
+	}
+	if h.permissionCache != nil {
+		h.permissionCache.SetRolePermissions(role, permissions, version)
+	}
+	return permissions, nil
+}
+
+// userPermissions 获取当前用户的角色和权限。结果保存在上下文中，
+// 后续的中间件和处理函数直接使用，不再查询数据库
+func (h *Handler) userPermissions(c *gin.Context) (cache.UserPermissions, error) {
+	if permissions, exists := c.Get(permissionsKey); exists {
+		return permissions.(cache.UserPermissions), nil
+	}
+
 	userID := h.getUserID(c)
 	if userID == 0 {
-		return false
+		return cache.UserPermissions{}, errors.New("未登录")
+	}
+
+	var version uint64
+	if h.permissionCache != nil {
+		version = h.permissionCache.Version()
+		if permissions, found := h.permissionCache.GetUserPermissions(userID); found {
+			c.Set(permissionsKey, permissions)
+			return permissions, nil
+		}
 	}
 
-	// 获取用户信息
 	user, err := h.dao.UserDao.GetUserByID(userID)
 	if err != nil {
-		return false
+		return cache.UserPermissions{}, err
 	}
-
-	// 如果是管理员，拥有所有权限
-	if user.Role == RoleAdmin {
-		return true
+	rolePermissions, err := h.rolePermissions(user.Role)
+	if err != nil {
+		return cache.UserPermissions{}, err
 	}
 
-	// 检查用户角色是否有该权限
-	permissions, exists := rolePermissions[user.Role]
-	if !exists {
-		return false
+	permissions := cache.UserPermissions{Role: user.Role, Permissions: rolePermissions}
+	if h.permissionCache != nil {
+		h.permissionCache.SetUserPermissions(userID, permissions, version)
 	}
+	c.Set(permissionsKey, permissions)
+	return permissions, nil
+}
 
-	// 检查特定权限
-	for _, p := range permissions {
-		if p == permission {
-			return true
-		}
+// invalidatePermissions 用户角色或角色权限修改后清除权限缓存
+func (h *Handler) invalidatePermissions() {
+	if h.permissionCache != nil {
+		h.permissionCache.Invalidate()
 	}
+}
 
-	return false
+// 检查用户是否有指定权限
+func (h *Handler) hasPermission(c *gin.Context, permission string) bool {
+	permissions, err := h.userPermissions(c)
+	if err != nil {
+		return false
+	}
+	return permissionsAllow(permissions.Permissions, permission)
 }
 
 // RequirePermission 中间件，用于检查用户是否有指定权限
@@ -99,6 +136,69 @@ func (h *Handler) RequirePermission(permission string) gin.HandlerFunc {
 	}
 }
 
+// hasClassPermission 检查用户能否在班级中使用指定权限：
+// 拥有 manage_class 的用户可以管理所有班级，班级的老师看自己角色的权限，助教看助教角色的权限。
+// 检查通过时把班级老师的ID保存到上下文中
+func (h *Handler) hasClassPermission(c *gin.Context, classID uint, permission string) bool {
+	userID := h.getUserID(c)
+	if userID == 0 {
+		return false
+	}
+
+	class, role, err := h.dao.ClassDao.GetMemberRole(classID, userID)
+	if err != nil {
+		return false
+	}
+
+	allowed := false
+	switch {
+	case h.hasPermission(c, PermissionManageClass):
+		allowed = true
+	case role == RoleTeacher:
+		allowed = h.hasPermission(c, permission)
+	case role == model.ClassRoleAssistant:
+		permissions, err := h.rolePermissions(RoleAssistant)
+		allowed = err == nil && permissionsAllow(permissions, permission)
+	}
+	if allowed {
+		c.Set(classTeacherIDKey, class.TeacherID)
+	}
+	return allowed
+}
+
+// classTeacherID 班级老师的ID，班级的 DAO 方法按老师检查班级归属，
+// 管理员和助教通过权限检查后以班级老师的身份调用
+func (h *Handler) classTeacherID(c *gin.Context) uint {
+	if teacherID, exists := c.Get(classTeacherIDKey); exists {
+		return teacherID.(uint)
+	}
+	return h.getUserID(c)
+}
+
+// RequireClassPermission 中间件，用于检查用户能否在路径参数指定的班级中使用指定权限
+func (h *Handler) RequireClassPermission(permission string, classIDParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		classID, err := strconv.ParseUint(c.Param(classIDParam), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "无效的班级ID",
+			})
+			c.Abort()
+			return
+		}
+
+		if !h.hasClassPermission(c, uint(classID), permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "没有权限管理该班级",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // 检查用户是否是资源所有者
 func (h *Handler) isResourceOwner(c *gin.Context, resourceType string, resourceID uint) bool {
 	// 获取当前用户ID
@@ -115,17 +215,12 @@ func (h *Handler) isResourceOwner(c *gin.Context, resourceType string, resourceI
 			return false
 		}
 		return project.UserID == userID
-	case "class":
-		class, err := h.dao.ClassDao.GetClass(resourceID)
-		if err != nil {
-			return false
-		}
-		return class.TeacherID == userID
 	}
 	return false
 }
 
-// RequireOwnership 中间件，用于检查用户是否是资源所有者
+// RequireOwnership 中间件，用于检查用户是否是资源所有者。
+// 班级的所有者是班级的老师，还需要角色拥有管理自己班级的权限
 func (h *Handler) RequireOwnership(resourceType string, idParam string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从路径参数获取资源ID
@@ -139,6 +234,18 @@ func (h *Handler) RequireOwnership(resourceType string, idParam string) gin.Hand
 			return
 		}
 
+		if resourceType == "class" {
+			if !h.hasClassPermission(c, uint(resourceID), PermissionManageOwnClass) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "您不是该班级的老师",
+				})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		// 检查用户是否是管理员
 		if h.hasPermission(c, PermissionManageAll) {
 			c.Next()
@@ -158,7 +265,7 @@ func (h *Handler) RequireOwnership(resourceType string, idParam string) gin.Hand
 	}
 }
 
-// 检查用户是否是班级成员
+// 检查用户是否是班级成员（老师、助教或学生）
 func (h *Handler) isClassMember(c *gin.Context, classID uint) bool {
 	// 获取当前用户ID
 	userID := h.getUserID(c)
@@ -167,25 +274,11 @@ func (h *Handler) isClassMember(c *gin.Context, classID uint) bool {
 		return false
 	}
 
-	// 获取班级信息
-	class, err := h.dao.ClassDao.GetClass(classID)
+	_, role, err := h.dao.ClassDao.GetMemberRole(classID, userID)
 	if err != nil {
 		return false
 	}
-
-	// 如果是班级的教师，则是成员
-	if class.TeacherID == userID {
-		return true
-	}
-
-	// 检查是否是班级的学生
-	for _, student := range class.Students {
-		if student.ID == userID {
-			return true
-		}
-	}
-
-	return false
+	return role != ""
 }
 
 // RequireClassMembership 中间件，用于检查用户是否是班级成员
@@ -202,8 +295,8 @@ func (h *Handler) RequireClassMembership(classIDParam string) gin.HandlerFunc {
 			return
 		}
 
-		// 检查用户是否是管理员
-		if h.hasPermission(c, PermissionManageAll) {
+		// 可以管理所有班级的用户不需要是成员
+		if h.hasPermission(c, PermissionManageClass) {
 			c.Next()
 			return
 		}
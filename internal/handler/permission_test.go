@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/dao/testutils"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// 测试班级权限：老师只能管理自己的班级，助教只有助教角色的权限，管理员可以管理所有班级
+func TestHandler_RequireClassPermission(t *testing.T) {
+	const (
+		adminID        uint = 1
+		teacherID      uint = 10
+		otherTeacherID uint = 11
+		assistantID    uint = 20
+		studentID      uint = 30
+	)
+	class := &model.Class{ID: 5, TeacherID: teacherID}
+
+	tests := []struct {
+		name             string
+		userID           uint
+		path             string
+		permission       string
+		wantStatus       int
+		wantClassTeacher uint
+	}{
+		{"班级的老师可以管理班级", teacherID, "/classes/5", PermissionManageOwnClass, http.StatusOK, teacherID},
+		{"其他老师不能管理班级", otherTeacherID, "/classes/5", PermissionManageOwnStudents, http.StatusForbidden, 0},
+		{"助教可以管理班级的学生", assistantID, "/classes/5", PermissionManageOwnStudents, http.StatusOK, teacherID},
+		{"助教不能修改班级", assistantID, "/classes/5", PermissionManageOwnClass, http.StatusForbidden, 0},
+		{"学生不能管理班级", studentID, "/classes/5", PermissionManageOwnStudents, http.StatusForbidden, 0},
+		{"管理员可以管理所有班级", adminID, "/classes/5", PermissionManageOwnClass, http.StatusOK, teacherID},
+		{"班级ID无效", teacherID, "/classes/abc", PermissionManageOwnClass, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userDao := new(MockUserDao)
+			userDao.On("GetUserByID", adminID).Return(&model.User{ID: adminID, Role: RoleAdmin}, nil).Maybe()
+			userDao.On("GetUserByID", mock.Anything).Return(&model.User{Role: RoleTeacher}, nil).Maybe()
+			classDao := new(MockClassDao)
+			classDao.On("GetMemberRole", class.ID, teacherID).Return(class, RoleTeacher, nil).Maybe()
+			classDao.On("GetMemberRole", class.ID, assistantID).Return(class, model.ClassRoleAssistant, nil).Maybe()
+			classDao.On("GetMemberRole", class.ID, studentID).Return(class, model.ClassRoleStudent, nil).Maybe()
+			classDao.On("GetMemberRole", class.ID, mock.Anything).Return(class, "", nil).Maybe()
+			roleDao := new(MockRoleDao)
+			roleDao.On("GetRolePermissions", RoleAdmin).Return([]string{PermissionManageAll}, nil).Maybe()
+			roleDao.On("GetRolePermissions", RoleTeacher).Return([]string{PermissionManageOwnClass, PermissionManageOwnStudents}, nil).Maybe()
+			roleDao.On("GetRolePermissions", RoleAssistant).Return([]string{PermissionManageOwnStudents}, nil).Maybe()
+
+			h := &Handler{dao: &dao.Dao{UserDao: userDao, ClassDao: classDao, RoleDao: roleDao}}
+			gin.SetMode(gin.TestMode)
+			r := gin.New()
+			var gotClassTeacher uint
+			r.GET("/classes/:class_id", func(c *gin.Context) {
+				c.Set("userID", tt.userID)
+			}, h.RequireClassPermission(tt.permission, "class_id"), func(c *gin.Context) {
+				gotClassTeacher = h.classTeacherID(c)
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantClassTeacher, gotClassTeacher)
+		})
+	}
+}
+
+// 测试权限缓存：同一个请求只查询一次用户，之后的请求使用缓存，修改角色后缓存失效
+func TestHandler_PermissionCache(t *testing.T) {
+	const (
+		adminID   uint = 1
+		teacherID uint = 10
+	)
+	userDao := new(MockUserDao)
+	userDao.On("GetUserByID", adminID).Return(&model.User{ID: adminID, Role: RoleAdmin}, nil)
+	// 第一次请求和修改角色前各查询一次
+	userDao.On("GetUserByID", teacherID).Return(&model.User{ID: teacherID, Role: RoleTeacher}, nil).Twice()
+	userDao.On("GetUserByID", teacherID).Return(&model.User{ID: teacherID, Role: RoleStudent}, nil).Once()
+	userDao.On("UpdateUser", teacherID, map[string]interface{}{"role": RoleStudent}).Return(nil)
+	roleDao := new(MockRoleDao)
+	roleDao.On("GetRolePermissions", RoleAdmin).Return([]string{PermissionManageAll}, nil)
+	roleDao.On("GetRolePermissions", RoleTeacher).Return([]string{PermissionManageOwnClass, PermissionManageOwnStudents}, nil)
+	roleDao.On("GetRolePermissions", RoleStudent).Return([]string{PermissionCreateScratch}, nil)
+	roleDao.On("RoleExists", RoleStudent).Return(true, nil)
+
+	h := NewHandler(&dao.Dao{UserDao: userDao, RoleDao: roleDao}, nil, nil, nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 64)
+		c.Set("userID", uint(id))
+	})
+	r.GET("/classes", h.RequirePermission(PermissionManageOwnClass), h.RequirePermission(PermissionManageOwnStudents), h.GetCurrentUserPermissions)
+	r.POST("/users/role", h.SetUserRole)
+	request := func(method, path string, userID uint, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-User-ID", strconv.FormatUint(uint64(userID), 10))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 两个权限中间件和处理函数只查询一次用户
+	w := request(http.MethodGet, "/classes", teacherID, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"role":"teacher"`)
+	userDao.AssertNumberOfCalls(t, "GetUserByID", 1)
+	roleDao.AssertNumberOfCalls(t, "GetRolePermissions", 1)
+
+	// 之后的请求使用缓存
+	w = request(http.MethodGet, "/classes", teacherID, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	userDao.AssertNumberOfCalls(t, "GetUserByID", 1)
+
+	// 管理员修改角色后缓存失效，新角色立即生效
+	w = request(http.MethodPost, "/users/role", adminID, `{"user_id":10,"role":"student"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request(http.MethodGet, "/classes", teacherID, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	userDao.AssertNumberOfCalls(t, "GetUserByID", 4)
+	userDao.AssertExpectations(t)
+}
+
+// BenchmarkHandler_RequirePermission 对比使用权限缓存前后，经过两个权限中间件的请求耗时
+func BenchmarkHandler_RequirePermission(b *testing.B) {
+	db := testutils.SetupTestDB()
+	userDao := dao.NewUserDao(db)
+	teacher := &model.User{Username: "teacher", Password: "password", Email: "teacher@example.com", Role: RoleTeacher}
+	if err := userDao.CreateUser(teacher); err != nil {
+		b.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, bm := range []struct {
+		name  string
+		cache bool
+	}{
+		{"无缓存", false},
+		{"缓存", true},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			h := NewHandler(&dao.Dao{UserDao: userDao, RoleDao: dao.NewRoleDao(db)}, nil, nil, nil)
+			if !bm.cache {
+				h.permissionCache = nil
+			}
+			r := gin.New()
+			r.GET("/classes", func(c *gin.Context) {
+				c.Set("userID", teacher.ID)
+			}, h.RequirePermission(PermissionManageOwnClass), h.RequirePermission(PermissionManageOwnStudents), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/classes", nil))
+				if w.Code != http.StatusOK {
+					b.Fatalf("status = %d", w.Code)
+				}
+			}
+		})
+	}
+}
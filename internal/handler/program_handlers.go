@@ -406,6 +406,7 @@ func (h *Handler) AdminDeleteProgramHandler(c *gin.Context, params *AdminDeleteP
 	if err != nil {
 		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_PROGRAM, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, err)
 	}
+	h.audit(c, model.AuditActionDeleteProgram, model.AuditResourceProgram, auditID(params.ID), program, nil)
 
 	return &gorails.ResponseEmpty{}, nil, nil
 }
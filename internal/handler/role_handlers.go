@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// roleError 将角色管理的错误转换为接口错误
+func roleError(err error) gorails.Error {
+	switch {
+	case errors.Is(err, dao.ErrRoleNotFound):
+		return gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	case errors.Is(err, dao.ErrRoleName), errors.Is(err, dao.ErrRoleExists), errors.Is(err, dao.ErrUnknownPermission),
+		errors.Is(err, dao.ErrAdminPermission), errors.Is(err, dao.ErrRoleBuiltIn), errors.Is(err, dao.ErrRoleInUse):
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+}
+
+// ListRolesResponse 所有角色及可以分配的权限
+type ListRolesResponse struct {
+	Roles       []dao.RoleInfo `json:"roles"`
+	Permissions []string       `json:"permissions"`
+}
+
+// ListRolesHandler 列出所有角色及其权限
+func (h *Handler) ListRolesHandler(c *gin.Context, params *gorails.EmptyParams) (*ListRolesResponse, *gorails.ResponseMeta, gorails.Error) {
+	roles, err := h.dao.RoleDao.ListRoles()
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	return &ListRolesResponse{Roles: roles, Permissions: model.Permissions}, nil, nil
+}
+
+// CreateRoleParams 创建角色请求参数
+type CreateRoleParams struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func (p *CreateRoleParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// CreateRoleHandler 创建自定义角色
+func (h *Handler) CreateRoleHandler(c *gin.Context, params *CreateRoleParams) (*dao.RoleInfo, *gorails.ResponseMeta, gorails.Error) {
+	role, err := h.dao.RoleDao.CreateRole(params.Name, params.Description, params.Permissions)
+	if err != nil {
+		return nil, nil, roleError(err)
+	}
+	h.invalidatePermissions()
+	h.audit(c, model.AuditActionCreateRole, model.AuditResourceRole, role.Name, nil, role)
+	return role, nil, nil
+}
+
+// UpdateRoleParams 修改角色请求参数，权限整体替换
+type UpdateRoleParams struct {
+	Name        string   `json:"-" uri:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func (p *UpdateRoleParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// UpdateRoleHandler 修改角色的说明和权限，对拥有该角色的用户立即生效
+func (h *Handler) UpdateRoleHandler(c *gin.Context, params *UpdateRoleParams) (*dao.RoleInfo, *gorails.ResponseMeta, gorails.Error) {
+	before, err := h.dao.RoleDao.GetRole(params.Name)
+	if err != nil {
+		return nil, nil, roleError(err)
+	}
+	role, err := h.dao.RoleDao.UpdateRole(params.Name, params.Description, params.Permissions)
+	if err != nil {
+		return nil, nil, roleError(err)
+	}
+	h.invalidatePermissions()
+	h.audit(c, model.AuditActionUpdateRole, model.AuditResourceRole, role.Name, before, role)
+	return role, nil, nil
+}
+
+// DeleteRoleParams 删除角色请求参数
+type DeleteRoleParams struct {
+	Name string `uri:"name" binding:"required"`
+}
+
+func (p *DeleteRoleParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_ROLE, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// DeleteRoleHandler 删除自定义角色
+func (h *Handler) DeleteRoleHandler(c *gin.Context, params *DeleteRoleParams) (*gorails.ResponseEmpty, *gorails.ResponseMeta, gorails.Error) {
+	before, err := h.dao.RoleDao.GetRole(params.Name)
+	if err != nil {
+		return nil, nil, roleError(err)
+	}
+	if err := h.dao.RoleDao.DeleteRole(params.Name); err != nil {
+		return nil, nil, roleError(err)
+	}
+	h.invalidatePermissions()
+	h.audit(c, model.AuditActionDeleteRole, model.AuditResourceRole, params.Name, before, nil)
+	return &gorails.ResponseEmpty{}, nil, nil
+}
+
+// SetClassMemberRoleParams 设置班级成员角色请求参数
+type SetClassMemberRoleParams struct {
+	ClassID uint   `json:"-" uri:"class_id" binding:"required"`
+	UserID  uint   `json:"-" uri:"user_id" binding:"required"`
+	Role    string `json:"role" binding:"required,oneof=student assistant"`
+}
+
+func (p *SetClassMemberRoleParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// SetClassMemberRoleResponse 设置班级成员角色响应
+type SetClassMemberRoleResponse struct {
+	UserID uint   `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// SetClassMemberRoleHandler 把班级成员设为助教或改回学生，助教可以管理班级中的学生和作业
+func (h *Handler) SetClassMemberRoleHandler(c *gin.Context, params *SetClassMemberRoleParams) (*SetClassMemberRoleResponse, *gorails.ResponseMeta, gorails.Error) {
+	if err := h.dao.ClassDao.SetMemberRole(params.ClassID, h.classTeacherID(c), params.UserID, params.Role); err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+	response := &SetClassMemberRoleResponse{UserID: params.UserID, Role: params.Role}
+	h.audit(c, model.AuditActionSetClassMemberRole, model.AuditResourceClass, auditID(params.ClassID), nil, response)
+	return response, nil, nil
+}
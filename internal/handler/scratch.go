@@ -19,6 +19,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jun/fun_code/internal/global"
 	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/sb3"
 	"github.com/jun/fun_code/web"
 	"github.com/mail2fish/gorails/gorails"
 )
@@ -126,36 +127,9 @@ func (h *Handler) GetLibraryAssetHandler(c *gin.Context, params *GetLibraryAsset
 	var assetData []byte
 	var err error
 
-	// 辅助函数：尝试读取嵌入资源或文件系统资源
-	readAsset := func(name string) ([]byte, error) {
-		// 先尝试嵌入的文件
-		data, e := web.GetScratchAsset(name)
-		if e == nil {
-			return data, nil
-		}
-
-		// 嵌入失败则尝试文件系统
-		assetIDLength := len(name)
-		if assetIDLength < 36 {
-			return nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
-		}
-
-		assetID1 := name[:assetIDLength/4]
-		assetID2 := name[assetIDLength/4 : assetIDLength/2]
-		assetID3 := name[assetIDLength/2 : assetIDLength*3/4]
-		assetID4 := name[assetIDLength*3/4:]
-
-		filePath := filepath.Join(h.dao.ScratchDao.GetScratchBasePath(), "assets", assetID1, assetID2, assetID3, assetID4)
-		data, e = os.ReadFile(filePath)
-		if e != nil {
-			return nil, e
-		}
-		return data, nil
-	}
-
 	// 先检查是否存在 .gz 版本
 	gzName := filename + ".gz"
-	gzData, gzErr := readAsset(gzName)
+	gzData, gzErr := readScratchAssetFile(h.dao.ScratchDao.GetScratchBasePath(), gzName)
 
 	if gzErr == nil {
 		if supportGzip {
@@ -179,7 +153,7 @@ func (h *Handler) GetLibraryAssetHandler(c *gin.Context, params *GetLibraryAsset
 		}
 	} else {
 		// 不存在 .gz，则按原逻辑读取未压缩资源
-		assetData, err = readAsset(filename)
+		assetData, err = readScratchAssetFile(h.dao.ScratchDao.GetScratchBasePath(), filename)
 		if err != nil {
 			return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
 		}
@@ -250,8 +224,8 @@ func (h *Handler) UploadScratchAssetHandler(c *gin.Context, params *UploadScratc
 		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
 	}
 
-	//  最多只读取2MB
-	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 2*1024*1024)
+	// 与导入 .sb3 时单个资源的大小限制相同
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, sb3.MaxAssetSize)
 
 	// 读取请求体中的二进制数据
 	bodyData, err := io.ReadAll(c.Request.Body)
@@ -263,6 +237,73 @@ func (h *Handler) UploadScratchAssetHandler(c *gin.Context, params *UploadScratc
 		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
 	}
 
+	if gerr := h.saveScratchAsset(userID, assetID, bodyData); gerr != nil {
+		return nil, nil, gerr
+	}
+
+	return &UploadScratchAssetResponse{
+		Status:  "ok",
+		AssetID: assetID,
+	}, nil, nil
+}
+
+// scratchAssetPath 资源文件的存储路径，资源名平分成 4 段作为目录和文件名
+func scratchAssetPath(basePath, assetID string) string {
+	n := len(assetID)
+	return filepath.Join(basePath, "assets", assetID[:n/4], assetID[n/4:n/2], assetID[n/2:n*3/4], assetID[n*3/4:])
+}
+
+// readScratchAssetFile 读取资源文件，先尝试嵌入的素材库，再尝试 basePath 下上传的资源，不解压 .gz 文件
+func readScratchAssetFile(basePath, name string) ([]byte, error) {
+	data, err := web.GetScratchAsset(name)
+	if err == nil {
+		return data, nil
+	}
+	if len(name) < 36 {
+		return nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
+	}
+	return os.ReadFile(scratchAssetPath(basePath, name))
+}
+
+// ReadScratchAsset 读取资源的原始内容，只有 .gz 压缩版本时解压后返回，用于打包 .sb3
+func ReadScratchAsset(basePath, name string) ([]byte, error) {
+	data, err := readScratchAssetFile(basePath, name)
+	if err == nil {
+		return data, nil
+	}
+	gzData, gzErr := readScratchAssetFile(basePath, name+".gz")
+	if gzErr != nil {
+		return nil, err
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(gzData))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	return io.ReadAll(gr)
+}
+
+// readScratchAsset 读取当前存储目录下的资源
+func (h *Handler) readScratchAsset(name string) ([]byte, error) {
+	return ReadScratchAsset(h.dao.ScratchDao.GetScratchBasePath(), name)
+}
+
+// scratchAssetExists 判断资源是否已经在素材库或上传的资源中
+func (h *Handler) scratchAssetExists(name string) bool {
+	if _, err := web.GetScratchAsset(name); err == nil {
+		return true
+	}
+	basePath := h.dao.ScratchDao.GetScratchBasePath()
+	for _, candidate := range []string{name, name + ".gz"} {
+		if _, err := os.Stat(scratchAssetPath(basePath, candidate)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// saveScratchAsset 按 4 段目录保存资源文件并记录到用户资源
+func (h *Handler) saveScratchAsset(userID uint, assetID string, data []byte) gorails.Error {
 	// 根据文件扩展名设置适当的Content-Type
 	contentType := "application/octet-stream" // 默认
 	switch {
@@ -280,38 +321,28 @@ func (h *Handler) UploadScratchAssetHandler(c *gin.Context, params *UploadScratc
 		contentType = "application/json"
 	}
 
-	assetID1 := assetID[:assetIDLength/4]
-	assetID2 := assetID[assetIDLength/4 : assetIDLength/2]
-	assetID3 := assetID[assetIDLength/2 : assetIDLength*3/4]
-	assetID4 := assetID[assetIDLength*3/4:]
-
 	// 使用 scratch 服务的基础路径
-	assetDir := filepath.Join(h.dao.ScratchDao.GetScratchBasePath(), "assets", assetID1, assetID2, assetID3)
-	if err := os.MkdirAll(assetDir, 0755); err != nil {
-		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER_ASSET, global.ErrorCodeCreateFailed, global.ErrorMsgCreateFailed, err)
+	filePath := scratchAssetPath(h.dao.ScratchDao.GetScratchBasePath(), assetID)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER_ASSET, global.ErrorCodeCreateFailed, global.ErrorMsgCreateFailed, err)
 	}
 
 	// 保存文件
-	filePath := filepath.Join(assetDir, assetID4)
-	if err := os.WriteFile(filePath, bodyData, 0644); err != nil {
-		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER_ASSET, global.ErrorCodeWriteFileFailed, global.ErrorMsgWriteFileFailed, err)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER_ASSET, global.ErrorCodeWriteFileFailed, global.ErrorMsgWriteFileFailed, err)
 	}
 
 	// 保存用户资源
-	err = h.dao.UserAssetDao.CreateUserAsset(&model.UserAsset{
+	err := h.dao.UserAssetDao.CreateUserAsset(&model.UserAsset{
 		UserID:    userID,
 		AssetID:   assetID,
 		AssetType: contentType,
-		Size:      int64(len(bodyData)),
+		Size:      int64(len(data)),
 	})
 	if err != nil {
-		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER_ASSET, global.ErrorCodeCreateFailed, global.ErrorMsgCreateFailed, err)
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER_ASSET, global.ErrorCodeCreateFailed, global.ErrorMsgCreateFailed, err)
 	}
-
-	return &UploadScratchAssetResponse{
-		Status:  "ok",
-		AssetID: assetID,
-	}, nil, nil
+	return nil
 }
 
 func RenderUploadScratchAssetResponse(c *gin.Context, response *UploadScratchAssetResponse, meta *gorails.ResponseMeta) {
@@ -429,12 +460,18 @@ func (h *Handler) DeleteScratchProjectHandler(c *gin.Context, params *DeleteScra
 	if userID != h.getUserID(c) && !h.hasPermission(c, PermissionManageAll) {
 		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, nil)
 	}
+	// 删除前的项目信息写入审计记录
+	project, err := h.dao.ScratchDao.GetProject(id)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
 	// 删除项目
 	if err := h.dao.ScratchDao.DeleteProject(userID, id); err != nil {
 		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, err)
 	}
 	// 删除分享
 	h.dao.ShareDao.DeleteShare(id, userID)
+	h.audit(c, model.AuditActionDeleteScratch, model.AuditResourceScratch, auditID(id), project, nil)
 	return &gorails.ResponseEmpty{}, nil, nil
 }
 
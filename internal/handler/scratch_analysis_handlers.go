@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/mermaid"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/scratchanalysis"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// GetScratchProjectAnalysisParams 分析项目请求参数
+type GetScratchProjectAnalysisParams struct {
+	ProjectID uint   `uri:"id" binding:"required"`
+	MD5       string `form:"md5"` // 历史版本的 MD5，为空表示当前版本
+}
+
+func (p *GetScratchProjectAnalysisParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// GetScratchProjectAnalysisResponse 分析项目响应
+type GetScratchProjectAnalysisResponse struct {
+	ProjectID uint                    `json:"project_id"`
+	MD5       string                  `json:"md5"`
+	Report    *scratchanalysis.Report `json:"report"`
+}
+
+// GetScratchProjectAnalysisHandler 分析项目的计算思维得分和代码问题
+func (h *Handler) GetScratchProjectAnalysisHandler(c *gin.Context, params *GetScratchProjectAnalysisParams) (*GetScratchProjectAnalysisResponse, *gorails.ResponseMeta, gorails.Error) {
+	project, gerr := h.getOwnedScratchProject(c, params.ProjectID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	md5 := params.MD5
+	if md5 == "" {
+		md5 = project.MD5
+	}
+	if md5 == "" {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeFileNotFound, global.ErrorMsgFileNotFound, errors.New("项目还没有保存过"))
+	}
+	parsed, gerr := h.loadScratchProjectHistory(project.ID, md5)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	return &GetScratchProjectAnalysisResponse{
+		ProjectID: project.ID,
+		MD5:       md5,
+		Report:    scratchanalysis.Analyze(parsed),
+	}, nil, nil
+}
+
+// ListClassScratchAnalysisParams 班级项目分析请求参数
+type ListClassScratchAnalysisParams struct {
+	ClassID  uint      `json:"class_id" uri:"class_id" binding:"required"`
+	Since    time.Time // 只分析这个时间之后修改过的项目，零值表示不限
+	PageSize uint      `json:"page_size" form:"pageSize"` // 每页的学生数，没有可分析项目的学生不计入
+	BeginID  uint      `json:"begin_id" form:"beginID"`   // 从这个学生ID之后开始，即上一页最后一行的 student_id
+}
+
+func (p *ListClassScratchAnalysisParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if value := c.Query("since"); value != "" {
+		since, err := parseTimeQuery(value)
+		if err != nil {
+			return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+		p.Since = since
+	}
+
+	// 每个项目都要读取并分析，一次只处理少量学生
+	p.PageSize = 10
+	if pageSize, err := strconv.ParseUint(c.DefaultQuery("pageSize", "10"), 10, 32); err == nil && pageSize > 0 && pageSize <= 50 {
+		p.PageSize = uint(pageSize)
+	}
+	if beginID, err := strconv.ParseUint(c.DefaultQuery("beginID", "0"), 10, 32); err == nil {
+		p.BeginID = uint(beginID)
+	}
+	return nil
+}
+
+// ClassScratchAnalysisRow 班级项目分析表中的一行，对应一个学生的一个项目
+type ClassScratchAnalysisRow struct {
+	StudentID   uint                   `json:"student_id"`
+	Username    string                 `json:"username"`
+	Nickname    string                 `json:"nickname"`
+	ProjectID   uint                   `json:"project_id"`
+	ProjectName string                 `json:"project_name"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+	Scores      scratchanalysis.Scores `json:"scores"`
+	Total       int                    `json:"total"`
+	Level       string                 `json:"level"`
+	Smells      int                    `json:"smells"`          // 代码问题数
+	Error       string                 `json:"error,omitempty"` // 读取或解析失败的原因
+}
+
+// ListClassScratchAnalysisHandler 按学生分页分析班级学生的 Scratch 项目，按学生和项目列出得分。
+// 每页以有项目的学生结尾，下一页的 beginID 取最后一行的 student_id
+func (h *Handler) ListClassScratchAnalysisHandler(c *gin.Context, params *ListClassScratchAnalysisParams) ([]ClassScratchAnalysisRow, *gorails.ResponseMeta, gorails.Error) {
+	students, err := h.dao.ClassDao.ListStudents(params.ClassID, h.classTeacherID(c))
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	rows := []ClassScratchAnalysisRow{}
+	var count uint
+	hasNext := false
+	for i, student := range students {
+		if student.ID <= params.BeginID {
+			continue
+		}
+		studentRows, gerr := h.analyzeStudentScratchProjects(student, params.Since)
+		if gerr != nil {
+			return nil, nil, gerr
+		}
+		if len(studentRows) == 0 {
+			continue
+		}
+		rows = append(rows, studentRows...)
+		count++
+		if count == params.PageSize {
+			hasNext = i < len(students)-1
+			break
+		}
+	}
+	return rows, &gorails.ResponseMeta{HasNext: hasNext, Total: len(students)}, nil
+}
+
+// analyzeStudentScratchProjects 分析学生在 since 之后修改过的项目，读取或解析失败的项目记录原因
+func (h *Handler) analyzeStudentScratchProjects(student model.User, since time.Time) ([]ClassScratchAnalysisRow, gorails.Error) {
+	rows := []ClassScratchAnalysisRow{}
+	var beginID uint
+	for {
+		projects, hasMore, err := h.dao.ScratchDao.ListProjectsWithPagination(student.ID, 100, beginID, true, true)
+		if err != nil {
+			return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+		}
+		for _, project := range projects {
+			beginID = project.ID
+			// 没有保存过的项目没有内容
+			if project.MD5 == "" || project.UpdatedAt.Before(since) {
+				continue
+			}
+			row := ClassScratchAnalysisRow{
+				StudentID:   student.ID,
+				Username:    student.Username,
+				Nickname:    student.Nickname,
+				ProjectID:   project.ID,
+				ProjectName: project.Name,
+				UpdatedAt:   project.UpdatedAt,
+			}
+			data, err := h.dao.ScratchDao.GetProjectHistory(project.ID, project.MD5)
+			if err == nil {
+				var parsed *mermaid.Project
+				if parsed, err = mermaid.ParseProject(data); err == nil {
+					report := scratchanalysis.Analyze(parsed)
+					row.Scores = report.Scores
+					row.Total = report.Total
+					row.Level = report.Level
+					row.Smells = report.Smells.Count()
+				}
+			}
+			if err != nil {
+				row.Error = err.Error()
+			}
+			rows = append(rows, row)
+		}
+		if !hasMore || len(projects) == 0 {
+			return rows, nil
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// 测试班级项目分析按学生分页，没有项目的学生不占用分页
+func TestHandler_ListClassScratchAnalysisPaging(t *testing.T) {
+	const teacherID uint = 9
+	updatedAt := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+	classDao := new(MockClassDao)
+	classDao.On("ListStudents", uint(1), teacherID).Return([]model.User{{ID: 11}, {ID: 12}, {ID: 13}, {ID: 14}}, nil)
+	scratchDao := new(MockScratchDao)
+	for studentID, projects := range map[uint][]model.ScratchProject{
+		11: {{ID: 101, MD5: "a", UpdatedAt: updatedAt}},
+		12: {{ID: 102, UpdatedAt: updatedAt}}, // 没有保存过
+		13: {{ID: 103, MD5: "c", UpdatedAt: updatedAt}},
+		14: {{ID: 104, MD5: "d", UpdatedAt: updatedAt}},
+	} {
+		scratchDao.On("ListProjectsWithPagination", studentID, uint(100), uint(0), true, true).Return(projects, false, nil)
+	}
+	scratchDao.On("GetProjectHistory", uint(101), "a").Return([]byte(`{"targets":[]}`), nil)
+	scratchDao.On("GetProjectHistory", uint(103), "c").Return([]byte(`{"targets":[]}`), nil)
+	scratchDao.On("GetProjectHistory", uint(104), "d").Return(nil, assert.AnError)
+
+	h := NewHandler(&dao.Dao{ClassDao: classDao, ScratchDao: scratchDao}, nil, zap.NewNop(), &config.Config{})
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(classTeacherIDKey, teacherID)
+
+	rows, meta, gerr := h.ListClassScratchAnalysisHandler(c, &ListClassScratchAnalysisParams{ClassID: 1, PageSize: 2})
+	assert.Nil(t, gerr)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, uint(11), rows[0].StudentID)
+		assert.Equal(t, uint(13), rows[1].StudentID)
+		assert.Empty(t, rows[1].Error)
+	}
+	assert.True(t, meta.HasNext)
+	assert.Equal(t, 4, meta.Total)
+
+	rows, meta, gerr = h.ListClassScratchAnalysisHandler(c, &ListClassScratchAnalysisParams{ClassID: 1, PageSize: 2, BeginID: 13})
+	assert.Nil(t, gerr)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, uint(104), rows[0].ProjectID)
+		assert.NotEmpty(t, rows[0].Error)
+	}
+	assert.False(t, meta.HasNext)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// CollectOrphanAssetsParams 回收未引用资源的请求参数
+type CollectOrphanAssetsParams struct {
+	DryRun bool   `form:"dry_run"` // 只统计不删除
+	MinAge string `form:"min_age"` // 比这个时间更新的资源不回收，如 "24h"，默认 24 小时
+
+	minAge time.Duration
+}
+
+func (p *CollectOrphanAssetsParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	p.minAge = dao.DefaultAssetGCMinAge
+	if p.MinAge != "" {
+		minAge, err := time.ParseDuration(p.MinAge)
+		if err != nil || minAge < 0 {
+			return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+		}
+		p.minAge = minAge
+	}
+	return nil
+}
+
+// CollectOrphanAssetsHandler 回收没有被任何项目历史版本或作业快照引用的 Scratch 资源
+func (h *Handler) CollectOrphanAssetsHandler(c *gin.Context, params *CollectOrphanAssetsParams) (*dao.AssetGCResult, *gorails.ResponseMeta, gorails.Error) {
+	result, err := h.dao.ScratchDao.CollectOrphanAssets(dao.AssetGCOptions{
+		DryRun:        params.DryRun,
+		MinAge:        params.minAge,
+		ReferenceDirs: []string{h.config.Storage.SubmissionsDir()},
+	})
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeDeleteFailed, global.ErrorMsgDeleteFailed, err)
+	}
+	return result, nil, nil
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/mermaid"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// DiffScratchProjectHistoriesParams 比较两个历史版本的请求参数
+type DiffScratchProjectHistoriesParams struct {
+	ProjectID uint   `uri:"id" binding:"required"`
+	From      string `form:"from" binding:"required"` // 旧版本 MD5
+	To        string `form:"to"`                      // 新版本 MD5，为空表示当前版本
+}
+
+func (p *DiffScratchProjectHistoriesParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// DiffScratchProjectHistoriesResponse 比较两个历史版本的响应
+type DiffScratchProjectHistoriesResponse struct {
+	ProjectID uint                 `json:"project_id"`
+	From      string               `json:"from"`
+	To        string               `json:"to"`
+	Diff      *mermaid.ProjectDiff `json:"diff"`
+}
+
+// DiffScratchProjectHistoriesHandler 比较两个历史版本，列出新增、删除和修改的角色、脚本、变量和造型
+func (h *Handler) DiffScratchProjectHistoriesHandler(c *gin.Context, params *DiffScratchProjectHistoriesParams) (*DiffScratchProjectHistoriesResponse, *gorails.ResponseMeta, gorails.Error) {
+	project, gerr := h.getOwnedScratchProject(c, params.ProjectID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	to := params.To
+	if to == "" {
+		to = project.MD5
+	}
+
+	oldProject, gerr := h.loadScratchProjectHistory(project.ID, params.From)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+	newProject, gerr := h.loadScratchProjectHistory(project.ID, to)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	return &DiffScratchProjectHistoriesResponse{
+		ProjectID: project.ID,
+		From:      params.From,
+		To:        to,
+		Diff:      mermaid.DiffProjects(oldProject, newProject),
+	}, nil, nil
+}
+
+// RestoreScratchProjectHistoryParams 恢复历史版本的请求参数
+type RestoreScratchProjectHistoryParams struct {
+	ProjectID uint   `uri:"id" binding:"required"`
+	MD5       string `uri:"md5" binding:"required"`
+}
+
+func (p *RestoreScratchProjectHistoryParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// RestoreScratchProjectHistoryResponse 恢复历史版本的响应
+type RestoreScratchProjectHistoryResponse struct {
+	ProjectID uint      `json:"project_id"`
+	MD5       string    `json:"md5"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RestoreScratchProjectHistoryHandler 把指定的历史版本设为当前版本，其他历史版本保留不变
+func (h *Handler) RestoreScratchProjectHistoryHandler(c *gin.Context, params *RestoreScratchProjectHistoryParams) (*RestoreScratchProjectHistoryResponse, *gorails.ResponseMeta, gorails.Error) {
+	project, gerr := h.getOwnedScratchProject(c, params.ProjectID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	// 受保护的项目不允许修改
+	for _, id := range h.config.Protected.Projects {
+		if project.ID == id {
+			return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, nil)
+		}
+	}
+
+	project, err := h.dao.ScratchDao.RestoreProjectHistory(project.ID, params.MD5)
+	if err != nil {
+		if ge, ok := err.(gorails.Error); ok {
+			return nil, nil, ge
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+
+	return &RestoreScratchProjectHistoryResponse{
+		ProjectID: project.ID,
+		MD5:       project.MD5,
+		UpdatedAt: project.UpdatedAt,
+	}, nil, nil
+}
+
+// getOwnedScratchProject 获取项目，只有项目创建者或管理员可以访问
+func (h *Handler) getOwnedScratchProject(c *gin.Context, projectID uint) (*model.ScratchProject, gorails.Error) {
+	project, err := h.dao.ScratchDao.GetProject(projectID)
+	if err != nil {
+		return nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+	if project.UserID != h.getUserID(c) && !h.hasPermission(c, PermissionManageAll) {
+		return nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeNoPermission, global.ErrorMsgNoPermission, nil)
+	}
+	return project, nil
+}
+
+// loadScratchProjectHistory 读取并解析项目的历史版本
+func (h *Handler) loadScratchProjectHistory(projectID uint, md5 string) (*mermaid.Project, gorails.Error) {
+	data, err := h.dao.ScratchDao.GetProjectHistory(projectID, md5)
+	if err != nil {
+		if ge, ok := err.(gorails.Error); ok {
+			return nil, ge
+		}
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+	}
+	project, err := mermaid.ParseProject(data)
+	if err != nil {
+		return nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeQueryFailed, "解析项目数据失败", err)
+	}
+	return project, nil
+}
@@ -50,34 +50,10 @@ func (h *Handler) CreateScratchProjectHandler(c *gin.Context, params *CreateScra
 	}
 
 	// 添加限流逻辑
-	h.createProjectLimiterLock.Lock()
-	now := time.Now()
-
-	// 获取用户的调用记录
-	times, exists := h.createProjectLimiter[userID]
-	if !exists {
-		times = []time.Time{}
-	}
-
-	// 清理3分钟前的记录
-	var validTimes []time.Time
-	for _, t := range times {
-		if now.Sub(t) < 3*time.Minute {
-			validTimes = append(validTimes, t)
-		}
-	}
-
-	// 检查是否超过限制（3分钟内最多3次）
-	if len(validTimes) >= h.config.ScratchEditor.CreateProjectLimiter {
-		h.createProjectLimiterLock.Unlock()
+	if !h.allowCreateProject(userID) {
 		return nil, nil, gorails.NewError(http.StatusTooManyRequests, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeTooManyRequests, global.ErrorMsgTooManyRequests, nil)
 	}
 
-	// 添加当前时间到记录中
-	validTimes = append(validTimes, now)
-	h.createProjectLimiter[userID] = validTimes
-	h.createProjectLimiterLock.Unlock()
-
 	// 序列化数据
 	jsonData, err := json.Marshal(params.Data)
 	if err != nil {
@@ -96,6 +72,31 @@ func (h *Handler) CreateScratchProjectHandler(c *gin.Context, params *CreateScra
 	}, nil, nil
 }
 
+// allowCreateProject 检查用户 3 分钟内创建项目的次数是否超过限制，未超过时记录本次创建
+func (h *Handler) allowCreateProject(userID uint) bool {
+	h.createProjectLimiterLock.Lock()
+	defer h.createProjectLimiterLock.Unlock()
+	now := time.Now()
+
+	// 清理3分钟前的记录
+	var validTimes []time.Time
+	for _, t := range h.createProjectLimiter[userID] {
+		if now.Sub(t) < 3*time.Minute {
+			validTimes = append(validTimes, t)
+		}
+	}
+
+	// 检查是否超过限制（3分钟内最多3次）
+	if len(validTimes) >= h.config.ScratchEditor.CreateProjectLimiter {
+		h.createProjectLimiter[userID] = validTimes
+		return false
+	}
+
+	// 添加当前时间到记录中
+	h.createProjectLimiter[userID] = append(validTimes, now)
+	return true
+}
+
 func RenderCreateScratchProjectResponse(c *gin.Context, response *CreateScratchProjectResponse, meta *gorails.ResponseMeta) {
 	c.JSON(http.StatusOK, response)
 }
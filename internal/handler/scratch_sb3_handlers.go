@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/mermaid"
+	"github.com/jun/fun_code/internal/sb3"
+	"github.com/mail2fish/gorails/gorails"
+	"go.uber.org/zap"
+)
+
+// maxSB3UploadSize 上传的 .sb3 文件的最大大小
+const maxSB3UploadSize = 50 << 20
+
+// ImportScratchSB3Params 导入 .sb3 文件请求参数
+type ImportScratchSB3Params struct {
+	File *multipart.FileHeader
+	Name string // 项目名称，为空时使用文件名
+}
+
+func (p *ImportScratchSB3Params) Parse(c *gin.Context) gorails.Error {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSB3UploadSize)
+	file, err := c.FormFile("file")
+	if err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	p.File = file
+	p.Name = strings.TrimSpace(c.PostForm("name"))
+	if p.Name == "" {
+		p.Name = mermaid.ExtractFileName(file.Filename)
+	}
+	return nil
+}
+
+// ImportScratchSB3Response 导入 .sb3 文件响应
+type ImportScratchSB3Response struct {
+	ProjectID      uint     `json:"project_id"`
+	Name           string   `json:"name"`
+	AssetsImported int      `json:"assets_imported"` // 新保存的资源数，已经存在的资源不重复保存
+	MissingAssets  []string `json:"missing_assets"`  // 项目引用了但文件中没有、服务器上也没有或文件名不合法的资源
+}
+
+// ImportScratchSB3Handler 导入离线编辑器保存的 .sb3 文件，创建新的 Scratch 项目
+func (h *Handler) ImportScratchSB3Handler(c *gin.Context, params *ImportScratchSB3Params) (*ImportScratchSB3Response, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.getUserID(c)
+	if userID == 0 {
+		return nil, nil, gorails.NewError(http.StatusUnauthorized, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeUnauthorized, global.ErrorMsgUnauthorized, nil)
+	}
+	if !h.allowCreateProject(userID) {
+		return nil, nil, gorails.NewError(http.StatusTooManyRequests, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeTooManyRequests, global.ErrorMsgTooManyRequests, nil)
+	}
+
+	file, err := params.File.Open()
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+	}
+	defer file.Close()
+	archive, err := sb3.Read(file, params.File.Size)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if _, err := mermaid.ParseProject(archive.Project); err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, "解析项目数据失败", err)
+	}
+	names, err := sb3.AssetNames(archive.Project)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, "解析项目数据失败", err)
+	}
+
+	// 只保存项目引用的资源，服务器上已有的资源不重复保存
+	response := &ImportScratchSB3Response{Name: params.Name, MissingAssets: []string{}}
+	for _, name := range names {
+		// 文件名来自上传的 project.json，不合法的名称不能拿去拼接存储路径
+		if !sb3.IsAssetName(name) {
+			response.MissingAssets = append(response.MissingAssets, name)
+			continue
+		}
+		if h.scratchAssetExists(name) {
+			continue
+		}
+		data, ok := archive.Assets[name]
+		if !ok {
+			response.MissingAssets = append(response.MissingAssets, name)
+			continue
+		}
+		if gerr := h.saveScratchAsset(userID, name, data); gerr != nil {
+			return nil, nil, gerr
+		}
+		response.AssetsImported++
+	}
+
+	projectID, err := h.dao.ScratchDao.SaveProject(userID, 0, params.Name, archive.Project)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeCreateFailed, global.ErrorMsgCreateFailed, err)
+	}
+	response.ProjectID = projectID
+	return response, nil, nil
+}
+
+// ExportScratchSB3Params 导出 .sb3 文件请求参数
+type ExportScratchSB3Params struct {
+	ProjectID uint   `uri:"id" binding:"required"`
+	MD5       string `form:"md5"` // 历史版本的 MD5，为空表示当前版本
+}
+
+func (p *ExportScratchSB3Params) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// ExportScratchSB3Handler 把项目或历史版本连同引用的造型和声音导出为 .sb3 文件，可以用离线编辑器打开
+func (h *Handler) ExportScratchSB3Handler(c *gin.Context, params *ExportScratchSB3Params) ([]byte, *gorails.ResponseMeta, gorails.Error) {
+	project, gerr := h.getOwnedScratchProject(c, params.ProjectID)
+	if gerr != nil {
+		return nil, nil, gerr
+	}
+
+	md5 := params.MD5
+	if md5 == "" {
+		md5 = project.MD5
+	}
+	if md5 == "" {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeFileNotFound, global.ErrorMsgFileNotFound, errors.New("项目还没有保存过"))
+	}
+	data, err := h.dao.ScratchDao.GetProjectHistory(project.ID, md5)
+	if err != nil {
+		if ge, ok := err.(gorails.Error); ok {
+			return nil, nil, ge
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+	}
+
+	var buf bytes.Buffer
+	missing, err := sb3.Write(&buf, data, h.readScratchAsset)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_SCRATCH, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+	}
+	// 缺少资源时离线编辑器仍然可以打开项目，对应的造型和声音为空
+	if len(missing) > 0 && h.logger != nil {
+		h.logger.Warn("导出 sb3 时缺少资源", zap.Uint("project_id", project.ID), zap.String("md5", md5), zap.Strings("assets", missing))
+	}
+
+	c.Header("Content-Type", "application/x.scratch.sb3")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"project_%d.sb3\"; filename*=UTF-8''%s", project.ID, url.PathEscape(project.Name+".sb3")))
+	return buf.Bytes(), nil, nil
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/model"
+	"github.com/jun/fun_code/internal/sb3"
+	"github.com/mail2fish/gorails/gorails"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+// 测试导入 .sb3 保存引用的资源并创建项目，导出时把资源重新打包
+func TestHandler_ScratchSB3ImportExport(t *testing.T) {
+	const userID uint = 7
+	basePath := t.TempDir()
+
+	costume := []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+	sum := md5.Sum(costume)
+	costumeName := hex.EncodeToString(sum[:]) + ".svg"
+	missingName := "0123456789abcdef0123456789abcdef.wav"
+	// 不合法的文件名拼接出的路径在资源目录之外，即使那里有文件也不能当作已有的资源
+	outsideName := "../secret.txt"
+	outsidePath := scratchAssetPath(basePath, outsideName)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(outsidePath), 0755))
+	assert.NoError(t, os.WriteFile(outsidePath, []byte("secret"), 0644))
+	project := []byte(`{"targets":[{"isStage":true,"name":"Stage","blocks":{},"costumes":[{"name":"背景","assetId":"` + costumeName[:32] + `","md5ext":"` + costumeName + `","dataFormat":"svg"}],` +
+		`"sounds":[{"name":"啵","md5ext":"` + missingName + `","dataFormat":"wav"},{"name":"秘密","md5ext":"` + outsideName + `","dataFormat":"wav"}]}]}`)
+
+	var sb3File bytes.Buffer
+	zw := zip.NewWriter(&sb3File)
+	for name, content := range map[string][]byte{sb3.ProjectFile: project, costumeName: costume} {
+		fw, err := zw.Create(name)
+		assert.NoError(t, err)
+		fw.Write(content)
+	}
+	assert.NoError(t, zw.Close())
+
+	scratchDao := new(MockScratchDao)
+	scratchDao.On("GetScratchBasePath").Return(basePath)
+	scratchDao.On("SaveProject", userID, uint(0), "我的作品", project).Return(uint(3), nil).Once()
+	scratchDao.On("GetProject", uint(3)).Return(&model.ScratchProject{ID: 3, UserID: userID, Name: "我的作品", MD5: "abc"}, nil)
+	scratchDao.On("GetProjectHistory", uint(3), "abc").Return(project, nil)
+	userAssetDao := new(MockUserAssetDao)
+	userAssetDao.On("CreateUserAsset", mock.MatchedBy(func(asset *model.UserAsset) bool {
+		return asset.UserID == userID && asset.AssetID == costumeName && asset.AssetType == "image/svg+xml"
+	})).Return(nil).Once()
+
+	cfg := &config.Config{}
+	cfg.ScratchEditor.CreateProjectLimiter = 3
+	h := NewHandler(&dao.Dao{ScratchDao: scratchDao, UserAssetDao: userAssetDao}, nil, zap.NewNop(), cfg)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", userID)
+	})
+	r.POST("/scratch/projects/import", gorails.Wrap(h.ImportScratchSB3Handler, nil))
+	r.GET("/scratch/projects/:id/sb3", gorails.Wrap(h.ExportScratchSB3Handler, RenderAttachment))
+
+	// 导入
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "我的作品.sb3")
+	assert.NoError(t, err)
+	fw.Write(sb3File.Bytes())
+	assert.NoError(t, mw.Close())
+	req := httptest.NewRequest(http.MethodPost, "/scratch/projects/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data ImportScratchSB3Response `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, uint(3), resp.Data.ProjectID)
+	assert.Equal(t, 1, resp.Data.AssetsImported)
+	assert.Equal(t, []string{outsideName, missingName}, resp.Data.MissingAssets)
+	saved, err := os.ReadFile(scratchAssetPath(basePath, costumeName))
+	assert.NoError(t, err)
+	assert.Equal(t, costume, saved)
+
+	// 导出
+	req = httptest.NewRequest(http.MethodGet, "/scratch/projects/3/sb3", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x.scratch.sb3", w.Header().Get("Content-Type"))
+	archive, err := sb3.Read(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, project, archive.Project)
+	assert.Equal(t, map[string][]byte{costumeName: costume}, archive.Assets)
+
+	scratchDao.AssertExpectations(t)
+	userAssetDao.AssertExpectations(t)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// ListMySessionsParams 列出我的登录会话请求参数
+type ListMySessionsParams struct {
+}
+
+func (p *ListMySessionsParams) Parse(c *gin.Context) gorails.Error {
+	return nil
+}
+
+// SessionResponse 登录会话信息
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // 是否是发出本次请求的会话
+}
+
+// ListMySessionsResponse 列出我的登录会话响应
+type ListMySessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// ListMySessionsHandler 列出当前用户在各个设备上的登录会话
+func (h *Handler) ListMySessionsHandler(c *gin.Context, params *ListMySessionsParams) (*ListMySessionsResponse, *gorails.ResponseMeta, gorails.Error) {
+	sessions, err := h.dao.AuthDao.ListSessions(h.getUserID(c))
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	current := c.GetString("sessionID")
+	response := &ListMySessionsResponse{Sessions: make([]SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, SessionResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.SessionID == current,
+		})
+	}
+	return response, nil, nil
+}
+
+// RevokeMySessionParams 注销我的一个登录会话请求参数
+type RevokeMySessionParams struct {
+	ID uint `uri:"id" binding:"required"`
+}
+
+func (p *RevokeMySessionParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// RevokeSessionsResponse 注销会话响应
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"` // 注销的会话数
+}
+
+// RevokeMySessionHandler 注销当前用户的一个登录会话，对应设备需要重新登录
+func (h *Handler) RevokeMySessionHandler(c *gin.Context, params *RevokeMySessionParams) (*RevokeSessionsResponse, *gorails.ResponseMeta, gorails.Error) {
+	if err := h.dao.AuthDao.RevokeSession(h.getUserID(c), params.ID); err != nil {
+		if ge, ok := err.(gorails.Error); ok {
+			return nil, nil, ge
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+	return &RevokeSessionsResponse{Revoked: 1}, nil, nil
+}
+
+// RevokeClassSessionsParams 注销班级所有成员会话请求参数
+type RevokeClassSessionsParams struct {
+	ClassID uint `uri:"class_id" binding:"required"`
+}
+
+func (p *RevokeClassSessionsParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// RevokeClassSessionsHandler 让班级中除自己以外的所有成员在所有设备上退出登录，用于考试前统一重新登录
+func (h *Handler) RevokeClassSessionsHandler(c *gin.Context, params *RevokeClassSessionsParams) (*RevokeSessionsResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.getUserID(c)
+
+	students, err := h.dao.ClassDao.ListStudents(params.ClassID, h.classTeacherID(c))
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	userIDs := make([]uint, 0, len(students))
+	for _, student := range students {
+		if student.ID != userID {
+			userIDs = append(userIDs, student.ID)
+		}
+	}
+
+	revoked, err := h.dao.AuthDao.RevokeUserSessions(userIDs)
+	if err != nil {
+		if ge, ok := err.(gorails.Error); ok {
+			return nil, nil, ge
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+	return &RevokeSessionsResponse{Revoked: revoked}, nil, nil
+}
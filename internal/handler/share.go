@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jun/fun_code/internal/dao"
 	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/model"
 	"github.com/jun/fun_code/web"
 	"github.com/mail2fish/gorails/gorails"
 	"go.uber.org/zap"
@@ -74,6 +75,10 @@ func (h *Handler) CreateShareHandler(c *gin.Context, params *CreateShareParams)
 		if err != nil {
 			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_THIRD_PARTY, MODULE_SHARE, 3, "重新分享失败", err)
 		}
+		resharedShare := *share
+		resharedShare.Title, resharedShare.Description = params.Title, params.Description
+		resharedShare.ViewCount, resharedShare.IsActive = 0, true
+		h.audit(c, model.AuditActionCreateShare, model.AuditResourceShare, auditID(share.ID), share, &resharedShare)
 		return &CreateShareResponse{
 			ShareToken: share.ShareToken,
 			Title:      share.Title,
@@ -86,6 +91,7 @@ func (h *Handler) CreateShareHandler(c *gin.Context, params *CreateShareParams)
 	if err != nil {
 		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_THIRD_PARTY, MODULE_SHARE, 3, "创建分享失败", err)
 	}
+	h.audit(c, model.AuditActionCreateShare, model.AuditResourceShare, auditID(share.ID), nil, share)
 
 	// 返回响应
 	return &CreateShareResponse{
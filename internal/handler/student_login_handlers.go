@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/qrcode"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+// pictureLoginEmoji 打印登录卡时图标对应的 emoji，与 dao.PictureLoginIcons 对应
+var pictureLoginEmoji = map[string]string{
+	"cat":    "🐱",
+	"dog":    "🐶",
+	"rabbit": "🐰",
+	"fish":   "🐟",
+	"bird":   "🐦",
+	"sun":    "☀️",
+	"star":   "⭐",
+	"flower": "🌸",
+	"apple":  "🍎",
+}
+
+// ===== 学生端：图片密码和二维码登录卡 =====
+
+// GetPictureLoginClassParams 获取图片登录页面信息请求参数
+type GetPictureLoginClassParams struct {
+	Code string `uri:"code" binding:"required"`
+}
+
+func (p *GetPictureLoginClassParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// PictureLoginStudent 登录页上可以选择的学生
+type PictureLoginStudent struct {
+	ID       uint   `json:"id"`
+	Nickname string `json:"nickname"`
+}
+
+// GetPictureLoginClassResponse 图片登录页面信息
+type GetPictureLoginClassResponse struct {
+	ClassName      string                `json:"class_name"`
+	Icons          []string              `json:"icons"`           // 按顺序排成 3x3 的图标
+	PasswordLength int                   `json:"password_length"` // 需要选中的图标数
+	Students       []PictureLoginStudent `json:"students"`
+}
+
+// GetPictureLoginClassHandler 返回班级图片登录页需要的学生名单和图标
+func (h *Handler) GetPictureLoginClassHandler(c *gin.Context, params *GetPictureLoginClassParams) (*GetPictureLoginClassResponse, *gorails.ResponseMeta, gorails.Error) {
+	class, students, err := h.dao.AuthDao.GetPictureLoginClass(params.Code)
+	if err != nil {
+		if errors.Is(err, dao.ErrPictureLoginDisabled) {
+			return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	response := &GetPictureLoginClassResponse{
+		ClassName:      class.Name,
+		Icons:          dao.PictureLoginIcons,
+		PasswordLength: dao.PicturePasswordLength,
+		Students:       make([]PictureLoginStudent, len(students)),
+	}
+	for i, student := range students {
+		// 没有昵称的学生按ID显示，不在登录页公开用户名
+		nickname := student.Nickname
+		if nickname == "" {
+			nickname = h.TWithData("picture_login.unnamed_student", c, map[string]interface{}{"ID": student.ID})
+		}
+		response.Students[i] = PictureLoginStudent{ID: student.ID, Nickname: nickname}
+	}
+	return response, nil, nil
+}
+
+// PictureLoginParams 图片密码登录请求参数
+type PictureLoginParams struct {
+	Code   string `json:"code" binding:"required"`
+	UserID uint   `json:"user_id" binding:"required"`
+	Icons  []int  `json:"icons" binding:"required"` // 选中图标的下标
+}
+
+func (p *PictureLoginParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// PictureLoginHandler 学生选中自己的名字和图片密码登录，得到与密码登录相同的令牌和会话
+func (h *Handler) PictureLoginHandler(c *gin.Context, params *PictureLoginParams) (*LoginResponse, *gorails.ResponseMeta, gorails.Error) {
+	loginResponse, err := h.dao.AuthDao.PictureLogin(params.Code, params.UserID, params.Icons, dao.SessionClient{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		if errors.Is(err, dao.ErrPictureLoginDisabled) {
+			return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+		}
+		return nil, nil, loginError(c, err)
+	}
+
+	setLoginCookies(c, loginResponse)
+
+	return &LoginResponse{
+		Token:              loginResponse.Token,
+		Role:               loginResponse.Role,
+		ExpiresIn:          loginResponse.ExpiresIn,
+		RefreshToken:       loginResponse.RefreshToken,
+		MustChangePassword: loginResponse.MustChangePassword,
+	}, nil, nil
+}
+
+// BadgeLoginParams 登录卡登录请求参数
+type BadgeLoginParams struct {
+	Token string `form:"token" binding:"required"`
+}
+
+func (p *BadgeLoginParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_AUTH, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+// BadgeLoginHandler 扫描登录卡上的二维码打开此链接，登录后跳转到首页
+func (h *Handler) BadgeLoginHandler(c *gin.Context, params *BadgeLoginParams) (*LoginResponse, *gorails.ResponseMeta, gorails.Error) {
+	loginResponse, err := h.dao.AuthDao.BadgeLogin(params.Token, dao.SessionClient{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	})
+	if err != nil {
+		return nil, nil, loginError(c, err)
+	}
+
+	setLoginCookies(c, loginResponse)
+
+	return &LoginResponse{
+		Token:     loginResponse.Token,
+		Role:      loginResponse.Role,
+		ExpiresIn: loginResponse.ExpiresIn,
+	}, nil, nil
+}
+
+// RenderLoginRedirect 登录成功后跳转到首页，令牌已经写在 cookie 中
+func RenderLoginRedirect(c *gin.Context, response *LoginResponse, meta *gorails.ResponseMeta) {
+	c.Redirect(http.StatusFound, "/")
+}
+
+// ===== 教师端：开启图片登录和打印登录卡 =====
+
+// UpdateClassPictureLoginParams 开启或关闭图片登录请求参数
+type UpdateClassPictureLoginParams struct {
+	ClassID uint  `json:"-" uri:"class_id"`
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+func (p *UpdateClassPictureLoginParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.ClassID == 0 {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, nil)
+	}
+	return nil
+}
+
+// UpdateClassPictureLoginResponse 开启或关闭图片登录响应
+type UpdateClassPictureLoginResponse struct {
+	Message string `json:"message"`
+}
+
+// UpdateClassPictureLoginHandler 开启或关闭班级的图片密码和登录卡登录，关闭后已打印的登录卡也不能使用
+func (h *Handler) UpdateClassPictureLoginHandler(c *gin.Context, params *UpdateClassPictureLoginParams) (*UpdateClassPictureLoginResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.classTeacherID(c)
+
+	if err := h.dao.ClassDao.UpdateClass(params.ClassID, userID, map[string]interface{}{"picture_login": *params.Enabled}); err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+
+	if *params.Enabled {
+		return &UpdateClassPictureLoginResponse{Message: "已开启图片登录"}, nil, nil
+	}
+	return &UpdateClassPictureLoginResponse{Message: "已关闭图片登录"}, nil, nil
+}
+
+// StudentLoginCardsParams 生成登录卡请求参数
+type StudentLoginCardsParams struct {
+	ClassID    uint   `json:"-" uri:"class_id"`
+	StudentIDs []uint `json:"student_ids"` // 为空表示班级所有学生
+	Picture    bool   `json:"picture"`     // 重新生成图片密码
+	Badge      bool   `json:"badge"`       // 重新生成二维码登录卡
+}
+
+func (p *StudentLoginCardsParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.ClassID == 0 || (!p.Picture && !p.Badge) {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("picture 和 badge 至少选一个"))
+	}
+	return nil
+}
+
+// loginCard 打印在登录卡上的内容
+type loginCard struct {
+	Nickname string
+	Pictures []string
+	QRCode   template.HTML
+}
+
+var loginCardsTmpl = template.Must(template.New("login_cards").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 16px; }
+h1 { font-size: 18px; }
+.sheet { display: grid; grid-template-columns: repeat(3, 1fr); gap: 8px; }
+.card { border: 1px dashed #999; padding: 12px; text-align: center; page-break-inside: avoid; }
+.card .name { font-size: 20px; font-weight: bold; margin-bottom: 6px; }
+.card .pictures { font-size: 40px; letter-spacing: 8px; }
+@media print { h1 { display: none; } body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="sheet">
+{{range .Cards}}<div class="card">
+<div class="name">{{.Nickname}}</div>
+{{if .Pictures}}<div class="pictures">{{range .Pictures}}<span>{{.}}</span>{{end}}</div>{{end}}
+{{if .QRCode}}<div class="qrcode">{{.QRCode}}</div>{{end}}
+</div>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// StudentLoginCardsHandler 重新生成学生的图片密码和（或）登录卡，并返回可打印的卡片，
+// 每个学生一张，旧的图片密码和登录卡立即失效
+func (h *Handler) StudentLoginCardsHandler(c *gin.Context, params *StudentLoginCardsParams) (*TemplateRenderResponse, *gorails.ResponseMeta, gorails.Error) {
+	userID := h.classTeacherID(c)
+
+	class, err := h.dao.ClassDao.GetClass(params.ClassID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+
+	cards, err := h.dao.ClassDao.ResetStudentLogins(params.ClassID, userID, params.StudentIDs, params.Picture, params.Badge)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeUpdateFailed, global.ErrorMsgUpdateFailed, err)
+	}
+
+	badgeURL := requestBaseURL(c) + "/api/auth/badge_login?token="
+	printed := make([]loginCard, len(cards))
+	for i, card := range cards {
+		printed[i].Nickname = card.User.Nickname
+		if printed[i].Nickname == "" {
+			printed[i].Nickname = card.User.Username
+		}
+		for _, icon := range card.Picture {
+			printed[i].Pictures = append(printed[i].Pictures, pictureLoginEmoji[dao.PictureLoginIcons[icon]])
+		}
+		if card.BadgeToken != "" {
+			code, err := qrcode.Encode(badgeURL + url.QueryEscape(card.BadgeToken))
+			if err != nil {
+				return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_CLASS, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+			}
+			printed[i].QRCode = template.HTML(code.SVG(160))
+		}
+	}
+
+	return &TemplateRenderResponse{Tmpl: loginCardsTmpl, Data: map[string]interface{}{
+		"Title": class.Name + " 登录卡",
+		"Cards": printed,
+	}}, nil, nil
+}
+
+// requestBaseURL 根据请求推算站点地址，经过反向代理时使用 X-Forwarded-Proto
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/dao"
 	"github.com/jun/fun_code/internal/global"
 	"github.com/jun/fun_code/internal/model"
 	"github.com/mail2fish/gorails/gorails"
@@ -19,6 +20,8 @@ type CreateUserParams struct {
 	Password string `json:"password" binding:"required"`
 	Email    string `json:"email"`
 	Role     string `json:"role"`
+	// MustChangePassword 设置的是临时密码，用户首次登录后必须修改
+	MustChangePassword bool `json:"must_change_password"`
 }
 
 func (p *CreateUserParams) Parse(c *gin.Context) gorails.Error {
@@ -37,15 +40,46 @@ type CreateUserResponse struct {
 	Role     string `json:"role"`
 }
 
+// checkRoleExists 检查要设置的角色是否存在，为空表示使用默认角色或不修改
+func (h *Handler) checkRoleExists(role string) gorails.Error {
+	if role == "" {
+		return nil
+	}
+	exists, err := h.dao.RoleDao.RoleExists(role)
+	if err != nil {
+		return gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+	if !exists {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, dao.ErrRoleNotFound)
+	}
+	return nil
+}
+
+// checkPasswordPolicy 管理员设置的密码同样要符合密码策略
+func (h *Handler) checkPasswordPolicy(password string) gorails.Error {
+	if err := h.dao.PasswordDao.CheckPolicy(password); err != nil {
+		return passwordError(err)
+	}
+	return nil
+}
+
 // CreateUserHandler 创建用户 gorails.Wrap 形式
 func (h *Handler) CreateUserHandler(c *gin.Context, params *CreateUserParams) (*CreateUserResponse, *gorails.ResponseMeta, gorails.Error) {
+	if gerr := h.checkRoleExists(params.Role); gerr != nil {
+		return nil, nil, gerr
+	}
+	if gerr := h.checkPasswordPolicy(params.Password); gerr != nil {
+		return nil, nil, gerr
+	}
+
 	// 构造用户模型
 	user := &model.User{
-		Username: params.Username,
-		Nickname: params.Nickname,
-		Password: params.Password,
-		Email:    params.Email,
-		Role:     params.Role,
+		Username:           params.Username,
+		Nickname:           params.Nickname,
+		Password:           params.Password,
+		Email:              params.Email,
+		Role:               params.Role,
+		MustChangePassword: params.MustChangePassword,
 	}
 
 	// 如果 Nickname 为空，则使用 Username 作为 Nickname
@@ -133,6 +167,8 @@ type UserResponse struct {
 	Nickname  string         `gorm:"size:50" json:"nickname"`
 	Email     string         `gorm:"size:100" json:"email"`
 	Role      string         `gorm:"size:20;default:'student'" json:"role"` // 用户角色: admin, teacher, student
+
+	MustChangePassword bool `json:"must_change_password,omitempty"` // 需要先修改密码
 }
 
 // ListUsersHandler 列出用户 gorails.Wrap 形式
@@ -185,6 +221,8 @@ type UpdateUserParams struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
+	// MustChangePassword 为 true 时用户下次登录后必须修改密码，不传表示不变
+	MustChangePassword *bool `json:"must_change_password"`
 }
 
 func (p *UpdateUserParams) Parse(c *gin.Context) gorails.Error {
@@ -201,15 +239,25 @@ func (p *UpdateUserParams) Parse(c *gin.Context) gorails.Error {
 
 // UpdateUserResponse 更新用户响应
 type UpdateUserResponse struct {
-	ID       uint   `json:"id"`
-	Username string `json:"username"`
-	Nickname string `json:"nickname"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
+	ID                 uint   `json:"id"`
+	Username           string `json:"username"`
+	Nickname           string `json:"nickname"`
+	Email              string `json:"email"`
+	Role               string `json:"role"`
+	MustChangePassword bool   `json:"must_change_password"`
 }
 
 // UpdateUserHandler 更新用户 gorails.Wrap 形式
 func (h *Handler) UpdateUserHandler(c *gin.Context, params *UpdateUserParams) (*UpdateUserResponse, *gorails.ResponseMeta, gorails.Error) {
+	if gerr := h.checkRoleExists(params.Role); gerr != nil {
+		return nil, nil, gerr
+	}
+	if params.Password != "" {
+		if gerr := h.checkPasswordPolicy(params.Password); gerr != nil {
+			return nil, nil, gerr
+		}
+	}
+
 	// 构建更新参数
 	updates := make(map[string]interface{})
 	if params.Username != "" {
@@ -227,6 +275,19 @@ func (h *Handler) UpdateUserHandler(c *gin.Context, params *UpdateUserParams) (*
 	if params.Role != "" {
 		updates["role"] = params.Role
 	}
+	if params.MustChangePassword != nil {
+		updates["must_change_password"] = *params.MustChangePassword
+	}
+
+	// 修改角色时记录原来的角色
+	var oldRole string
+	if params.Role != "" {
+		before, err := h.dao.UserDao.GetUserByID(params.UserID)
+		if err != nil {
+			return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+		}
+		oldRole = before.Role
+	}
 
 	// 调用服务层更新用户
 	err := h.dao.UserDao.UpdateUser(params.UserID, updates)
@@ -243,6 +304,18 @@ func (h *Handler) UpdateUserHandler(c *gin.Context, params *UpdateUserParams) (*
 		msg := h.i18n.Translate("user.update_failed", lang)
 		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeUserUpdateFailed, msg, err)
 	}
+	// 管理员重置密码后注销该用户所有设备上的登录，旧的刷新令牌也不能再用
+	if params.Password != "" {
+		if _, err := h.dao.AuthDao.RevokeUserSessions([]uint{params.UserID}); err != nil {
+			return nil, nil, passwordError(err)
+		}
+	}
+	if params.Role != "" {
+		h.invalidatePermissions()
+		if oldRole != params.Role {
+			h.audit(c, model.AuditActionSetUserRole, model.AuditResourceUser, auditID(params.UserID), gin.H{"role": oldRole}, gin.H{"role": params.Role})
+		}
+	}
 
 	// 获取更新后的用户信息
 	user, err := h.dao.UserDao.GetUserByID(params.UserID)
@@ -256,6 +329,7 @@ func (h *Handler) UpdateUserHandler(c *gin.Context, params *UpdateUserParams) (*
 	response.Nickname = user.Nickname
 	response.Email = user.Email
 	response.Role = user.Role
+	response.MustChangePassword = user.MustChangePassword
 
 	return response, nil, nil
 }
@@ -274,11 +348,12 @@ func (p *GetUserParams) Parse(c *gin.Context) gorails.Error {
 
 // GetUserResponse 获取用户信息响应
 type GetUserResponse struct {
-	ID       uint   `json:"id"`
-	Username string `json:"username"`
-	Nickname string `json:"nickname"`
-	Email    string `json:"email"`
-	Role     string `json:"role"`
+	ID                 uint   `json:"id"`
+	Username           string `json:"username"`
+	Nickname           string `json:"nickname"`
+	Email              string `json:"email"`
+	Role               string `json:"role"`
+	MustChangePassword bool   `json:"must_change_password"`
 }
 
 // GetUserHandler 获取用户信息 gorails.Wrap 形式
@@ -300,6 +375,7 @@ func (h *Handler) GetUserHandler(c *gin.Context, params *GetUserParams) (*GetUse
 	response.Nickname = user.Nickname
 	response.Email = user.Email
 	response.Role = user.Role
+	response.MustChangePassword = user.MustChangePassword
 
 	return response, nil, nil
 }
@@ -374,13 +450,21 @@ func (h *Handler) SetUserRole(c *gin.Context) {
 	}
 
 	// 验证角色是否有效
-	if req.Role != RoleAdmin && req.Role != RoleTeacher && req.Role != RoleStudent {
+	if exists, err := h.dao.RoleDao.RoleExists(req.Role); err != nil || !exists {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "无效的角色",
 		})
 		return
 	}
 
+	user, err := h.dao.UserDao.GetUserByID(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "用户不存在",
+		})
+		return
+	}
+
 	// 更新用户角色
 	updates := map[string]interface{}{
 		"role": req.Role,
@@ -392,6 +476,8 @@ func (h *Handler) SetUserRole(c *gin.Context) {
 		})
 		return
 	}
+	h.invalidatePermissions()
+	h.audit(c, model.AuditActionSetUserRole, model.AuditResourceUser, auditID(req.UserID), gin.H{"role": user.Role}, gin.H{"role": req.Role})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "用户角色设置成功",
@@ -407,24 +493,18 @@ func (h *Handler) GetCurrentUserPermissions(c *gin.Context) {
 		return
 	}
 
-	// 获取用户信息
-	user, err := h.dao.UserDao.GetUserByID(userID)
+	// 获取用户角色和对应的权限
+	permissions, err := h.userPermissions(c)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "获取用户信息失败: " + err.Error(),
+			"error": "获取角色权限失败: " + err.Error(),
 		})
 		return
 	}
 
-	// 获取用户角色对应的权限
-	permissions, exists := rolePermissions[user.Role]
-	if !exists {
-		permissions = []string{}
-	}
-
 	c.JSON(http.StatusOK, gin.H{
-		"role":        user.Role,
-		"permissions": permissions,
+		"role":        permissions.Role,
+		"permissions": permissions.Permissions,
 	})
 }
 
@@ -448,6 +528,7 @@ func (h *Handler) GetCurrentUserHandler(c *gin.Context, params *gorails.EmptyPar
 	response.Nickname = user.Nickname
 	response.Email = user.Email
 	response.Role = user.Role
+	response.MustChangePassword = user.MustChangePassword
 
 	return response, nil, nil
 }
@@ -0,0 +1,378 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jun/fun_code/internal/csvutil"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/jun/fun_code/internal/global"
+	"github.com/jun/fun_code/internal/xlsx"
+	"github.com/mail2fish/gorails/gorails"
+)
+
+const (
+	// maxUserImportRows 单次导入的最大行数
+	maxUserImportRows = 1000
+	// initialPasswordLength 自动生成的初始密码长度
+	initialPasswordLength = 6
+	// initialPasswordChars 初始密码字符集，去掉了容易混淆的 0/o、1/l/i 等字符，方便低年级学生输入
+	initialPasswordChars = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// userImportColumns 导入文件的表头，支持中英文两种写法
+var userImportColumns = map[string]string{
+	"username":   "username",
+	"用户名":        "username",
+	"nickname":   "nickname",
+	"昵称":         "nickname",
+	"password":   "password",
+	"密码":         "password",
+	"email":      "email",
+	"邮箱":         "email",
+	"class_code": "class_code",
+	"班级邀请码":      "class_code",
+}
+
+// ImportUsersParams 批量导入用户请求参数
+type ImportUsersParams struct {
+	File   *multipart.FileHeader
+	DryRun bool
+}
+
+func (p *ImportUsersParams) Parse(c *gin.Context) gorails.Error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	p.File = file
+	p.DryRun, _ = strconv.ParseBool(c.PostForm("dry_run"))
+	return nil
+}
+
+// ImportedAccount 导入成功的账号及初始密码
+type ImportedAccount struct {
+	ID        uint   `json:"id"`
+	Username  string `json:"username"`
+	Nickname  string `json:"nickname"`
+	Password  string `json:"password"`
+	ClassCode string `json:"class_code"`
+}
+
+// ImportUsersResponse 批量导入用户响应
+type ImportUsersResponse struct {
+	DryRun   bool                     `json:"dry_run"`
+	Total    int                      `json:"total"`
+	Created  int                      `json:"created"`
+	Errors   []dao.UserImportRowError `json:"errors"`
+	Accounts []ImportedAccount        `json:"accounts,omitempty"` // 仅在导入成功时返回，用于打印初始密码
+}
+
+// ImportUsersHandler 通过 CSV 或 XLSX 文件批量导入学生
+// 任意一行校验失败时不会创建任何用户；dry_run=true 时只校验不写入。
+// 密码列为空时自动生成初始密码，导入成功后在响应中返回，供打印密码条使用
+func (h *Handler) ImportUsersHandler(c *gin.Context, params *ImportUsersParams) (*ImportUsersResponse, *gorails.ResponseMeta, gorails.Error) {
+	table, err := readUserImportTable(params.File)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeReadFileFailed, global.ErrorMsgReadFileFailed, err)
+	}
+	rows, err := parseUserImportRows(table)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+
+	// 文件中填写的密码要符合密码策略，有不符合的行时只校验不导入
+	var policyErrors []dao.UserImportRowError
+	for i := range rows {
+		if rows[i].Password != "" {
+			if err := h.dao.PasswordDao.CheckPolicy(rows[i].Password); err != nil {
+				policyErrors = append(policyErrors, dao.UserImportRowError{Line: rows[i].Line, Field: "password", Message: err.Error()})
+			}
+			continue
+		}
+		password, err := generateInitialPassword(h.dao.PasswordDao)
+		if err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+		}
+		rows[i].Password = password
+	}
+
+	users, rowErrors, err := h.dao.UserDao.ImportUsers(rows, params.DryRun || len(policyErrors) > 0)
+	if err != nil {
+		if ge, ok := err.(gorails.Error); ok {
+			return nil, nil, ge
+		}
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeUserCreateFailed, global.ErrorMsgUserCreateFailed, err)
+	}
+	if len(policyErrors) > 0 {
+		rowErrors = append(rowErrors, policyErrors...)
+		sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Line < rowErrors[j].Line })
+	}
+
+	response := &ImportUsersResponse{
+		DryRun:  params.DryRun,
+		Total:   len(rows),
+		Created: len(users),
+		Errors:  rowErrors,
+	}
+	if response.Errors == nil {
+		response.Errors = []dao.UserImportRowError{}
+	}
+	for i, user := range users {
+		response.Accounts = append(response.Accounts, ImportedAccount{
+			ID:        user.ID,
+			Username:  user.Username,
+			Nickname:  user.Nickname,
+			Password:  rows[i].Password,
+			ClassCode: rows[i].ClassCode,
+		})
+	}
+
+	return response, nil, nil
+}
+
+// readUserImportTable 按扩展名读取 CSV 或 XLSX 文件
+func readUserImportTable(fileHeader *multipart.FileHeader) ([][]string, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".xlsx":
+		return xlsx.ReadRows(file, fileHeader.Size)
+	case ".csv":
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		// Excel 另存的 CSV 带有 BOM
+		data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		return r.ReadAll()
+	default:
+		return nil, errors.New("只支持 .csv 和 .xlsx 文件")
+	}
+}
+
+// parseUserImportRows 根据表头把表格转换为导入数据，跳过空行
+func parseUserImportRows(table [][]string) ([]dao.UserImportRow, error) {
+	if len(table) == 0 {
+		return nil, errors.New("文件内容为空")
+	}
+
+	columns := make(map[string]int)
+	for i, title := range table[0] {
+		if field, ok := userImportColumns[strings.ToLower(strings.TrimSpace(title))]; ok {
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, errors.New("缺少用户名(username)列")
+	}
+
+	cell := func(record []string, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		value := strings.TrimSpace(record[i])
+		// 导出的 CSV 中转义过的内容，密码原样保留
+		if field != "password" {
+			value = csvutil.UnescapeCell(value)
+		}
+		return value
+	}
+
+	var rows []dao.UserImportRow
+	for i, record := range table[1:] {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		rows = append(rows, dao.UserImportRow{
+			Line:      i + 2, // 表头占第 1 行
+			Username:  cell(record, "username"),
+			Nickname:  cell(record, "nickname"),
+			Password:  cell(record, "password"),
+			Email:     cell(record, "email"),
+			ClassCode: cell(record, "class_code"),
+		})
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("文件中没有用户数据")
+	}
+	if len(rows) > maxUserImportRows {
+		return nil, fmt.Errorf("单次最多导入 %d 个用户", maxUserImportRows)
+	}
+	return rows, nil
+}
+
+// generateInitialPassword 生成符合密码策略的随机初始密码，策略要求更长时按策略的最短长度生成
+func generateInitialPassword(passwordDao dao.PasswordDao) (string, error) {
+	length := initialPasswordLength
+	if minLength := passwordDao.Policy().WithDefaults().MinLength; minLength > length {
+		length = minLength
+	}
+	max := big.NewInt(int64(len(initialPasswordChars)))
+	// 字符集同时包含字母和数字，随机生成的密码很少不符合要求，不符合时重新生成
+	for attempt := 0; attempt < 100; attempt++ {
+		password := make([]byte, length)
+		for i := range password {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			password[i] = initialPasswordChars[n.Int64()]
+		}
+		if passwordDao.CheckPolicy(string(password)) == nil {
+			return string(password), nil
+		}
+	}
+	return "", errors.New("无法生成符合密码策略的初始密码")
+}
+
+// PasswordSheetParams 打印初始密码条请求参数
+type PasswordSheetParams struct {
+	Title    string            `json:"title"`
+	Accounts []ImportedAccount `json:"accounts" binding:"required,min=1"`
+}
+
+func (p *PasswordSheetParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindJSON(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	return nil
+}
+
+var passwordSheetTmpl = template.Must(template.New("password_sheet").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 16px; }
+h1 { font-size: 18px; }
+.sheet { display: grid; grid-template-columns: repeat(3, 1fr); gap: 8px; }
+.card { border: 1px dashed #999; padding: 12px; page-break-inside: avoid; }
+.card .name { font-size: 16px; font-weight: bold; margin-bottom: 6px; }
+.card .field { font-family: monospace; font-size: 15px; }
+@media print { h1 { display: none; } body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="sheet">
+{{range .Accounts}}<div class="card">
+<div class="name">{{.Nickname}}</div>
+<div class="field">用户名：{{.Username}}</div>
+<div class="field">密码：{{.Password}}</div>
+{{if .ClassCode}}<div class="field">班级邀请码：{{.ClassCode}}</div>{{end}}
+</div>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// PasswordSheetHandler 生成可打印的初始密码条，每个账号一张，沿虚线剪开分发给学生
+func (h *Handler) PasswordSheetHandler(c *gin.Context, params *PasswordSheetParams) (*TemplateRenderResponse, *gorails.ResponseMeta, gorails.Error) {
+	if params.Title == "" {
+		params.Title = "初始密码"
+	}
+	for i := range params.Accounts {
+		if params.Accounts[i].Nickname == "" {
+			params.Accounts[i].Nickname = params.Accounts[i].Username
+		}
+	}
+	return &TemplateRenderResponse{Tmpl: passwordSheetTmpl, Data: params}, nil, nil
+}
+
+// ExportClassUsersParams 导出班级学生请求参数
+type ExportClassUsersParams struct {
+	ClassID uint   `json:"class_id" uri:"class_id" binding:"required"`
+	Format  string `json:"format" form:"format"`
+}
+
+func (p *ExportClassUsersParams) Parse(c *gin.Context) gorails.Error {
+	if err := c.ShouldBindUri(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if err := c.ShouldBindQuery(p); err != nil {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, err)
+	}
+	if p.Format == "" {
+		p.Format = "csv"
+	}
+	if p.Format != "csv" && p.Format != "xlsx" {
+		return gorails.NewError(http.StatusBadRequest, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeInvalidParams, global.ErrorMsgInvalidParams, errors.New("format 只支持 csv 和 xlsx"))
+	}
+	return nil
+}
+
+// ExportClassUsersHandler 导出班级学生名单
+// 表头与导入文件一致，导出的文件补上密码后可以直接用于导入
+func (h *Handler) ExportClassUsersHandler(c *gin.Context, params *ExportClassUsersParams) ([]byte, *gorails.ResponseMeta, gorails.Error) {
+	class, err := h.dao.ClassDao.GetClass(params.ClassID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusNotFound, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeQueryNotFound, global.ErrorMsgQueryNotFound, err)
+	}
+
+	// 只导出学生，不含助教
+	students, err := h.dao.ClassDao.ListStudents(class.ID, class.TeacherID)
+	if err != nil {
+		return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeQueryFailed, global.ErrorMsgQueryFailed, err)
+	}
+
+	table := [][]string{{"用户名", "昵称", "密码", "邮箱", "班级邀请码"}}
+	for _, student := range students {
+		table = append(table, []string{student.Username, student.Nickname, "", student.Email, class.Code})
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	if params.Format == "xlsx" {
+		if err := xlsx.Write(&buf, class.Name, table); err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+		}
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	} else {
+		// 写入 UTF-8 BOM，避免 Excel 打开中文乱码
+		buf.WriteString("\xEF\xBB\xBF")
+		w := csv.NewWriter(&buf)
+		// 转义用户输入的内容，避免被 Excel 当作公式执行，导入时会还原
+		for _, row := range table[1:] {
+			for i := range row {
+				row[i] = csvutil.SafeCell(row[i])
+			}
+		}
+		w.WriteAll(table)
+		if err := w.Error(); err != nil {
+			return nil, nil, gorails.NewError(http.StatusInternalServerError, gorails.ERR_HANDLER, global.ERR_MODULE_USER, global.ErrorCodeSystemError, global.ErrorMsgSystemError, err)
+		}
+		contentType = "text/csv; charset=utf-8"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"class_%d_users.%s\"", class.ID, params.Format))
+	return buf.Bytes(), nil, nil
+}
+
+// RenderAttachment 以附件形式返回数据，Content-Type 由处理函数事先设置
+func RenderAttachment(c *gin.Context, data []byte, meta *gorails.ResponseMeta) {
+	c.Data(http.StatusOK, c.Writer.Header().Get("Content-Type"), data)
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/jun/fun_code/internal/config"
+	"github.com/jun/fun_code/internal/dao"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试导出时转义过的内容在重新导入时还原，密码原样保留
+func TestParseUserImportRowsUnescapesExportedCells(t *testing.T) {
+	rows, err := parseUserImportRows([][]string{
+		{"用户名", "昵称", "密码", "邮箱", "班级邀请码"},
+		{"tom", "'=汤姆", "'=secret", "'-tom@example.com", "ABC123"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "tom", rows[0].Username)
+		assert.Equal(t, "=汤姆", rows[0].Nickname)
+		assert.Equal(t, "'=secret", rows[0].Password)
+		assert.Equal(t, "-tom@example.com", rows[0].Email)
+		assert.Equal(t, 2, rows[0].Line)
+	}
+}
+
+// 测试自动生成的初始密码满足更严格的密码策略
+func TestGenerateInitialPasswordFollowsPolicy(t *testing.T) {
+	passwordDao := dao.NewPasswordDao(nil, config.PasswordConfig{MinLength: 10, RequireLetter: true, RequireDigit: true}, nil, "")
+	for i := 0; i < 20; i++ {
+		password, err := generateInitialPassword(passwordDao)
+		assert.NoError(t, err)
+		assert.Len(t, password, 10)
+		assert.NoError(t, passwordDao.CheckPolicy(password))
+	}
+}
@@ -0,0 +1,170 @@
+// Package mailtest 提供进程内的 SMTP 服务器，用于测试发送邮件
+package mailtest
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message 服务器收到的一封邮件
+type Message struct {
+	From string
+	To   []string
+	Data string // 原始邮件内容，包括邮件头
+}
+
+// Subject 解码后的邮件标题
+func (m Message) Subject() string {
+	msg, err := mail.ReadMessage(strings.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return msg.Header.Get("Subject")
+	}
+	return subject
+}
+
+// Body 解码后的邮件正文
+func (m Message) Body() string {
+	msg, err := mail.ReadMessage(strings.NewReader(m.Data))
+	if err != nil {
+		return ""
+	}
+	var body io.Reader = msg.Body
+	if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	b, _ := io.ReadAll(body)
+	return string(b)
+}
+
+// Server 只支持不加密、不登录的最基本的 SMTP 会话，收到的邮件保存在内存中
+type Server struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	wg       sync.WaitGroup
+}
+
+// NewServer 在本机随机端口启动 SMTP 服务器，使用完需要调用 Close
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Host 服务器地址
+func (s *Server) Host() string {
+	return "127.0.0.1"
+}
+
+// Port 服务器端口
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Messages 已收到的邮件
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close 停止服务器
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	reply := func(code int, text string) {
+		io.WriteString(conn, strconv.Itoa(code)+" "+text+"\r\n")
+	}
+	reply(220, "mailtest ESMTP")
+
+	var current Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			io.WriteString(conn, "250-mailtest\r\n250 8BITMIME\r\n")
+		case "MAIL":
+			current = Message{From: address(arg)}
+			reply(250, "OK")
+		case "RCPT":
+			current.To = append(current.To, address(arg))
+			reply(250, "OK")
+		case "DATA":
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			current.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			reply(250, "OK")
+		case "RSET", "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// address 取出 "FROM:<a@b.c>" 中的地址
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr = strings.TrimSpace(addr)
+	if i := strings.IndexByte(addr, ' '); i >= 0 {
+		addr = addr[:i]
+	}
+	return strings.Trim(addr, "<>")
+}
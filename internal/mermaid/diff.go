@@ -0,0 +1,249 @@
+package mermaid
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change status values used in ProjectDiff
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// maxDiffValueLength limits how much of a variable or list value is shown in a diff
+const maxDiffValueLength = 100
+
+// ItemChange describes a change to a script, variable, list or costume
+type ItemChange struct {
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// TargetDiff describes the changes of one sprite or the stage
+type TargetDiff struct {
+	Name      string       `json:"name"`
+	IsStage   bool         `json:"is_stage"`
+	Status    string       `json:"status"`
+	Scripts   []ItemChange `json:"scripts,omitempty"`
+	Variables []ItemChange `json:"variables,omitempty"`
+	Lists     []ItemChange `json:"lists,omitempty"`
+	Costumes  []ItemChange `json:"costumes,omitempty"`
+}
+
+// ProjectDiff lists the sprites and stage that differ between two versions of a project
+type ProjectDiff struct {
+	Targets []TargetDiff `json:"targets"`
+}
+
+// HasChanges reports whether the two projects differ
+func (d *ProjectDiff) HasChanges() bool {
+	return len(d.Targets) > 0
+}
+
+// DiffProjects compares two versions of a project.
+// Sprites are matched by name and the stage with the stage. Scripts, variables and lists are matched
+// by their Scratch IDs, which the editor keeps stable across saves; costumes are matched by name.
+// Moving a script around the workspace is not reported as a change.
+func DiffProjects(oldProject, newProject *Project) *ProjectDiff {
+	translator := NewOpcodeTranslator()
+	diff := &ProjectDiff{Targets: []TargetDiff{}}
+
+	oldTargets := make(map[string]*Target, len(oldProject.Targets))
+	for i := range oldProject.Targets {
+		oldTargets[targetKey(&oldProject.Targets[i])] = &oldProject.Targets[i]
+	}
+
+	empty := &Target{}
+	seen := make(map[string]bool, len(newProject.Targets))
+	for i := range newProject.Targets {
+		newTarget := &newProject.Targets[i]
+		key := targetKey(newTarget)
+		seen[key] = true
+
+		oldTarget, ok := oldTargets[key]
+		status := DiffChanged
+		if !ok {
+			oldTarget = empty
+			status = DiffAdded
+		}
+		if targetDiff, changed := diffTarget(oldTarget, newTarget, status, translator); changed {
+			diff.Targets = append(diff.Targets, targetDiff)
+		}
+	}
+
+	for i := range oldProject.Targets {
+		oldTarget := &oldProject.Targets[i]
+		if seen[targetKey(oldTarget)] {
+			continue
+		}
+		targetDiff, _ := diffTarget(oldTarget, empty, DiffRemoved, translator)
+		diff.Targets = append(diff.Targets, targetDiff)
+	}
+	return diff
+}
+
+func targetKey(target *Target) string {
+	if target.IsStage {
+		// Sprite names cannot be empty, so this never collides with a sprite
+		return ""
+	}
+	return target.Name
+}
+
+func diffTarget(oldTarget, newTarget *Target, status string, translator *OpcodeTranslator) (TargetDiff, bool) {
+	named := newTarget
+	if status == DiffRemoved {
+		named = oldTarget
+	}
+	result := TargetDiff{
+		Name:      named.Name,
+		IsStage:   named.IsStage,
+		Status:    status,
+		Scripts:   diffItems(scriptSummaries(oldTarget, translator), scriptSummaries(newTarget, translator)),
+		Variables: diffItems(variableSummaries(oldTarget.Variables), variableSummaries(newTarget.Variables)),
+		Lists:     diffItems(variableSummaries(oldTarget.Lists), variableSummaries(newTarget.Lists)),
+		Costumes:  diffItems(costumeSummaries(oldTarget.Costumes), costumeSummaries(newTarget.Costumes)),
+	}
+	changed := status != DiffChanged ||
+		len(result.Scripts) > 0 || len(result.Variables) > 0 || len(result.Lists) > 0 || len(result.Costumes) > 0
+	return result, changed
+}
+
+// itemSummary is what gets compared for a script, variable, list or costume.
+// Items with the same key are reported as changed when their content differs,
+// display is shown to the user as the old or new value.
+type itemSummary struct {
+	key     string
+	name    string
+	display string
+	content string
+}
+
+func diffItems(oldItems, newItems []itemSummary) []ItemChange {
+	oldByKey := make(map[string]itemSummary, len(oldItems))
+	for _, item := range oldItems {
+		oldByKey[item.key] = item
+	}
+
+	var changes []ItemChange
+	seen := make(map[string]bool, len(newItems))
+	for _, item := range newItems {
+		seen[item.key] = true
+		old, ok := oldByKey[item.key]
+		switch {
+		case !ok:
+			changes = append(changes, ItemChange{Status: DiffAdded, ID: item.key, Name: item.name, New: item.display})
+		case old.content != item.content:
+			changes = append(changes, ItemChange{Status: DiffChanged, ID: item.key, Name: item.name, Old: old.display, New: item.display})
+		}
+	}
+	for _, item := range oldItems {
+		if !seen[item.key] {
+			changes = append(changes, ItemChange{Status: DiffRemoved, ID: item.key, Name: item.name, Old: item.display})
+		}
+	}
+	return changes
+}
+
+// scriptSummaries describes each script (a top-level block and everything attached to it) of a target
+func scriptSummaries(target *Target, translator *OpcodeTranslator) []itemSummary {
+	if len(target.Blocks) == 0 {
+		return nil
+	}
+
+	scripts := target.Scripts()
+	var summaries []itemSummary
+	for _, top := range findTopLevelBlocks(target.Blocks) {
+		ids := scripts[top]
+		sort.Strings(ids)
+
+		hash := md5.New()
+		for _, id := range ids {
+			block := target.Blocks[id]
+			fields, _ := json.Marshal(block.Fields)
+			inputs, _ := json.Marshal(block.Inputs)
+			next := ""
+			if block.Next != nil {
+				next = *block.Next
+			}
+			fmt.Fprintf(hash, "%s|%s|%s|%s|%s\n", id, block.Opcode, fields, inputs, next)
+		}
+
+		label := GetBlockLabel(target.Blocks[top], translator, target.Broadcasts, target.Blocks)
+		summaries = append(summaries, itemSummary{
+			key:     top,
+			name:    label,
+			display: fmt.Sprintf("%s (%d)", label, len(ids)),
+			content: fmt.Sprintf("%x", hash.Sum(nil)),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].key < summaries[j].key })
+	return summaries
+}
+
+// findScriptTop follows the parent links of a block up to the top-level block of its script
+func findScriptTop(blocks map[string]Block, id string) string {
+	for steps := 0; steps < len(blocks); steps++ {
+		block := blocks[id]
+		if block.Parent == nil {
+			return id
+		}
+		if _, ok := blocks[*block.Parent]; !ok {
+			return id
+		}
+		id = *block.Parent
+	}
+	return id
+}
+
+func variableSummaries(variables map[string][]interface{}) []itemSummary {
+	summaries := make([]itemSummary, 0, len(variables))
+	for id, variable := range variables {
+		var name string
+		var value interface{}
+		if len(variable) > 0 {
+			name, _ = variable[0].(string)
+		}
+		if len(variable) > 1 {
+			value = variable[1]
+		}
+		data, _ := json.Marshal(value)
+		display := string(data)
+		if runes := []rune(display); len(runes) > maxDiffValueLength {
+			display = string(runes[:maxDiffValueLength]) + "..."
+		}
+		summaries = append(summaries, itemSummary{
+			key:     id,
+			name:    name,
+			display: name + " = " + display,
+			content: name + "\x00" + string(data),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].key < summaries[j].key })
+	return summaries
+}
+
+func costumeSummaries(costumes []Costume) []itemSummary {
+	summaries := make([]itemSummary, 0, len(costumes))
+	for _, costume := range costumes {
+		md5ext := costume.MD5Ext
+		if md5ext == "" && costume.AssetID != "" {
+			md5ext = costume.AssetID + "." + strings.TrimPrefix(costume.DataFormat, ".")
+		}
+		summaries = append(summaries, itemSummary{
+			key:     costume.Name,
+			name:    costume.Name,
+			display: md5ext,
+			content: md5ext,
+		})
+	}
+	return summaries
+}
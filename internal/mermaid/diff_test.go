@@ -0,0 +1,109 @@
+package mermaid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const diffOldProject = `{
+  "targets": [
+    {
+      "isStage": true,
+      "name": "Stage",
+      "variables": {"v1": ["score", 0]},
+      "lists": {},
+      "blocks": {},
+      "costumes": [{"name": "backdrop1", "assetId": "aaa", "md5ext": "aaa.svg", "dataFormat": "svg"}]
+    },
+    {
+      "isStage": false,
+      "name": "Cat",
+      "variables": {},
+      "blocks": {
+        "b1": {"opcode": "event_whenflagclicked", "next": "b2", "parent": null, "topLevel": true, "fields": {}, "inputs": {}},
+        "b2": {"opcode": "motion_movesteps", "next": null, "parent": "b1", "topLevel": false, "fields": {}, "inputs": {"STEPS": [1, [4, "10"]]}},
+        "r1": [12, "score", "v1", 100, 200]
+      },
+      "costumes": [{"name": "cat-a", "assetId": "bbb", "md5ext": "bbb.svg", "dataFormat": "svg"}]
+    },
+    {
+      "isStage": false,
+      "name": "Dog",
+      "blocks": {},
+      "costumes": []
+    }
+  ]
+}`
+
+const diffNewProject = `{
+  "targets": [
+    {
+      "isStage": true,
+      "name": "Stage",
+      "variables": {"v1": ["score", 0], "v2": ["lives", 3]},
+      "lists": {"l1": ["items", ["a", "b"]]},
+      "blocks": {},
+      "costumes": [{"name": "backdrop1", "assetId": "aaa", "md5ext": "aaa.svg", "dataFormat": "svg"}]
+    },
+    {
+      "isStage": false,
+      "name": "Cat",
+      "variables": {},
+      "blocks": {
+        "b1": {"opcode": "event_whenflagclicked", "next": "b2", "parent": null, "topLevel": true, "fields": {}, "inputs": {}},
+        "b2": {"opcode": "motion_movesteps", "next": null, "parent": "b1", "topLevel": false, "fields": {}, "inputs": {"STEPS": [1, [4, "20"]]}},
+        "b3": {"opcode": "event_whenkeypressed", "next": null, "parent": null, "topLevel": true, "fields": {"KEY_OPTION": ["space", null]}, "inputs": {}}
+      },
+      "costumes": [{"name": "cat-a", "assetId": "ccc", "md5ext": "ccc.svg", "dataFormat": "svg"}]
+    },
+    {
+      "isStage": false,
+      "name": "Ball",
+      "blocks": {},
+      "costumes": [{"name": "ball", "assetId": "ddd", "md5ext": "ddd.png", "dataFormat": "png"}]
+    }
+  ]
+}`
+
+func TestDiffProjects(t *testing.T) {
+	oldProject, err := ParseProject([]byte(diffOldProject))
+	require.NoError(t, err)
+	newProject, err := ParseProject([]byte(diffNewProject))
+	require.NoError(t, err)
+
+	diff := DiffProjects(oldProject, newProject)
+	require.True(t, diff.HasChanges())
+	require.Len(t, diff.Targets, 4)
+
+	stage := diff.Targets[0]
+	assert.True(t, stage.IsStage)
+	assert.Equal(t, DiffChanged, stage.Status)
+	assert.Equal(t, []ItemChange{{Status: DiffAdded, ID: "v2", Name: "lives", New: "lives = 3"}}, stage.Variables)
+	assert.Equal(t, []ItemChange{{Status: DiffAdded, ID: "l1", Name: "items", New: `items = ["a","b"]`}}, stage.Lists)
+	assert.Empty(t, stage.Scripts)
+	assert.Empty(t, stage.Costumes)
+
+	cat := diff.Targets[1]
+	assert.Equal(t, "Cat", cat.Name)
+	assert.Equal(t, DiffChanged, cat.Status)
+	require.Len(t, cat.Scripts, 2)
+	assert.Equal(t, DiffChanged, cat.Scripts[0].Status)
+	assert.Equal(t, "b1", cat.Scripts[0].ID)
+	assert.Equal(t, DiffAdded, cat.Scripts[1].Status)
+	assert.Equal(t, "b3", cat.Scripts[1].ID)
+	assert.Equal(t, []ItemChange{{Status: DiffChanged, ID: "cat-a", Name: "cat-a", Old: "bbb.svg", New: "ccc.svg"}}, cat.Costumes)
+
+	ball := diff.Targets[2]
+	assert.Equal(t, "Ball", ball.Name)
+	assert.Equal(t, DiffAdded, ball.Status)
+	assert.Len(t, ball.Costumes, 1)
+
+	dog := diff.Targets[3]
+	assert.Equal(t, "Dog", dog.Name)
+	assert.Equal(t, DiffRemoved, dog.Status)
+
+	// Comparing a version with itself reports nothing
+	assert.False(t, DiffProjects(newProject, newProject).HasChanges())
+}
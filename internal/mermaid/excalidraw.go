@@ -0,0 +1,503 @@
+package mermaid
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Sizes of the Excalidraw scene, in pixels
+const (
+	excalidrawFontSize   = 16.0
+	excalidrawLineHeight = 1.25
+	excalidrawTextWidth  = 220.0 // Labels wrap at this width
+	excalidrawPadding    = 16.0
+	excalidrawMinWidth   = 120.0
+	excalidrawNodeGap    = 40.0
+	excalidrawLayerGap   = 70.0
+	excalidrawColumnGap  = 160.0
+	excalidrawFramePad   = 30.0
+	excalidrawDetour     = 40.0 // How far edges going back up pass beside the nodes
+)
+
+type excalidrawScene struct {
+	Type     string                 `json:"type"`
+	Version  int                    `json:"version"`
+	Source   string                 `json:"source"`
+	Elements []*excalidrawElement   `json:"elements"`
+	AppState map[string]interface{} `json:"appState"`
+	Files    map[string]interface{} `json:"files"`
+}
+
+type excalidrawBound struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type excalidrawBinding struct {
+	ElementID string  `json:"elementId"`
+	Focus     float64 `json:"focus"`
+	Gap       float64 `json:"gap"`
+}
+
+type excalidrawRoundness struct {
+	Type int `json:"type"`
+}
+
+// excalidrawElement holds the fields of all the element types used, fields of other types are left out
+type excalidrawElement struct {
+	ID              string               `json:"id"`
+	Type            string               `json:"type"`
+	X               float64              `json:"x"`
+	Y               float64              `json:"y"`
+	Width           float64              `json:"width"`
+	Height          float64              `json:"height"`
+	Angle           float64              `json:"angle"`
+	StrokeColor     string               `json:"strokeColor"`
+	BackgroundColor string               `json:"backgroundColor"`
+	FillStyle       string               `json:"fillStyle"`
+	StrokeWidth     float64              `json:"strokeWidth"`
+	StrokeStyle     string               `json:"strokeStyle"`
+	Roughness       int                  `json:"roughness"`
+	Opacity         int                  `json:"opacity"`
+	GroupIDs        []string             `json:"groupIds"`
+	FrameID         *string              `json:"frameId"`
+	Roundness       *excalidrawRoundness `json:"roundness"`
+	Seed            int                  `json:"seed"`
+	Version         int                  `json:"version"`
+	VersionNonce    int                  `json:"versionNonce"`
+	IsDeleted       bool                 `json:"isDeleted"`
+	BoundElements   []excalidrawBound    `json:"boundElements"`
+	Updated         int64                `json:"updated"`
+	Link            *string              `json:"link"`
+	Locked          bool                 `json:"locked"`
+
+	// Text
+	Text          string  `json:"text,omitempty"`
+	OriginalText  string  `json:"originalText,omitempty"`
+	FontSize      float64 `json:"fontSize,omitempty"`
+	FontFamily    int     `json:"fontFamily,omitempty"`
+	TextAlign     string  `json:"textAlign,omitempty"`
+	VerticalAlign string  `json:"verticalAlign,omitempty"`
+	ContainerID   *string `json:"containerId,omitempty"`
+	LineHeight    float64 `json:"lineHeight,omitempty"`
+	AutoResize    bool    `json:"autoResize,omitempty"`
+
+	// Arrow
+	Points         [][2]float64       `json:"points,omitempty"`
+	StartBinding   *excalidrawBinding `json:"startBinding,omitempty"`
+	EndBinding     *excalidrawBinding `json:"endBinding,omitempty"`
+	StartArrowhead *string            `json:"startArrowhead,omitempty"`
+	EndArrowhead   *string            `json:"endArrowhead,omitempty"`
+
+	// Frame
+	Name string `json:"name,omitempty"`
+}
+
+// excalidrawBox is where a node is drawn
+type excalidrawBox struct {
+	x, y, w, h float64
+	layer      int
+}
+
+func (b *excalidrawBox) centerX() float64 { return b.x + b.w/2 }
+func (b *excalidrawBox) centerY() float64 { return b.y + b.h/2 }
+
+// RenderExcalidraw lays out a flowchart as an Excalidraw scene, the content of an .excalidraw file.
+// The scripts flow top down in layers, custom block definitions are placed beside them in frames
+func RenderExcalidraw(g *Graph) ([]byte, error) {
+	elements := make(map[string]*excalidrawElement)
+	var order []*excalidrawElement
+	add := func(e *excalidrawElement) *excalidrawElement {
+		elements[e.ID] = e
+		order = append(order, e)
+		return e
+	}
+
+	// Nodes with their labels
+	labels := make(map[string][]string)
+	boxes := make(map[string]*excalidrawBox, len(g.Nodes))
+	for _, node := range g.Nodes {
+		lines := wrapExcalidrawText(node.Label, excalidrawTextWidth)
+		labels[node.ID] = lines
+		w, h := excalidrawTextSize(lines)
+		switch node.Shape {
+		case ShapeDecision:
+			// The text has to fit inside the diamond
+			w, h = w*1.4, h*1.8
+		case ShapeHat:
+			w, h = w*1.3, h*1.4
+		}
+		boxes[node.ID] = &excalidrawBox{w: math.Max(w+2*excalidrawPadding, excalidrawMinWidth), h: h + 2*excalidrawPadding}
+	}
+	layoutExcalidraw(g, boxes)
+
+	for _, node := range g.Nodes {
+		box := boxes[node.ID]
+		shape := add(newExcalidrawElement(node.ID, "rectangle", box.x, box.y, box.w, box.h))
+		switch node.Shape {
+		case ShapeAction:
+			shape.BackgroundColor = "#a5d8ff"
+			shape.Roundness = &excalidrawRoundness{Type: 3}
+		case ShapeDecision:
+			shape.Type = "diamond"
+			shape.BackgroundColor = "#ffec99"
+		case ShapeHat:
+			shape.Type = "ellipse"
+			shape.BackgroundColor = "#b2f2bb"
+		case ShapeCall:
+			shape.BackgroundColor = "#d0bfff"
+			shape.StrokeWidth = 4
+		}
+		if text := addExcalidrawText(add, shape, labels[node.ID], box.centerX(), box.centerY()); text != nil {
+			shape.BoundElements = append(shape.BoundElements, excalidrawBound{ID: text.ID, Type: "text"})
+		}
+	}
+
+	for i, edge := range g.Edges {
+		from, to := boxes[edge.From], boxes[edge.To]
+		if from == nil || to == nil {
+			continue
+		}
+		points := excalidrawEdgePoints(from, to, edge.Style == EdgeFlow)
+		arrow := add(newExcalidrawElement("edge_"+strconv.Itoa(i), "arrow", points[0][0], points[0][1], 0, 0))
+		arrow.Roundness = &excalidrawRoundness{Type: 2}
+		minX, minY, maxX, maxY := 0.0, 0.0, 0.0, 0.0
+		for _, p := range points {
+			relative := [2]float64{round2(p[0] - points[0][0]), round2(p[1] - points[0][1])}
+			arrow.Points = append(arrow.Points, relative)
+			minX, minY = math.Min(minX, relative[0]), math.Min(minY, relative[1])
+			maxX, maxY = math.Max(maxX, relative[0]), math.Max(maxY, relative[1])
+		}
+		arrow.Width, arrow.Height = round2(maxX-minX), round2(maxY-minY)
+		arrow.StartBinding = &excalidrawBinding{ElementID: edge.From, Gap: 1}
+		arrow.EndBinding = &excalidrawBinding{ElementID: edge.To, Gap: 1}
+		head := "arrow"
+		arrow.EndArrowhead = &head
+		if edge.Style != EdgeFlow {
+			arrow.StrokeStyle = "dashed"
+			arrow.StrokeColor = "#1971c2"
+		}
+		if edge.Style == EdgeLinkBoth {
+			arrow.StartArrowhead = &head
+		}
+		elements[edge.From].BoundElements = append(elements[edge.From].BoundElements, excalidrawBound{ID: arrow.ID, Type: "arrow"})
+		if edge.To != edge.From {
+			elements[edge.To].BoundElements = append(elements[edge.To].BoundElements, excalidrawBound{ID: arrow.ID, Type: "arrow"})
+		}
+
+		if edge.Label != "" {
+			// The label sits on the middle segment
+			mid := len(points) / 2
+			x, y := (points[mid-1][0]+points[mid][0])/2, (points[mid-1][1]+points[mid][1])/2
+			if text := addExcalidrawText(add, arrow, []string{edge.Label}, x, y); text != nil {
+				arrow.BoundElements = append(arrow.BoundElements, excalidrawBound{ID: text.ID, Type: "text"})
+			}
+		}
+	}
+
+	// Frames around custom block definitions, after their children
+	for _, subgraph := range g.Subgraphs {
+		minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+		var children []string
+		for _, node := range g.Nodes {
+			if node.Subgraph != subgraph.ID {
+				continue
+			}
+			box := boxes[node.ID]
+			minX, minY = math.Min(minX, box.x), math.Min(minY, box.y)
+			maxX, maxY = math.Max(maxX, box.x+box.w), math.Max(maxY, box.y+box.h)
+			children = append(children, node.ID)
+			for _, bound := range elements[node.ID].BoundElements {
+				if bound.Type == "text" {
+					children = append(children, bound.ID)
+				}
+			}
+		}
+		if len(children) == 0 {
+			continue
+		}
+		frame := add(newExcalidrawElement(subgraph.ID, "frame", minX-excalidrawFramePad, minY-excalidrawFramePad,
+			maxX-minX+2*excalidrawFramePad, maxY-minY+2*excalidrawFramePad))
+		frame.Name = subgraph.Label
+		frame.StrokeWidth = 1
+		for _, id := range children {
+			frameID := frame.ID
+			elements[id].FrameID = &frameID
+		}
+	}
+
+	return json.MarshalIndent(excalidrawScene{
+		Type:     "excalidraw",
+		Version:  2,
+		Source:   "fun_code",
+		Elements: order,
+		AppState: map[string]interface{}{"viewBackgroundColor": "#ffffff", "gridSize": nil},
+		Files:    map[string]interface{}{},
+	}, "", "  ")
+}
+
+func newExcalidrawElement(id, kind string, x, y, w, h float64) *excalidrawElement {
+	// Seeds only change how rough lines look, derive them from the ID so the scene is stable
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	seed := int(hash.Sum32() & 0x7fffffff)
+	return &excalidrawElement{
+		ID:              id,
+		Type:            kind,
+		X:               round2(x),
+		Y:               round2(y),
+		Width:           round2(w),
+		Height:          round2(h),
+		StrokeColor:     "#1e1e1e",
+		BackgroundColor: "transparent",
+		FillStyle:       "solid",
+		StrokeWidth:     2,
+		StrokeStyle:     "solid",
+		Roughness:       1,
+		Opacity:         100,
+		GroupIDs:        []string{},
+		Seed:            seed,
+		Version:         1,
+		VersionNonce:    seed,
+		Updated:         1,
+	}
+}
+
+// addExcalidrawText adds the label of a container centered at x, y
+func addExcalidrawText(add func(*excalidrawElement) *excalidrawElement, container *excalidrawElement, lines []string, x, y float64) *excalidrawElement {
+	if len(lines) == 0 {
+		return nil
+	}
+	w, h := excalidrawTextSize(lines)
+	text := add(newExcalidrawElement(container.ID+"_text", "text", x-w/2, y-h/2, w, h))
+	text.StrokeWidth = 1
+	text.Text = strings.Join(lines, "\n")
+	text.OriginalText = strings.Join(lines, " ")
+	text.FontSize = excalidrawFontSize
+	text.FontFamily = 2
+	text.TextAlign = "center"
+	text.VerticalAlign = "middle"
+	containerID := container.ID
+	text.ContainerID = &containerID
+	text.LineHeight = excalidrawLineHeight
+	text.AutoResize = true
+	return text
+}
+
+// layoutExcalidraw places the boxes of the nodes. Each group of nodes connected by flow edges is a
+// column, the main flowchart first and then custom block definitions. Inside a column nodes are in
+// layers by the longest path from the top, so a block is always below the blocks that run before it
+func layoutExcalidraw(g *Graph, boxes map[string]*excalidrawBox) {
+	out := make(map[string][]string)
+	hasIncoming := make(map[string]bool)
+	parent := make(map[string]string)
+	var find func(id string) string
+	find = func(id string) string {
+		if p, ok := parent[id]; ok && p != id {
+			root := find(p)
+			parent[id] = root
+			return root
+		}
+		return id
+	}
+	for _, edge := range g.Edges {
+		if edge.Style != EdgeFlow || boxes[edge.From] == nil || boxes[edge.To] == nil || edge.From == edge.To {
+			continue
+		}
+		out[edge.From] = append(out[edge.From], edge.To)
+		hasIncoming[edge.To] = true
+		if a, b := find(edge.From), find(edge.To); a != b {
+			parent[b] = a
+		}
+	}
+
+	// Columns in the order of their first node
+	var columns [][]string
+	columnOf := make(map[string]int)
+	for _, node := range g.Nodes {
+		root := find(node.ID)
+		i, ok := columnOf[root]
+		if !ok {
+			i = len(columns)
+			columnOf[root] = i
+			columns = append(columns, nil)
+		}
+		columns[i] = append(columns[i], node.ID)
+	}
+
+	x := 0.0
+	for _, column := range columns {
+		// Depth first from the roots to find the edges going back up, which close loops
+		state := make(map[string]int) // 1 on the stack, 2 done
+		var postorder []string
+		back := make(map[[2]string]bool)
+		var visit func(id string)
+		visit = func(id string) {
+			state[id] = 1
+			for _, next := range out[id] {
+				switch state[next] {
+				case 0:
+					visit(next)
+				case 1:
+					back[[2]string{id, next}] = true
+				}
+			}
+			state[id] = 2
+			postorder = append(postorder, id)
+		}
+		for _, id := range column {
+			if !hasIncoming[id] && state[id] == 0 {
+				visit(id)
+			}
+		}
+		for _, id := range column {
+			if state[id] == 0 {
+				visit(id)
+			}
+		}
+
+		// Longest path layering in topological order
+		for i := len(postorder) - 1; i >= 0; i-- {
+			id := postorder[i]
+			for _, next := range out[id] {
+				if !back[[2]string{id, next}] && boxes[next].layer < boxes[id].layer+1 {
+					boxes[next].layer = boxes[id].layer + 1
+				}
+			}
+		}
+
+		layers := make(map[int][]string)
+		maxLayer := 0
+		for _, id := range column {
+			layer := boxes[id].layer
+			layers[layer] = append(layers[layer], id)
+			maxLayer = max(maxLayer, layer)
+		}
+		width := 0.0
+		for _, ids := range layers {
+			w := -excalidrawNodeGap
+			for _, id := range ids {
+				w += boxes[id].w + excalidrawNodeGap
+			}
+			width = math.Max(width, w)
+		}
+
+		y := 0.0
+		for layer := 0; layer <= maxLayer; layer++ {
+			ids := layers[layer]
+			w, h := -excalidrawNodeGap, 0.0
+			for _, id := range ids {
+				w += boxes[id].w + excalidrawNodeGap
+				h = math.Max(h, boxes[id].h)
+			}
+			// Center the layer in the column
+			left := x + (width-w)/2
+			for _, id := range ids {
+				box := boxes[id]
+				box.x = left
+				box.y = y + (h-box.h)/2
+				left += box.w + excalidrawNodeGap
+			}
+			y += h + excalidrawLayerGap
+		}
+		x += width + excalidrawColumnGap
+	}
+}
+
+// excalidrawEdgePoints returns the absolute points of an edge. Flow edges going down run from the bottom
+// of a node to the top of the next, edges going back up pass on the right of the nodes
+func excalidrawEdgePoints(from, to *excalidrawBox, flow bool) [][2]float64 {
+	if !flow {
+		// Links between scripts go straight between the closest sides
+		switch {
+		case to.x > from.x+from.w:
+			return [][2]float64{{from.x + from.w, from.centerY()}, {to.x, to.centerY()}}
+		case to.x+to.w < from.x:
+			return [][2]float64{{from.x, from.centerY()}, {to.x + to.w, to.centerY()}}
+		case to.y > from.y:
+			return [][2]float64{{from.centerX(), from.y + from.h}, {to.centerX(), to.y}}
+		}
+		return [][2]float64{{from.centerX(), from.y}, {to.centerX(), to.y + to.h}}
+	}
+	if to.layer > from.layer {
+		return [][2]float64{{from.centerX(), from.y + from.h}, {to.centerX(), to.y}}
+	}
+	right := math.Max(from.x+from.w, to.x+to.w) + excalidrawDetour
+	startY, endY := from.centerY(), to.centerY()
+	if from == to {
+		startY, endY = from.y+from.h*0.3, from.y+from.h*0.7
+	}
+	return [][2]float64{{from.x + from.w, startY}, {right, startY}, {right, endY}, {to.x + to.w, endY}}
+}
+
+// wrapExcalidrawText breaks a label into lines no wider than width, at spaces when possible
+func wrapExcalidrawText(text string, width float64) []string {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return nil
+	}
+	var lines []string
+	var line []rune
+	lineWidth := 0.0
+	lastSpace := -1
+	for _, r := range text {
+		w := excalidrawRuneWidth(r)
+		if lineWidth+w > width && len(line) > 0 {
+			switch {
+			case r == ' ':
+				lines = append(lines, string(line))
+				line, lastSpace = nil, -1
+				lineWidth = 0
+				continue
+			case lastSpace > 0:
+				lines = append(lines, string(line[:lastSpace]))
+				line = append([]rune(nil), line[lastSpace+1:]...)
+			default:
+				lines = append(lines, string(line))
+				line = nil
+			}
+			lastSpace = -1
+			lineWidth = 0
+			for _, c := range line {
+				lineWidth += excalidrawRuneWidth(c)
+			}
+		}
+		if r == ' ' {
+			lastSpace = len(line)
+		}
+		line = append(line, r)
+		lineWidth += w
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// excalidrawTextSize estimates the size of lines of text, Excalidraw measures it again when editing
+func excalidrawTextSize(lines []string) (float64, float64) {
+	w := 0.0
+	for _, line := range lines {
+		lineWidth := 0.0
+		for _, r := range line {
+			lineWidth += excalidrawRuneWidth(r)
+		}
+		w = math.Max(w, lineWidth)
+	}
+	return math.Ceil(w), float64(len(lines)) * excalidrawFontSize * excalidrawLineHeight
+}
+
+// excalidrawRuneWidth estimates the width of a character, CJK characters are square
+func excalidrawRuneWidth(r rune) float64 {
+	if r >= 0x2E80 {
+		return excalidrawFontSize
+	}
+	return excalidrawFontSize * 0.6
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
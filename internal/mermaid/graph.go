@@ -0,0 +1,260 @@
+package mermaid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeShape is the kind of a flowchart node, each output format draws it with its own shape
+type NodeShape int
+
+const (
+	ShapeBox      NodeShape = iota // Sprites and the ends of control blocks
+	ShapeAction                    // Ordinary blocks
+	ShapeDecision                  // Conditions and loops that check a condition
+	ShapeHat                       // Blocks that start a script
+	ShapeCall                      // Custom block calls
+)
+
+// EdgeStyle tells how control moves along an edge
+type EdgeStyle int
+
+const (
+	EdgeFlow     EdgeStyle = iota // To the next block of the script
+	EdgeLink                      // To another script, like a broadcast
+	EdgeLinkBoth                  // To another script and back, like broadcast and wait
+)
+
+// Node is a block or a helper node of a flowchart
+type Node struct {
+	ID       string
+	Label    string
+	Shape    NodeShape
+	Subgraph string // ID of the subgraph holding the node, "" for none
+}
+
+// Edge connects two nodes of a flowchart
+type Edge struct {
+	From  string
+	To    string
+	Label string
+	Style EdgeStyle
+}
+
+// Subgraph groups the nodes of a custom block definition
+type Subgraph struct {
+	ID    string
+	Label string
+}
+
+// Graph is a flowchart independent of the output format, nodes and edges are in the order they were built
+type Graph struct {
+	Title     string
+	Nodes     []Node
+	Edges     []Edge
+	Subgraphs []Subgraph
+
+	nodeIndex map[string]int
+	subgraph  string // subgraph new nodes are added to
+}
+
+func newGraph(title string) *Graph {
+	return &Graph{Title: title, nodeIndex: make(map[string]int)}
+}
+
+// addNode adds a node to the current subgraph, a node added again keeps its first label
+func (g *Graph) addNode(id, label string, shape NodeShape) {
+	if _, exists := g.nodeIndex[id]; exists {
+		return
+	}
+	g.nodeIndex[id] = len(g.Nodes)
+	g.Nodes = append(g.Nodes, Node{ID: id, Label: label, Shape: shape, Subgraph: g.subgraph})
+}
+
+func (g *Graph) addEdge(from, to, label string) {
+	g.addLink(from, to, label, EdgeFlow)
+}
+
+func (g *Graph) addLink(from, to, label string, style EdgeStyle) {
+	g.Edges = append(g.Edges, Edge{From: from, To: to, Label: label, Style: style})
+}
+
+func (g *Graph) beginSubgraph(id, label string) {
+	g.Subgraphs = append(g.Subgraphs, Subgraph{ID: id, Label: label})
+	g.subgraph = id
+}
+
+func (g *Graph) endSubgraph() {
+	g.subgraph = ""
+}
+
+// Node returns the node with the ID
+func (g *Graph) Node(id string) (Node, bool) {
+	i, exists := g.nodeIndex[id]
+	if !exists {
+		return Node{}, false
+	}
+	return g.Nodes[i], true
+}
+
+// Format is an output format of a flowchart
+type Format string
+
+const (
+	FormatMermaid    Format = "mermaid"
+	FormatDOT        Format = "dot"
+	FormatPlantUML   Format = "plantuml"
+	FormatExcalidraw Format = "excalidraw"
+)
+
+// GenerateFlowchart generates the flowchart of a Scratch project in a format,
+// labeled in the language of the translator
+func GenerateFlowchart(project *Project, rootName string, format Format, translator *OpcodeTranslator) (string, error) {
+	switch format {
+	case FormatMermaid, "":
+		return RenderMermaid(BuildFlowchart(project, rootName, translator)), nil
+	case FormatDOT:
+		return RenderDOT(BuildFlowchart(project, rootName, translator)), nil
+	case FormatPlantUML:
+		return RenderPlantUML(project, rootName, translator), nil
+	case FormatExcalidraw:
+		scene, err := RenderExcalidraw(BuildFlowchart(project, rootName, translator))
+		if err != nil {
+			return "", err
+		}
+		return string(scene), nil
+	}
+	return "", fmt.Errorf("unknown flowchart format %q", format)
+}
+
+// RenderMermaid renders a flowchart as a Mermaid top-down flowchart
+func RenderMermaid(g *Graph) string {
+	var builder strings.Builder
+	builder.WriteString("flowchart TD\n")
+
+	writeNode := func(node Node, indent string) {
+		opening, closing := mermaidShape(node.Shape)
+		builder.WriteString(fmt.Sprintf("%s%s%s%s%s\n", indent, node.ID, opening, sanitizeMermaidLabel(node.Label), closing))
+	}
+	for _, node := range g.Nodes {
+		if node.Subgraph == "" {
+			writeNode(node, "    ")
+		}
+	}
+	for _, subgraph := range g.Subgraphs {
+		builder.WriteString(fmt.Sprintf("    subgraph %s [%s]\n", subgraph.ID, sanitizeMermaidLabel(subgraph.Label)))
+		for _, node := range g.Nodes {
+			if node.Subgraph == subgraph.ID {
+				writeNode(node, "        ")
+			}
+		}
+		builder.WriteString("    end\n")
+	}
+
+	for _, edge := range g.Edges {
+		arrow := "-->"
+		switch edge.Style {
+		case EdgeLink:
+			arrow = "-.->"
+		case EdgeLinkBoth:
+			arrow = "<-.->"
+		}
+		if edge.Label == "" {
+			builder.WriteString(fmt.Sprintf("    %s %s %s\n", edge.From, arrow, edge.To))
+		} else {
+			builder.WriteString(fmt.Sprintf("    %s %s|%s| %s\n", edge.From, arrow, sanitizeMermaidLabel(edge.Label), edge.To))
+		}
+	}
+	return builder.String()
+}
+
+// mermaidShape returns the start and close markers of a node shape
+func mermaidShape(shape NodeShape) (string, string) {
+	switch shape {
+	case ShapeAction:
+		return "( ", ")"
+	case ShapeDecision:
+		return "{ ", " }"
+	case ShapeHat:
+		return "([ ", " ])"
+	case ShapeCall:
+		return "[[ ", " ]]"
+	}
+	return "[", "]"
+}
+
+var dotLabelReplacer = strings.NewReplacer(
+	"\\", "\\\\",
+	"\"", "\\\"",
+	"\n", " ",
+	"\r", " ",
+)
+
+func dotQuote(s string) string {
+	return "\"" + dotLabelReplacer.Replace(s) + "\""
+}
+
+// RenderDOT renders a flowchart as a Graphviz digraph, custom block definitions become clusters
+func RenderDOT(g *Graph) string {
+	var builder strings.Builder
+	builder.WriteString("digraph flowchart {\n")
+	builder.WriteString(fmt.Sprintf("    label=%s;\n", dotQuote(g.Title)))
+	builder.WriteString("    labelloc=t;\n")
+	builder.WriteString("    node [fontname=\"sans-serif\"];\n")
+	builder.WriteString("    edge [fontname=\"sans-serif\"];\n")
+
+	writeNode := func(node Node, indent string) {
+		builder.WriteString(fmt.Sprintf("%s%s [label=%s, %s];\n", indent, dotQuote(node.ID), dotQuote(node.Label), dotShape(node.Shape)))
+	}
+	for _, node := range g.Nodes {
+		if node.Subgraph == "" {
+			writeNode(node, "    ")
+		}
+	}
+	for _, subgraph := range g.Subgraphs {
+		// Graphviz only draws a box around subgraphs named cluster...
+		builder.WriteString(fmt.Sprintf("    subgraph %s {\n", dotQuote("cluster_"+subgraph.ID)))
+		builder.WriteString(fmt.Sprintf("        label=%s;\n", dotQuote(subgraph.Label)))
+		for _, node := range g.Nodes {
+			if node.Subgraph == subgraph.ID {
+				writeNode(node, "        ")
+			}
+		}
+		builder.WriteString("    }\n")
+	}
+
+	for _, edge := range g.Edges {
+		var attrs []string
+		if edge.Label != "" {
+			attrs = append(attrs, "label="+dotQuote(edge.Label))
+		}
+		switch edge.Style {
+		case EdgeLink:
+			attrs = append(attrs, "style=dashed")
+		case EdgeLinkBoth:
+			attrs = append(attrs, "style=dashed", "dir=both")
+		}
+		if len(attrs) == 0 {
+			builder.WriteString(fmt.Sprintf("    %s -> %s;\n", dotQuote(edge.From), dotQuote(edge.To)))
+		} else {
+			builder.WriteString(fmt.Sprintf("    %s -> %s [%s];\n", dotQuote(edge.From), dotQuote(edge.To), strings.Join(attrs, ", ")))
+		}
+	}
+	builder.WriteString("}\n")
+	return builder.String()
+}
+
+// dotShape returns the node attributes of a node shape
+func dotShape(shape NodeShape) string {
+	switch shape {
+	case ShapeAction:
+		return "shape=box, style=rounded"
+	case ShapeDecision:
+		return "shape=diamond"
+	case ShapeHat:
+		return "shape=ellipse"
+	case ShapeCall:
+		return "shape=box, peripheries=2"
+	}
+	return "shape=box"
+}
@@ -0,0 +1,176 @@
+package mermaid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IsHatOpcode reports whether a block starts a script, scripts without one never run
+func IsHatOpcode(opcode string) bool {
+	switch opcode {
+	case "control_start_as_clone", "procedures_definition":
+		return true
+	}
+	// Includes the hats of extensions like videoSensing_whenMotionGreaterThan
+	return strings.Contains(opcode, "_when")
+}
+
+// blockRef identifies a block of a target
+type blockRef struct {
+	target int
+	id     string
+}
+
+// procedureKey identifies a custom block of a target
+type procedureKey struct {
+	target   int
+	procCode string
+}
+
+// addLinks adds dotted edges for control that moves between scripts: custom block calls to their
+// definitions, broadcasts to the scripts that receive them in any sprite, and clone creation to the
+// scripts clones start. Broadcast and wait links both ways since the sender waits for the receivers.
+// prefixes holds the node prefix of each script by target index and top-level block ID
+func addLinks(g *Graph, project *Project, prefixes []map[string]string, idMapper *IDMapper) {
+	nodeName := func(ref blockRef) string {
+		blocks := project.Targets[ref.target].Blocks
+		prefix, ok := prefixes[ref.target][findScriptTop(blocks, ref.id)]
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("%s_%s", prefix, idMapper.GetSafeID(ref.id))
+	}
+	link := func(from, to blockRef, style EdgeStyle, label string) {
+		fromNode, toNode := nodeName(from), nodeName(to)
+		if fromNode == "" || toNode == "" {
+			return
+		}
+		g.addLink(fromNode, toNode, label, style)
+	}
+
+	// Collect the scripts that can be started from other scripts
+	definitions := make(map[procedureKey]blockRef)
+	var receivers []blockRef
+	cloneHats := make(map[int][]blockRef)
+	targetIndex := make(map[string]int)
+	for ti := range project.Targets {
+		target := &project.Targets[ti]
+		if !target.IsStage {
+			targetIndex[target.Name] = ti
+		}
+		for _, id := range sortedBlockIDs(target.Blocks) {
+			block := target.Blocks[id]
+			switch block.Opcode {
+			case "procedures_definition":
+				if prototype, ok := findProcedurePrototype(block, target.Blocks); ok && prototype.Mutation != nil {
+					definitions[procedureKey{ti, prototype.Mutation.ProcCode}] = blockRef{ti, id}
+				}
+			case "event_whenbroadcastreceived":
+				receivers = append(receivers, blockRef{ti, id})
+			case "control_start_as_clone":
+				cloneHats[ti] = append(cloneHats[ti], blockRef{ti, id})
+			}
+		}
+	}
+
+	for ti := range project.Targets {
+		target := &project.Targets[ti]
+		for _, id := range sortedBlockIDs(target.Blocks) {
+			block := target.Blocks[id]
+			from := blockRef{ti, id}
+			switch block.Opcode {
+			case "procedures_call":
+				if block.Mutation != nil {
+					if definition, ok := definitions[procedureKey{ti, block.Mutation.ProcCode}]; ok {
+						link(from, definition, EdgeLink, "")
+					}
+				}
+			case "event_broadcast", "event_broadcastandwait":
+				messageID, message := broadcastMessage(block.Inputs["BROADCAST_INPUT"])
+				if messageID == "" && message == "" {
+					// The message is computed by a reporter and is not known until the project runs
+					continue
+				}
+				style := EdgeLink
+				if block.Opcode == "event_broadcastandwait" {
+					style = EdgeLinkBoth
+				}
+				for _, receiver := range receivers {
+					receiverBlock := project.Targets[receiver.target].Blocks[receiver.id]
+					receiverID, receiverName := fieldMessage(receiverBlock.Fields["BROADCAST_OPTION"])
+					// Match by ID, or by name when one side has no ID
+					if (messageID != "" && messageID == receiverID) || ((messageID == "" || receiverID == "") && strings.EqualFold(message, receiverName)) {
+						link(from, receiver, style, message)
+					}
+				}
+			case "control_create_clone_of":
+				cloneOf := ti
+				if option := cloneOption(block, target.Blocks); option != "_myself_" {
+					index, ok := targetIndex[option]
+					if !ok {
+						continue
+					}
+					cloneOf = index
+				}
+				for _, hat := range cloneHats[cloneOf] {
+					link(from, hat, EdgeLink, "")
+				}
+			}
+		}
+	}
+}
+
+// broadcastMessage returns the ID and name of the message of a broadcast input
+func broadcastMessage(input interface{}) (string, string) {
+	v, ok := input.([]interface{})
+	if !ok || len(v) < 2 {
+		return "", ""
+	}
+	nested, ok := v[1].([]interface{})
+	if !ok || len(nested) < 2 {
+		return "", ""
+	}
+	name, _ := nested[1].(string)
+	var id string
+	if len(nested) >= 3 {
+		id, _ = nested[2].(string)
+	}
+	return id, name
+}
+
+// fieldMessage returns the ID and name of the message of a broadcast field, [name, id]
+func fieldMessage(field interface{}) (string, string) {
+	v, ok := field.([]interface{})
+	if !ok || len(v) == 0 {
+		return "", ""
+	}
+	name, _ := v[0].(string)
+	var id string
+	if len(v) >= 2 {
+		id, _ = v[1].(string)
+	}
+	return id, name
+}
+
+// cloneOption returns the sprite name chosen in the menu of a create clone block, "_myself_" for itself
+func cloneOption(block Block, blocks map[string]Block) string {
+	input, ok := block.Inputs["CLONE_OPTION"].([]interface{})
+	if !ok || len(input) < 2 {
+		return ""
+	}
+	id, ok := input[1].(string)
+	if !ok {
+		return ""
+	}
+	return fieldString(blocks[id].Fields["CLONE_OPTION"])
+}
+
+func sortedBlockIDs(blocks map[string]Block) []string {
+	ids := make([]string, 0, len(blocks))
+	for id := range blocks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
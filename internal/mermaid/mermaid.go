@@ -35,7 +35,7 @@ type IDMapper struct {
 	counter int
 }
 
-// OpcodeTranslator maps opcode to Chinese labels
+// OpcodeTranslator maps opcodes to the labels of a language
 type OpcodeTranslator struct {
 	translations map[string]string
 }
@@ -48,15 +48,20 @@ func NewIDMapper() *IDMapper {
 	}
 }
 
-// NewOpcodeTranslator creates a new opcode translator
+// NewOpcodeTranslator creates a new opcode translator with Chinese labels
 func NewOpcodeTranslator() *OpcodeTranslator {
-	// Load translations from zh-cn.json using embed
+	return NewOpcodeTranslatorForLanguage("zh-CN")
+}
+
+// NewOpcodeTranslatorForLanguage creates an opcode translator for a language code like "en" or "zh-CN".
+// Chinese is used for an empty code, English for languages without translations
+func NewOpcodeTranslatorForLanguage(lang string) *OpcodeTranslator {
 	translator := &OpcodeTranslator{
 		translations: make(map[string]string),
 	}
 
 	// Read translations from embedded file
-	if data, err := TranslationsFS.ReadFile("zh-cn.json"); err == nil {
+	if data, err := TranslationsFS.ReadFile(translationFile(lang)); err == nil {
 		var translations map[string]string
 		if err := json.Unmarshal(data, &translations); err == nil {
 			translator.translations = translations
@@ -66,7 +71,16 @@ func NewOpcodeTranslator() *OpcodeTranslator {
 	return translator
 }
 
-// Translate translates an opcode to Chinese label
+// translationFile returns the embedded translation file of a language
+func translationFile(lang string) string {
+	lang = strings.ToLower(lang)
+	if lang == "" || strings.HasPrefix(lang, "zh") {
+		return "zh-cn.json"
+	}
+	return "en.json"
+}
+
+// Translate translates an opcode to its label
 func (t *OpcodeTranslator) Translate(opcode string) string {
 	// Convert opcode like "motion_gotoxy" to "MOTION_GOTOXY" key format
 	key := strings.ToUpper(strings.ReplaceAll(opcode, ".", "_"))
@@ -74,6 +88,12 @@ func (t *OpcodeTranslator) Translate(opcode string) string {
 	if translation, exists := t.translations[key]; exists {
 		return translation
 	}
+	// Scratch names the messages of operators OPERATORS_JOIN, OPERATORS_LETTEROF...
+	if rest, ok := strings.CutPrefix(key, "OPERATOR_"); ok {
+		if translation, exists := t.translations["OPERATORS_"+strings.ReplaceAll(rest, "_", "")]; exists {
+			return translation
+		}
+	}
 
 	// If no translation found, return a simplified version of the opcode
 	parts := strings.Split(opcode, "_")
@@ -104,24 +124,25 @@ func generateID(text string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(text)))
 }
 
-// GenerateMermaid generates a Mermaid flowchart from a Scratch project
+// GenerateMermaid generates a Mermaid flowchart from a Scratch project, labeled in Chinese
 func GenerateMermaid(project *Project, rootName string) string {
-	var builder strings.Builder
+	return RenderMermaid(BuildFlowchart(project, rootName, NewOpcodeTranslator()))
+}
+
+// BuildFlowchart builds the flowchart of a Scratch project, labeled in the language of the translator
+func BuildFlowchart(project *Project, rootName string, translator *OpcodeTranslator) *Graph {
+	g := newGraph(rootName)
 
 	// Create ID mapper for all blocks
 	idMapper := NewIDMapper()
 
-	// Create translator
-	translator := NewOpcodeTranslator()
+	g.addNode("Start", rootName, ShapeBox)
 
-	// Write header
-	builder.WriteString("flowchart TD\n")
-	builder.WriteString("    Start[")
-	builder.WriteString(sanitizeMermaidLabel(rootName))
-	builder.WriteString("]\n")
+	// Script prefixes of each target, used to link blocks across scripts and sprites
+	prefixes := make([]map[string]string, len(project.Targets))
 
 	// Process each target
-	for _, target := range project.Targets {
+	for ti, target := range project.Targets {
 		// Skip stage if it has no blocks
 		if target.IsStage && len(target.Blocks) == 0 {
 			continue
@@ -135,12 +156,14 @@ func GenerateMermaid(project *Project, rootName string) string {
 		// Create a branch for this target
 		// Use MD5 hash for safe node ID
 		branchHash := generateID(target.Name)
-		builder.WriteString(fmt.Sprintf("    Start --> %s[%s]\n", branchHash, sanitizeMermaidLabel(target.Name)))
+		g.addNode(branchHash, target.Name, ShapeBox)
+		g.addEdge("Start", branchHash, "")
 
 		// Find all top-level blocks (program entry points)
 		topLevelBlocks := findTopLevelBlocks(target.Blocks)
 
 		// Generate flowchart for each top-level block chain
+		prefixes[ti] = make(map[string]string, len(topLevelBlocks))
 		for i, topBlockID := range topLevelBlocks {
 			if topBlockID == "" {
 				continue
@@ -151,21 +174,34 @@ func GenerateMermaid(project *Project, rootName string) string {
 				// Use index in hash for multiple chains
 				prefix = fmt.Sprintf("%s_%d", branchHash, i)
 			}
+			prefixes[ti][topBlockID] = prefix
+
+			visited := make(map[string]bool)
+			topBlock := target.Blocks[topBlockID]
+			if topBlock.Opcode == "procedures_definition" {
+				// Custom blocks are drawn as a subgraph, calls link to it
+				label := GetBlockLabel(topBlock, translator, target.Broadcasts, target.Blocks)
+				g.beginSubgraph(prefix+"_proc", label)
+				generateBlockFlow(g, target.Blocks, topBlockID, prefix, 0, visited, idMapper, translator, target.Broadcasts)
+				g.endSubgraph()
+				continue
+			}
 
 			// Connect the first block to the character node
 			safeID := idMapper.GetSafeID(topBlockID)
 			firstNodeName := fmt.Sprintf("%s_%s", prefix, safeID)
-			builder.WriteString(fmt.Sprintf("    %s --> %s\n", branchHash, firstNodeName))
+			g.addEdge(branchHash, firstNodeName, "")
 
-			visited := make(map[string]bool)
-			generateBlockFlow(&builder, target.Blocks, topBlockID, prefix, 0, visited, idMapper, translator, target.Broadcasts)
+			generateBlockFlow(g, target.Blocks, topBlockID, prefix, 0, visited, idMapper, translator, target.Broadcasts)
 		}
 	}
 
-	return builder.String()
+	addLinks(g, project, prefixes, idMapper)
+
+	return g
 }
 
-// findTopLevelBlocks finds all top-level blocks (entry points)
+// findTopLevelBlocks finds all top-level blocks (entry points), sorted by ID so the output is stable
 func findTopLevelBlocks(blocks map[string]Block) []string {
 	var topLevelIDs []string
 	for id, block := range blocks {
@@ -173,16 +209,17 @@ func findTopLevelBlocks(blocks map[string]Block) []string {
 			topLevelIDs = append(topLevelIDs, id)
 		}
 	}
+	sort.Strings(topLevelIDs)
 	return topLevelIDs
 }
 
 // generateBlockFlow recursively generates the flowchart for a block chain
-func generateBlockFlow(builder *strings.Builder, blocks map[string]Block, blockID string, prefix string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string) {
-	generateBlockFlowWithTarget(builder, blocks, blockID, prefix, depth, visited, idMapper, translator, broadcasts, "")
+func generateBlockFlow(g *Graph, blocks map[string]Block, blockID string, prefix string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string) {
+	generateBlockFlowWithTarget(g, blocks, blockID, prefix, depth, visited, idMapper, translator, broadcasts, "")
 }
 
 // generateBlockFlowWithTarget recursively generates the flowchart for a block chain with a target end node
-func generateBlockFlowWithTarget(builder *strings.Builder, blocks map[string]Block, blockID string, prefix string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string, targetEndNode string) {
+func generateBlockFlowWithTarget(g *Graph, blocks map[string]Block, blockID string, prefix string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string, targetEndNode string) {
 	if blockID == "" || visited[blockID] {
 		return
 	}
@@ -191,7 +228,9 @@ func generateBlockFlowWithTarget(builder *strings.Builder, blocks map[string]Blo
 	// Limit recursion depth
 	if depth > 500 {
 		safeID := idMapper.GetSafeID(blockID)
-		builder.WriteString(fmt.Sprintf("    %s_%s --> %s_%s_loop[无限循环...]\n", prefix, safeID, prefix, safeID))
+		loopNode := fmt.Sprintf("%s_%s_loop", prefix, safeID)
+		g.addNode(loopNode, translator.Translate("FLOWCHART_TOO_DEEP"), ShapeBox)
+		g.addEdge(fmt.Sprintf("%s_%s", prefix, safeID), loopNode, "")
 		return
 	}
 
@@ -205,14 +244,11 @@ func generateBlockFlowWithTarget(builder *strings.Builder, blocks map[string]Blo
 	safeID := idMapper.GetSafeID(blockID)
 	nodeName := fmt.Sprintf("%s_%s", prefix, safeID)
 
-	// Determine node shape based on opcode type
-	nodeShape, nodeShapeClose := getNodeShape(block.Opcode)
-
-	// Write node with appropriate shape
-	builder.WriteString(fmt.Sprintf("    %s%s%s%s\n", nodeName, nodeShape, sanitizeMermaidLabel(label), nodeShapeClose))
+	// Node shape is based on opcode type
+	g.addNode(nodeName, label, getNodeShape(block.Opcode))
 
 	// Handle control blocks with substacks
-	if _, handled := HandleControlBlockWithTarget(builder, blocks, block, nodeName, prefix, blockID, depth, visited, idMapper, translator, broadcasts, targetEndNode); handled {
+	if _, handled := HandleControlBlockWithTarget(g, blocks, block, nodeName, prefix, blockID, depth, visited, idMapper, translator, broadcasts, targetEndNode); handled {
 		return
 	}
 
@@ -220,34 +256,35 @@ func generateBlockFlowWithTarget(builder *strings.Builder, blocks map[string]Blo
 	if block.Next != nil {
 		nextSafeID := idMapper.GetSafeID(*block.Next)
 		nextNodeName := fmt.Sprintf("%s_%s", prefix, nextSafeID)
-		builder.WriteString(fmt.Sprintf("    %s --> %s\n", nodeName, nextNodeName))
-		generateBlockFlowWithTarget(builder, blocks, *block.Next, prefix, depth+1, visited, idMapper, translator, broadcasts, targetEndNode)
-	} else if strings.HasPrefix(block.Opcode, "event_") {
-		// Event blocks might be standalone
-		builder.WriteString(fmt.Sprintf("    %s --> %s_end[结束]\n", nodeName, nodeName))
+		g.addEdge(nodeName, nextNodeName, "")
+		generateBlockFlowWithTarget(g, blocks, *block.Next, prefix, depth+1, visited, idMapper, translator, broadcasts, targetEndNode)
 	} else if targetEndNode != "" {
 		// If no next block but target end node is specified, connect to it
-		builder.WriteString(fmt.Sprintf("    %s --> %s\n", nodeName, targetEndNode))
+		g.addEdge(nodeName, targetEndNode, "")
+	} else if strings.HasPrefix(block.Opcode, "event_") {
+		// Event blocks might be standalone
+		g.addNode(nodeName+"_end", translator.Translate("FLOWCHART_END"), ShapeBox)
+		g.addEdge(nodeName, nodeName+"_end", "")
 	}
 }
 
 // HandleControlBlock handles special control blocks (loops, conditionals)
-func HandleControlBlock(builder *strings.Builder, blocks map[string]Block, block Block, nodeName, prefix, blockID string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string) (bool, bool) {
-	return HandleControlBlockWithTarget(builder, blocks, block, nodeName, prefix, blockID, depth, visited, idMapper, translator, broadcasts, "")
+func HandleControlBlock(g *Graph, blocks map[string]Block, block Block, nodeName, prefix, blockID string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string) (bool, bool) {
+	return HandleControlBlockWithTarget(g, blocks, block, nodeName, prefix, blockID, depth, visited, idMapper, translator, broadcasts, "")
 }
 
 // HandleControlBlockWithTarget handles special control blocks with a target end node
-func HandleControlBlockWithTarget(builder *strings.Builder, blocks map[string]Block, block Block, nodeName, prefix, blockID string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string, targetEndNode string) (bool, bool) {
+func HandleControlBlockWithTarget(g *Graph, blocks map[string]Block, block Block, nodeName, prefix, blockID string, depth int, visited map[string]bool, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string, targetEndNode string) (bool, bool) {
 
 	// Handle FOREVER loop
 	if block.Opcode == "control_forever" {
 		loopContinueNode := fmt.Sprintf("%s_loop_continue", nodeName)
-		builder.WriteString(fmt.Sprintf("    %s[继续循环]\n", loopContinueNode))
+		g.addNode(loopContinueNode, translator.Translate("FLOWCHART_LOOP_CONTINUE"), ShapeBox)
 
 		if substack := getSubstackBlockID(block); substack != "" {
 			substackSafeID := idMapper.GetSafeID(substack)
 			substackNode := fmt.Sprintf("%s_%s", prefix, substackSafeID)
-			builder.WriteString(fmt.Sprintf("    %s --> %s\n", nodeName, substackNode))
+			g.addEdge(nodeName, substackNode, "")
 
 			// Track visited blocks for this loop to avoid cycles in nested structures
 			loopVisited := make(map[string]bool)
@@ -256,85 +293,92 @@ func HandleControlBlockWithTarget(builder *strings.Builder, blocks map[string]Bl
 			}
 
 			// Generate the entire substack chain, forcing it to end at the loop continue node
-			generateBlockFlowWithTarget(builder, blocks, substack, prefix, depth+1, loopVisited, idMapper, translator, broadcasts, loopContinueNode)
+			generateBlockFlowWithTarget(g, blocks, substack, prefix, depth+1, loopVisited, idMapper, translator, broadcasts, loopContinueNode)
 		} else {
 			// Empty loop body still connects through the loop continue node
-			builder.WriteString(fmt.Sprintf("    %s --> %s\n", nodeName, loopContinueNode))
+			g.addEdge(nodeName, loopContinueNode, "")
 		}
 
 		// Loop continue node connects back to the forever node
-		builder.WriteString(fmt.Sprintf("    %s --> %s\n", loopContinueNode, nodeName))
+		g.addEdge(loopContinueNode, nodeName, "")
 		return true, true
 	}
 
 	// Handle IF block
 	if block.Opcode == "control_if" {
 		conditionEndNode := fmt.Sprintf("%s_cond_end", nodeName)
-		builder.WriteString(fmt.Sprintf("    %s[条件结束]\n", conditionEndNode))
+		g.addNode(conditionEndNode, translator.Translate("FLOWCHART_CONDITION_END"), ShapeBox)
 
 		if substack := getSubstackBlockID(block); substack != "" {
 			substackSafeID := idMapper.GetSafeID(substack)
 			substackNode := fmt.Sprintf("%s_%s", prefix, substackSafeID)
-			builder.WriteString(fmt.Sprintf("    %s -->|是| %s\n", nodeName, substackNode))
-			generateBlockFlowWithTarget(builder, blocks, substack, prefix, depth+1, visited, idMapper, translator, broadcasts, conditionEndNode)
+			g.addEdge(nodeName, substackNode, translator.Translate("FLOWCHART_YES"))
+			generateBlockFlowWithTarget(g, blocks, substack, prefix, depth+1, visited, idMapper, translator, broadcasts, conditionEndNode)
 
 			if lastBlockID := findLastBlockInChain(blocks, substack); lastBlockID == "" {
-				builder.WriteString(fmt.Sprintf("    %s --> %s\n", substackNode, conditionEndNode))
+				g.addEdge(substackNode, conditionEndNode, "")
 			}
 		} else {
-			builder.WriteString(fmt.Sprintf("    %s -->|是| %s\n", nodeName, conditionEndNode))
+			g.addEdge(nodeName, conditionEndNode, translator.Translate("FLOWCHART_YES"))
 		}
 
-		builder.WriteString(fmt.Sprintf("    %s -->|否| %s\n", nodeName, conditionEndNode))
+		g.addEdge(nodeName, conditionEndNode, translator.Translate("FLOWCHART_NO"))
 
-		connectEndNodeToNext(builder, conditionEndNode, block, blockID, prefix, blocks, idMapper, translator, broadcasts, depth, visited, targetEndNode)
+		connectEndNodeToNext(g, conditionEndNode, block, blockID, prefix, blocks, idMapper, translator, broadcasts, depth, visited, targetEndNode)
 		return true, true
 	}
 
 	// Handle IF-ELSE block
 	if block.Opcode == "control_if_else" {
 		conditionEndNode := fmt.Sprintf("%s_cond_end", nodeName)
-		builder.WriteString(fmt.Sprintf("    %s[条件结束]\n", conditionEndNode))
+		g.addNode(conditionEndNode, translator.Translate("FLOWCHART_CONDITION_END"), ShapeBox)
 
 		if substack1 := getSubstackBlockID(block); substack1 != "" {
 			substack1SafeID := idMapper.GetSafeID(substack1)
 			substackNode := fmt.Sprintf("%s_%s", prefix, substack1SafeID)
-			builder.WriteString(fmt.Sprintf("    %s -->|是| %s\n", nodeName, substackNode))
-			generateBlockFlowWithTarget(builder, blocks, substack1, prefix, depth+1, visited, idMapper, translator, broadcasts, conditionEndNode)
+			g.addEdge(nodeName, substackNode, translator.Translate("FLOWCHART_YES"))
+			generateBlockFlowWithTarget(g, blocks, substack1, prefix, depth+1, visited, idMapper, translator, broadcasts, conditionEndNode)
 
 			if lastBlockID := findLastBlockInChain(blocks, substack1); lastBlockID == "" {
-				builder.WriteString(fmt.Sprintf("    %s --> %s\n", substackNode, conditionEndNode))
+				g.addEdge(substackNode, conditionEndNode, "")
 			}
 		} else {
-			builder.WriteString(fmt.Sprintf("    %s -->|是| %s\n", nodeName, conditionEndNode))
+			g.addEdge(nodeName, conditionEndNode, translator.Translate("FLOWCHART_YES"))
 		}
 
 		if substack2 := getSubstack2BlockID(block); substack2 != "" {
 			substack2SafeID := idMapper.GetSafeID(substack2)
 			substackNode := fmt.Sprintf("%s_%s", prefix, substack2SafeID)
-			builder.WriteString(fmt.Sprintf("    %s -->|否| %s\n", nodeName, substackNode))
-			generateBlockFlowWithTarget(builder, blocks, substack2, prefix, depth+1, visited, idMapper, translator, broadcasts, conditionEndNode)
+			g.addEdge(nodeName, substackNode, translator.Translate("FLOWCHART_NO"))
+			generateBlockFlowWithTarget(g, blocks, substack2, prefix, depth+1, visited, idMapper, translator, broadcasts, conditionEndNode)
 
 			if lastBlockID := findLastBlockInChain(blocks, substack2); lastBlockID == "" {
-				builder.WriteString(fmt.Sprintf("    %s --> %s\n", substackNode, conditionEndNode))
+				g.addEdge(substackNode, conditionEndNode, "")
 			}
 		} else {
-			builder.WriteString(fmt.Sprintf("    %s -->|否| %s\n", nodeName, conditionEndNode))
+			g.addEdge(nodeName, conditionEndNode, translator.Translate("FLOWCHART_NO"))
 		}
 
-		connectEndNodeToNext(builder, conditionEndNode, block, blockID, prefix, blocks, idMapper, translator, broadcasts, depth, visited, targetEndNode)
+		connectEndNodeToNext(g, conditionEndNode, block, blockID, prefix, blocks, idMapper, translator, broadcasts, depth, visited, targetEndNode)
 		return true, true
 	}
 
-	// Handle REPEAT loop
+	// Handle REPEAT and REPEAT UNTIL loops: the body runs again until the count is reached or the condition is true
 	if block.Opcode == "control_repeat" || block.Opcode == "control_repeat_until" {
 		loopEndNode := fmt.Sprintf("%s_loop_end", nodeName)
-		builder.WriteString(fmt.Sprintf("    %s[循环结束]\n", loopEndNode))
+		loopContinueNode := fmt.Sprintf("%s_loop_continue", nodeName)
+		g.addNode(loopEndNode, translator.Translate("FLOWCHART_LOOP_END"), ShapeBox)
+		g.addNode(loopContinueNode, translator.Translate("FLOWCHART_LOOP_CONTINUE"), ShapeBox)
+
+		runLabel, exitLabel := translator.Translate("FLOWCHART_REPEAT"), translator.Translate("FLOWCHART_DONE")
+		if block.Opcode == "control_repeat_until" {
+			runLabel, exitLabel = translator.Translate("FLOWCHART_NO"), translator.Translate("FLOWCHART_YES")
+		}
 
 		if substack := getSubstackBlockID(block); substack != "" {
 			substackSafeID := idMapper.GetSafeID(substack)
 			substackNode := fmt.Sprintf("%s_%s", prefix, substackSafeID)
-			builder.WriteString(fmt.Sprintf("    %s -->|成立| %s\n", nodeName, substackNode))
+			g.addEdge(nodeName, substackNode, runLabel)
 
 			loopVisited := make(map[string]bool)
 			for k, v := range visited {
@@ -342,17 +386,36 @@ func HandleControlBlockWithTarget(builder *strings.Builder, blocks map[string]Bl
 			}
 
 			if _, exists := blocks[substack]; exists {
-				generateBlockFlowWithTarget(builder, blocks, substack, prefix, depth+1, loopVisited, idMapper, translator, broadcasts, loopEndNode)
+				generateBlockFlowWithTarget(g, blocks, substack, prefix, depth+1, loopVisited, idMapper, translator, broadcasts, loopContinueNode)
 			} else {
-				builder.WriteString(fmt.Sprintf("    %s --> %s\n", substackNode, loopEndNode))
+				g.addEdge(substackNode, loopContinueNode, "")
 			}
 		} else {
-			builder.WriteString(fmt.Sprintf("    %s -->|成立| %s\n", nodeName, loopEndNode))
+			g.addEdge(nodeName, loopContinueNode, runLabel)
 		}
 
-		builder.WriteString(fmt.Sprintf("    %s -->|不成立| %s\n", nodeName, loopEndNode))
+		g.addEdge(loopContinueNode, nodeName, "")
+		g.addEdge(nodeName, loopEndNode, exitLabel)
 
-		connectEndNodeToNext(builder, loopEndNode, block, blockID, prefix, blocks, idMapper, translator, broadcasts, depth, visited, targetEndNode)
+		connectEndNodeToNext(g, loopEndNode, block, blockID, prefix, blocks, idMapper, translator, broadcasts, depth, visited, targetEndNode)
+		return true, true
+	}
+
+	// Handle WAIT UNTIL: the condition is checked again until it is true
+	if block.Opcode == "control_wait_until" {
+		g.addEdge(nodeName, nodeName, translator.Translate("FLOWCHART_NO"))
+		if block.Next != nil {
+			nextNodeName := fmt.Sprintf("%s_%s", prefix, idMapper.GetSafeID(*block.Next))
+			g.addEdge(nodeName, nextNodeName, translator.Translate("FLOWCHART_YES"))
+			generateBlockFlowWithTarget(g, blocks, *block.Next, prefix, depth+1, visited, idMapper, translator, broadcasts, targetEndNode)
+		} else if targetEndNode != "" {
+			g.addEdge(nodeName, targetEndNode, translator.Translate("FLOWCHART_YES"))
+		} else if parentTarget := findParentExitTarget(block, blockID, prefix, blocks, idMapper); parentTarget != "" {
+			g.addEdge(nodeName, parentTarget, translator.Translate("FLOWCHART_YES"))
+		} else {
+			g.addNode(nodeName+"_end", translator.Translate("FLOWCHART_END"), ShapeBox)
+			g.addEdge(nodeName, nodeName+"_end", translator.Translate("FLOWCHART_YES"))
+		}
 		return true, true
 	}
 
@@ -441,35 +504,25 @@ func extractInputValue(input interface{}) string {
 	return ""
 }
 
-var keyOptionTranslations = map[string]string{
-	"space":       "空格",
-	"any":         "任意键",
-	"left arrow":  "左箭头",
-	"right arrow": "右箭头",
-	"up arrow":    "上箭头",
-	"down arrow":  "下箭头",
+// fieldValueKeys maps menu values that are not block opcodes to their translation keys
+var fieldValueKeys = map[string]string{
+	"_mouse_":     "_MOUSE_",
+	"_random_":    "_RANDOM_",
+	"_myself_":    "_MYSELF_",
+	"_edge_":      "_EDGE_",
+	"_stage_":     "_STAGE_",
+	"left-right":  "LEFT-RIGHT",
+	"space":       "KEY_SPACE",
+	"any":         "KEY_ANY",
+	"left arrow":  "KEY_LEFT_ARROW",
+	"right arrow": "KEY_RIGHT_ARROW",
+	"up arrow":    "KEY_UP_ARROW",
+	"down arrow":  "KEY_DOWN_ARROW",
 }
 
 func translateFieldValue(valStr string, translator *OpcodeTranslator) string {
-	switch valStr {
-	case "_mouse_":
-		return "鼠标指针"
-	case "_random_":
-		return "随机位置"
-	case "_myself_":
-		return "自己"
-	case "_edge_":
-		// Try to get translation from zh-cn.json first
-		if translated := translator.Translate("_EDGE_"); translated != "" && translated != "_EDGE_" {
-			return translated
-		}
-		// Fallback to default translation
-		return "舞台边缘"
-	case "left-right":
-		return "左右旋转"
-	}
-	if translated, ok := keyOptionTranslations[strings.ToLower(valStr)]; ok {
-		return translated
+	if key, ok := fieldValueKeys[strings.ToLower(valStr)]; ok {
+		return translator.Translate(key)
 	}
 	if translated := translator.Translate(valStr); translated != "" && translated != valStr {
 		return translated
@@ -488,25 +541,14 @@ func getReferencedBlockLabelRecursive(blockID string, block Block, translator *O
 
 	// Prevent infinite recursion
 	if visited[blockID] {
-		return "循环引用"
+		return translator.Translate("FLOWCHART_CIRCULAR")
 	}
 	visited[blockID] = true
 
 	// Get basic description from fields
 	var parts []string
-	for _, val := range block.Fields {
-		var valStr string
-		switch v := val.(type) {
-		case string:
-			valStr = v
-		case []interface{}:
-			if len(v) > 0 {
-				if str, ok := v[0].(string); ok {
-					valStr = str
-				}
-			}
-		}
-		if valStr != "" {
+	for _, key := range sortedKeys(block.Fields) {
+		if valStr := fieldString(block.Fields[key]); valStr != "" {
 			parts = append(parts, translateFieldValue(valStr, translator))
 		}
 	}
@@ -518,23 +560,17 @@ func getReferencedBlockLabelRecursive(blockID string, block Block, translator *O
 		return parts[0]
 	}
 
-	// Get values from inputs (for sensing blocks, etc.)
-	if strings.HasPrefix(opcode, "operator") || strings.HasPrefix(opcode, "operators") {
-		for _, key := range getOrderedOperatorKeys(opcode, block.Inputs) {
-			if input, exists := block.Inputs[key]; exists {
-				inputValue := resolveInputDisplay(input, translator, broadcasts, blocks, visited)
-				if inputValue != "" {
-					parts = append(parts, inputValue)
-				}
-			}
-		}
-	} else {
-		for _, input := range block.Inputs {
-			inputValue := resolveInputDisplay(input, translator, broadcasts, blocks, visited)
-			if inputValue != "" {
-				parts = append(parts, inputValue)
+	// Get values from inputs in the order of the placeholders, nested reporters become sub-expressions.
+	// Empty inputs are kept so the values still match their placeholders
+	parts = nil
+	for _, key := range argumentKeys(block) {
+		if value, isField := block.Fields[key]; isField {
+			if valStr := fieldString(value); valStr != "" {
+				parts = append(parts, translateFieldValue(valStr, translator))
 			}
+			continue
 		}
+		parts = append(parts, inputLabel(block.Inputs[key], translator, broadcasts, blocks, visited))
 	}
 
 	// Get translation
@@ -560,66 +596,248 @@ func getReferencedBlockLabelRecursive(blockID string, block Block, translator *O
 }
 
 func resolveInputDisplay(input interface{}, translator *OpcodeTranslator, broadcasts map[string]string, blocks map[string]Block, visited map[string]bool) string {
-	switch v := input.(type) {
+	return inputLabel(input, translator, broadcasts, blocks, visited)
+}
+
+// booleanReporters are the reporters with a hexagonal shape in the editor
+var booleanReporters = map[string]bool{
+	"operator_gt":                  true,
+	"operator_lt":                  true,
+	"operator_equals":              true,
+	"operator_and":                 true,
+	"operator_or":                  true,
+	"operator_not":                 true,
+	"operator_contains":            true,
+	"sensing_touchingobject":       true,
+	"sensing_touchingcolor":        true,
+	"sensing_coloristouchingcolor": true,
+	"sensing_keypressed":           true,
+	"sensing_mousedown":            true,
+	"data_listcontainsitem":        true,
+	"argument_reporter_boolean":    true,
+}
+
+// inputLabel renders the value of an input. Reporters placed in the input are rendered as an
+// expression tree the way Scratch text notation does: (reporter) for values and <reporter> for booleans.
+// Shadow blocks such as menus and number fields are shown as their plain value.
+// Inputs are [shadow type, value] or [shadow type, value, obscured shadow], where the value is a block ID,
+// a literal like [4, "10"] or a variable like [12, "score", "id"]
+func inputLabel(input interface{}, translator *OpcodeTranslator, broadcasts map[string]string, blocks map[string]Block, visited map[string]bool) string {
+	v, ok := input.([]interface{})
+	if !ok || len(v) < 2 {
+		if input == nil {
+			return ""
+		}
+		return extractInputValue(input)
+	}
+
+	switch value := v[1].(type) {
+	case nil:
+		// Empty boolean input
+		return ""
+	case string:
+		referencedBlock, exists := blocks[value]
+		if !exists {
+			return value
+		}
+		label := getReferencedBlockLabelRecursive(value, referencedBlock, translator, broadcasts, blocks, visited)
+		if referencedBlock.Shadow {
+			return label
+		}
+		if booleanReporters[referencedBlock.Opcode] {
+			return "<" + label + ">"
+		}
+		return "(" + label + ")"
 	case []interface{}:
-		if len(v) > 1 {
-			if refBlockID, ok := v[1].(string); ok {
-				if referencedBlock, exists := blocks[refBlockID]; exists {
-					return getReferencedBlockLabelRecursive(refBlockID, referencedBlock, translator, broadcasts, blocks, visited)
-				}
-				return refBlockID
+		if len(value) >= 3 {
+			// Variables and lists
+			if kind, ok := value[0].(float64); ok && (kind == 12 || kind == 13) {
+				return fmt.Sprintf("(%v)", value[1])
 			}
 		}
-		return extractInputValue(v)
-	default:
-		return extractInputValue(v)
 	}
+	return extractInputValue(v)
 }
 
-func getOrderedOperatorKeys(opcode string, inputs map[string]interface{}) []string {
-	var ordered []string
-	preferredGroups := [][]string{
-		{"OPERAND1", "OPERAND2", "OPERAND3"},
-		{"NUM1", "NUM2", "NUM3"},
-		{"STRING1", "STRING2"},
-		{"FROM", "TO"},
-		{"A", "B"},
-	}
+// argumentOrder lists the fields and inputs of a block in the order of the %1, %2... placeholders of
+// its translation. Blocks not listed here have at most one argument or only arguments in alphabetical order
+var argumentOrder = map[string][]string{
+	"data_setvariableto":            {"VARIABLE", "VALUE"},
+	"data_changevariableby":         {"VARIABLE", "VALUE"},
+	"data_addtolist":                {"ITEM", "LIST"},
+	"data_deleteoflist":             {"INDEX", "LIST"},
+	"data_insertatlist":             {"ITEM", "INDEX", "LIST"},
+	"data_replaceitemoflist":        {"INDEX", "LIST", "ITEM"},
+	"data_itemoflist":               {"INDEX", "LIST"},
+	"data_itemnumoflist":            {"ITEM", "LIST"},
+	"data_listcontainsitem":         {"LIST", "ITEM"},
+	"event_whengreaterthan":         {"WHENGREATERTHANMENU", "VALUE"},
+	"looks_sayforsecs":              {"MESSAGE", "SECS"},
+	"looks_thinkforsecs":            {"MESSAGE", "SECS"},
+	"looks_changeeffectby":          {"EFFECT", "CHANGE"},
+	"looks_seteffectto":             {"EFFECT", "VALUE"},
+	"looks_goforwardbackwardlayers": {"FORWARD_BACKWARD", "NUM"},
+	"motion_gotoxy":                 {"X", "Y"},
+	"motion_glidesecstoxy":          {"SECS", "X", "Y"},
+	"motion_glideto":                {"SECS", "TO"},
+	"operator_random":               {"FROM", "TO"},
+	"operator_letter_of":            {"LETTER", "STRING"},
+	"operator_mathop":               {"OPERATOR", "NUM"},
+	"sensing_coloristouchingcolor":  {"COLOR", "COLOR2"},
+	"sensing_of":                    {"PROPERTY", "OBJECT"},
+	"sound_changeeffectby":          {"EFFECT", "VALUE"},
+	"sound_seteffectto":             {"EFFECT", "VALUE"},
+}
 
+// argumentKeys returns the field and input names of a block in placeholder order.
+// Known blocks follow argumentOrder, the rest use the operand order of operators and then names in
+// alphabetical order. Stacks of C blocks are not arguments and are left out
+func argumentKeys(block Block) []string {
 	added := make(map[string]bool)
-	for _, group := range preferredGroups {
-		for _, key := range group {
-			if _, exists := inputs[key]; exists && !added[key] {
-				ordered = append(ordered, key)
-				added[key] = true
+	var keys []string
+	add := func(key string) {
+		if added[key] || key == "SUBSTACK" || key == "SUBSTACK2" {
+			return
+		}
+		_, isField := block.Fields[key]
+		_, isInput := block.Inputs[key]
+		if isField || isInput {
+			keys = append(keys, key)
+			added[key] = true
+		}
+	}
+
+	for _, key := range argumentOrder[block.Opcode] {
+		add(key)
+	}
+	for _, key := range []string{"OPERAND1", "OPERAND2", "NUM1", "NUM2", "STRING1", "STRING2"} {
+		add(key)
+	}
+	for _, key := range sortedKeys(block.Fields) {
+		add(key)
+	}
+	for _, key := range sortedKeys(block.Inputs) {
+		add(key)
+	}
+	return keys
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldString returns the value of a field, fields in Scratch are usually [display_value, id]
+func fieldString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			if str, ok := v[0].(string); ok {
+				return str
+			}
+			if v[0] != nil {
+				return fmt.Sprintf("%v", v[0])
 			}
 		}
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
 	}
+	return ""
+}
 
-	var leftovers []string
-	for key := range inputs {
-		if !added[key] {
-			leftovers = append(leftovers, key)
+// procedureSignature renders the proccode of a custom block prototype with its argument names,
+// like "jump (height)" for "jump %s"
+func procedureSignature(prototype Block) string {
+	if prototype.Mutation == nil {
+		return ""
+	}
+	var names []string
+	json.Unmarshal([]byte(prototype.Mutation.ArgumentNames), &names)
+	i := 0
+	return replaceProcArguments(prototype.Mutation.ProcCode, func(placeholder string) string {
+		name := ""
+		if i < len(names) {
+			name = names[i]
 		}
+		i++
+		if placeholder == "%b" {
+			return "<" + name + ">"
+		}
+		return "(" + name + ")"
+	})
+}
+
+// procedureCallLabel renders a custom block call with the values of its arguments
+func procedureCallLabel(block Block, translator *OpcodeTranslator, broadcasts map[string]string, blocks map[string]Block) string {
+	if block.Mutation == nil {
+		return block.Opcode
 	}
-	sort.Strings(leftovers)
-	ordered = append(ordered, leftovers...)
+	var ids []string
+	json.Unmarshal([]byte(block.Mutation.ArgumentIDs), &ids)
+	i := 0
+	return replaceProcArguments(block.Mutation.ProcCode, func(placeholder string) string {
+		value := ""
+		if i < len(ids) {
+			value = inputLabel(block.Inputs[ids[i]], translator, broadcasts, blocks, make(map[string]bool))
+		}
+		i++
+		if value == "" && placeholder == "%b" {
+			// An empty boolean slot
+			return "<>"
+		}
+		return value
+	})
+}
 
-	return ordered
+// replaceProcArguments replaces the %s, %n and %b placeholders of a proccode in order
+func replaceProcArguments(procCode string, replace func(placeholder string) string) string {
+	words := strings.Split(procCode, " ")
+	for i, word := range words {
+		switch word {
+		case "%s", "%n", "%b":
+			words[i] = replace(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// findProcedurePrototype returns the prototype block of a custom block definition
+func findProcedurePrototype(definition Block, blocks map[string]Block) (Block, bool) {
+	if input, ok := definition.Inputs["custom_block"].([]interface{}); ok && len(input) >= 2 {
+		if id, ok := input[1].(string); ok {
+			prototype, exists := blocks[id]
+			return prototype, exists
+		}
+	}
+	return Block{}, false
 }
 
 // GetBlockLabel generates a human-readable label for a block
 func GetBlockLabel(block Block, translator *OpcodeTranslator, broadcasts map[string]string, blocks map[string]Block) string {
 	opcode := block.Opcode
 
+	// Custom blocks are labeled with their own text
+	switch opcode {
+	case "procedures_definition":
+		prototype, _ := findProcedurePrototype(block, blocks)
+		return strings.ReplaceAll(translator.Translate(opcode), "%1", procedureSignature(prototype))
+	case "procedures_call":
+		return procedureCallLabel(block, translator, broadcasts, blocks)
+	}
+
 	// Special handling for control_if and control_if_else - extract CONDITION first
 	if opcode == "control_if" || opcode == "control_if_else" {
 		var conditionLabel string
 		if conditionInput, exists := block.Inputs["CONDITION"]; exists {
 			conditionLabel = resolveInputDisplay(conditionInput, translator, broadcasts, blocks, make(map[string]bool))
-			if conditionLabel == "" {
-				conditionLabel = extractInputValue(conditionInput)
-			}
 		}
 
 		// Get translation
@@ -643,7 +861,7 @@ func GetBlockLabel(block Block, translator *OpcodeTranslator, broadcasts map[str
 
 		// Fallback if no translation or condition exists
 		if conditionLabel != "" {
-			return fmt.Sprintf("如果 %s", conditionLabel)
+			return fmt.Sprintf("if %s", conditionLabel)
 		}
 		// Last fallback
 		if chineseLabel != "" && chineseLabel != simplifiedOpcode {
@@ -661,150 +879,40 @@ func GetBlockLabel(block Block, translator *OpcodeTranslator, broadcasts map[str
 		return opcode
 	}
 
-	// Get fields for more context
+	// Get fields and inputs for more context, in the order of the translation placeholders
 	var fieldVals []string
-	for key, val := range block.Fields {
-		// Special handling for BROADCAST_INPUT
-		if key == "BROADCAST_INPUT" {
-			switch v := val.(type) {
-			case []interface{}:
+	for _, key := range argumentKeys(block) {
+		if val, isField := block.Fields[key]; isField {
+			// Special handling for BROADCAST_INPUT
+			if key == "BROADCAST_INPUT" {
 				// Format: [display_name, broadcast_id]
-				if len(v) >= 2 {
+				if v, ok := val.([]interface{}); ok && len(v) >= 2 {
 					if id, ok := v[1].(string); ok {
-						// Try to find the broadcast name using the ID
+						// Try to find the broadcast name using the ID, fallback to display name
 						if name, exists := broadcasts[id]; exists {
 							fieldVals = append(fieldVals, name)
-						} else if len(v) > 0 {
-							// Fallback to display name if ID lookup fails
-							if displayName, ok := v[0].(string); ok {
-								fieldVals = append(fieldVals, displayName)
-							}
+						} else if displayName, ok := v[0].(string); ok {
+							fieldVals = append(fieldVals, displayName)
 						}
 					}
 				}
+				continue
 			}
-			continue
-		}
-
-		var valStr string
-		switch v := val.(type) {
-		case string:
-			valStr = v
-		case []interface{}:
-			// Fields in Scratch are usually [display_value, id]
-			if len(v) > 0 {
-				if str, ok := v[0].(string); ok {
-					valStr = str
-				} else {
-					valStr = fmt.Sprintf("%v", v[0])
-				}
+			if valStr := fieldString(val); valStr != "" {
+				fieldVals = append(fieldVals, translateFieldValue(valStr, translator))
 			}
-		default:
-			valStr = fmt.Sprintf("%v", v)
-		}
-		if valStr != "" {
-			fieldVals = append(fieldVals, translateFieldValue(valStr, translator))
+			continue
 		}
-	}
 
-	// Special handling for motion_gotoxy - needs ordered X and Y values
-	if opcode == "motion_gotoxy" {
-		for _, key := range []string{"X", "Y"} {
-			if input, exists := block.Inputs[key]; exists {
-				value := resolveInputDisplay(input, translator, broadcasts, blocks, make(map[string]bool))
-				if value == "" {
-					value = extractInputValue(input)
-				}
-				fieldVals = append(fieldVals, value)
-			}
-		}
-	} else {
-		// Also get input values
-		for key, input := range block.Inputs {
-			// Skip SUBSTACK input for control blocks (it's the loop body, not a parameter)
-			if key == "SUBSTACK" || key == "SUBSTACK2" {
-				continue
-			}
-			// Special handling for BROADCAST_INPUT
-			if key == "BROADCAST_INPUT" {
-				switch v := input.(type) {
-				case []interface{}:
-					if len(v) > 1 {
-						// Format: [type, [11, "display_name", "broadcast_id"]]
-						if nested, ok := v[1].([]interface{}); ok && len(nested) >= 3 {
-							// Use the third element which is the broadcast ID
-							if id, ok := nested[2].(string); ok {
-								// Try to find the broadcast name using the ID
-								if name, exists := broadcasts[id]; exists {
-									fieldVals = append(fieldVals, name)
-								} else if len(nested) > 1 {
-									// Fallback to display name if ID lookup fails
-									if displayName, ok := nested[1].(string); ok {
-										fieldVals = append(fieldVals, displayName)
-									}
-								}
-							}
-						} else if nested, ok := v[1].([]interface{}); ok && len(nested) >= 2 {
-							// If only two elements, use the second one as display name
-							if displayName, ok := nested[1].(string); ok {
-								fieldVals = append(fieldVals, displayName)
-							}
-						}
-					}
-				}
+		input := block.Inputs[key]
+		// Special handling for BROADCAST_INPUT
+		if key == "BROADCAST_INPUT" {
+			if name := broadcastName(input, broadcasts); name != "" {
+				fieldVals = append(fieldVals, name)
 				continue
 			}
-
-			switch v := input.(type) {
-			case []interface{}:
-				if len(v) > 1 {
-					// Check if the second element is a block ID reference
-					if blockID, ok := v[1].(string); ok {
-						// Try to resolve the referenced block
-						if referencedBlock, exists := blocks[blockID]; exists {
-							// Get a simplified label for the referenced block to avoid recursion
-							refLabel := getReferencedBlockLabel(blockID, referencedBlock, translator, broadcasts, blocks)
-							if refLabel != "" {
-								fieldVals = append(fieldVals, refLabel)
-							} else {
-								// Fallback: get the field value from the referenced block
-								var refValue string
-								for _, fieldVal := range referencedBlock.Fields {
-									switch fv := fieldVal.(type) {
-									case string:
-										refValue = fv
-									case []interface{}:
-										// Handle array like ["_mouse_"]
-										if len(fv) > 0 {
-											if str, ok := fv[0].(string); ok {
-												refValue = str
-											}
-										}
-									}
-									break // Only take the first field value
-								}
-								if refValue != "" {
-									fieldVals = append(fieldVals, translateFieldValue(refValue, translator))
-								} else {
-									fieldVals = append(fieldVals, blockID)
-								}
-							}
-						} else {
-							// Not a block reference, just a string value
-							fieldVals = append(fieldVals, blockID)
-						}
-					} else if str, ok := v[1].([]interface{}); ok && len(str) > 0 {
-						// This is a nested array, use extractInputValue
-						fieldVals = append(fieldVals, extractInputValue(v))
-					} else {
-						fieldVals = append(fieldVals, extractInputValue(v[1]))
-					}
-				} else {
-					// Simple input value
-					fieldVals = append(fieldVals, extractInputValue(v))
-				}
-			}
 		}
+		fieldVals = append(fieldVals, inputLabel(input, translator, broadcasts, blocks, make(map[string]bool)))
 	}
 
 	// Build label
@@ -842,7 +950,7 @@ func GetBlockLabel(block Block, translator *OpcodeTranslator, broadcasts map[str
 	if chineseLabel == "" || chineseLabel == opcode {
 		// Fallback to showing key fields
 		if len(fieldVals) > 0 {
-			return action + ": " + strings.Join(fieldVals, ", ")
+			return label
 		}
 		return action
 	}
@@ -850,26 +958,35 @@ func GetBlockLabel(block Block, translator *OpcodeTranslator, broadcasts map[str
 	return chineseLabel
 }
 
-// getNodeShape returns the appropriate Mermaid node shape based on opcode type
-// Returns start and close markers
-func getNodeShape(opcode string) (string, string) {
-	// Decision blocks (conditionals) - use diamond shape
-	if strings.Contains(opcode, "control_if") || strings.Contains(opcode, "operator") {
-		return "{ ", " }"
+// broadcastName returns the name of the message of a broadcast input, "" when a reporter computes it
+func broadcastName(input interface{}, broadcasts map[string]string) string {
+	id, name := broadcastMessage(input)
+	if broadcastName, exists := broadcasts[id]; exists && id != "" {
+		return broadcastName
+	}
+	return name
+}
+
+// getNodeShape returns the node shape of a block based on its opcode type
+func getNodeShape(opcode string) NodeShape {
+	// Decision blocks (conditionals)
+	if strings.Contains(opcode, "control_if") || strings.Contains(opcode, "operator") ||
+		opcode == "control_repeat_until" || opcode == "control_wait_until" {
+		return ShapeDecision
 	}
 
-	// Event blocks - use round shape
-	if strings.HasPrefix(opcode, "event_") {
-		return "( ", ")"
+	// Hat blocks start a script
+	if IsHatOpcode(opcode) {
+		return ShapeHat
 	}
 
-	// Broadcast and stop blocks - use round shape
-	if strings.Contains(opcode, "broadcast") || strings.Contains(opcode, "stop") {
-		return "( ", ")"
+	// Custom block calls
+	if opcode == "procedures_call" {
+		return ShapeCall
 	}
 
-	// Regular action blocks - use round shape
-	return "( ", ")"
+	// Regular action blocks, including events, broadcasts and stop blocks
+	return ShapeAction
 }
 
 func findNearestLoopAncestorNode(block Block, blocks map[string]Block, idMapper *IDMapper, prefix string) string {
@@ -894,28 +1011,29 @@ func findNearestLoopAncestorNode(block Block, blocks map[string]Block, idMapper
 	return ""
 }
 
-func connectEndNodeToNext(builder *strings.Builder, endNode string, block Block, blockID string, prefix string, blocks map[string]Block, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string, depth int, visited map[string]bool, targetEndNode string) {
-	if targetEndNode != "" {
-		// If target end node is specified, connect to it instead of finding parent
-		builder.WriteString(fmt.Sprintf("    %s --> %s\n", endNode, targetEndNode))
-		return
-	}
-
+func connectEndNodeToNext(g *Graph, endNode string, block Block, blockID string, prefix string, blocks map[string]Block, idMapper *IDMapper, translator *OpcodeTranslator, broadcasts map[string]string, depth int, visited map[string]bool, targetEndNode string) {
+	// The blocks after a control block come first, the target end node is where the whole chain ends
 	if block.Next != nil {
 		nextSafeID := idMapper.GetSafeID(*block.Next)
 		nextNodeName := fmt.Sprintf("%s_%s", prefix, nextSafeID)
-		builder.WriteString(fmt.Sprintf("    %s --> %s\n", endNode, nextNodeName))
-		generateBlockFlow(builder, blocks, *block.Next, prefix, depth+1, visited, idMapper, translator, broadcasts)
+		g.addEdge(endNode, nextNodeName, "")
+		generateBlockFlowWithTarget(g, blocks, *block.Next, prefix, depth+1, visited, idMapper, translator, broadcasts, targetEndNode)
+		return
+	}
+
+	if targetEndNode != "" {
+		g.addEdge(endNode, targetEndNode, "")
 		return
 	}
 
 	if parentTarget := findParentExitTarget(block, blockID, prefix, blocks, idMapper); parentTarget != "" {
-		builder.WriteString(fmt.Sprintf("    %s --> %s\n", endNode, parentTarget))
+		g.addEdge(endNode, parentTarget, "")
 		return
 	}
 
 	endNodeName := fmt.Sprintf("%s_end", endNode)
-	builder.WriteString(fmt.Sprintf("    %s --> %s[结束]\n", endNode, endNodeName))
+	g.addNode(endNodeName, translator.Translate("FLOWCHART_END"), ShapeBox)
+	g.addEdge(endNode, endNodeName, "")
 }
 
 func findParentExitTarget(block Block, blockID string, prefix string, blocks map[string]Block, idMapper *IDMapper) string {
@@ -956,19 +1074,21 @@ func findParentExitTarget(block Block, blockID string, prefix string, blocks map
 
 func isControlBlockWithEnd(opcode string) bool {
 	switch opcode {
-	case "control_if", "control_if_else", "control_repeat", "control_repeat_until":
+	case "control_if", "control_if_else", "control_forever", "control_repeat", "control_repeat_until":
 		return true
 	default:
 		return false
 	}
 }
 
+// getControlBlockEndNodeName returns where a chain nested in the control block goes when it ends:
+// the end of a conditional, or back to the start of a loop
 func getControlBlockEndNodeName(opcode, nodeName string) string {
 	switch opcode {
 	case "control_if", "control_if_else":
 		return fmt.Sprintf("%s_cond_end", nodeName)
-	case "control_repeat", "control_repeat_until":
-		return fmt.Sprintf("%s_loop_end", nodeName)
+	case "control_forever", "control_repeat", "control_repeat_until":
+		return fmt.Sprintf("%s_loop_continue", nodeName)
 	default:
 		return ""
 	}
@@ -0,0 +1,162 @@
+package mermaid
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestGenerateFlowchartGolden renders each testdata/flowchart/<family>.json in the text formats and compares
+// it with <family>.mmd, .dot and .puml, run with -update to rewrite the golden files after an intended change
+func TestGenerateFlowchartGolden(t *testing.T) {
+	families := []string{"control", "procedures", "broadcast", "clone", "expressions"}
+	formats := map[Format]string{FormatMermaid: ".mmd", FormatDOT: ".dot", FormatPlantUML: ".puml"}
+	for _, family := range families {
+		project := loadFlowchartProject(t, family)
+		for format, ext := range formats {
+			t.Run(family+ext, func(t *testing.T) {
+				got, err := GenerateFlowchart(project, family, format, NewOpcodeTranslator())
+				require.NoError(t, err)
+				golden := filepath.Join("testdata", "flowchart", family+ext)
+				if *update {
+					require.NoError(t, os.WriteFile(golden, []byte(got), 0644))
+				}
+				want, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				assert.Equal(t, string(want), got)
+			})
+		}
+	}
+
+	// GenerateMermaid keeps the Chinese labels
+	assert.Equal(t, RenderMermaid(BuildFlowchart(loadFlowchartProject(t, "control"), "control", NewOpcodeTranslator())),
+		GenerateMermaid(loadFlowchartProject(t, "control"), "control"))
+}
+
+func TestGenerateFlowchartEnglish(t *testing.T) {
+	project := loadFlowchartProject(t, "control")
+	got, err := GenerateFlowchart(project, "control", FormatMermaid, NewOpcodeTranslatorForLanguage("en-US"))
+	require.NoError(t, err)
+	assert.Contains(t, got, "[End loop]")
+	assert.Contains(t, got, "[End if]")
+	assert.Contains(t, got, "[Next iteration]")
+	assert.Contains(t, got, "-->|yes|")
+	assert.Contains(t, got, "repeat until &lt;&#40;score&#41; &gt; 50&gt;")
+	assert.Contains(t, got, "touching edge?")
+	assert.NotRegexp(t, `\p{Han}`, got)
+
+	_, err = GenerateFlowchart(project, "control", Format("svg"), NewOpcodeTranslator())
+	assert.Error(t, err)
+}
+
+// Every label has an English translation
+func TestTranslationsComplete(t *testing.T) {
+	zh, err := TranslationsFS.ReadFile("zh-cn.json")
+	require.NoError(t, err)
+	en, err := TranslationsFS.ReadFile("en.json")
+	require.NoError(t, err)
+	var zhLabels, enLabels map[string]string
+	require.NoError(t, json.Unmarshal(zh, &zhLabels))
+	require.NoError(t, json.Unmarshal(en, &enLabels))
+	for key := range zhLabels {
+		assert.Contains(t, enLabels, key)
+	}
+	assert.Len(t, enLabels, len(zhLabels))
+}
+
+func TestRenderExcalidraw(t *testing.T) {
+	g := BuildFlowchart(loadFlowchartProject(t, "procedures"), "procedures", NewOpcodeTranslator())
+	data, err := RenderExcalidraw(g)
+	require.NoError(t, err)
+
+	var scene struct {
+		Type     string `json:"type"`
+		Elements []struct {
+			ID            string  `json:"id"`
+			Type          string  `json:"type"`
+			X             float64 `json:"x"`
+			Y             float64 `json:"y"`
+			Height        float64 `json:"height"`
+			FrameID       *string `json:"frameId"`
+			ContainerID   *string `json:"containerId"`
+			BoundElements []struct {
+				ID string `json:"id"`
+			} `json:"boundElements"`
+			StartBinding *struct {
+				ElementID string `json:"elementId"`
+			} `json:"startBinding"`
+			EndBinding *struct {
+				ElementID string `json:"elementId"`
+			} `json:"endBinding"`
+		} `json:"elements"`
+	}
+	require.NoError(t, json.Unmarshal(data, &scene))
+	assert.Equal(t, "excalidraw", scene.Type)
+
+	byID := make(map[string]int)
+	counts := make(map[string]int)
+	for i, e := range scene.Elements {
+		byID[e.ID] = i
+		counts[e.Type]++
+	}
+	assert.Equal(t, len(g.Edges), counts["arrow"])
+	assert.Equal(t, 1, counts["frame"])
+
+	for _, e := range scene.Elements {
+		// Bindings and containers point to elements of the scene
+		if e.StartBinding != nil {
+			assert.Contains(t, byID, e.StartBinding.ElementID)
+			assert.Contains(t, byID, e.EndBinding.ElementID)
+		}
+		if e.ContainerID != nil {
+			assert.Contains(t, byID, *e.ContainerID)
+		}
+		for _, bound := range e.BoundElements {
+			assert.Contains(t, byID, bound.ID)
+		}
+	}
+
+	// The definition is in a frame, the calls are not, and the blocks of a script flow down
+	definition := scene.Elements[byID[g.Subgraphs[0].ID]]
+	for _, node := range g.Nodes {
+		e := scene.Elements[byID[node.ID]]
+		if node.Subgraph != "" {
+			require.NotNil(t, e.FrameID)
+			assert.Equal(t, definition.ID, *e.FrameID)
+		} else {
+			assert.Nil(t, e.FrameID)
+		}
+	}
+	for _, edge := range g.Edges {
+		from, to := scene.Elements[byID[edge.From]], scene.Elements[byID[edge.To]]
+		if edge.Style == EdgeFlow && !strings.HasSuffix(edge.From, "_loop_continue") {
+			assert.Greater(t, to.Y, from.Y, "%s -> %s", edge.From, edge.To)
+		}
+	}
+}
+
+func loadFlowchartProject(t *testing.T, family string) *Project {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "flowchart", family+".json"))
+	require.NoError(t, err)
+	project, err := ParseProject(data)
+	require.NoError(t, err)
+	return project
+}
+
+func TestIsHatOpcode(t *testing.T) {
+	assert.True(t, IsHatOpcode("event_whenflagclicked"))
+	assert.True(t, IsHatOpcode("procedures_definition"))
+	assert.True(t, IsHatOpcode("control_start_as_clone"))
+	assert.True(t, IsHatOpcode("videoSensing_whenMotionGreaterThan"))
+	assert.False(t, IsHatOpcode("procedures_call"))
+	assert.False(t, IsHatOpcode("motion_movesteps"))
+}
@@ -0,0 +1,106 @@
+package mermaid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderPlantUML renders the scripts of a Scratch project as a PlantUML activity diagram with a partition
+// for each sprite. Control blocks become if, while and repeat, control moving between scripts like
+// broadcasts is not drawn since activity diagrams have no edges between flows
+func RenderPlantUML(project *Project, rootName string, translator *OpcodeTranslator) string {
+	var builder strings.Builder
+	builder.WriteString("@startuml\n")
+	builder.WriteString(fmt.Sprintf("title %s\n", plantUMLText(rootName)))
+
+	for _, target := range project.Targets {
+		if len(target.Blocks) == 0 {
+			continue
+		}
+		w := &plantUMLWriter{
+			builder:    &builder,
+			blocks:     target.Blocks,
+			broadcasts: target.Broadcasts,
+			translator: translator,
+		}
+		builder.WriteString(fmt.Sprintf("partition \"%s\" {\n", strings.ReplaceAll(plantUMLText(target.Name), "\"", "'")))
+		for _, topBlockID := range findTopLevelBlocks(target.Blocks) {
+			builder.WriteString("start\n")
+			// A script ending in a forever loop never stops
+			if !w.writeChain(topBlockID, 0, make(map[string]bool)) {
+				builder.WriteString("stop\n")
+			}
+		}
+		builder.WriteString("}\n")
+	}
+
+	builder.WriteString("@enduml\n")
+	return builder.String()
+}
+
+type plantUMLWriter struct {
+	builder    *strings.Builder
+	blocks     map[string]Block
+	broadcasts map[string]string
+	translator *OpcodeTranslator
+}
+
+// writeChain writes a block and the blocks after it, and reports whether the chain ends in a forever loop
+func (w *plantUMLWriter) writeChain(blockID string, depth int, visited map[string]bool) bool {
+	endless := false
+	for blockID != "" && !visited[blockID] {
+		visited[blockID] = true
+		block, exists := w.blocks[blockID]
+		if !exists {
+			break
+		}
+
+		indent := strings.Repeat("  ", depth)
+		label := plantUMLText(GetBlockLabel(block, w.translator, w.broadcasts, w.blocks))
+		yes, no := w.translator.Translate("FLOWCHART_YES"), w.translator.Translate("FLOWCHART_NO")
+		endless = false
+		switch block.Opcode {
+		case "control_if", "control_if_else":
+			w.printf("%sif (%s) then (%s)\n", indent, label, yes)
+			w.writeChain(getSubstackBlockID(block), depth+1, visited)
+			if block.Opcode == "control_if_else" {
+				w.printf("%selse (%s)\n", indent, no)
+				w.writeChain(getSubstack2BlockID(block), depth+1, visited)
+			}
+			w.printf("%sendif\n", indent)
+		case "control_forever":
+			w.printf("%srepeat\n", indent)
+			w.writeChain(getSubstackBlockID(block), depth+1, visited)
+			w.printf("%srepeat while (%s)\n", indent, label)
+			endless = true
+		case "control_repeat":
+			w.printf("%swhile (%s) is (%s)\n", indent, label, w.translator.Translate("FLOWCHART_REPEAT"))
+			w.writeChain(getSubstackBlockID(block), depth+1, visited)
+			w.printf("%sendwhile (%s)\n", indent, w.translator.Translate("FLOWCHART_DONE"))
+		case "control_repeat_until":
+			w.printf("%swhile (%s) is (%s)\n", indent, label, no)
+			w.writeChain(getSubstackBlockID(block), depth+1, visited)
+			w.printf("%sendwhile (%s)\n", indent, yes)
+		case "control_wait_until":
+			w.printf("%swhile (%s) is (%s)\n", indent, label, no)
+			w.printf("%sendwhile (%s)\n", indent, yes)
+		default:
+			w.printf("%s:%s;\n", indent, label)
+		}
+
+		if block.Next == nil {
+			break
+		}
+		blockID = *block.Next
+	}
+	return endless
+}
+
+func (w *plantUMLWriter) printf(format string, args ...interface{}) {
+	w.builder.WriteString(fmt.Sprintf(format, args...))
+}
+
+// plantUMLText keeps a label on one line, a line break would end the activity
+func plantUMLText(label string) string {
+	return strings.Join(strings.Fields(label), " ")
+}
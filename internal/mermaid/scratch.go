@@ -2,6 +2,7 @@ package mermaid
 
 import (
 	"archive/zip"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,6 +21,18 @@ type Target struct {
 	Blocks     map[string]Block  `json:"blocks"`
 	IsVisible  bool              `json:"visible"`
 	Broadcasts map[string]string `json:"broadcasts"`
+	// Variables and Lists map an ID to [name, value], cloud variables have a third element
+	Variables map[string][]interface{} `json:"variables"`
+	Lists     map[string][]interface{} `json:"lists"`
+	Costumes  []Costume                `json:"costumes"`
+}
+
+// Costume represents a costume (or stage backdrop) of a target
+type Costume struct {
+	Name       string `json:"name"`
+	AssetID    string `json:"assetId"`
+	MD5Ext     string `json:"md5ext"`
+	DataFormat string `json:"dataFormat"`
 }
 
 // Block represents a Scratch block
@@ -27,9 +40,40 @@ type Block struct {
 	Opcode   string                 `json:"opcode"`
 	Next     *string                `json:"next"`
 	Parent   *string                `json:"parent"`
+	Shadow   bool                   `json:"shadow"`
 	TopLevel bool                   `json:"topLevel"`
 	Fields   map[string]interface{} `json:"fields"`
 	Inputs   map[string]interface{} `json:"inputs"`
+	Mutation *Mutation              `json:"mutation,omitempty"`
+}
+
+// Mutation holds the extra data of custom block prototypes and calls
+type Mutation struct {
+	ProcCode      string `json:"proccode"`      // like "jump %s times", %s and %n are values and %b is a boolean
+	ArgumentIDs   string `json:"argumentids"`   // JSON encoded list of the input names of the arguments
+	ArgumentNames string `json:"argumentnames"` // JSON encoded list of the argument names, only on prototypes
+}
+
+// UnmarshalJSON skips top-level variable and list reporters, which Scratch stores
+// as arrays like [12, "name", "id", x, y] instead of block objects
+func (b *Block) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		*b = Block{}
+		return nil
+	}
+	type plainBlock Block
+	return json.Unmarshal(data, (*plainBlock)(b))
+}
+
+// Scripts groups the IDs of all blocks of the target by script,
+// keyed by the ID of the top-level block the script starts with
+func (t *Target) Scripts() map[string][]string {
+	scripts := make(map[string][]string)
+	for id := range t.Blocks {
+		top := findScriptTop(t.Blocks, id)
+		scripts[top] = append(scripts[top], id)
+	}
+	return scripts
 }
 
 // ParseSB3 parses a Scratch .sb3 file and returns the project data
@@ -62,13 +106,15 @@ func ParseSB3(filename string) (*Project, error) {
 		return nil, fmt.Errorf("project.json not found in sb3 file")
 	}
 
-	// Parse JSON
+	return ParseProject(projectData)
+}
+
+// ParseProject parses the content of a project.json file
+func ParseProject(data []byte) (*Project, error) {
 	var project Project
-	err = json.Unmarshal(projectData, &project)
-	if err != nil {
+	if err := json.Unmarshal(data, &project); err != nil {
 		return nil, fmt.Errorf("failed to parse project.json: %w", err)
 	}
-
 	return &project, nil
 }
 
@@ -2,6 +2,6 @@ package mermaid
 
 import "embed"
 
-//go:embed zh-cn.json
+//go:embed zh-cn.json en.json
 var TranslationsFS embed.FS
 
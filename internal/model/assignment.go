@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Assignment 作业模型，挂在班级课程（ClassCourse）的某个课时上
+type Assignment struct {
+	ID          uint   `json:"id" gorm:"primarykey;autoIncrement"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+	DeletedAt   *int64 `json:"deleted_at,omitempty" gorm:"index"`
+	ClassID     uint   `json:"class_id" gorm:"not null;index:idx_assignment_class_lesson"`  // 班级ID
+	CourseID    uint   `json:"course_id" gorm:"not null;index"`                             // 课程ID
+	LessonID    uint   `json:"lesson_id" gorm:"not null;index:idx_assignment_class_lesson"` // 课时ID
+	TeacherID   uint   `json:"teacher_id" gorm:"not null;index"`                            // 布置作业的教师ID
+	Title       string `json:"title" gorm:"size:200;not null"`                              // 作业标题
+	Description string `json:"description" gorm:"type:text"`                                // 作业要求
+	ProjectType int    `json:"project_type" gorm:"default:0"`                               // 要求提交的项目类型，0 表示不限
+	DueAt       int64  `json:"due_at" gorm:"default:0;index"`                               // 截止时间 Unix 时间戳，0 表示不限
+	AllowLate   bool   `json:"allow_late" gorm:"default:false"`                             // 截止后是否允许迟交
+	IsPublished bool   `json:"is_published" gorm:"default:false"`                           // 是否对学生可见
+}
+
+func (a *Assignment) TableName() string {
+	return "assignments"
+}
+
+// IsOverdue 判断给定时间是否已超过截止时间
+func (a *Assignment) IsOverdue(now time.Time) bool {
+	return a.DueAt > 0 && now.Unix() > a.DueAt
+}
+
+// BeforeCreate GORM钩子，在创建前设置时间戳
+func (a *Assignment) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now().Unix()
+	a.CreatedAt = now
+	a.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM钩子，在更新前设置时间戳
+func (a *Assignment) BeforeUpdate(tx *gorm.DB) error {
+	a.UpdatedAt = time.Now().Unix()
+	return nil
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// 审计事件的操作
+const (
+	AuditActionDeleteUser         = "user.delete"            // 删除用户
+	AuditActionSetUserRole        = "user.set_role"          // 修改用户角色
+	AuditActionDeleteScratch      = "scratch_project.delete" // 删除 Scratch 项目
+	AuditActionDeleteClass        = "class.delete"           // 删除班级
+	AuditActionSetClassMemberRole = "class.set_member_role"  // 设置班级成员角色
+	AuditActionDeleteProgram      = "program.delete"         // 管理员删除程序
+	AuditActionCreateRole         = "role.create"            // 创建角色
+	AuditActionUpdateRole         = "role.update"            // 修改角色权限
+	AuditActionDeleteRole         = "role.delete"            // 删除角色
+	AuditActionCreateShare        = "share.create"           // 创建分享
+)
+
+// 审计事件的资源类型
+const (
+	AuditResourceUser    = "user"
+	AuditResourceScratch = "scratch_project"
+	AuditResourceClass   = "class"
+	AuditResourceProgram = "program"
+	AuditResourceRole    = "role"
+	AuditResourceShare   = "share"
+)
+
+// AuditEvent 管理操作和删除操作的审计记录，写入后不修改
+type AuditEvent struct {
+	ID           uint      `gorm:"primarykey;autoIncrement" json:"id"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+	ActorID      uint      `gorm:"index" json:"actor_id"`       // 执行操作的用户
+	ActorName    string    `gorm:"size:50" json:"actor_name"`   // 操作时的用户名，用户删除后仍然可以看到
+	Action       string    `gorm:"size:50;index" json:"action"` // 操作，见 AuditAction 常量
+	ResourceType string    `gorm:"size:50;index:idx_audit_resource" json:"resource_type"`
+	ResourceID   string    `gorm:"size:100;index:idx_audit_resource" json:"resource_id"` // 角色等资源用名称标识，所以是字符串
+	Before       string    `gorm:"type:text" json:"before"`                              // 操作前的资源 JSON，创建时为空
+	After        string    `gorm:"type:text" json:"after"`                               // 操作后的资源 JSON，删除时为空
+	IP           string    `gorm:"size:64" json:"ip"`
+}
+
+func (e *AuditEvent) TableName() string {
+	return "audit_events"
+}
@@ -22,6 +22,12 @@ type Class struct {
 	Students    []User    `json:"students" gorm:"many2many:class_users"`  // 学生列表
 	Courses     []Course  `json:"courses" gorm:"many2many:class_courses"` // 课程列表
 	IsActive    bool      `json:"is_active" gorm:"default:true"`          // 是否激活
+
+	CodeExpiresAt   int64 `json:"code_expires_at" gorm:"default:0"`      // 邀请码过期时间 Unix 时间戳，0 表示不过期
+	MaxStudents     int   `json:"max_students" gorm:"default:0"`         // 最多可加入的学生数，0 表示不限
+	RequireApproval bool  `json:"require_approval" gorm:"default:false"` // 通过邀请码加入时是否需要老师审核
+
+	PictureLogin bool `json:"picture_login" gorm:"default:false"` // 是否允许学生用图片密码和二维码登录卡登录
 }
 
 func (c *Class) TableName() string {
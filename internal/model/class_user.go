@@ -6,6 +6,12 @@ import (
 	"gorm.io/gorm"
 )
 
+// 班级成员状态
+const (
+	ClassUserStatusActive  = "active"  // 正常成员
+	ClassUserStatusPending = "pending" // 通过邀请码申请加入，等待老师审核
+)
+
 // ClassUser 班级与用户的关联表
 type ClassUser struct {
 	ClassID   uint   `json:"class_id" gorm:"not null;index"`    // 班级ID
@@ -16,6 +22,8 @@ type ClassUser struct {
 	CreatedAt int64  `json:"created_at"`                        // 创建时间 Unix 时间戳
 	UpdatedAt int64  `json:"updated_at"`                        // 更新时间 Unix 时间戳
 	DeletedAt *int64 `json:"deleted_at,omitempty" gorm:"index"` // 删除时间 Unix 时间戳
+
+	Status string `json:"status" gorm:"size:20;default:'active'"` // 成员状态，待审核的成员 IsActive 为 false
 }
 
 func (c *ClassUser) TableName() string {
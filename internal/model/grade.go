@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Grade 老师对一次作业提交的评分，每个提交最多一条
+type Grade struct {
+	ID           uint   `json:"id" gorm:"primarykey;autoIncrement"`
+	CreatedAt    int64  `json:"created_at"`
+	UpdatedAt    int64  `json:"updated_at"`
+	SubmissionID uint   `json:"submission_id" gorm:"not null;uniqueIndex"` // 提交ID
+	AssignmentID uint   `json:"assignment_id" gorm:"not null;index"`       // 作业ID
+	ClassID      uint   `json:"class_id" gorm:"not null;index"`            // 班级ID，便于按班级导出
+	StudentID    uint   `json:"student_id" gorm:"not null;index"`          // 学生ID
+	GraderID     uint   `json:"grader_id" gorm:"not null"`                 // 评分老师ID
+	Score        int    `json:"score"`                                     // 得分，使用评分标准时为各项得分之和
+	MaxScore     int    `json:"max_score"`                                 // 满分，使用评分标准时为各项满分之和
+	Comment      string `json:"comment" gorm:"type:text"`                  // 总评
+
+	Items          []GradeItem          `json:"items,omitempty" gorm:"foreignKey:GradeID"`
+	SpriteComments []GradeSpriteComment `json:"sprite_comments,omitempty" gorm:"foreignKey:GradeID"`
+	Assignment     *Assignment          `json:"assignment,omitempty" gorm:"foreignKey:AssignmentID"`
+}
+
+func (g *Grade) TableName() string {
+	return "grades"
+}
+
+// BeforeCreate GORM钩子，在创建前设置时间戳
+func (g *Grade) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now().Unix()
+	g.CreatedAt = now
+	g.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM钩子，在更新前设置时间戳
+func (g *Grade) BeforeUpdate(tx *gorm.DB) error {
+	g.UpdatedAt = time.Now().Unix()
+	return nil
+}
+
+// GradeItem 评分标准中某一项的得分
+type GradeItem struct {
+	ID          uint   `json:"id" gorm:"primarykey;autoIncrement"`
+	GradeID     uint   `json:"grade_id" gorm:"not null;index"`
+	CriterionID uint   `json:"criterion_id" gorm:"not null"`
+	Title       string `json:"title" gorm:"size:200"` // 评分时的评分项名称，评分标准修改后仍能看到当时的名称
+	Points      int    `json:"points"`                // 得分
+	MaxPoints   int    `json:"max_points"`            // 评分时该项的满分
+	Comment     string `json:"comment" gorm:"size:1000"`
+}
+
+func (g *GradeItem) TableName() string {
+	return "grade_items"
+}
+
+// GradeSpriteComment 针对 Scratch 项目中某个角色（或舞台）的评语
+type GradeSpriteComment struct {
+	ID      uint   `json:"id" gorm:"primarykey;autoIncrement"`
+	GradeID uint   `json:"grade_id" gorm:"not null;index"`
+	Sprite  string `json:"sprite" gorm:"size:200;not null"` // 角色名称，舞台为 Stage
+	Comment string `json:"comment" gorm:"type:text"`
+}
+
+func (g *GradeSpriteComment) TableName() string {
+	return "grade_sprite_comments"
+}
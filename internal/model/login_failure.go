@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// 登录失败原因
+const (
+	LoginFailureUnknownUser   = "unknown_user"   // 用户不存在
+	LoginFailureWrongPassword = "wrong_password" // 密码错误
+	LoginFailureLocked        = "locked"         // 尝试次数过多被暂时锁定
+	LoginFailureWrongPicture  = "wrong_picture"  // 图片密码错误
+	LoginFailureInvalidBadge  = "invalid_badge"  // 登录卡无效或已重新生成
+	LoginFailureNoRole        = "no_role"        // 目录帐号不属于任何允许登录的组
+)
+
+// LoginFailure 登录失败记录，供管理员查看
+type LoginFailure struct {
+	ID        uint      `gorm:"primarykey;autoIncrement" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	Username  string    `gorm:"size:255;index" json:"username"` // 尝试登录的用户名
+	UserID    uint      `json:"user_id"`                        // 用户不存在时为 0
+	IP        string    `gorm:"size:64;index" json:"ip"`
+	UserAgent string    `gorm:"size:512" json:"user_agent"`
+	Reason    string    `gorm:"size:32" json:"reason"`
+}
+
+func (l *LoginFailure) TableName() string {
+	return "login_failures"
+}
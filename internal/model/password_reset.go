@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 重置码的来源
+const (
+	PasswordResetTeacher = "teacher" // 老师为班级中的学生生成
+	PasswordResetEmail   = "email"   // 用户通过邮件找回密码
+)
+
+// PasswordReset 一次性的重置密码码，只保存哈希，使用后或过期后失效
+type PasswordReset struct {
+	ID        uint       `gorm:"primarykey;autoIncrement" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"` // 重置码的 SHA-256
+	Kind      string     `gorm:"size:20;not null" json:"kind"`
+	CreatedBy uint       `json:"created_by"` // 生成重置码的老师，邮件找回时为 0
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	Attempts  int        `gorm:"not null;default:0" json:"-"` // 输错的次数，太多时作废
+}
+
+func (p *PasswordReset) TableName() string {
+	return "password_resets"
+}
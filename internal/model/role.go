@@ -0,0 +1,75 @@
+package model
+
+import "time"
+
+// RoleAssistant 助教角色，只在用户担任助教的班级中生效
+const RoleAssistant = "assistant"
+
+// 班级成员在班级中的角色
+const (
+	ClassRoleStudent   = "student"   // 学生
+	ClassRoleAssistant = "assistant" // 助教，权限由 RoleAssistant 角色决定
+)
+
+// 权限常量
+const (
+	PermissionManageAll         = "manage_all"          // 管理所有资源
+	PermissionManageClass       = "manage_class"        // 管理所有班级
+	PermissionManageUsers       = "manage_users"        // 管理用户
+	PermissionManageOwnClass    = "manage_own_class"    // 管理自己的班级
+	PermissionManageOwnStudents = "manage_own_students" // 管理自己班级的学生
+	PermissionCreateScratch     = "create_scratch"      // 创建Scratch项目
+	PermissionViewOwnScratch    = "view_own_scratch"    // 查看自己的Scratch项目
+	PermissionEditOwnScratch    = "edit_own_scratch"    // 编辑自己的Scratch项目
+	PermissionViewClassScratch  = "view_class_scratch"  // 查看班级的Scratch项目
+	PermissionViewCourseScratch = "view_course_scratch" // 查看课程的Scratch项目
+)
+
+// Permissions 可以分配给角色的所有权限
+var Permissions = []string{
+	PermissionManageAll,
+	PermissionManageClass,
+	PermissionManageUsers,
+	PermissionManageOwnClass,
+	PermissionManageOwnStudents,
+	PermissionCreateScratch,
+	PermissionViewOwnScratch,
+	PermissionEditOwnScratch,
+	PermissionViewClassScratch,
+	PermissionViewCourseScratch,
+}
+
+// IsPermission 检查是否是已定义的权限
+func IsPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Role 角色，用户的 Role 字段保存角色名称
+type Role struct {
+	ID          uint             `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Name        string           `json:"name" gorm:"uniqueIndex;size:20;not null"` // 角色名称，与 users.role 对应
+	Description string           `json:"description" gorm:"size:200"`              // 角色说明
+	BuiltIn     bool             `json:"built_in" gorm:"default:false"`            // 内置角色不能删除
+	Permissions []RolePermission `json:"-" gorm:"foreignKey:RoleID"`
+}
+
+func (r *Role) TableName() string {
+	return "roles"
+}
+
+// RolePermission 角色拥有的权限
+type RolePermission struct {
+	RoleID     uint   `json:"role_id" gorm:"primaryKey;autoIncrement:false"`
+	Permission string `json:"permission" gorm:"primaryKey;size:50"`
+}
+
+func (r *RolePermission) TableName() string {
+	return "role_permissions"
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RubricCriterion 课程评分标准中的一项，例如“使用了循环”占 10 分
+type RubricCriterion struct {
+	ID          uint   `json:"id" gorm:"primarykey;autoIncrement"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+	DeletedAt   *int64 `json:"deleted_at,omitempty" gorm:"index"`
+	CourseID    uint   `json:"course_id" gorm:"not null;index"` // 课程ID
+	Title       string `json:"title" gorm:"size:200;not null"`  // 评分项名称
+	Description string `json:"description" gorm:"size:1000"`    // 评分说明
+	MaxPoints   int    `json:"max_points" gorm:"not null"`      // 该项满分
+	SortOrder   int    `json:"sort_order" gorm:"default:0"`     // 排序号
+}
+
+func (r *RubricCriterion) TableName() string {
+	return "rubric_criteria"
+}
+
+// BeforeCreate GORM钩子，在创建前设置时间戳
+func (r *RubricCriterion) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now().Unix()
+	r.CreatedAt = now
+	r.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM钩子，在更新前设置时间戳
+func (r *RubricCriterion) BeforeUpdate(tx *gorm.DB) error {
+	r.UpdatedAt = time.Now().Unix()
+	return nil
+}
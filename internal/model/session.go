@@ -6,18 +6,39 @@ import (
 	"gorm.io/gorm"
 )
 
-// UserSession 用户会话模型
+// UserSession 用户会话模型，每次登录创建一个会话，同一用户可以在多台设备上同时登录
 type UserSession struct {
-	ID        uint           `gorm:"primarykey;autoIncrement" json:"id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
-	UserID    uint           `gorm:"uniqueIndex;not null"`          // 用户ID
-	SessionID string         `gorm:"size:255;not null;uniqueIndex"` // 会话ID
-	ExpiresAt time.Time      `gorm:"not null"`                      // 过期时间
-	IsActive  bool           `gorm:"default:true"`                  // 是否活跃
+	ID         uint           `gorm:"primarykey;autoIncrement" json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	UserID     uint           `gorm:"index;not null"`                // 用户ID
+	SessionID  string         `gorm:"size:255;not null;uniqueIndex"` // 会话ID，写在 JWT 中
+	ExpiresAt  time.Time      `gorm:"not null"`                      // 过期时间
+	IsActive   bool           `gorm:"default:true"`                  // 是否活跃
+	Device     string         `gorm:"size:100"`                      // 由 User-Agent 识别的设备，如 "Windows · Chrome"
+	UserAgent  string         `gorm:"size:512"`                      // 登录时的 User-Agent
+	IP         string         `gorm:"size:64"`                       // 登录时的 IP
+	LastSeenAt time.Time      // 最近一次使用时间
 }
 
 func (u *UserSession) TableName() string {
 	return "user_sessions"
 }
+
+// RefreshToken 刷新令牌，只保存哈希。每次续期都会换发新令牌，同一会话的令牌属于同一家族，
+// 已换发过的令牌再次出现说明令牌可能被盗用，整个会话会被注销
+type RefreshToken struct {
+	ID        uint       `gorm:"primarykey;autoIncrement" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"index;not null"`               // 用户ID
+	SessionID string     `gorm:"size:255;not null;index"`      // 所属会话ID，即令牌家族
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex"` // 令牌的 SHA-256
+	ExpiresAt time.Time  `gorm:"not null"`                     // 过期时间
+	UsedAt    *time.Time // 换发新令牌的时间，为空表示尚未使用
+	RevokedAt *time.Time // 注销时间
+}
+
+func (r *RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
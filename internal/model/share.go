@@ -7,8 +7,8 @@ import (
 // 项目类型常量
 const (
 	ProjectTypeScratch = 1 // Scratch项目
+	ProjectTypeProgram = 2 // 通用程序（Python 等）
 	// 可以在这里添加更多项目类型
-	// ProjectTypeOther = 2
 )
 
 // Share 通过网页分享项目给其他人观看的模型
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// StudentLogin 低年级学生在班级中的图片密码和二维码登录卡，每个学生在每个班级一条
+type StudentLogin struct {
+	ID            uint       `gorm:"primarykey;autoIncrement" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ClassID       uint       `gorm:"not null;uniqueIndex:idx_student_logins_class_user" json:"class_id"`
+	UserID        uint       `gorm:"not null;uniqueIndex:idx_student_logins_class_user" json:"user_id"`
+	PictureHash   string     `gorm:"size:255" json:"-"`         // 图片密码的 bcrypt 哈希，为空表示未设置
+	BadgeHash     string     `gorm:"size:64;index" json:"-"`    // 登录卡令牌的 SHA-256，为空表示未发卡
+	BadgeIssuedAt *time.Time `json:"badge_issued_at,omitempty"` // 最近一次发卡时间
+}
+
+func (s *StudentLogin) TableName() string {
+	return "student_logins"
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 提交状态
+const (
+	SubmissionStatusSubmitted = "submitted" // 已提交，等待老师查看
+	SubmissionStatusReturned  = "returned"  // 老师退回，需要修改后重新提交
+	SubmissionStatusGraded    = "graded"    // 老师已评分
+)
+
+// Submission 学生提交的作业
+// 每次提交都会新增一条记录，并把当时的项目内容（按 MD5 区分版本）复制一份快照，
+// 这样学生之后继续修改项目或历史文件被清理都不会影响已提交的内容
+type Submission struct {
+	ID            uint   `json:"id" gorm:"primarykey;autoIncrement"`
+	CreatedAt     int64  `json:"created_at"`
+	UpdatedAt     int64  `json:"updated_at"`
+	AssignmentID  uint   `json:"assignment_id" gorm:"not null;index:idx_submission_assignment_student;uniqueIndex:idx_submission_attempt"` // 作业ID
+	StudentID     uint   `json:"student_id" gorm:"not null;index:idx_submission_assignment_student;uniqueIndex:idx_submission_attempt"`    // 学生ID
+	ProjectType   int    `json:"project_type" gorm:"not null"`                                                                             // 项目类型，见 ProjectTypeScratch/ProjectTypeProgram
+	ProjectID     uint   `json:"project_id" gorm:"not null;index"`                                                                         // 提交的项目ID
+	ProjectMD5    string `json:"project_md5" gorm:"size:32"`                                                                               // 提交时项目版本的 MD5
+	FilePath      string `json:"-" gorm:"size:500"`                                                                                        // 快照文件的相对目录
+	Attempt       int    `json:"attempt" gorm:"default:1;uniqueIndex:idx_submission_attempt"`                                              // 第几次提交，同一学生的同一作业中不重复
+	IsLate        bool   `json:"is_late" gorm:"default:false"`                                                                             // 是否迟交
+	Note          string `json:"note" gorm:"size:1000"`                                                                                    // 学生留言
+	Status        string `json:"status" gorm:"size:20;default:'submitted'"`                                                                // 状态
+	ReviewComment string `json:"review_comment" gorm:"size:1000"`                                                                          // 老师退回时的说明
+	ReviewerID    uint   `json:"reviewer_id" gorm:"default:0"`                                                                             // 处理该提交的老师ID
+	ReviewedAt    int64  `json:"reviewed_at" gorm:"default:0"`                                                                             // 老师处理时间
+
+	Student User `json:"student,omitempty" gorm:"foreignKey:StudentID"`
+}
+
+func (s *Submission) TableName() string {
+	return "submissions"
+}
+
+// BeforeCreate GORM钩子，在创建前设置时间戳
+func (s *Submission) BeforeCreate(tx *gorm.DB) error {
+	now := time.Now().Unix()
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	return nil
+}
+
+// BeforeUpdate GORM钩子，在更新前设置时间戳
+func (s *Submission) BeforeUpdate(tx *gorm.DB) error {
+	s.UpdatedAt = time.Now().Unix()
+	return nil
+}
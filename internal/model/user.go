@@ -16,8 +16,13 @@ type User struct {
 	Nickname  string         `gorm:"size:50" json:"nickname"`
 	Password  string         `gorm:"size:100" json:"-"`
 	Email     string         `gorm:"size:100" json:"email"`
-	Role      string         `gorm:"size:20;default:'student'" json:"role"` // 用户角色: admin, teacher, student
+	Role      string         `gorm:"size:20;default:'student'" json:"role"` // 用户角色，对应 roles 表中的角色名称
 	Files     []File         `json:"files,omitempty"`
+
+	// AuthProvider 外部目录中的帐号登录时自动创建，为空表示本地帐号，密码只能在外部目录中修改
+	AuthProvider string `gorm:"size:20" json:"auth_provider,omitempty"`
+	// MustChangePassword 管理员设置的临时密码，下次登录后必须先修改密码才能使用其他功能
+	MustChangePassword bool `gorm:"default:false" json:"must_change_password"`
 }
 
 func (u *User) TableName() string {
@@ -29,3 +34,9 @@ const (
 	RoleTeacher = "teacher"
 	RoleStudent = "student"
 )
+
+// 用户的认证来源
+const (
+	AuthProviderLDAP = "ldap"
+	AuthProviderOIDC = "oidc"
+)
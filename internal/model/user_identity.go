@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// UserIdentity 用户关联的外部身份，同一个身份提供方的 subject 只能关联一个用户
+type UserIdentity struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uint      `gorm:"index;not null" json:"user_id"`
+	Provider    string    `gorm:"size:20" json:"provider"`                                        // 如 oidc
+	Issuer      string    `gorm:"size:255;uniqueIndex:idx_user_identities_subject" json:"issuer"` // 身份提供方
+	Subject     string    `gorm:"size:255;uniqueIndex:idx_user_identities_subject" json:"subject"`
+	Email       string    `gorm:"size:100" json:"email"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+func (i *UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,343 @@
+// Package oidc 实现 OpenID Connect 授权码模式登录的客户端部分，总是使用 PKCE
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultScopes 未配置时请求的 scope
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+// ErrNonceMismatch ID Token 中的 nonce 与登录请求不一致，可能是重放的令牌
+var ErrNonceMismatch = errors.New("ID Token 的 nonce 不匹配")
+
+// keysRefreshInterval 遇到未知的 kid 时重新获取公钥的最短间隔，避免被伪造的令牌拖着反复请求
+const keysRefreshInterval = time.Minute
+
+// Provider OpenID Connect 身份提供方，端点和公钥在第一次使用时通过 discovery 获取
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]interface{} // kid -> 公钥
+	keysAt   time.Time
+}
+
+// metadata .well-known/openid-configuration 中用到的字段
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider 创建身份提供方客户端，scopes 为空时使用 DefaultScopes
+func NewProvider(issuer, clientID, clientSecret string, scopes []string) *Provider {
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	hasOpenID := false
+	for _, scope := range scopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	return &Provider{
+		issuer:       strings.TrimRight(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer 身份提供方的标识，与 ID Token 中的 iss 一致
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// AuthRequest 一次登录请求的随机值，需要保存到回调时使用
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// NewAuthRequest 生成新的 state、nonce 和 PKCE code_verifier
+func NewAuthRequest() (*AuthRequest, error) {
+	var values [3]string
+	for i := range values {
+		value, err := RandomToken()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// RandomToken 生成 32 字节的随机字符串
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge 计算 PKCE S256 方式的 code_challenge
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL 返回跳转到身份提供方登录页的地址
+func (p *Provider) AuthCodeURL(req *AuthRequest, redirectURL string) (string, error) {
+	md, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(p.scopes, " ")},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {CodeChallenge(req.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return md.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// tokenResponse 令牌端点的响应
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange 用授权码换取 ID Token，验证签名、issuer、audience、有效期和 nonce 后返回其中的声明
+func (p *Provider) Exchange(code, redirectURL string, req *AuthRequest) (Claims, error) {
+	md, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {req.CodeVerifier},
+	}
+	request, err := http.NewRequest(http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("请求令牌失败: %w", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取令牌响应失败: %w", err)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("令牌响应格式错误 (HTTP %d): %w", response.StatusCode, err)
+	}
+	if response.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("换取令牌失败 (HTTP %d): %s %s", response.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("令牌响应中没有 id_token")
+	}
+	return p.verify(token.IDToken, req.Nonce)
+}
+
+// verify 验证 ID Token
+func (p *Provider) verify(idToken, nonce string) (Claims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, p.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ID Token 无效: %w", err)
+	}
+
+	result := Claims(claims)
+	if result.String("nonce") != nonce {
+		return nil, ErrNonceMismatch
+	}
+	// 有多个 audience 时 azp 必须是本应用
+	if azp := result.String("azp"); azp != "" && azp != p.clientID {
+		return nil, fmt.Errorf("ID Token 的 azp 不是本应用: %s", azp)
+	}
+	if result.Subject() == "" {
+		return nil, errors.New("ID Token 中没有 sub")
+	}
+	return result, nil
+}
+
+// discover 获取身份提供方的端点，成功后缓存
+func (p *Provider) discover() (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var md metadata
+	if err := p.getJSON(p.issuer+"/.well-known/openid-configuration", &md); err != nil {
+		return nil, fmt.Errorf("获取 OpenID 配置失败: %w", err)
+	}
+	if strings.TrimRight(md.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("OpenID 配置中的 issuer 不一致: %s", md.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("OpenID 配置缺少端点")
+	}
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// keyFunc 按 kid 查找验证签名的公钥，找不到时重新获取一次公钥
+func (p *Provider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	key, found := p.lookupKey(kid)
+	refresh := !found && time.Since(p.keysAt) >= keysRefreshInterval
+	jwksURI := ""
+	if p.metadata != nil {
+		jwksURI = p.metadata.JWKSURI
+	}
+	p.mu.Unlock()
+	if found {
+		return key, nil
+	}
+	if !refresh || jwksURI == "" {
+		return nil, fmt.Errorf("未知的签名公钥: %q", kid)
+	}
+
+	var set jsonWebKeySet
+	if err := p.getJSON(jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("获取签名公钥失败: %w", err)
+	}
+	keys := set.publicKeys()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	p.keysAt = time.Now()
+	if key, found := p.lookupKey(kid); found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未知的签名公钥: %q", kid)
+}
+
+// lookupKey 令牌没有 kid 时，只有一个公钥就用这个公钥
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, found := p.keys[kid]
+	return key, found
+}
+
+func (p *Provider) getJSON(url string, v interface{}) error {
+	response, err := p.httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", response.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(v)
+}
+
+// Claims ID Token 中的声明
+type Claims map[string]interface{}
+
+// Subject 用户在身份提供方的唯一标识
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// String 返回字符串声明，不存在或不是字符串时返回空字符串
+func (c Claims) String(name string) string {
+	value, _ := c.lookup(name).(string)
+	return value
+}
+
+// Strings 返回字符串或字符串数组声明，如 groups、roles
+func (c Claims) Strings(name string) []string {
+	switch value := c.lookup(name).(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// lookup 支持用 . 访问嵌套的声明，如 Keycloak 的 realm_access.roles
+func (c Claims) lookup(name string) interface{} {
+	if value, ok := c[name]; ok {
+		return value
+	}
+	var current interface{} = map[string]interface{}(c)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
@@ -0,0 +1,91 @@
+package oidc_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/jun/fun_code/internal/oidc"
+	"github.com/jun/fun_code/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+const redirectURL = "http://localhost:8080/api/auth/oidc/callback"
+
+// login 走一遍授权流程，返回回调地址中的 code
+func login(t *testing.T, server *oidctest.Server, provider *oidc.Provider, req *oidc.AuthRequest, claims map[string]interface{}) string {
+	authURL, err := provider.AuthCodeURL(req, redirectURL)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	callback, err := server.Login(authURL, claims)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	u, _ := url.Parse(callback)
+	assert.Equal(t, req.State, u.Query().Get("state"))
+	return u.Query().Get("code")
+}
+
+func TestProviderExchange(t *testing.T) {
+	server := oidctest.NewServer("fun_code", "secret")
+	defer server.Close()
+	provider := oidc.NewProvider(server.Issuer(), "fun_code", "secret", []string{"profile"})
+
+	req, err := oidc.NewAuthRequest()
+	assert.NoError(t, err)
+	authURL, err := provider.AuthCodeURL(req, redirectURL)
+	assert.NoError(t, err)
+	u, _ := url.Parse(authURL)
+	assert.Equal(t, "openid profile", u.Query().Get("scope"))
+	assert.Equal(t, oidc.CodeChallenge(req.CodeVerifier), u.Query().Get("code_challenge"))
+
+	code := login(t, server, provider, req, map[string]interface{}{
+		"sub":          "user-1",
+		"name":         "王老师",
+		"groups":       []string{"teachers", "staff"},
+		"realm_access": map[string]interface{}{"roles": []string{"admin"}},
+	})
+	claims, err := provider.Exchange(code, redirectURL, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject())
+	assert.Equal(t, "王老师", claims.String("name"))
+	assert.Equal(t, []string{"teachers", "staff"}, claims.Strings("groups"))
+	assert.Equal(t, []string{"admin"}, claims.Strings("realm_access.roles"))
+	assert.Empty(t, claims.Strings("missing"))
+
+	// 授权码只能使用一次
+	_, err = provider.Exchange(code, redirectURL, req)
+	assert.Error(t, err)
+}
+
+func TestProviderExchangeRejects(t *testing.T) {
+	server := oidctest.NewServer("fun_code", "secret")
+	defer server.Close()
+	provider := oidc.NewProvider(server.Issuer(), "fun_code", "secret", nil)
+	claims := map[string]interface{}{"sub": "user-1"}
+
+	// code_verifier 与 code_challenge 不匹配
+	req, _ := oidc.NewAuthRequest()
+	code := login(t, server, provider, req, claims)
+	_, err := provider.Exchange(code, redirectURL, &oidc.AuthRequest{Nonce: req.Nonce, CodeVerifier: "other"})
+	assert.Error(t, err)
+
+	// nonce 不匹配
+	req, _ = oidc.NewAuthRequest()
+	code = login(t, server, provider, req, claims)
+	_, err = provider.Exchange(code, redirectURL, &oidc.AuthRequest{Nonce: "other", CodeVerifier: req.CodeVerifier})
+	assert.ErrorIs(t, err, oidc.ErrNonceMismatch)
+
+	// 签发给其他应用的令牌
+	req, _ = oidc.NewAuthRequest()
+	code = login(t, server, provider, req, map[string]interface{}{"sub": "user-1", "aud": "other-app"})
+	_, err = provider.Exchange(code, redirectURL, req)
+	assert.Error(t, err)
+
+	// 客户端密钥错误
+	wrongSecret := oidc.NewProvider(server.Issuer(), "fun_code", "wrong", nil)
+	req, _ = oidc.NewAuthRequest()
+	code = login(t, server, wrongSecret, req, claims)
+	_, err = wrongSecret.Exchange(code, redirectURL, req)
+	assert.Error(t, err)
+}
@@ -0,0 +1,445 @@
+// Package qrcode 生成二维码，只支持字节模式、M 级纠错和 1-10 版本，
+// 足够编码登录卡片上的链接，不依赖第三方库
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTooLong 内容超出支持的最大版本容量
+var ErrTooLong = errors.New("qrcode: 内容太长")
+
+// versionInfo M 级纠错下每个版本的分块情况
+type versionInfo struct {
+	ecPerBlock  int   // 每块纠错码字数
+	blocks      []int // 每块数据码字数
+	alignCenter []int // 校正图形中心坐标
+}
+
+var versions = [...]versionInfo{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+func (v versionInfo) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// Code 二维码矩阵，不含四周的空白区
+type Code struct {
+	Version  int
+	Size     int
+	modules  [][]bool
+	function [][]bool // 功能图形区域，不放数据也不加掩码
+}
+
+// Black 返回第 y 行第 x 列是否为深色模块
+func (c *Code) Black(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Encode 把内容编码为二维码，自动选择能容纳内容的最小版本
+func Encode(content string) (*Code, error) {
+	data := []byte(content)
+	for version := 1; version < len(versions); version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > versions[version].dataCodewords()*8 {
+			continue
+		}
+		codewords := addErrorCorrection(version, encodeData(version, countBits, data))
+		return newCode(version, codewords), nil
+	}
+	return nil, ErrTooLong
+}
+
+// encodeData 按字节模式编码并填充到该版本的数据码字数
+func encodeData(version, countBits int, data []byte) []byte {
+	capacity := versions[version].dataCodewords() * 8
+	var bb bitBuffer
+	bb.append(0x4, 4) // 字节模式
+	bb.append(uint32(len(data)), countBits)
+	for _, b := range data {
+		bb.append(uint32(b), 8)
+	}
+	// 终止符最多 4 位，然后补齐到整字节
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+	for pad := uint32(0xEC); len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	return bb.bytes()
+}
+
+// addErrorCorrection 分块计算纠错码，并按规范交错排列
+func addErrorCorrection(version int, data []byte) []byte {
+	info := versions[version]
+	divisor := rsGenerator(info.ecPerBlock)
+
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, n := range info.blocks {
+		block := data[offset : offset+n]
+		offset += n
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+	}
+
+	result := make([]byte, 0, len(data)+info.ecPerBlock*len(info.blocks))
+	maxLen := info.blocks[len(info.blocks)-1]
+	for i := 0; i < maxLen; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// newCode 绘制功能图形、放置码字并选择惩罚分最低的掩码
+func newCode(version int, codewords []byte) *Code {
+	size := version*4 + 17
+	c := &Code{Version: version, Size: size}
+	c.modules = make([][]bool, size)
+	c.function = make([][]bool, size)
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+
+	c.drawFunctionPatterns()
+	c.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask) // 再次异或即可撤销
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c
+}
+
+func (c *Code) set(x, y int, black bool) {
+	c.modules[y][x] = black
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	align := versions[c.Version].alignCenter
+	last := len(align) - 1
+	for i, y := range align {
+		for j, x := range align {
+			// 与定位图形重叠的三个角不画
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// 先用掩码 0 占住格式信息的位置，选定掩码后再重画
+	c.drawFormatBits(0)
+	c.drawVersionBits()
+}
+
+// drawFinder 以 (cx, cy) 为中心画定位图形和外围的分隔符
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment 以 (cx, cy) 为中心画 5x5 的校正图形
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatBits M 级纠错和掩码编号的 15 位格式信息
+func formatBits(mask int) int {
+	data := mask // M 级的纠错等级位为 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// 左上角定位图形旁的一份
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	// 右上角和左下角的另一份
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true) // 固定的深色模块
+}
+
+// versionBits 18 位版本信息，版本 7 及以上才有
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	return version<<12 | rem
+}
+
+func (c *Code) drawVersionBits() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionBits(c.Version)
+	for i := 0; i < 18; i++ {
+		black := (bits>>i)&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.set(a, b, black)
+		c.set(b, a, black)
+	}
+}
+
+// drawCodewords 从右下角开始，每两列一组上下交替放置数据位
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // 跳过竖直的时序图形
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.function[y][x] && maskBit(mask, x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 按规范的四条规则计算惩罚分，分数越低越容易识别
+func (c *Code) penalty() int {
+	score := 0
+	line := make([]bool, c.Size)
+	for _, vertical := range []bool{false, true} {
+		for i := 0; i < c.Size; i++ {
+			for j := 0; j < c.Size; j++ {
+				if vertical {
+					line[j] = c.modules[j][i]
+				} else {
+					line[j] = c.modules[i][j]
+				}
+			}
+			score += linePenalty(line)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				v := c.modules[y][x]
+				if c.modules[y][x+1] == v && c.modules[y+1][x] == v && c.modules[y+1][x+1] == v {
+					score += 3
+				}
+			}
+		}
+	}
+	total := c.Size * c.Size
+	// 深色模块比例每偏离 50% 5 个百分点加 10 分
+	score += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return score
+}
+
+var finderLike = [...]bool{true, false, true, true, true, false, true}
+
+// linePenalty 一行（列）中连续同色和类似定位图形的惩罚分
+func linePenalty(line []bool) int {
+	score := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += run - 2
+		}
+		run = 1
+	}
+
+	// 1:1:3:1:1 的图形一侧有 4 个浅色模块
+	for i := 0; i+len(finderLike) <= len(line); i++ {
+		match := true
+		for j, v := range finderLike {
+			if line[i+j] != v {
+				match = false
+				break
+			}
+		}
+		if match && (lightRun(line, i-4, i) || lightRun(line, i+len(finderLike), i+len(finderLike)+4)) {
+			score += 40
+		}
+	}
+	return score
+}
+
+// lightRun [from, to) 都是浅色，超出边界的部分视为空白区
+func lightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SVG 返回带 4 个模块空白区的 SVG 图片，size 为图片宽高（像素）
+func (c *Code) SVG(size int) string {
+	const quiet = 4
+	n := c.Size + quiet*2
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&sb, "M%d %dh1v1h-1z", x+quiet, y+quiet)
+			}
+		}
+	}
+	sb.WriteString(`"/></svg>`)
+	return sb.String()
+}
+
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (v>>i)&1 != 0)
+	}
+}
+
+func (bb bitBuffer) bytes() []byte {
+	result := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			result[i>>3] |= 1 << (7 - i&7)
+		}
+	}
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,170 @@
+package qrcode
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试纠错码与规范中 "HELLO WORLD" 1-M 的示例一致
+func TestRSRemainder(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	assert.Equal(t, want, rsRemainder(data, rsGenerator(10)))
+}
+
+// 测试格式信息和版本信息与规范中的表格一致
+func TestFormatAndVersionBits(t *testing.T) {
+	assert.Equal(t, 0b101010000010010, formatBits(0))
+	assert.Equal(t, 0b100010111111001, formatBits(4))
+	assert.Equal(t, 0b100101010100000, formatBits(7))
+	assert.Equal(t, 0b000111110010010100, versionBits(7))
+	assert.Equal(t, 0b001010010011010011, versionBits(10))
+}
+
+// readCodewords 按放置顺序读回码字，用来检查矩阵中的数据
+func readCodewords(c *Code, mask int) []byte {
+	var bb bitBuffer
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !c.function[y][x] {
+					bb = append(bb, c.modules[y][x] != maskBit(mask, x, y))
+				}
+			}
+		}
+	}
+	return bb.bytes()
+}
+
+// readMask 从左上角的格式信息中读出掩码编号
+func readMask(c *Code) int {
+	bits := 0
+	for i := 14; i >= 9; i-- {
+		bits = bits<<1 | boolInt(c.Black(14-i, 8))
+	}
+	bits = bits<<1 | boolInt(c.Black(7, 8))
+	bits = bits<<1 | boolInt(c.Black(8, 8))
+	bits = bits<<1 | boolInt(c.Black(8, 7))
+	for i := 5; i >= 0; i-- {
+		bits = bits<<1 | boolInt(c.Black(8, i))
+	}
+	for mask := 0; mask < 8; mask++ {
+		if formatBits(mask) == bits {
+			return mask
+		}
+	}
+	return -1
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// 测试编码后能从矩阵中读回同样的码字，并选择最小的版本
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		content string
+		version int
+	}{
+		{"hi", 1},
+		{"http://10.0.0.2:8080/login/badge?token=" + strings.Repeat("x", 43), 5},
+		{strings.Repeat("a", 200), 10},
+	}
+	for _, tt := range tests {
+		code, err := Encode(tt.content)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, tt.version, code.Version)
+		assert.Equal(t, tt.version*4+17, code.Size)
+
+		mask := readMask(code)
+		assert.GreaterOrEqual(t, mask, 0)
+
+		countBits := 8
+		if tt.version >= 10 {
+			countBits = 16
+		}
+		want := addErrorCorrection(tt.version, encodeData(tt.version, countBits, []byte(tt.content)))
+		assert.Equal(t, want, readCodewords(code, mask)[:len(want)])
+
+		// 三个定位图形
+		for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+			assert.True(t, code.Black(corner[0], corner[1]))
+			assert.False(t, code.Black(corner[0]+1, corner[1]+1))
+			assert.True(t, code.Black(corner[0]+3, corner[1]+3))
+		}
+	}
+
+	_, err := Encode(strings.Repeat("a", 300))
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+// 测试与另一个实现生成的矩阵完全一致。testdata 中的矩阵由 rsc.io/qr/coding 按同样的版本、
+// M 级纠错和掩码生成，# 为深色模块，首行记录版本和掩码
+func TestEncodeMatchesReference(t *testing.T) {
+	tests := map[string]string{
+		"hi":    "hi",
+		"badge": "http://10.0.0.2:8080/login/badge?token=" + strings.Repeat("x", 43),
+		"long":  strings.Repeat("a", 200),
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", name+".txt"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			var version, mask int
+			_, err = fmt.Sscanf(lines[0], "version %d mask %d", &version, &mask)
+			assert.NoError(t, err)
+			rows := lines[1:]
+
+			code, err := Encode(content)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, version, code.Version)
+			assert.Equal(t, mask, readMask(code))
+			if !assert.Len(t, rows, code.Size) {
+				return
+			}
+			for y, row := range rows {
+				var got strings.Builder
+				for x := 0; x < code.Size; x++ {
+					if code.Black(x, y) {
+						got.WriteByte('#')
+					} else {
+						got.WriteByte('.')
+					}
+				}
+				assert.Equal(t, row, got.String(), "第 %d 行", y)
+			}
+		})
+	}
+}
+
+func TestSVG(t *testing.T) {
+	code, err := Encode("hi")
+	assert.NoError(t, err)
+	svg := code.SVG(120)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="120" height="120" viewBox="0 0 29 29"`))
+	assert.Contains(t, svg, "M4 4h1v1h-1z")
+}
@@ -0,0 +1,205 @@
+// Package sb3 读写 Scratch 3 的 .sb3 项目文件。
+// .sb3 是一个 zip 文件，根目录下是 project.json 和以内容 MD5 命名的造型、声音文件
+package sb3
+
+import (
+	"archive/zip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ProjectFile .sb3 中项目文件的名称
+const ProjectFile = "project.json"
+
+const (
+	// MaxProjectSize project.json 解压后的最大大小
+	MaxProjectSize = 20 << 20
+	// MaxAssetSize 单个资源文件解压后的最大大小，与编辑器上传资源的限制相同
+	MaxAssetSize = 2 << 20
+	// MaxTotalSize 所有文件解压后的最大总大小，避免 zip 炸弹
+	MaxTotalSize = 200 << 20
+)
+
+var (
+	// ErrNoProject 文件中没有 project.json
+	ErrNoProject = errors.New("sb3: 文件中没有 project.json")
+	// ErrTooLarge 文件解压后超过大小限制
+	ErrTooLarge = errors.New("sb3: 文件太大")
+)
+
+// assetNamePattern 资源文件名是内容的 MD5 加扩展名，也用来避免拼出目录外的路径
+var assetNamePattern = regexp.MustCompile(`^[0-9a-f]{32}\.[a-z0-9]{2,5}$`)
+
+// Archive .sb3 文件的内容
+type Archive struct {
+	Project []byte            // project.json 的内容
+	Assets  map[string][]byte // 资源文件名到内容，只包含文件名和 MD5 一致的资源
+	Skipped []string          // 文件名不合法或 MD5 与文件名不一致而跳过的文件
+}
+
+// IsAssetName 判断是否为合法的资源文件名
+func IsAssetName(name string) bool {
+	return assetNamePattern.MatchString(name)
+}
+
+// assetRefProject 只解析 project.json 中与资源相关的字段
+type assetRefProject struct {
+	Targets []struct {
+		Costumes []assetRef `json:"costumes"`
+		Sounds   []assetRef `json:"sounds"`
+	} `json:"targets"`
+}
+
+type assetRef struct {
+	AssetID    string `json:"assetId"`
+	MD5Ext     string `json:"md5ext"`
+	DataFormat string `json:"dataFormat"`
+}
+
+// AssetNames 返回 project.json 中造型和声音引用的资源文件名，按名称排序且不重复
+func AssetNames(project []byte) ([]string, error) {
+	var p assetRefProject
+	if err := json.Unmarshal(project, &p); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, target := range p.Targets {
+		for _, list := range [][]assetRef{target.Costumes, target.Sounds} {
+			for _, ref := range list {
+				name := ref.MD5Ext
+				if name == "" && ref.AssetID != "" {
+					name = ref.AssetID + "." + strings.TrimPrefix(ref.DataFormat, ".")
+				}
+				if name != "" && !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Read 读取 .sb3 文件，校验资源文件的 MD5
+func Read(r io.ReaderAt, size int64) (*Archive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("sb3: 无法打开文件: %w", err)
+	}
+
+	archive := &Archive{Assets: make(map[string][]byte)}
+	var total int64
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		// 部分工具会把文件放在子目录中，只看文件名
+		name := path.Base(file.Name)
+		limit := int64(MaxAssetSize)
+		if name == ProjectFile {
+			limit = MaxProjectSize
+		} else if !IsAssetName(strings.ToLower(name)) {
+			archive.Skipped = append(archive.Skipped, file.Name)
+			continue
+		}
+
+		data, err := readFile(file, limit)
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(data))
+		if total > MaxTotalSize {
+			return nil, ErrTooLarge
+		}
+
+		if name == ProjectFile {
+			archive.Project = data
+			continue
+		}
+		name = strings.ToLower(name)
+		sum := md5.Sum(data)
+		if hex.EncodeToString(sum[:]) != name[:32] {
+			archive.Skipped = append(archive.Skipped, file.Name)
+			continue
+		}
+		archive.Assets[name] = data
+	}
+
+	if archive.Project == nil {
+		return nil, ErrNoProject
+	}
+	return archive, nil
+}
+
+// readFile 读取 zip 中的文件，超过 limit 时返回 ErrTooLarge
+func readFile(file *zip.File, limit int64) ([]byte, error) {
+	if file.UncompressedSize64 > uint64(limit) {
+		return nil, ErrTooLarge
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("sb3: 无法读取 %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+	// 文件头中的大小可能是伪造的，读取时再限制一次
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("sb3: 无法读取 %s: %w", file.Name, err)
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// Write 把 project.json 和它引用的资源写成 .sb3 文件。
+// load 按资源文件名读取资源内容，读取失败的资源不写入，并在 missing 中返回
+func Write(w io.Writer, project []byte, load func(name string) ([]byte, error)) (missing []string, err error) {
+	names, err := AssetNames(project)
+	if err != nil {
+		return nil, fmt.Errorf("sb3: 无法解析 project.json: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	fw, err := zw.Create(ProjectFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(project); err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if !IsAssetName(name) {
+			missing = append(missing, name)
+			continue
+		}
+		data, err := load(name)
+		if err != nil {
+			missing = append(missing, name)
+			continue
+		}
+		fw, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
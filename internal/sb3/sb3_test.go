@@ -0,0 +1,111 @@
+package sb3
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assetName(data []byte, ext string) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]) + "." + ext
+}
+
+// 测试写入后再读取，project.json 和资源保持一致，缺少的资源单独返回
+func TestWriteAndRead(t *testing.T) {
+	costume := []byte("<svg></svg>")
+	sound := []byte("RIFF....WAVE")
+	costumeName := assetName(costume, "svg")
+	soundName := assetName(sound, "wav")
+	missingName := assetName([]byte("missing"), "png")
+	project := []byte(`{"targets":[{"isStage":true,"costumes":[{"md5ext":"` + costumeName + `"}],"sounds":[]},` +
+		`{"isStage":false,"costumes":[{"assetId":"` + costumeName[:32] + `","dataFormat":"svg"},{"md5ext":"` + missingName + `"}],` +
+		`"sounds":[{"md5ext":"` + soundName + `"}]}]}`)
+
+	assets := map[string][]byte{costumeName: costume, soundName: sound}
+	var buf bytes.Buffer
+	missing, err := Write(&buf, project, func(name string) ([]byte, error) {
+		if data, ok := assets[name]; ok {
+			return data, nil
+		}
+		return nil, errors.New("not found")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{missingName}, missing)
+
+	archive, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, project, archive.Project)
+	assert.Equal(t, assets, archive.Assets)
+	assert.Empty(t, archive.Skipped)
+}
+
+// 测试读取时跳过 MD5 与文件名不一致的资源和无关文件
+func TestReadSkipsInvalidAssets(t *testing.T) {
+	costume := []byte("<svg></svg>")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string][]byte{
+		"Project/project.json":                     []byte(`{"targets":[]}`),
+		"Project/" + assetName(costume, "svg"):     costume,
+		"0123456789abcdef0123456789abcdef.png":     []byte("not matching"),
+		"../evil.sh":                               []byte("rm -rf /"),
+		"Project/" + assetName(costume, "svg")[:8]: costume,
+	}
+	for name, content := range files {
+		fw, err := zw.Create(name)
+		assert.NoError(t, err)
+		fw.Write(content)
+	}
+	assert.NoError(t, zw.Close())
+
+	archive, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"targets":[]}`), archive.Project)
+	assert.Equal(t, map[string][]byte{assetName(costume, "svg"): costume}, archive.Assets)
+	assert.Len(t, archive.Skipped, 3)
+}
+
+// 测试超过上传资源大小限制的资源不能通过导入绕过限制
+func TestReadAssetTooLarge(t *testing.T) {
+	sound := make([]byte, MaxAssetSize+1)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create(ProjectFile)
+	assert.NoError(t, err)
+	fw.Write([]byte(`{"targets":[]}`))
+	fw, err = zw.Create(assetName(sound, "wav"))
+	assert.NoError(t, err)
+	fw.Write(sound)
+	assert.NoError(t, zw.Close())
+
+	_, err = Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestReadWithoutProject(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	zw.Create("readme.txt")
+	assert.NoError(t, zw.Close())
+
+	_, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.ErrorIs(t, err, ErrNoProject)
+
+	_, err = Read(bytes.NewReader([]byte("not a zip")), 9)
+	assert.Error(t, err)
+}
+
+func TestAssetNames(t *testing.T) {
+	names, err := AssetNames([]byte(`{"targets":[{"costumes":[{"md5ext":"b.svg"},{"md5ext":"a.png"}],"sounds":[{"md5ext":"b.svg"}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.png", "b.svg"}, names)
+
+	_, err = AssetNames([]byte(`not json`))
+	assert.Error(t, err)
+}
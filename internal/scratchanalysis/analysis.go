@@ -0,0 +1,465 @@
+// Package scratchanalysis 对 Scratch 项目做静态分析，参照 Dr. Scratch 的方法
+// 给出七个计算思维维度的得分（每项 0-3 分，共 21 分），并找出常见的代码问题
+package scratchanalysis
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jun/fun_code/internal/mermaid"
+)
+
+// 总分对应的水平，与 Dr. Scratch 一致
+const (
+	LevelBasic      = "basic"      // 0-7 分
+	LevelDeveloping = "developing" // 8-14 分
+	LevelProficient = "proficient" // 15-21 分
+)
+
+// minDuplicateBlocks 判断重复脚本时脚本至少包含的积木数，太短的脚本重复很正常
+const minDuplicateBlocks = 5
+
+// defaultSpriteName 编辑器新建角色时的默认名称
+var defaultSpriteName = regexp.MustCompile(`^(Sprite|角色)\d*$`)
+
+// Scores 计算思维各维度的得分，每项 0-3 分
+type Scores struct {
+	Abstraction        int `json:"abstraction"`         // 抽象：多个脚本、自制积木、克隆
+	Parallelism        int `json:"parallelism"`         // 并行：同一事件触发多个脚本
+	Logic              int `json:"logic"`               // 逻辑：如果、如果否则、与或非
+	Synchronization    int `json:"synchronization"`     // 同步：等待、广播、停止
+	FlowControl        int `json:"flow_control"`        // 流程控制：顺序、重复、重复直到
+	UserInteractivity  int `json:"user_interactivity"`  // 用户交互：绿旗、键盘鼠标、声音视频
+	DataRepresentation int `json:"data_representation"` // 数据表示：修改角色属性、变量、列表
+}
+
+// Total 总分
+func (s Scores) Total() int {
+	return s.Abstraction + s.Parallelism + s.Logic + s.Synchronization + s.FlowControl + s.UserInteractivity + s.DataRepresentation
+}
+
+// Level 总分对应的水平
+func (s Scores) Level() string {
+	switch total := s.Total(); {
+	case total >= 15:
+		return LevelProficient
+	case total >= 8:
+		return LevelDeveloping
+	default:
+		return LevelBasic
+	}
+}
+
+// ScriptRef 指向一个脚本
+type ScriptRef struct {
+	Target  string `json:"target"`   // 角色或舞台的名称
+	BlockID string `json:"block_id"` // 脚本第一个积木的ID
+	Label   string `json:"label"`    // 第一个积木的显示文字
+	Blocks  int    `json:"blocks"`   // 脚本包含的积木数
+}
+
+// VariableRef 指向一个变量或列表
+type VariableRef struct {
+	Target string `json:"target"` // 所属角色，全局变量为舞台
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	IsList bool   `json:"is_list"`
+}
+
+// Smells 代码问题
+type Smells struct {
+	DeadScripts        []ScriptRef   `json:"dead_scripts"`         // 没有事件积木开头、永远不会执行的脚本
+	UnusedVariables    []VariableRef `json:"unused_variables"`     // 没有被任何积木使用的变量和列表
+	DuplicatedScripts  [][]ScriptRef `json:"duplicated_scripts"`   // 内容相同的脚本，每组至少两个
+	DefaultSpriteNames []string      `json:"default_sprite_names"` // 没有改名的角色
+}
+
+// Count 问题总数，每组重复脚本算一个
+func (s *Smells) Count() int {
+	return len(s.DeadScripts) + len(s.UnusedVariables) + len(s.DuplicatedScripts) + len(s.DefaultSpriteNames)
+}
+
+// Report 分析结果
+type Report struct {
+	Scores  Scores `json:"scores"`
+	Total   int    `json:"total"`
+	Level   string `json:"level"`
+	Sprites int    `json:"sprites"` // 角色数，不含舞台
+	Scripts int    `json:"scripts"`
+	Blocks  int    `json:"blocks"` // 积木数，不含输入框等影子积木
+	Smells  Smells `json:"smells"`
+}
+
+// script 分析时使用的脚本信息
+type script struct {
+	target *mermaid.Target
+	top    string
+	ids    []string
+	blocks int // 不含影子积木
+}
+
+// Analyze 分析项目
+func Analyze(project *mermaid.Project) *Report {
+	translator := mermaid.NewOpcodeTranslator()
+	report := &Report{
+		Smells: Smells{
+			DeadScripts:        []ScriptRef{},
+			UnusedVariables:    []VariableRef{},
+			DuplicatedScripts:  [][]ScriptRef{},
+			DefaultSpriteNames: []string{},
+		},
+	}
+
+	var scripts []script
+	opcodes := make(map[string]bool)
+	for i := range project.Targets {
+		target := &project.Targets[i]
+		if !target.IsStage {
+			report.Sprites++
+			if defaultSpriteName.MatchString(target.Name) {
+				report.Smells.DefaultSpriteNames = append(report.Smells.DefaultSpriteNames, target.Name)
+			}
+		}
+
+		grouped := target.Scripts()
+		tops := make([]string, 0, len(grouped))
+		for top := range grouped {
+			tops = append(tops, top)
+		}
+		sort.Strings(tops)
+		for _, top := range tops {
+			s := script{target: target, top: top, ids: grouped[top]}
+			for _, id := range s.ids {
+				block := target.Blocks[id]
+				if block.Opcode == "" || block.Shadow {
+					continue
+				}
+				s.blocks++
+				opcodes[block.Opcode] = true
+			}
+			if s.blocks == 0 {
+				continue
+			}
+			scripts = append(scripts, s)
+			report.Blocks += s.blocks
+			if !mermaid.IsHatOpcode(target.Blocks[top].Opcode) {
+				report.Smells.DeadScripts = append(report.Smells.DeadScripts, s.ref(translator))
+			}
+		}
+	}
+	report.Scripts = len(scripts)
+
+	report.Scores = score(scripts, opcodes)
+	report.Total = report.Scores.Total()
+	report.Level = report.Scores.Level()
+	report.Smells.UnusedVariables = unusedVariables(project)
+	report.Smells.DuplicatedScripts = duplicatedScripts(scripts, translator)
+	return report
+}
+
+func (s *script) ref(translator *mermaid.OpcodeTranslator) ScriptRef {
+	return ScriptRef{
+		Target:  s.target.Name,
+		BlockID: s.top,
+		Label:   mermaid.GetBlockLabel(s.target.Blocks[s.top], translator, s.target.Broadcasts, s.target.Blocks),
+		Blocks:  s.blocks,
+	}
+}
+
+// rule 积木出现时该维度至少得到的分数
+type rule struct {
+	level   int
+	opcodes []string
+}
+
+var (
+	logicRules = []rule{
+		{1, []string{"control_if"}},
+		{2, []string{"control_if_else"}},
+		{3, []string{"operator_and", "operator_or", "operator_not"}},
+	}
+	synchronizationRules = []rule{
+		{1, []string{"control_wait"}},
+		{2, []string{"event_broadcast", "event_whenbroadcastreceived", "control_stop"}},
+		{3, []string{"control_wait_until", "event_whenbackdropswitchesto", "event_broadcastandwait"}},
+	}
+	flowControlRules = []rule{
+		{2, []string{"control_repeat", "control_forever"}},
+		{3, []string{"control_repeat_until"}},
+	}
+	userInteractivityRules = []rule{
+		{1, []string{"event_whenflagclicked"}},
+		{2, []string{"event_whenkeypressed", "event_whenthisspriteclicked", "event_whenstageclicked",
+			"sensing_askandwait", "sensing_answer", "sensing_keypressed", "sensing_mousedown", "sensing_mousex", "sensing_mousey"}},
+		{3, []string{"event_whengreaterthan", "sensing_loudness"}},
+	}
+	dataRepresentationRules = []rule{
+		{2, []string{"data_setvariableto", "data_changevariableby", "data_showvariable", "data_hidevariable"}},
+	}
+)
+
+// score 计算各维度得分
+func score(scripts []script, opcodes map[string]bool) Scores {
+	var s Scores
+
+	// 抽象
+	if len(scripts) > 1 {
+		s.Abstraction = 1
+	}
+	if opcodes["procedures_definition"] {
+		s.Abstraction = 2
+	}
+	if opcodes["control_create_clone_of"] || opcodes["control_start_as_clone"] {
+		s.Abstraction = 3
+	}
+
+	s.Parallelism = parallelism(scripts)
+	s.Logic = applyRules(0, logicRules, opcodes)
+	s.Synchronization = applyRules(0, synchronizationRules, opcodes)
+
+	// 流程控制：有两个以上积木连在一起就是顺序结构
+	for _, sc := range scripts {
+		if sc.blocks > 1 {
+			s.FlowControl = 1
+			break
+		}
+	}
+	s.FlowControl = applyRules(s.FlowControl, flowControlRules, opcodes)
+
+	s.UserInteractivity = applyRules(0, userInteractivityRules, opcodes)
+	for opcode := range opcodes {
+		// 视频侦测扩展
+		if strings.HasPrefix(opcode, "videoSensing_") {
+			s.UserInteractivity = 3
+		}
+	}
+
+	for opcode := range opcodes {
+		switch {
+		case strings.HasPrefix(opcode, "data_") && strings.Contains(opcode, "list"):
+			s.DataRepresentation = max(s.DataRepresentation, 3)
+		case strings.HasPrefix(opcode, "motion_") || strings.HasPrefix(opcode, "looks_"):
+			s.DataRepresentation = max(s.DataRepresentation, 1)
+		}
+	}
+	s.DataRepresentation = applyRules(s.DataRepresentation, dataRepresentationRules, opcodes)
+	return s
+}
+
+func applyRules(level int, rules []rule, opcodes map[string]bool) int {
+	for _, r := range rules {
+		for _, opcode := range r.opcodes {
+			if opcodes[opcode] && r.level > level {
+				level = r.level
+			}
+		}
+	}
+	return level
+}
+
+// parallelism 同一事件触发两个以上脚本时，这些脚本会同时执行
+func parallelism(scripts []script) int {
+	counts := make(map[string]int)
+	level := 0
+	for _, sc := range scripts {
+		block := sc.target.Blocks[sc.top]
+		var key string
+		var keyLevel int
+		switch block.Opcode {
+		case "event_whenflagclicked":
+			key, keyLevel = block.Opcode, 1
+		case "event_whenkeypressed":
+			key, keyLevel = block.Opcode+fieldValue(block, "KEY_OPTION"), 2
+		case "event_whenthisspriteclicked", "event_whenstageclicked":
+			key, keyLevel = block.Opcode+sc.target.Name, 2
+		case "event_whenbroadcastreceived":
+			key, keyLevel = block.Opcode+fieldValue(block, "BROADCAST_OPTION"), 3
+		case "event_whenbackdropswitchesto":
+			key, keyLevel = block.Opcode+fieldValue(block, "BACKDROP"), 3
+		case "event_whengreaterthan":
+			key, keyLevel = block.Opcode+fieldValue(block, "WHENGREATERTHANMENU"), 3
+		case "control_start_as_clone":
+			key, keyLevel = block.Opcode+sc.target.Name, 3
+		default:
+			continue
+		}
+		counts[key]++
+		if counts[key] > 1 && keyLevel > level {
+			level = keyLevel
+		}
+	}
+	return level
+}
+
+// fieldValue 字段的值，字段在 project.json 中是 [值, ID]
+func fieldValue(block mermaid.Block, name string) string {
+	field, ok := block.Fields[name].([]interface{})
+	if !ok || len(field) == 0 {
+		return ""
+	}
+	value, _ := field[0].(string)
+	return value
+}
+
+// unusedVariables 找出没有被任何积木使用的变量和列表
+func unusedVariables(project *mermaid.Project) []VariableRef {
+	used := make(map[string]bool)
+	// 侦测积木“角色的属性”按名称引用其他角色的变量
+	usedNames := make(map[string]bool)
+	for _, target := range project.Targets {
+		for _, block := range target.Blocks {
+			for _, name := range []string{"VARIABLE", "LIST"} {
+				if field, ok := block.Fields[name].([]interface{}); ok && len(field) > 1 {
+					if id, ok := field[1].(string); ok {
+						used[id] = true
+					}
+				}
+			}
+			if block.Opcode == "sensing_of" {
+				usedNames[fieldValue(block, "PROPERTY")] = true
+			}
+			for _, input := range block.Inputs {
+				collectInputVariables(input, used)
+			}
+		}
+	}
+
+	unused := []VariableRef{}
+	for _, target := range project.Targets {
+		for _, group := range []struct {
+			items  map[string][]interface{}
+			isList bool
+		}{{target.Variables, false}, {target.Lists, true}} {
+			var refs []VariableRef
+			for id, item := range group.items {
+				var name string
+				if len(item) > 0 {
+					name, _ = item[0].(string)
+				}
+				if used[id] || (!target.IsStage && !group.isList && usedNames[name]) {
+					continue
+				}
+				refs = append(refs, VariableRef{Target: target.Name, ID: id, Name: name, IsList: group.isList})
+			}
+			sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+			unused = append(unused, refs...)
+		}
+	}
+	return unused
+}
+
+// collectInputVariables 输入中直接放入的变量和列表在 project.json 中是 [12, 名称, ID] 和 [13, 名称, ID]
+func collectInputVariables(value interface{}, used map[string]bool) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return
+	}
+	if len(list) >= 3 {
+		if kind, ok := list[0].(float64); ok && (kind == 12 || kind == 13) {
+			if id, ok := list[2].(string); ok {
+				used[id] = true
+			}
+			return
+		}
+	}
+	for _, item := range list {
+		collectInputVariables(item, used)
+	}
+}
+
+// duplicatedScripts 找出内容相同的脚本，比较时忽略积木ID和位置，变量按名称比较
+func duplicatedScripts(scripts []script, translator *mermaid.OpcodeTranslator) [][]ScriptRef {
+	groups := make(map[string][]ScriptRef)
+	var order []string
+	for i := range scripts {
+		sc := &scripts[i]
+		if sc.blocks < minDuplicateBlocks {
+			continue
+		}
+		h := md5.New()
+		writeChain(h, sc.target.Blocks, sc.top, make(map[string]bool))
+		key := fmt.Sprintf("%x", h.Sum(nil))
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], sc.ref(translator))
+	}
+
+	duplicated := [][]ScriptRef{}
+	for _, key := range order {
+		if len(groups[key]) > 1 {
+			duplicated = append(duplicated, groups[key])
+		}
+	}
+	return duplicated
+}
+
+// writeChain 把从 id 开始的一串积木的内容写入 h
+func writeChain(h hash.Hash, blocks map[string]mermaid.Block, id string, visited map[string]bool) {
+	for id != "" && !visited[id] {
+		visited[id] = true
+		block, ok := blocks[id]
+		if !ok {
+			return
+		}
+		fmt.Fprintf(h, "%s{", block.Opcode)
+		for _, name := range sortedKeys(block.Fields) {
+			fmt.Fprintf(h, "%s=%s;", name, fieldValue(block, name))
+		}
+		for _, name := range sortedKeys(block.Inputs) {
+			fmt.Fprintf(h, "%s:", name)
+			writeInput(h, blocks, block.Inputs[name], visited)
+			h.Write([]byte(";"))
+		}
+		h.Write([]byte("}"))
+
+		id = ""
+		if block.Next != nil {
+			id = *block.Next
+		}
+	}
+}
+
+// writeInput 写入输入的内容，输入中引用的积木展开写入，其他值按原样写入
+func writeInput(h hash.Hash, blocks map[string]mermaid.Block, value interface{}, visited map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		if _, ok := blocks[v]; ok {
+			h.Write([]byte("("))
+			writeChain(h, blocks, v, visited)
+			h.Write([]byte(")"))
+			return
+		}
+	case []interface{}:
+		// 变量和列表忽略ID，只比较名称
+		if len(v) >= 3 {
+			if kind, ok := v[0].(float64); ok && (kind == 12 || kind == 13) {
+				fmt.Fprintf(h, "[%v %v]", v[0], v[1])
+				return
+			}
+		}
+		h.Write([]byte("["))
+		for _, item := range v {
+			writeInput(h, blocks, item, visited)
+			h.Write([]byte(","))
+		}
+		h.Write([]byte("]"))
+		return
+	}
+	data, _ := json.Marshal(value)
+	h.Write(data)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
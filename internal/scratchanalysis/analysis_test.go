@@ -0,0 +1,104 @@
+package scratchanalysis
+
+import (
+	"testing"
+
+	"github.com/jun/fun_code/internal/mermaid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const analysisProject = `{
+  "targets": [
+    {
+      "isStage": true,
+      "name": "Stage",
+      "variables": {"v1": ["score", 0], "v2": ["unused", 0]},
+      "lists": {"l1": ["names", []]},
+      "blocks": {}
+    },
+    {
+      "isStage": false,
+      "name": "Cat",
+      "variables": {"v3": ["speed", 1]},
+      "blocks": {
+        "a1": {"opcode": "event_whenflagclicked", "next": "a2", "parent": null, "topLevel": true, "fields": {}, "inputs": {}},
+        "a2": {"opcode": "control_forever", "next": null, "parent": "a1", "topLevel": false, "fields": {}, "inputs": {"SUBSTACK": [2, "a3"]}},
+        "a3": {"opcode": "control_if", "next": null, "parent": "a2", "topLevel": false, "fields": {}, "inputs": {"CONDITION": [2, "a4"], "SUBSTACK": [2, "a5"]}},
+        "a4": {"opcode": "sensing_keypressed", "next": null, "parent": "a3", "topLevel": false, "fields": {}, "inputs": {"KEY_OPTION": [1, "a6"]}},
+        "a5": {"opcode": "data_changevariableby", "next": null, "parent": "a3", "topLevel": false, "fields": {"VARIABLE": ["score", "v1"]}, "inputs": {"VALUE": [1, [4, "1"]]}},
+        "a6": {"opcode": "sensing_keyoptions", "next": null, "parent": "a4", "topLevel": false, "shadow": true, "fields": {"KEY_OPTION": ["space", null]}, "inputs": {}},
+        "b1": {"opcode": "event_whenflagclicked", "next": "b2", "parent": null, "topLevel": true, "fields": {}, "inputs": {}},
+        "b2": {"opcode": "motion_movesteps", "next": null, "parent": "b1", "topLevel": false, "fields": {}, "inputs": {"STEPS": [3, [12, "speed", "v3"], [4, "10"]]}},
+        "c1": {"opcode": "looks_say", "next": null, "parent": null, "topLevel": true, "fields": {}, "inputs": {"MESSAGE": [1, [10, "hi"]]}}
+      }
+    },
+    {
+      "isStage": false,
+      "name": "Sprite1",
+      "blocks": {
+        "d1": {"opcode": "event_whenflagclicked", "next": "d2", "parent": null, "topLevel": true, "fields": {}, "inputs": {}},
+        "d2": {"opcode": "control_forever", "next": null, "parent": "d1", "topLevel": false, "fields": {}, "inputs": {"SUBSTACK": [2, "d3"]}},
+        "d3": {"opcode": "control_if", "next": null, "parent": "d2", "topLevel": false, "fields": {}, "inputs": {"CONDITION": [2, "d4"], "SUBSTACK": [2, "d5"]}},
+        "d4": {"opcode": "sensing_keypressed", "next": null, "parent": "d3", "topLevel": false, "fields": {}, "inputs": {"KEY_OPTION": [1, "d6"]}},
+        "d5": {"opcode": "data_changevariableby", "next": null, "parent": "d3", "topLevel": false, "fields": {"VARIABLE": ["score", "v1"]}, "inputs": {"VALUE": [1, [4, "1"]]}},
+        "d6": {"opcode": "sensing_keyoptions", "next": null, "parent": "d4", "topLevel": false, "shadow": true, "fields": {"KEY_OPTION": ["space", null]}, "inputs": {}}
+      }
+    }
+  ]
+}`
+
+func TestAnalyze(t *testing.T) {
+	project, err := mermaid.ParseProject([]byte(analysisProject))
+	require.NoError(t, err)
+
+	report := Analyze(project)
+	assert.Equal(t, Scores{
+		Abstraction:        1, // 多个脚本
+		Parallelism:        1, // 多个绿旗脚本
+		Logic:              1, // 如果
+		Synchronization:    0,
+		FlowControl:        2, // 重复执行
+		UserInteractivity:  2, // 按键检测
+		DataRepresentation: 2, // 修改变量
+	}, report.Scores)
+	assert.Equal(t, 9, report.Total)
+	assert.Equal(t, LevelDeveloping, report.Level)
+	assert.Equal(t, 2, report.Sprites)
+	assert.Equal(t, 4, report.Scripts)
+	assert.Equal(t, 13, report.Blocks)
+
+	require.Len(t, report.Smells.DeadScripts, 1)
+	assert.Equal(t, "c1", report.Smells.DeadScripts[0].BlockID)
+	assert.Equal(t, "Cat", report.Smells.DeadScripts[0].Target)
+
+	// speed 在输入中使用，score 在字段中使用
+	assert.Equal(t, []VariableRef{
+		{Target: "Stage", ID: "v2", Name: "unused"},
+		{Target: "Stage", ID: "l1", Name: "names", IsList: true},
+	}, report.Smells.UnusedVariables)
+
+	require.Len(t, report.Smells.DuplicatedScripts, 1)
+	assert.Equal(t, "a1", report.Smells.DuplicatedScripts[0][0].BlockID)
+	assert.Equal(t, "d1", report.Smells.DuplicatedScripts[0][1].BlockID)
+	assert.Equal(t, 5, report.Smells.DuplicatedScripts[0][0].Blocks)
+
+	assert.Equal(t, []string{"Sprite1"}, report.Smells.DefaultSpriteNames)
+	assert.Equal(t, 5, report.Smells.Count())
+}
+
+func TestScoreLevels(t *testing.T) {
+	opcodes := map[string]bool{
+		"procedures_definition":   true,
+		"control_create_clone_of": true,
+		"operator_and":            true,
+		"control_wait_until":      true,
+		"control_repeat_until":    true,
+		"sensing_loudness":        true,
+		"data_addtolist":          true,
+	}
+	s := score(nil, opcodes)
+	assert.Equal(t, Scores{3, 0, 3, 3, 3, 3, 3}, s)
+	assert.Equal(t, LevelProficient, s.Level())
+	assert.Equal(t, LevelBasic, Scores{}.Level())
+}
@@ -70,6 +70,20 @@ func (s *Server) setupRoutes() {
 		s.router.POST("/api/auth/register", gorails.Wrap(s.handler.RegisterHandler, nil))
 		s.router.POST("/api/auth/login", gorails.Wrap(s.handler.LoginHandler, nil))
 		s.router.POST("/api/auth/logout", gorails.Wrap(s.handler.LogoutHandler, nil))
+		s.router.POST("/api/auth/refresh", gorails.Wrap(s.handler.RefreshTokenHandler, nil))
+		// 低年级学生的图片密码和二维码登录卡
+		s.router.GET("/api/auth/picture_login/:code", gorails.Wrap(s.handler.GetPictureLoginClassHandler, nil))
+		s.router.POST("/api/auth/picture_login", gorails.Wrap(s.handler.PictureLoginHandler, nil))
+		s.router.GET("/api/auth/badge_login", gorails.Wrap(s.handler.BadgeLoginHandler, handler.RenderLoginRedirect))
+		// OpenID Connect 单点登录
+		s.router.GET("/api/auth/oidc", gorails.Wrap(s.handler.GetOIDCConfigHandler, nil))
+		s.router.GET("/api/auth/oidc/login", gorails.Wrap(s.handler.OIDCLoginHandler, handler.RenderOIDCRedirect))
+		// 关联外部身份时需要知道当前登录的用户
+		s.router.GET("/api/auth/oidc/callback", s.handler.TryAuthMiddleware(), gorails.Wrap(s.handler.OIDCCallbackHandler, handler.RenderOIDCRedirect))
+		// 密码策略和忘记密码
+		s.router.GET("/api/auth/password/policy", gorails.Wrap(s.handler.GetPasswordPolicyHandler, nil))
+		s.router.POST("/api/auth/password/forgot", gorails.Wrap(s.handler.ForgotPasswordHandler, nil))
+		s.router.POST("/api/auth/password/reset", gorails.Wrap(s.handler.ResetPasswordHandler, nil))
 		s.router.GET("/api/i18n/languages", gorails.Wrap(s.handler.GetSupportedLanguagesHandler, nil)) // 获取支持的语言列表
 		s.router.POST("/api/i18n/language", gorails.Wrap(s.handler.SetLanguageHandler, nil))           // 设置语言
 
@@ -92,6 +106,13 @@ func (s *Server) setupRoutes() {
 			auth.PUT("/scratch/projects/:id/thumbnail", gorails.Wrap(s.handler.UpdateProjectThumbnailHandler, nil))
 			auth.GET("/scratch/projects/:id/thumbnail", gorails.Wrap(s.handler.GetProjectThumbnailHandler, handler.RenderProjectThumbnail))
 			auth.GET("/scratch/projects/:id/histories", gorails.Wrap(s.handler.GetScratchProjectHistoriesHandler, nil))
+			auth.GET("/scratch/projects/:id/histories/diff", gorails.Wrap(s.handler.DiffScratchProjectHistoriesHandler, nil))
+			auth.POST("/scratch/projects/:id/histories/:md5/restore", gorails.Wrap(s.handler.RestoreScratchProjectHistoryHandler, nil))
+			// 导入和导出 .sb3 文件
+			auth.POST("/scratch/projects/import", gorails.Wrap(s.handler.ImportScratchSB3Handler, nil))
+			auth.GET("/scratch/projects/:id/sb3", gorails.Wrap(s.handler.ExportScratchSB3Handler, handler.RenderAttachment))
+			// 计算思维得分和代码问题
+			auth.GET("/scratch/projects/:id/analysis", gorails.Wrap(s.handler.GetScratchProjectAnalysisHandler, nil))
 			auth.GET("/scratch/projects", gorails.Wrap(s.handler.ListScratchProjectsHandler, nil))
 			auth.GET("/scratch/projects/search", gorails.Wrap(s.handler.SearchScratchHandler, nil))
 
@@ -130,8 +151,21 @@ func (s *Server) setupRoutes() {
 
 			auth.GET("/user/info", gorails.Wrap(s.handler.GetCurrentUserHandler, nil))
 
+			// 修改自己的密码，需要先修改密码时也可以访问
+			auth.PUT("/auth/password", gorails.Wrap(s.handler.ChangeMyPasswordHandler, nil))
+
+			// 登录会话管理
+			auth.GET("/auth/sessions", gorails.Wrap(s.handler.ListMySessionsHandler, nil))
+			auth.DELETE("/auth/sessions/:id", gorails.Wrap(s.handler.RevokeMySessionHandler, nil))
+
+			// 关联单点登录的外部身份
+			auth.GET("/auth/oidc/link", gorails.Wrap(s.handler.LinkOIDCHandler, handler.RenderOIDCRedirect))
+			auth.GET("/auth/identities", gorails.Wrap(s.handler.ListMyIdentitiesHandler, nil))
+			auth.DELETE("/auth/identities/:id", gorails.Wrap(s.handler.UnlinkMyIdentityHandler, nil))
+
 			// 学生端路由 - 查看自己参与的班级和课程
 			auth.GET("/student/classes", gorails.Wrap(s.handler.GetMyClassesHandler, nil))                          // 我的班级列表
+			auth.POST("/student/classes/join", gorails.Wrap(s.handler.JoinClassHandler, nil))                       // 通过邀请码加入班级
 			auth.GET("/student/classes/:class_id", gorails.Wrap(s.handler.GetMyClassHandler, nil))                  // 我的班级详情
 			auth.GET("/student/classes/:class_id/courses", gorails.Wrap(s.handler.GetMyClassCoursesHandler, nil))   // 我的班级课程
 			auth.GET("/student/courses/:course_id/lessons", gorails.Wrap(s.handler.GetMyCourseLessonsHandler, nil)) // 我的课程课时
@@ -140,24 +174,80 @@ func (s *Server) setupRoutes() {
 			auth.GET("/student/scratch/projects/:id", gorails.Wrap(s.handler.GetStudentScratchProjectHandler, handler.RenderScratchProject))
 			auth.POST("/student/scratch/projects", gorails.Wrap(s.handler.CreateScratchProjectHandler, handler.RenderCreateScratchProjectResponse))
 
+			// 学生端作业路由
+			auth.GET("/student/classes/:class_id/assignments", gorails.Wrap(s.handler.GetMyClassAssignmentsHandler, nil))                                // 我的班级作业
+			auth.GET("/student/assignments/:assignment_id", gorails.Wrap(s.handler.GetMyAssignmentHandler, nil))                                         // 作业详情及我的提交
+			auth.POST("/student/assignments/:assignment_id/submissions", gorails.Wrap(s.handler.SubmitAssignmentHandler, nil))                           // 提交作业
+			auth.GET("/student/submissions/:submission_id/content", gorails.Wrap(s.handler.GetMySubmissionContentHandler, handler.RenderScratchProject)) // 我提交的作业内容
+
 			{
-				admin := auth.Group("/admin").Use(s.handler.RequirePermission(handler.PermissionManageAll))
-				admin.POST("/classes/create", gorails.Wrap(s.handler.CreateClassHandler, nil))
+				// 班级管理路由：老师管理自己的班级，助教管理所在班级的学生和作业，拥有 manage_class 的用户管理所有班级
+				classes := auth.Group("/admin")
+				ownClass := s.handler.RequireOwnership("class", "class_id")
+				classStudents := s.handler.RequireClassPermission(handler.PermissionManageOwnStudents, "class_id")
+				classes.POST("/classes/create", s.handler.RequirePermission(handler.PermissionManageOwnClass), gorails.Wrap(s.handler.CreateClassHandler, nil))
 				// 班级列表路由
-				admin.GET("/classes/list", gorails.Wrap(s.handler.ListClassesHandler, nil))
+				classes.GET("/classes/list", s.handler.RequirePermission(handler.PermissionManageOwnClass), gorails.Wrap(s.handler.ListClassesHandler, nil))
 				// 获取单个班级的信息路由
-				admin.GET("/classes/:class_id", gorails.Wrap(s.handler.GetClassHandler, nil))
+				classes.GET("/classes/:class_id", classStudents, gorails.Wrap(s.handler.GetClassHandler, nil))
 				// 修改班级信息路由
-				admin.PUT("/classes/:class_id", gorails.Wrap(s.handler.UpdateClassHandler, nil))
+				classes.PUT("/classes/:class_id", ownClass, gorails.Wrap(s.handler.UpdateClassHandler, nil))
 				// 删除班级路由
-				admin.DELETE("/classes/:class_id", gorails.Wrap(s.handler.DeleteClassHandler, nil))
+				classes.DELETE("/classes/:class_id", ownClass, gorails.Wrap(s.handler.DeleteClassHandler, nil))
 
 				// 班级课程管理路由
-				admin.POST("/classes/:class_id/courses", gorails.Wrap(s.handler.AddCourseToClassHandler, nil))
-				admin.DELETE("/classes/:class_id/courses/:course_id", gorails.Wrap(s.handler.RemoveCourseFromClassHandler, nil))
-				admin.GET("/classes/:class_id/courses", gorails.Wrap(s.handler.GetClassCoursesHandler, nil))
-				admin.GET("/classes/:class_id/lessons", gorails.Wrap(s.handler.GetClassLessonsHandler, nil))
-				admin.GET("/classes/:class_id/students", gorails.Wrap(s.handler.GetClassStudentsHandler, nil))
+				classes.POST("/classes/:class_id/courses", ownClass, gorails.Wrap(s.handler.AddCourseToClassHandler, nil))
+				classes.DELETE("/classes/:class_id/courses/:course_id", ownClass, gorails.Wrap(s.handler.RemoveCourseFromClassHandler, nil))
+				classes.GET("/classes/:class_id/courses", classStudents, gorails.Wrap(s.handler.GetClassCoursesHandler, nil))
+				classes.GET("/classes/:class_id/lessons", classStudents, gorails.Wrap(s.handler.GetClassLessonsHandler, nil))
+				classes.GET("/classes/:class_id/students", classStudents, gorails.Wrap(s.handler.GetClassStudentsHandler, nil))
+
+				// 设置助教
+				classes.PUT("/classes/:class_id/members/:user_id/role", ownClass, gorails.Wrap(s.handler.SetClassMemberRoleHandler, nil))
+
+				// 邀请码与加入审核
+				classes.POST("/classes/:class_id/code/rotate", ownClass, gorails.Wrap(s.handler.RotateClassCodeHandler, nil))
+				classes.PUT("/classes/:class_id/join_settings", ownClass, gorails.Wrap(s.handler.UpdateClassJoinSettingsHandler, nil))
+				classes.GET("/classes/:class_id/join_requests", classStudents, gorails.Wrap(s.handler.ListClassJoinRequestsHandler, nil))
+				classes.POST("/classes/:class_id/join_requests/:user_id/approve", classStudents, gorails.Wrap(s.handler.ApproveClassJoinRequestHandler, nil))
+				classes.POST("/classes/:class_id/join_requests/:user_id/reject", classStudents, gorails.Wrap(s.handler.RejectClassJoinRequestHandler, nil))
+
+				// 图片密码和二维码登录卡
+				classes.PUT("/classes/:class_id/picture_login", ownClass, gorails.Wrap(s.handler.UpdateClassPictureLoginHandler, nil))
+				classes.POST("/classes/:class_id/login_cards", classStudents, gorails.Wrap(s.handler.StudentLoginCardsHandler, handler.RenderTemplateResponse))
+
+				// 为忘记密码的学生生成一次性重置码
+				classes.POST("/classes/:class_id/students/:user_id/password_reset", classStudents, gorails.Wrap(s.handler.CreateStudentResetCodeHandler, nil))
+
+				// 让班级所有成员退出登录
+				classes.POST("/classes/:class_id/sessions/revoke", classStudents, gorails.Wrap(s.handler.RevokeClassSessionsHandler, nil))
+
+				// 班级作业管理路由
+				classes.POST("/classes/:class_id/assignments", classStudents, gorails.Wrap(s.handler.CreateAssignmentHandler, nil))
+				classes.GET("/classes/:class_id/assignments", classStudents, gorails.Wrap(s.handler.ListClassAssignmentsHandler, nil))
+				classes.GET("/classes/:class_id/assignments/:assignment_id", classStudents, gorails.Wrap(s.handler.GetClassAssignmentHandler, nil))
+				classes.PUT("/classes/:class_id/assignments/:assignment_id", classStudents, gorails.Wrap(s.handler.UpdateAssignmentHandler, nil))
+				classes.DELETE("/classes/:class_id/assignments/:assignment_id", classStudents, gorails.Wrap(s.handler.DeleteAssignmentHandler, nil))
+				classes.GET("/classes/:class_id/assignments/:assignment_id/submissions", classStudents, gorails.Wrap(s.handler.ListAssignmentSubmissionsHandler, nil))
+				classes.GET("/classes/:class_id/submissions/:submission_id", classStudents, gorails.Wrap(s.handler.GetClassSubmissionHandler, nil))
+				classes.GET("/classes/:class_id/submissions/:submission_id/content", classStudents, gorails.Wrap(s.handler.GetClassSubmissionContentHandler, handler.RenderScratchProject))
+				classes.PUT("/classes/:class_id/submissions/:submission_id/return", classStudents, gorails.Wrap(s.handler.ReturnSubmissionHandler, nil))
+				classes.PUT("/classes/:class_id/submissions/:submission_id/grade", classStudents, gorails.Wrap(s.handler.SaveSubmissionGradeHandler, nil))
+				classes.GET("/classes/:class_id/submissions/:submission_id/grade", classStudents, gorails.Wrap(s.handler.GetSubmissionGradeHandler, nil))
+				classes.GET("/classes/:class_id/grades/export", classStudents, gorails.Wrap(s.handler.ExportClassGradesHandler, handler.RenderCSV))
+				// 班级所有学生的 Scratch 项目得分
+				classes.GET("/classes/:class_id/scratch_analysis", classStudents, gorails.Wrap(s.handler.ListClassScratchAnalysisHandler, nil))
+
+				// 学期结束时归档班级所有学生的作品
+				classes.GET("/classes/:class_id/archive", classStudents, gorails.Wrap(s.handler.ExportClassArchiveHandler, handler.RenderClassArchive))
+
+				admin := auth.Group("/admin").Use(s.handler.RequirePermission(handler.PermissionManageAll))
+
+				// 角色和权限管理路由
+				admin.GET("/roles", gorails.Wrap(s.handler.ListRolesHandler, nil))
+				admin.POST("/roles", gorails.Wrap(s.handler.CreateRoleHandler, nil))
+				admin.PUT("/roles/:name", gorails.Wrap(s.handler.UpdateRoleHandler, nil))
+				admin.DELETE("/roles/:name", gorails.Wrap(s.handler.DeleteRoleHandler, nil))
 
 				// 课程管理路由
 				admin.POST("/courses", gorails.Wrap(s.handler.CreateCourseHandler, nil))
@@ -173,6 +263,12 @@ func (s *Server) setupRoutes() {
 				admin.POST("/courses/:course_id/lessons", gorails.Wrap(s.handler.AddLessonToCourseHandler, nil))
 				admin.DELETE("/courses/:course_id/lessons/:lesson_id", gorails.Wrap(s.handler.RemoveLessonFromCourseHandler, nil))
 
+				// 课程评分标准路由
+				admin.GET("/courses/:course_id/rubric", gorails.Wrap(s.handler.ListRubricCriteriaHandler, nil))
+				admin.POST("/courses/:course_id/rubric", gorails.Wrap(s.handler.CreateRubricCriterionHandler, nil))
+				admin.PUT("/courses/:course_id/rubric/:criterion_id", gorails.Wrap(s.handler.UpdateRubricCriterionHandler, nil))
+				admin.DELETE("/courses/:course_id/rubric/:criterion_id", gorails.Wrap(s.handler.DeleteRubricCriterionHandler, nil))
+
 				// 课时管理路由
 				admin.POST("/lessons", gorails.Wrap(s.handler.CreateLessonHandler, nil))
 				admin.PUT("/lessons/:lesson_id", gorails.Wrap(s.handler.UpdateLessonHandler, nil))
@@ -183,14 +279,25 @@ func (s *Server) setupRoutes() {
 				admin.PUT("/lessons/reorder", gorails.Wrap(s.handler.ReorderLessonsHandler, nil))
 
 				// 用户管理路由 - 已改造为 gorails.Wrap 形式
-				admin.POST("/users/create", s.handler.RequirePermission("manage_users"), gorails.Wrap(s.handler.CreateUserHandler, nil))
-				admin.GET("/users/list", s.handler.RequirePermission("manage_users"), gorails.Wrap(s.handler.ListUsersHandler, nil))
-				admin.PUT("/users/:user_id", s.handler.RequirePermission("manage_users"), gorails.Wrap(s.handler.UpdateUserHandler, nil))
+				admin.POST("/users/create", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.CreateUserHandler, nil))
+				admin.GET("/users/list", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.ListUsersHandler, nil))
+				admin.PUT("/users/:user_id", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.UpdateUserHandler, nil))
 				admin.DELETE("/users/:user_id", gorails.Wrap(s.handler.DeleteUserHandler, nil))
-				admin.GET("/users/:user_id", s.handler.RequirePermission("manage_users"), gorails.Wrap(s.handler.GetUserHandler, nil))
-				admin.GET("/users/search", s.handler.RequirePermission("manage_users"), gorails.Wrap(s.handler.SearchUsersHandler, nil))
+				admin.GET("/users/:user_id", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.GetUserHandler, nil))
+				admin.GET("/users/search", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.SearchUsersHandler, nil))
+				admin.POST("/users/import", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.ImportUsersHandler, nil))
+				admin.POST("/users/password_sheet", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.PasswordSheetHandler, handler.RenderTemplateResponse))
+				admin.GET("/classes/:class_id/users/export", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.ExportClassUsersHandler, handler.RenderAttachment))
+				// 登录失败记录和解除锁定
+				admin.GET("/auth/login_failures", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.ListLoginFailuresHandler, nil))
+				admin.POST("/auth/unlock", s.handler.RequirePermission(handler.PermissionManageUsers), gorails.Wrap(s.handler.UnlockLoginHandler, nil))
+				// 审计记录查询和导出
+				admin.GET("/audit_events", gorails.Wrap(s.handler.ListAuditEventsHandler, nil))
+				admin.GET("/audit_events/export", gorails.Wrap(s.handler.ExportAuditEventsHandler, handler.RenderCSV))
 				// 获取所有scratch项目
 				admin.GET("/scratch/projects", gorails.Wrap(s.handler.GetAllScratchProjectHandler, nil))
+				// 回收未被引用的scratch资源
+				admin.POST("/scratch/assets/gc", gorails.Wrap(s.handler.CollectOrphanAssetsHandler, nil))
 
 				// 程序管理路由
 				admin.GET("/programs", gorails.Wrap(s.handler.AdminListProgramsHandler, nil))
@@ -202,6 +309,7 @@ func (s *Server) setupRoutes() {
 
 				// 流程图管理路由
 				admin.GET("/flowchart/scratch/:project_id", gorails.Wrap(s.handler.GetFlowchartScratchHandler, nil))
+				admin.POST("/flowchart/scratch/:project_id/excalidraw", gorails.Wrap(s.handler.CreateFlowchartScratchBoardHandler, nil))
 			}
 			// 班级相关路由
 		}
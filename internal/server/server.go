@@ -11,18 +11,19 @@ import (
 	"time"
 
 	ginzap "github.com/gin-contrib/zap"
+	"github.com/jun/fun_code/internal/backup"
 	"github.com/jun/fun_code/internal/cache"
 	"github.com/jun/fun_code/internal/config"
 	"github.com/jun/fun_code/internal/dao"
 	"github.com/jun/fun_code/internal/database"
 	"github.com/jun/fun_code/internal/handler"
 	"github.com/jun/fun_code/internal/i18n"
+	"github.com/jun/fun_code/internal/mail"
 	"github.com/jun/fun_code/internal/model"
 	"github.com/mail2fish/gorails/gorails"
 	"go.uber.org/zap"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 	"moul.io/zapgorm2"
@@ -31,6 +32,7 @@ import (
 type Server struct {
 	config    *config.Config
 	db        *gorm.DB
+	dao       *dao.Dao
 	handler   *handler.Handler
 	router    *gin.Engine
 	etagCache cache.ETagCache
@@ -49,7 +51,7 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 	}
 
 	// 初始化数据库
-	db, err := gorm.Open(sqlite.Open(cfg.Database.DSN), gormConfig)
+	db, err := database.Open(cfg.Database.Driver, cfg.Database.DSN, gormConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +60,9 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 	}
 
 	// 自动迁移数据库结构
-	database.RunMigrations(db)
+	if err := database.RunMigrations(db); err != nil {
+		return nil, err
+	}
 
 	// 确保文件存储目录存在
 	if err = os.MkdirAll(cfg.Storage.BasePath, 0755); err != nil {
@@ -80,11 +84,25 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 
 	isDemo := cfg.Env == "demo"
 
+	// 外部认证来源，登录时先于本地密码尝试
+	var authProviders []dao.AuthProvider
+	if cfg.LDAP.Enabled {
+		authProviders = append(authProviders, dao.NewLDAPAuthProvider(db, cfg.LDAP))
+	}
+
+	// 配置了发信服务器时可以通过邮件找回密码
+	var mailSender mail.Sender
+	var resetURL string
+	if cfg.SMTP.Enabled() {
+		mailSender = mail.NewSMTPSender(cfg.SMTP)
+		resetURL = strings.TrimRight(cfg.SMTP.BaseURL, "/") + "/www/reset_password"
+	}
+
 	// 先创建 ScratchDao，因为 ExcalidrawDao 需要依赖它
 	scratchDao := dao.NewScratchDao(db, filepath.Join(cfg.Storage.BasePath, "scratch"), cfg, logger)
 
 	fDao := &dao.Dao{
-		AuthDao:       dao.NewAuthDao(db, []byte(cfg.JWT.SecretKey), sessionCache, isDemo),
+		AuthDao:       dao.NewAuthDao(db, cfg.JWT, sessionCache, cache.NewLoginAttemptCache(c), isDemo, authProviders...),
 		FileDao:       dao.NewFileDao(db),
 		ScratchDao:    scratchDao,
 		ClassDao:      dao.NewClassDao(db),
@@ -95,6 +113,14 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 		LessonDao:     dao.NewLessonDao(db),
 		ExcalidrawDao: dao.NewExcalidrawDAO(db, filepath.Join(cfg.Storage.BasePath, "excalidraw"), cfg, logger),
 		ProgramDao:    dao.NewProgramDao(db, filepath.Join(cfg.Storage.BasePath, "programs"), cfg, logger),
+		AssignmentDao: dao.NewAssignmentDao(db, cfg.Storage.SubmissionsDir(), cfg, logger),
+		GradeDao:      dao.NewGradeDao(db),
+		PasswordDao:   dao.NewPasswordDao(db, cfg.Password, mailSender, resetURL),
+		RoleDao:       dao.NewRoleDao(db),
+		AuditDao:      dao.NewAuditDao(db),
+	}
+	if cfg.OIDC.Enabled {
+		fDao.OIDCDao = dao.NewOIDCDao(db, cfg.OIDC, cache.NewOIDCStateCache(c))
 	}
 
 	// 如果admin 用户不存在，则创建新用户
@@ -134,11 +160,16 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 		gin.SetMode(gin.DebugMode)
 
 	}
+	// 只信任配置的反向代理转发的客户端 IP，c.ClientIP() 用于登录限制和审计日志
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("设置可信代理失败: %w", err)
+	}
 
 	// 创建服务器实例
 	s := &Server{
 		config:    cfg,
 		db:        db,
+		dao:       fDao,
 		handler:   h,
 		router:    r,
 		etagCache: etagCache,
@@ -152,6 +183,24 @@ func NewServer(cfg *config.Config, logger *zap.Logger) (*Server, error) {
 }
 
 func (s *Server) Start() error {
+	// 按配置定时自动备份
+	scheduler, err := backup.NewScheduler(s.db, s.config, s.logger)
+	if err != nil {
+		return err
+	}
+	if scheduler != nil {
+		scheduler.Start()
+	}
+
+	// 后台按保留策略清理 Scratch 项目历史文件
+	compactInterval, err := s.config.History.CompactIntervalDuration()
+	if err != nil {
+		return err
+	}
+	if compactInterval > 0 {
+		go s.compactHistories(compactInterval)
+	}
+
 	// 获取本地IP用于显示
 	host, err := getLocalIP()
 	if err != nil {
@@ -184,6 +233,24 @@ func (s *Server) Start() error {
 	}
 }
 
+// compactHistories 定时清理 Scratch 项目历史文件
+func (s *Server) compactHistories(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		result, err := s.dao.ScratchDao.CompactHistories(false)
+		if err != nil {
+			s.logger.Error("failed to compact scratch histories", zap.Error(err))
+			continue
+		}
+		if result.FilesRemoved > 0 {
+			s.logger.Info("scratch histories compacted",
+				zap.Int("files_removed", result.FilesRemoved),
+				zap.Int64("bytes_reclaimed", result.BytesReclaimed))
+		}
+	}
+}
+
 // startHTTPOnly 启动模式1：只有HTTP
 func (s *Server) startHTTPOnly(host string) error {
 	fmt.Printf("Startup Mode: HTTP Only\n")
@@ -0,0 +1,321 @@
+// Package xlsx 提供最基本的 XLSX 读写，只处理单个工作表中的文本数据，
+// 用于用户批量导入导出，不依赖第三方库
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSheet 文件中没有工作表
+var ErrNoSheet = errors.New("xlsx: 文件中没有工作表")
+
+// ErrTooLarge 行号、列号或文件内容超出上限
+var ErrTooLarge = errors.New("xlsx: 超出工作表大小限制")
+
+// 与 Excel 相同的工作表大小上限。读取时按行号和列号补齐空行空列，
+// 超出上限的不是正常的文件，直接报错，避免按伪造的行列号分配大量内存
+const (
+	MaxRows    = 1048576
+	MaxColumns = 16384 // XFD 列
+
+	// maxPartSize 单个 XML 部件解压后的大小上限
+	maxPartSize = 64 << 20
+)
+
+type workbookXML struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type relationshipsXML struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type richTextXML struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (r richTextXML) String() string {
+	if len(r.R) == 0 {
+		return r.T
+	}
+	var sb strings.Builder
+	for _, run := range r.R {
+		sb.WriteString(run.T)
+	}
+	return sb.String()
+}
+
+type sharedStringsXML struct {
+	Items []richTextXML `xml:"si"`
+}
+
+type sheetXML struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string       `xml:"r,attr"`
+			T  string       `xml:"t,attr"`
+			V  string       `xml:"v"`
+			Is *richTextXML `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadRows 读取第一个工作表的所有行，单元格统一转成字符串
+func ReadRows(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared sharedStringsXML
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(f, &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, ErrNoSheet
+	}
+	var sheet sheetXML
+	if err := decodeZipXML(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for i, row := range sheet.Rows {
+		// 行号缺失时按顺序递增；空行在 XML 中会被省略，这里补齐
+		rowNum := row.R
+		if rowNum == 0 {
+			rowNum = len(rows) + 1
+		}
+		if rowNum < 0 || rowNum > MaxRows {
+			return nil, fmt.Errorf("%w: 行号 %d", ErrTooLarge, rowNum)
+		}
+		for len(rows) < rowNum-1 {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+		for j, cell := range row.Cells {
+			col := j
+			if cell.R != "" {
+				c, err := columnIndex(cell.R)
+				if errors.Is(err, ErrTooLarge) {
+					return nil, err
+				}
+				if err == nil {
+					col = c
+				}
+			}
+			if col >= MaxColumns {
+				return nil, fmt.Errorf("%w: 第 %d 行的列数", ErrTooLarge, rowNum)
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+
+			var value string
+			switch cell.T {
+			case "s":
+				idx, err := strconv.Atoi(cell.V)
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, fmt.Errorf("xlsx: 第 %d 行共享字符串索引无效", i+1)
+				}
+				value = shared.Items[idx].String()
+			case "inlineStr":
+				if cell.Is != nil {
+					value = cell.Is.String()
+				}
+			default:
+				value = cell.V
+			}
+			if col < len(values) {
+				values[col] = value
+			} else {
+				values = append(values, value)
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// firstSheetPath 通过 workbook.xml 和关系文件找到第一个工作表的路径
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	wf, ok := files["xl/workbook.xml"]
+	if !ok {
+		return fallback, nil
+	}
+	var workbook workbookXML
+	if err := decodeZipXML(wf, &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", ErrNoSheet
+	}
+
+	rf, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return fallback, nil
+	}
+	var rels relationshipsXML
+	if err := decodeZipXML(rf, &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+func decodeZipXML(f *zip.File, v interface{}) error {
+	// zip 读取时会检查实际大小不超过声明的大小
+	if f.UncompressedSize64 > maxPartSize {
+		return fmt.Errorf("%w: %s", ErrTooLarge, f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// columnIndex 把 "C12" 这样的单元格引用转换为从 0 开始的列号，超过 XFD 列时返回 ErrTooLarge
+func columnIndex(ref string) (int, error) {
+	col := 0
+	n := 0
+	for _, ch := range ref {
+		if ch >= 'A' && ch <= 'Z' {
+			col = col*26 + int(ch-'A'+1)
+		} else if ch >= 'a' && ch <= 'z' {
+			col = col*26 + int(ch-'a'+1)
+		} else {
+			break
+		}
+		n++
+		if col > MaxColumns {
+			return 0, fmt.Errorf("%w: 单元格 %q", ErrTooLarge, ref)
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("xlsx: 无效的单元格引用 %q", ref)
+	}
+	return col - 1, nil
+}
+
+// columnName 把从 0 开始的列号转换为 "A"、"AB" 这样的列名
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// Write 把数据写成只有一个工作表的 XLSX 文件，所有单元格都按文本写入
+func Write(w io.Writer, sheetName string, rows [][]string) error {
+	if sheetName == "" {
+		sheetName = "Sheet1"
+	}
+
+	zw := zip.NewWriter(w)
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookTemplate, escapeXML(sheetName))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+		{"xl/worksheets/sheet1.xml", sheetContent(rows)},
+	}
+	for _, part := range parts {
+		fw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func sheetContent(rows [][]string) string {
+	var sb strings.Builder
+	sb.WriteString(xml.Header)
+	sb.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(&sb, `<row r="%d">`, i+1)
+		for j, value := range row {
+			fmt.Fprintf(&sb, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, columnName(j), i+1, escapeXML(value))
+		}
+		sb.WriteString(`</row>`)
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	return sb.String()
+}
+
+func escapeXML(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+const contentTypesXML = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookTemplate = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const workbookRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
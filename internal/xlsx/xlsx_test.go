@@ -0,0 +1,100 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试写入后再读取，内容保持一致
+func TestWriteAndReadRows(t *testing.T) {
+	rows := [][]string{
+		{"用户名", "昵称", "密码"},
+		{"tom", "汤姆 & <猫>", ""},
+		{"jerry", "杰瑞", "123456"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, "用户", rows))
+
+	got, err := ReadRows(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Equal(t, rows[0], got[0])
+	assert.Equal(t, rows[2], got[2])
+	// 末尾的空单元格不一定会保留
+	assert.Equal(t, rows[1][:2], got[1][:2])
+}
+
+// 测试读取共享字符串、数字单元格和跳过的空行空列
+func TestReadRowsSharedStrings(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>username</t></si><si><r><t>小</t></r><r><t>明</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>1</v></c><c r="C3"><v>42</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		fw, err := zw.Create(name)
+		assert.NoError(t, err)
+		fw.Write([]byte(content))
+	}
+	assert.NoError(t, zw.Close())
+
+	rows, err := ReadRows(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, []string{"username"}, rows[0])
+	assert.Empty(t, rows[1])
+	assert.Equal(t, []string{"小明", "", "42"}, rows[2])
+}
+
+// 测试行号和列号超出工作表大小时报错，而不是按行列号补齐
+func TestReadRowsTooLarge(t *testing.T) {
+	sheet := func(rows string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		fw, err := zw.Create("xl/worksheets/sheet1.xml")
+		assert.NoError(t, err)
+		fw.Write([]byte(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + rows + `</sheetData></worksheet>`))
+		assert.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	tests := []string{
+		`<row r="1048577"><c r="A1048577"><v>1</v></c></row>`,
+		`<row r="1048576000"><c><v>1</v></c></row>`,
+		`<row r="-1"><c><v>1</v></c></row>`,
+		`<row r="1"><c r="XFE1"><v>1</v></c></row>`,
+		`<row r="1"><c r="ZZZZZZZZZZZZZZZZ1"><v>1</v></c></row>`,
+	}
+	for _, rows := range tests {
+		data := sheet(rows)
+		_, err := ReadRows(bytes.NewReader(data), int64(len(data)))
+		assert.ErrorIs(t, err, ErrTooLarge, rows)
+	}
+
+	// 最后一列仍然可以读取
+	data := sheet(`<row r="2"><c r="XFD2"><v>1</v></c></row>`)
+	rows, err := ReadRows(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Len(t, rows[1], MaxColumns)
+		assert.Equal(t, "1", rows[1][MaxColumns-1])
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "Z", columnName(25))
+	assert.Equal(t, "AA", columnName(26))
+
+	idx, err := columnIndex("AB12")
+	assert.NoError(t, err)
+	assert.Equal(t, 27, idx)
+}